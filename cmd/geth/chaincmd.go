@@ -107,6 +107,9 @@ The dumpgenesis command dumps the genesis block configuration in JSON format to
 			utils.TxLookupLimitFlag,
 			// record-replay: geth import --substatedir flag
 			research.SubstateDirFlag,
+			research.SubstateEncodingFlag,
+			research.SubstateCacheFlag,
+			research.SubstateHandlesFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
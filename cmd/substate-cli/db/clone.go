@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/research"
 	cli "gopkg.in/urfave/cli.v1"
 )
@@ -14,16 +14,18 @@ var CloneCommand = cli.Command{
 	Name:      "clone",
 	Usage:     "Create a clone DB of a given range of blocks",
 	ArgsUsage: "<srcPath> <dstPath> <blockNumFirst> <blockNumLast>",
-	Flags: []cli.Flag{
-		research.WorkersFlag,
-	},
+	Flags:     []cli.Flag{},
 	Description: `
 The substate-cli db clone command requires four arguments:
     <srcPath> <dstPath> <blockNumFirst> <blockNumLast>
 <srcPath> is the original substate database to read the information.
 <dstPath> is the target substate database to write the information
 <blockNumFirst> and <blockNumLast> are the first and
-last block of the inclusive range of blocks to clone.`,
+last block of the inclusive range of blocks to clone.
+
+Every substate key of the range is copied as is, including transfers and
+contract creations, with the code and account states it refers to. The
+metadata of the clone records the blocks of the range recorded in <srcPath>.`,
 }
 
 func clone(ctx *cli.Context) error {
@@ -47,28 +49,106 @@ func clone(ctx *cli.Context) error {
 		return fmt.Errorf("substate-cli db clone: error: first block has larger number than last block")
 	}
 
-	srcBackend, err := rawdb.NewLevelDBDatabase(srcPath, 1024, 100, "srcDB", true)
+	srcDB, err := openSubstateDBPath(srcPath, true)
 	if err != nil {
-		return fmt.Errorf("substate-cli db clone: error opening %s: %v", srcPath, err)
+		return fmt.Errorf("substate-cli db clone: %v", err)
 	}
-	srcDB := research.NewSubstateDB(srcBackend)
 	defer srcDB.Close()
+	srcMetadata, err := srcDB.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db clone: %s: %v", srcPath, err)
+	}
+	warnMissingRange(srcDB, "clone", uint64(first), uint64(last))
 
 	// Create dst DB
-	dstBackend, err := rawdb.NewLevelDBDatabase(dstPath, 1024, 100, "srcDB", false)
+	dstDB, err := openSubstateDBPath(dstPath, false)
 	if err != nil {
-		return fmt.Errorf("substate-cli db clone: error creating %s: %v", dstPath, err)
+		return fmt.Errorf("substate-cli db clone: %v", err)
 	}
-	dstDB := research.NewSubstateDB(dstBackend)
 	defer dstDB.Close()
+	dstMetadata, err := dstDB.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db clone: %s: %v", dstPath, err)
+	}
+	if srcMetadata != nil && dstMetadata != nil {
+		if err = dstMetadata.Compatible(srcMetadata); err != nil {
+			return fmt.Errorf("substate-cli db clone: %s: %v", dstPath, err)
+		}
+	}
 
-	cloneTask := func(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
-		dstDB.PutSubstate(block, tx, substate)
-		return nil
+	// copy every substate key verbatim, with the code it refers to
+	var numTx, numCode int64
+	copied := make(map[common.Hash]bool)
+	iter := srcDB.NewSubstateIterator(uint64(first))
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		block, tx, err := research.DecodeStage1SubstateKey(key)
+		if err != nil {
+			return fmt.Errorf("substate-cli db clone: %v", err)
+		}
+		if block > uint64(last) {
+			break
+		}
+
+		codeHashes, stateHashes, err := srcDB.SubstateReferences(value)
+		if err != nil {
+			return fmt.Errorf("substate-cli db clone: error decoding substate %v_%v: %v", block, tx, err)
+		}
+		for _, codeHash := range codeHashes {
+			if copied[codeHash] {
+				continue
+			}
+			code, err := srcDB.GetRaw(research.Stage1CodeKey(codeHash))
+			if err != nil {
+				return fmt.Errorf("substate-cli db clone: substate %v_%v: missing code %s", block, tx, codeHash.Hex())
+			}
+			if err = dstDB.PutRaw(research.Stage1CodeKey(codeHash), code); err != nil {
+				return fmt.Errorf("substate-cli db clone: error putting code %s: %v", codeHash.Hex(), err)
+			}
+			copied[codeHash] = true
+			numCode++
+		}
+		for _, stateHash := range stateHashes {
+			if copied[stateHash] {
+				continue
+			}
+			state, err := srcDB.GetRaw(research.Stage1AccountKey(stateHash))
+			if err == nil {
+				err = dstDB.PutRaw(research.Stage1AccountKey(stateHash), state)
+			}
+			if err != nil {
+				return fmt.Errorf("substate-cli db clone: error copying account state %s: %v", stateHash.Hex(), err)
+			}
+			copied[stateHash] = true
+		}
+
+		if err = dstDB.PutRaw(key, value); err != nil {
+			return fmt.Errorf("substate-cli db clone: error putting substate %v_%v: %v", block, tx, err)
+		}
+		numTx++
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db clone: error iterating %s: %v", srcPath, err)
 	}
 
-	taskPool := research.NewSubstateTaskPool("substate-cli db clone", cloneTask, uint64(first), uint64(last), ctx)
-	taskPool.DB = srcDB
-	err = taskPool.Execute()
-	return err
+	// the clone records the cloned blocks recorded in the source DB
+	if srcMetadata != nil {
+		if dstMetadata == nil {
+			dstMetadata = srcMetadata.Copy()
+			dstMetadata.Ranges = research.BlockRanges{}
+		}
+		for _, r := range srcMetadata.Ranges.Intersect(research.BlockRange{First: uint64(first), Last: uint64(last)}) {
+			dstMetadata.Ranges = dstMetadata.Ranges.Add(r)
+		}
+		if err = dstDB.PutMetadata(dstMetadata); err != nil {
+			return fmt.Errorf("substate-cli db clone: error putting metadata: %v", err)
+		}
+	}
+
+	fmt.Printf("substate-cli db clone: block range = %v %v\n", first, last)
+	fmt.Printf("substate-cli db clone: cloned #tx   = %v\n", numTx)
+	fmt.Printf("substate-cli db clone: cloned #code = %v\n", numCode)
+
+	return nil
 }
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var DumpCommand = cli.Command{
+	Action:    dump,
+	Name:      "dump",
+	Usage:     "Print the substates of a block or a transaction as JSON",
+	ArgsUsage: "<blockNum> [<tx>]",
+	Flags: []cli.Flag{
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db dump command requires one or two arguments:
+    <blockNum> [<tx>]
+<blockNum> is the block of the substates to print.
+<tx> is the index of the transaction to print. Without it, every substate of
+the block is printed as a list of {"block", "tx", "substate"} objects.`,
+}
+
+// blockSubstateJSON is a substate of a block printed by db dump
+type blockSubstateJSON struct {
+	Block    uint64             `json:"block"`
+	Tx       int                `json:"tx"`
+	Substate *research.Substate `json:"substate"`
+}
+
+func dump(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db dump command requires 1 or 2 arguments")
+	}
+
+	block, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("substate-cli db dump: error in parsing parameters: block number not an integer")
+	}
+	tx := -1
+	if len(ctx.Args()) == 2 {
+		tx, err = strconv.Atoi(ctx.Args().Get(1))
+		if err != nil || tx < 0 {
+			return fmt.Errorf("substate-cli db dump: error in parsing parameters: tx index not a non-negative integer")
+		}
+	}
+
+	db, err := openSubstateDB(ctx, true)
+	if err != nil {
+		return fmt.Errorf("substate-cli db dump: %v", err)
+	}
+	defer db.Close()
+	warnMissingRange(db, "dump", block, block)
+
+	var out interface{}
+	if tx >= 0 {
+		if !db.HasSubstate(block, tx) {
+			return fmt.Errorf("substate-cli db dump: substate %v_%v not found", block, tx)
+		}
+		out = db.GetSubstate(block, tx)
+	} else {
+		txSubstate := db.GetBlockSubstates(block)
+		if len(txSubstate) == 0 {
+			return fmt.Errorf("substate-cli db dump: no substates found in block %v", block)
+		}
+		txs := make([]int, 0, len(txSubstate))
+		for tx := range txSubstate {
+			txs = append(txs, tx)
+		}
+		sort.Ints(txs)
+		substates := make([]blockSubstateJSON, 0, len(txs))
+		for _, tx := range txs {
+			substates = append(substates, blockSubstateJSON{Block: block, Tx: tx, Substate: txSubstate[tx]})
+		}
+		out = substates
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("substate-cli db dump: error encoding JSON: %v", err)
+	}
+	fmt.Println(string(data))
+
+	return nil
+}
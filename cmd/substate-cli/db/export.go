@@ -0,0 +1,157 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	ExportFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format: jsonl (one substate per line) or json (a list of substates)",
+		Value: "jsonl",
+	}
+	ExportOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "File to write the substates to, standard output by default",
+	}
+	ExportAddressFlag = cli.StringSliceFlag{
+		Name:  "address",
+		Usage: "Only export substates involving this address, can be repeated",
+	}
+)
+
+var ExportCommand = cli.Command{
+	Action:    export,
+	Name:      "export",
+	Usage:     "Export the substates of a given range of blocks as JSON",
+	ArgsUsage: "<blockNumFirst> <blockNumLast>",
+	Flags: []cli.Flag{
+		ExportFormatFlag,
+		ExportOutFlag,
+		ExportAddressFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db export command requires two arguments:
+    <blockNumFirst> <blockNumLast>
+<blockNumFirst> and <blockNumLast> are the first and
+last block of the inclusive range of blocks to export.
+
+Each substate is written as a {"block", "tx", "substate"} object with its code
+inlined, which db import reads back. With --address, only the substates whose
+message is from or to the address, which create it, or whose allocs contain
+it are exported.`,
+}
+
+// involves tells whether a substate involves any of the addresses
+func involves(substate *research.Substate, addrs map[common.Address]bool) bool {
+	msg := substate.Message
+	if addrs[msg.From] || msg.To != nil && addrs[*msg.To] {
+		return true
+	}
+	if msg.To == nil && addrs[substate.Result.ContractAddress] {
+		return true
+	}
+	for addr := range addrs {
+		if _, exist := substate.InputAlloc[addr]; exist {
+			return true
+		}
+		if _, exist := substate.OutputAlloc[addr]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+func export(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db export command requires exactly 2 arguments")
+	}
+
+	first, last, err := parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("substate-cli db export: %v", err)
+	}
+	format := ctx.String(ExportFormatFlag.Name)
+	if format != "jsonl" && format != "json" {
+		return fmt.Errorf("substate-cli db export: unknown format %v", format)
+	}
+	addrs := make(map[common.Address]bool)
+	for _, addr := range ctx.StringSlice(ExportAddressFlag.Name) {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("substate-cli db export: invalid address %v", addr)
+		}
+		addrs[common.HexToAddress(addr)] = true
+	}
+
+	db, err := openSubstateDB(ctx, true)
+	if err != nil {
+		return fmt.Errorf("substate-cli db export: %v", err)
+	}
+	defer db.Close()
+	warnMissingRange(db, "export", first, last)
+
+	var out io.Writer = os.Stdout
+	if path := ctx.String(ExportOutFlag.Name); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("substate-cli db export: error creating %s: %v", path, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	writer := bufio.NewWriter(out)
+
+	var numTx int64
+	if format == "json" {
+		writer.WriteString("[\n")
+	}
+	for block := first; block <= last; block++ {
+		txSubstate := db.GetBlockSubstates(block)
+		txs := make([]int, 0, len(txSubstate))
+		for tx := range txSubstate {
+			txs = append(txs, tx)
+		}
+		sort.Ints(txs)
+		for _, tx := range txs {
+			substate := txSubstate[tx]
+			if len(addrs) > 0 && !involves(substate, addrs) {
+				continue
+			}
+			data, err := json.Marshal(blockSubstateJSON{Block: block, Tx: tx, Substate: substate})
+			if err != nil {
+				return fmt.Errorf("substate-cli db export: error encoding %v_%v: %v", block, tx, err)
+			}
+			if format == "json" && numTx > 0 {
+				writer.WriteString(",\n")
+			}
+			writer.Write(data)
+			if format == "jsonl" {
+				writer.WriteString("\n")
+			}
+			numTx++
+		}
+		if block == last {
+			// avoid overflow of block++ at the maximum block number
+			break
+		}
+	}
+	if format == "json" {
+		writer.WriteString("\n]\n")
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("substate-cli db export: error writing substates: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "substate-cli db export: exported #tx = %v\n", numTx)
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestInvolves(t *testing.T) {
+	var (
+		created = common.BytesToAddress([]byte("created"))
+		other   = common.BytesToAddress([]byte("other"))
+	)
+	// creation of created by testSender
+	creation := newTestSubstate(0)
+	creation.Message.To = nil
+	creation.Result.ContractAddress = created
+	// testContract is only read through the alloc
+	read := newTestSubstate(0)
+	read.Message.To = &other
+	delete(read.OutputAlloc, testContract)
+	// testContract is only written through the alloc
+	written := newTestSubstate(0)
+	written.Message.To = &other
+	delete(written.InputAlloc, testContract)
+
+	tests := []struct {
+		name     string
+		substate *research.Substate
+		addrs    []common.Address
+		want     bool
+	}{
+		{"from", newTestSubstate(0), []common.Address{testSender}, true},
+		{"to", newTestSubstate(0), []common.Address{testContract}, true},
+		{"created contract", creation, []common.Address{created}, true},
+		{"contract address of a call", newTestSubstate(0), []common.Address{common.Address{}}, false},
+		{"input alloc", read, []common.Address{testContract}, true},
+		{"output alloc", written, []common.Address{testContract}, true},
+		{"any address", newTestSubstate(0), []common.Address{other, testCoinbase}, true},
+		{"none", newTestSubstate(0), []common.Address{other}, false},
+		{"no address", newTestSubstate(0), nil, false},
+	}
+	for _, tt := range tests {
+		addrs := make(map[common.Address]bool)
+		for _, addr := range tt.addrs {
+			addrs[addr] = true
+		}
+		if got := involves(tt.substate, addrs); got != tt.want {
+			t.Errorf("%s: involves = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var GcCodeCommand = cli.Command{
+	Action:    gcCode,
+	Name:      "gc-code",
+	Usage:     "Delete the code and account states no longer referenced by any substate",
+	ArgsUsage: "",
+	Flags: []cli.Flag{
+		DryRunFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db gc-code command takes no argument.
+
+Every substate of the DB is decoded to collect the code hashes and the
+account states of compact substates it refers to, then the 1c entries of any
+other code hash and the 1a entries of any other account state are deleted.
+It fails without deleting anything if a substate cannot be decoded.`,
+}
+
+func gcCode(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 {
+		return fmt.Errorf("substate-cli db gc-code command takes no arguments")
+	}
+	dryRun := ctx.Bool(DryRunFlag.Name)
+
+	db, err := openSubstateDB(ctx, dryRun)
+	if err != nil {
+		return fmt.Errorf("substate-cli db gc-code: %v", err)
+	}
+	defer db.Close()
+
+	// code and account states referenced by substates
+	referenced := make(map[common.Hash]struct{})
+	referencedStates := make(map[common.Hash]struct{})
+	iter := db.NewSubstateIterator(0)
+	for iter.Next() {
+		codeHashes, stateHashes, err := db.SubstateReferences(iter.Value())
+		for _, codeHash := range codeHashes {
+			referenced[codeHash] = struct{}{}
+		}
+		for _, stateHash := range stateHashes {
+			referencedStates[stateHash] = struct{}{}
+		}
+		if err != nil {
+			iter.Release()
+			return fmt.Errorf("substate-cli db gc-code: error decoding %s, see db verify: %v", describeKey(iter.Key()), err)
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db gc-code: error iterating substate DB: %v", err)
+	}
+
+	var (
+		orphans           [][]byte
+		numCode, numState int64
+		orphanStates      int64
+		freedSize         int64
+	)
+	iter = db.NewCodeIterator()
+	for iter.Next() {
+		numCode++
+		codeHash, err := research.DecodeStage1CodeKey(iter.Key())
+		if err != nil {
+			continue
+		}
+		if _, exist := referenced[codeHash]; !exist {
+			orphans = append(orphans, common.CopyBytes(iter.Key()))
+			freedSize += int64(len(iter.Key()) + len(iter.Value()))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db gc-code: error iterating substate DB: %v", err)
+	}
+	numOrphanCode := len(orphans)
+
+	iter = db.NewAccountIterator()
+	for iter.Next() {
+		numState++
+		stateHash, err := research.DecodeStage1AccountKey(iter.Key())
+		if err != nil {
+			continue
+		}
+		if _, exist := referencedStates[stateHash]; !exist {
+			orphans = append(orphans, common.CopyBytes(iter.Key()))
+			orphanStates++
+			freedSize += int64(len(iter.Key()) + len(iter.Value()))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db gc-code: error iterating substate DB: %v", err)
+	}
+
+	if !dryRun {
+		for _, key := range orphans {
+			if err = db.DeleteRaw(key); err != nil {
+				return fmt.Errorf("substate-cli db gc-code: error deleting %s: %v", describeKey(key), err)
+			}
+		}
+	}
+	fmt.Printf("substate-cli db gc-code: total #code    = %v\n", numCode)
+	fmt.Printf("substate-cli db gc-code: deleted #code  = %v\n", numOrphanCode)
+	fmt.Printf("substate-cli db gc-code: total #state   = %v\n", numState)
+	fmt.Printf("substate-cli db gc-code: deleted #state = %v\n", orphanStates)
+	fmt.Printf("substate-cli db gc-code: freed %v bytes\n", freedSize)
+
+	return nil
+}
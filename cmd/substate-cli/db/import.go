@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var ImportOverwriteFlag = cli.BoolFlag{
+	Name:  "overwrite",
+	Usage: "Replace substates already in the substate DB that differ from the imported ones",
+}
+
+var ImportCommand = cli.Command{
+	Action:    importSubstates,
+	Name:      "import",
+	Usage:     "Import substates exported by db export",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		ImportOverwriteFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db import command requires one argument:
+    <file>
+<file> contains {"block", "tx", "substate"} objects written by db export,
+in either the jsonl or the json format.
+
+Substates already in the substate DB are kept if they differ from the
+imported ones, unless --overwrite is set. The blocks of the imported
+substates are added to the recorded ranges of the metadata, if any.`,
+}
+
+func importSubstates(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return fmt.Errorf("substate-cli db import command requires exactly 1 argument")
+	}
+
+	path := ctx.Args().Get(0)
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("substate-cli db import: error opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	db, err := openSubstateDB(ctx, false)
+	if err != nil {
+		return fmt.Errorf("substate-cli db import: %v", err)
+	}
+	defer db.Close()
+	md, err := db.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db import: %v", err)
+	}
+
+	var imported, identical, conflicts int64
+	err = research.ReadSubstatesJSON(file, func(block uint64, tx int, substate *research.Substate) error {
+		if md != nil {
+			md.Ranges = md.Ranges.Add(research.BlockRange{First: block, Last: block})
+		}
+		if db.HasSubstate(block, tx) {
+			if db.GetSubstate(block, tx).Equal(substate) {
+				identical++
+				return nil
+			}
+			if !ctx.Bool(ImportOverwriteFlag.Name) {
+				fmt.Printf("substate-cli db import: conflict: %v_%v differs from the substate DB, skipped\n", block, tx)
+				conflicts++
+				return nil
+			}
+			fmt.Printf("substate-cli db import: conflict: %v_%v differs from the substate DB, overwritten\n", block, tx)
+			conflicts++
+		}
+		db.PutSubstate(block, tx, substate)
+		imported++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("substate-cli db import: %s: %v", path, err)
+	}
+
+	fmt.Printf("substate-cli db import: imported #tx  = %v\n", imported)
+	fmt.Printf("substate-cli db import: identical #tx = %v\n", identical)
+	fmt.Printf("substate-cli db import: conflict #tx  = %v\n", conflicts)
+
+	if md != nil {
+		fmt.Printf("substate-cli db import: recorded ranges = %s\n", md.Ranges)
+		if err = db.PutMetadata(md); err != nil {
+			return fmt.Errorf("substate-cli db import: error putting metadata: %v", err)
+		}
+	}
+
+	return nil
+}
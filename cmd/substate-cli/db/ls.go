@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var LsCommand = cli.Command{
+	Action:    ls,
+	Name:      "ls",
+	Usage:     "List the transactions with a substate in a given range of blocks",
+	ArgsUsage: "<blockNumFirst> <blockNumLast>",
+	Flags: []cli.Flag{
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db ls command requires two arguments:
+    <blockNumFirst> <blockNumLast>
+<blockNumFirst> and <blockNumLast> are the first and
+last block of the inclusive range of blocks to list.
+
+Each substate is printed as block_tx, one per line.`,
+}
+
+func ls(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db ls command requires exactly 2 arguments")
+	}
+
+	first, last, err := parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("substate-cli db ls: %v", err)
+	}
+
+	db, err := openSubstateDB(ctx, true)
+	if err != nil {
+		return fmt.Errorf("substate-cli db ls: %v", err)
+	}
+	defer db.Close()
+	warnMissingRange(db, "ls", first, last)
+
+	var numTx int64
+	iter := db.NewSubstateIterator(first)
+	for iter.Next() {
+		block, tx, err := research.DecodeStage1SubstateKey(iter.Key())
+		if err != nil {
+			fmt.Printf("substate-cli db ls: invalid substate key %x: %v\n", iter.Key(), err)
+			continue
+		}
+		if block > last {
+			break
+		}
+		fmt.Printf("%v_%v\n", block, tx)
+		numTx++
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db ls: error iterating substate DB: %v", err)
+	}
+	fmt.Printf("substate-cli db ls: total #tx = %v\n", numTx)
+
+	return nil
+}
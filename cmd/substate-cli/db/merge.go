@@ -0,0 +1,209 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	MergeOverwriteFlag = cli.BoolFlag{
+		Name:  "overwrite",
+		Usage: "Replace conflicting keys of the destination DB by the ones of the source DBs",
+	}
+	DryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Only report what would be changed, without writing to the DB",
+	}
+)
+
+var MergeCommand = cli.Command{
+	Action:    merge,
+	Name:      "merge",
+	Usage:     "Merge substate DBs into a destination DB",
+	ArgsUsage: "<dstPath> <srcPath>...",
+	Flags: []cli.Flag{
+		MergeOverwriteFlag,
+		DryRunFlag,
+	},
+	Description: `
+The substate-cli db merge command requires at least two arguments:
+    <dstPath> <srcPath>...
+<dstPath> is the substate DB to merge into, created if it does not exist.
+<srcPath>... are the substate DBs to merge, in order.
+
+Every key of the source DBs is copied as is. A key already in the destination
+DB with a different value is a conflict, unless both values decode to the same
+substate in different encodings. Conflicting keys are reported and kept,
+unless --overwrite is set.
+
+The metadata of the source DBs must record the same chain as the destination
+DB; their recorded ranges are added to the ones of the destination DB.`,
+}
+
+// mergeStat counts the keys of a source DB by outcome
+type mergeStat struct {
+	copied    int64
+	identical int64
+	conflicts int64
+}
+
+// sameSubstate tells whether two substate values in different encodings
+// decode to the same substate
+func sameSubstate(dstDB *research.SubstateDB, dstValue []byte, srcDB *research.SubstateDB, srcValue []byte) (same bool) {
+	defer func() {
+		// missing code in either DB
+		if r := recover(); r != nil {
+			same = false
+		}
+	}()
+	dstRLP, _, err := dstDB.DecodeSubstateRLP(dstValue)
+	if err != nil {
+		return false
+	}
+	srcRLP, _, err := srcDB.DecodeSubstateRLP(srcValue)
+	if err != nil {
+		return false
+	}
+	dstSubstate, srcSubstate := &research.Substate{}, &research.Substate{}
+	dstSubstate.SetRLP(dstRLP, dstDB)
+	srcSubstate.SetRLP(srcRLP, srcDB)
+	return dstSubstate.Equal(srcSubstate)
+}
+
+// describeKey names a key of a substate DB in reports
+func describeKey(key []byte) string {
+	if block, tx, err := research.DecodeStage1SubstateKey(key); err == nil {
+		return fmt.Sprintf("substate %v_%v", block, tx)
+	}
+	if codeHash, err := research.DecodeStage1CodeKey(key); err == nil {
+		return fmt.Sprintf("code %s", codeHash.Hex())
+	}
+	return fmt.Sprintf("key %x", key)
+}
+
+func mergeDB(dstDB, srcDB *research.SubstateDB, overwrite, dryRun bool) (*mergeStat, error) {
+	stat := &mergeStat{}
+	iter := srcDB.NewRawIterator()
+	defer iter.Release()
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if research.IsMetadataKey(key) {
+			continue
+		}
+
+		dstValue, err := dstDB.GetRaw(key)
+		if err == nil {
+			if bytes.Equal(dstValue, value) {
+				stat.identical++
+				continue
+			}
+			_, _, keyErr := research.DecodeStage1SubstateKey(key)
+			if keyErr == nil && sameSubstate(dstDB, dstValue, srcDB, value) {
+				stat.identical++
+				continue
+			}
+			stat.conflicts++
+			if !overwrite {
+				fmt.Printf("substate-cli db merge: conflict: %s differs, kept\n", describeKey(key))
+				continue
+			}
+			fmt.Printf("substate-cli db merge: conflict: %s differs, overwritten\n", describeKey(key))
+		}
+
+		if !dryRun {
+			if err = dstDB.PutRaw(key, value); err != nil {
+				return stat, fmt.Errorf("error putting %s: %v", describeKey(key), err)
+			}
+		}
+		stat.copied++
+	}
+	return stat, iter.Error()
+}
+
+// mergeMetadata returns the metadata of dstDB with the ranges of srcDB added,
+// or an error if the DBs record different chains
+func mergeMetadata(dstMetadata *research.SubstateMetadata, srcDB *research.SubstateDB) (*research.SubstateMetadata, error) {
+	srcMetadata, err := srcDB.GetMetadata()
+	if err != nil || srcMetadata == nil {
+		return dstMetadata, err
+	}
+	if dstMetadata == nil {
+		return srcMetadata.Copy(), nil
+	}
+	if err = dstMetadata.Compatible(srcMetadata); err != nil {
+		return nil, err
+	}
+	md := dstMetadata.Copy()
+	for _, r := range srcMetadata.Ranges {
+		md.Ranges = md.Ranges.Add(r)
+	}
+	for _, filter := range srcMetadata.Filters {
+		if !containsString(md.Filters, filter) {
+			md.Filters = append(md.Filters, filter)
+		}
+	}
+	return md, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func merge(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		return fmt.Errorf("substate-cli db merge command requires at least 2 arguments")
+	}
+
+	dryRun := ctx.Bool(DryRunFlag.Name)
+	dstPath := ctx.Args().Get(0)
+	dstDB, err := openSubstateDBPath(dstPath, dryRun)
+	if err != nil {
+		return fmt.Errorf("substate-cli db merge: %v", err)
+	}
+	defer dstDB.Close()
+	md, err := dstDB.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db merge: %s: %v", dstPath, err)
+	}
+
+	for _, srcPath := range ctx.Args()[1:] {
+		if srcPath == dstPath {
+			return fmt.Errorf("substate-cli db merge: cannot merge %s into itself", srcPath)
+		}
+		srcDB, err := openSubstateDBPath(srcPath, true)
+		if err != nil {
+			return fmt.Errorf("substate-cli db merge: %v", err)
+		}
+		md, err = mergeMetadata(md, srcDB)
+		if err != nil {
+			srcDB.Close()
+			return fmt.Errorf("substate-cli db merge: %s: %v", srcPath, err)
+		}
+		stat, err := mergeDB(dstDB, srcDB, ctx.Bool(MergeOverwriteFlag.Name), dryRun)
+		srcDB.Close()
+		if err != nil {
+			return fmt.Errorf("substate-cli db merge: %s: %v", srcPath, err)
+		}
+		fmt.Printf("substate-cli db merge: %s: copied #key = %v, identical #key = %v, conflict #key = %v\n",
+			srcPath, stat.copied, stat.identical, stat.conflicts)
+	}
+
+	if md != nil {
+		fmt.Printf("substate-cli db merge: recorded ranges = %s\n", md.Ranges)
+		if !dryRun {
+			if err = dstDB.PutMetadata(md); err != nil {
+				return fmt.Errorf("substate-cli db merge: error putting metadata: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// countRawKeys returns the number of keys of a substate DB
+func countRawKeys(db *research.SubstateDB) int64 {
+	iter := db.NewRawIterator()
+	defer iter.Release()
+	var n int64
+	for iter.Next() {
+		n++
+	}
+	return n
+}
+
+func TestMergeDB(t *testing.T) {
+	tests := []struct {
+		name        string
+		dstValue    int64 // value of the substate 1_0 of the destination DB, if any
+		srcValue    int64 // value of the substate 1_0 of the source DB
+		srcEncoding string
+		overwrite   bool
+		dryRun      bool
+		want        mergeStat // copied is added to the account states of the source DB
+		wantValue   int64     // value of the substate 1_0 of the destination DB after merging, if any
+	}{
+		{name: "copy", srcValue: 5, want: mergeStat{copied: 2}, wantValue: 5},
+		{name: "dry run", srcValue: 5, dryRun: true, want: mergeStat{copied: 2}},
+		{name: "identical", dstValue: 5, srcValue: 5, want: mergeStat{identical: 2}, wantValue: 5},
+		{name: "other encoding", dstValue: 5, srcValue: 5, srcEncoding: research.CompactSubstateEncoding, want: mergeStat{identical: 2}, wantValue: 5},
+		{name: "conflict kept", dstValue: 5, srcValue: 6, want: mergeStat{identical: 1, conflicts: 1}, wantValue: 5},
+		{name: "conflict overwritten", dstValue: 5, srcValue: 6, overwrite: true, want: mergeStat{copied: 1, identical: 1, conflicts: 1}, wantValue: 6},
+		{name: "conflict dry run", dstValue: 5, srcValue: 6, overwrite: true, dryRun: true, want: mergeStat{copied: 1, identical: 1, conflicts: 1}, wantValue: 5},
+	}
+	for _, tt := range tests {
+		dstDB := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+		srcDB := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+		if tt.dstValue > 0 {
+			dstDB.PutSubstate(1, 0, newTestSubstate(tt.dstValue))
+		}
+		if tt.srcEncoding != "" {
+			if err := srcDB.SetEncoding(tt.srcEncoding); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		srcDB.PutSubstate(1, 0, newTestSubstate(tt.srcValue))
+		// account states of compact substates are only in the source DB
+		states := countRawKeys(srcDB) - 2
+
+		stat, err := mergeDB(dstDB, srcDB, tt.overwrite, tt.dryRun)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := tt.want
+		want.copied += states
+		if *stat != want {
+			t.Errorf("%s: merged %+v, want %+v", tt.name, *stat, want)
+		}
+
+		if tt.wantValue == 0 {
+			if n := countRawKeys(dstDB); n != 0 {
+				t.Errorf("%s: %d keys in the destination DB, want none", tt.name, n)
+			}
+			continue
+		}
+		if got := dstDB.GetSubstate(1, 0); !got.Equal(newTestSubstate(tt.wantValue)) {
+			t.Errorf("%s: substate 1_0 of value %v, want %v", tt.name, got.Message.Value, tt.wantValue)
+		}
+	}
+}
+
+func TestDescribeKey(t *testing.T) {
+	codeHash := research.CodeHash(testCode)
+	tests := []struct {
+		key  []byte
+		want string
+	}{
+		{research.Stage1SubstateKey(100, 2), "substate 100_2"},
+		{research.Stage1CodeKey(codeHash), "code " + codeHash.Hex()},
+		{[]byte("1s"), "key 3173"},
+		{common.FromHex("0x1a2b"), "key 1a2b"},
+	}
+	for _, tt := range tests {
+		if got := describeKey(tt.key); got != tt.want {
+			t.Errorf("describeKey(%x) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMergeDBSkipsMetadata(t *testing.T) {
+	dstDB := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+	srcDB := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+	srcDB.PutSubstate(1, 0, newTestSubstate(5))
+	if err := srcDB.PutMetadata(research.NewSubstateMetadata("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := mergeDB(dstDB, srcDB, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (mergeStat{copied: 2}); *stat != want {
+		t.Errorf("merged %+v, want %+v", *stat, want)
+	}
+	if md, err := dstDB.GetMetadata(); md != nil || err != nil {
+		t.Errorf("metadata %+v (error %v) copied to the destination DB", md, err)
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	metadata := func(chainID int64, filters []string, ranges ...research.BlockRange) *research.SubstateMetadata {
+		md := research.NewSubstateMetadata("test")
+		if chainID > 0 {
+			md.ChainID = big.NewInt(chainID)
+		}
+		md.Filters = filters
+		for _, r := range ranges {
+			md.Ranges = md.Ranges.Add(r)
+		}
+		return md
+	}
+	tests := []struct {
+		name        string
+		dst         *research.SubstateMetadata
+		src         *research.SubstateMetadata
+		wantRanges  research.BlockRanges
+		wantFilters []string
+		wantErr     bool
+	}{
+		{
+			name:       "no metadata",
+			dst:        metadata(1, nil, research.BlockRange{First: 1, Last: 10}),
+			wantRanges: research.BlockRanges{{First: 1, Last: 10}},
+		},
+		{
+			name:       "no destination metadata",
+			src:        metadata(1, nil, research.BlockRange{First: 1, Last: 10}),
+			wantRanges: research.BlockRanges{{First: 1, Last: 10}},
+		},
+		{
+			name:        "ranges and filters added",
+			dst:         metadata(1, []string{"a"}, research.BlockRange{First: 1, Last: 10}),
+			src:         metadata(1, []string{"a", "b"}, research.BlockRange{First: 11, Last: 20}, research.BlockRange{First: 30, Last: 40}),
+			wantRanges:  research.BlockRanges{{First: 1, Last: 20}, {First: 30, Last: 40}},
+			wantFilters: []string{"a", "b"},
+		},
+		{
+			name:       "unknown chain",
+			dst:        metadata(0, nil, research.BlockRange{First: 1, Last: 10}),
+			src:        metadata(5, nil, research.BlockRange{First: 20, Last: 30}),
+			wantRanges: research.BlockRanges{{First: 1, Last: 10}, {First: 20, Last: 30}},
+		},
+		{
+			name:    "other chain",
+			dst:     metadata(1, nil, research.BlockRange{First: 1, Last: 10}),
+			src:     metadata(5, nil, research.BlockRange{First: 20, Last: 30}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		srcDB := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+		if tt.src != nil {
+			if err := srcDB.PutMetadata(tt.src); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		var dstRanges research.BlockRanges
+		if tt.dst != nil {
+			dstRanges = append(dstRanges, tt.dst.Ranges...)
+		}
+
+		md, err := mergeMetadata(tt.dst, srcDB)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !reflect.DeepEqual(md.Ranges, tt.wantRanges) {
+			t.Errorf("%s: ranges %s, want %s", tt.name, md.Ranges, tt.wantRanges)
+		}
+		if len(md.Filters) > 0 || len(tt.wantFilters) > 0 {
+			if !reflect.DeepEqual(md.Filters, tt.wantFilters) {
+				t.Errorf("%s: filters %v, want %v", tt.name, md.Filters, tt.wantFilters)
+			}
+		}
+		// the metadata of the destination DB is left unchanged
+		if tt.dst != nil && !reflect.DeepEqual(tt.dst.Ranges, dstRanges) {
+			t.Errorf("%s: destination ranges changed to %s", tt.name, tt.dst.Ranges)
+		}
+	}
+}
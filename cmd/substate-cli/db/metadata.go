@@ -0,0 +1,90 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	MetadataChainIDFlag = cli.Uint64Flag{
+		Name:  "chain-id",
+		Usage: "Chain ID of the substates, when creating the metadata",
+		Value: params.MainnetChainConfig.ChainID.Uint64(),
+	}
+	MetadataModeFlag = cli.StringFlag{
+		Name:  "mode",
+		Usage: "How the substates were produced, when creating the metadata",
+		Value: "geth import",
+	}
+)
+
+var MetadataCommand = cli.Command{
+	Action:    metadata,
+	Name:      "metadata",
+	Usage:     "Print the metadata of a substate DB, or declare a range of blocks recorded",
+	ArgsUsage: "[<blockNumFirst> <blockNumLast>]",
+	Flags: []cli.Flag{
+		MetadataChainIDFlag,
+		MetadataModeFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db metadata command takes two optional arguments:
+    [<blockNumFirst> <blockNumLast>]
+Without arguments, it prints the metadata of the substate DB as JSON.
+
+With <blockNumFirst> and <blockNumLast>, the inclusive range of blocks is
+added to the recorded ranges. The metadata of DBs recorded before metadata
+existed is created with --chain-id and --mode.`,
+}
+
+func metadata(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 && len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db metadata command requires 0 or 2 arguments")
+	}
+
+	db, err := openSubstateDB(ctx, len(ctx.Args()) == 0)
+	if err != nil {
+		return fmt.Errorf("substate-cli db metadata: %v", err)
+	}
+	defer db.Close()
+	md, err := db.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db metadata: %v", err)
+	}
+
+	if len(ctx.Args()) == 2 {
+		first, last, err := parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("substate-cli db metadata: %v", err)
+		}
+		if md == nil {
+			md = research.NewSubstateMetadata(ctx.String(MetadataModeFlag.Name))
+			md.ChainID = new(big.Int).SetUint64(ctx.Uint64(MetadataChainIDFlag.Name))
+			if md.ChainID.Cmp(params.MainnetChainConfig.ChainID) == 0 {
+				md.ChainConfig = params.MainnetChainConfig
+			}
+		}
+		md.Ranges = md.Ranges.Add(research.BlockRange{First: first, Last: last})
+		if err = db.PutMetadata(md); err != nil {
+			return fmt.Errorf("substate-cli db metadata: error putting metadata: %v", err)
+		}
+	}
+
+	if md == nil {
+		fmt.Printf("substate-cli db metadata: no metadata\n")
+		return nil
+	}
+	out, err := json.MarshalIndent(md, "", " ")
+	if err != nil {
+		return fmt.Errorf("substate-cli db metadata: %v", err)
+	}
+	fmt.Println(string(out))
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// openSubstateDB opens the substate DB of --substateDir
+func openSubstateDB(ctx *cli.Context, readonly bool) (*research.SubstateDB, error) {
+	return openSubstateDBPath(ctx.String(research.SubstateDirFlag.Name), readonly)
+}
+
+// openSubstateDBPath opens the substate DB at path
+func openSubstateDBPath(path string, readonly bool) (*research.SubstateDB, error) {
+	backend, err := research.OpenBackend(path, readonly)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	db := research.NewSubstateDB(backend)
+	if _, err = db.GetMetadata(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// warnMissingRange warns on stderr about the blocks first to last that were
+// not recorded. The substates of these blocks may still exist, e.g. if they
+// were imported, so they are read as usual.
+func warnMissingRange(db *research.SubstateDB, cmd string, first, last uint64) {
+	if err := db.ValidateRange(first, last); err != nil {
+		fmt.Fprintf(os.Stderr, "substate-cli db %s: warning: %v\n", cmd, err)
+	}
+}
+
+// parseBlockRange parses the <blockNumFirst> <blockNumLast> arguments
+func parseBlockRange(firstArg, lastArg string) (uint64, uint64, error) {
+	first, ferr := strconv.ParseInt(firstArg, 10, 64)
+	last, lerr := strconv.ParseInt(lastArg, 10, 64)
+	if ferr != nil || lerr != nil {
+		return 0, 0, fmt.Errorf("error in parsing parameters: block number not an integer")
+	}
+	if first < 0 || last < 0 {
+		return 0, 0, fmt.Errorf("error: block number must be greater than 0")
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("error: first block has larger number than last block")
+	}
+	return uint64(first), uint64(last), nil
+}
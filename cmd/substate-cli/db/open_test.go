@@ -0,0 +1,33 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestParseBlockRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     string
+		last      string
+		wantFirst uint64
+		wantLast  uint64
+		wantErr   bool
+	}{
+		{"range", "100", "200", 100, 200, false},
+		{"single block", "0", "0", 0, 0, false},
+		{"not an integer", "100", "2OO", 0, 0, true},
+		{"hex", "0x64", "200", 0, 0, true},
+		{"negative", "-1", "200", 0, 0, true},
+		{"first after last", "200", "100", 0, 0, true},
+	}
+	for _, tt := range tests {
+		first, last, err := parseBlockRange(tt.first, tt.last)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if first != tt.wantFirst || last != tt.wantLast {
+			t.Errorf("%s: range %v %v, want %v %v", tt.name, first, last, tt.wantFirst, tt.wantLast)
+		}
+	}
+}
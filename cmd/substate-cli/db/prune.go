@@ -0,0 +1,86 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var PruneCommand = cli.Command{
+	Action:    prune,
+	Name:      "prune",
+	Usage:     "Delete the substates of a given range of blocks",
+	ArgsUsage: "<blockNumFirst> <blockNumLast>",
+	Flags: []cli.Flag{
+		DryRunFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db prune command requires two arguments:
+    <blockNumFirst> <blockNumLast>
+<blockNumFirst> and <blockNumLast> are the first and
+last block of the inclusive range of blocks to delete.
+
+The range is removed from the recorded ranges of the metadata. The code of
+the deleted substates is kept; db gc-code removes the code no
+longer referenced by any substate.`,
+}
+
+func prune(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db prune command requires exactly 2 arguments")
+	}
+
+	first, last, err := parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("substate-cli db prune: %v", err)
+	}
+	dryRun := ctx.Bool(DryRunFlag.Name)
+
+	db, err := openSubstateDB(ctx, dryRun)
+	if err != nil {
+		return fmt.Errorf("substate-cli db prune: %v", err)
+	}
+	defer db.Close()
+	md, err := db.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db prune: %v", err)
+	}
+
+	var keys [][]byte
+	iter := db.NewSubstateIterator(first)
+	for iter.Next() {
+		block, _, err := research.DecodeStage1SubstateKey(iter.Key())
+		if err != nil {
+			continue
+		}
+		if block > last {
+			break
+		}
+		keys = append(keys, common.CopyBytes(iter.Key()))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db prune: error iterating substate DB: %v", err)
+	}
+
+	if !dryRun {
+		for _, key := range keys {
+			if err = db.DeleteRaw(key); err != nil {
+				return fmt.Errorf("substate-cli db prune: error deleting %s: %v", describeKey(key), err)
+			}
+		}
+		if md != nil {
+			md.Ranges = md.Ranges.Remove(research.BlockRange{First: first, Last: last})
+			if err = db.PutMetadata(md); err != nil {
+				return fmt.Errorf("substate-cli db prune: error putting metadata: %v", err)
+			}
+		}
+	}
+	fmt.Printf("substate-cli db prune: block range = %v %v\n", first, last)
+	fmt.Printf("substate-cli db prune: deleted #tx = %v\n", len(keys))
+
+	return nil
+}
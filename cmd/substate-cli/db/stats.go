@@ -0,0 +1,191 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var BucketSizeFlag = cli.Uint64Flag{
+	Name:  "bucket-size",
+	Usage: "Number of blocks per range of the transaction counts",
+	Value: 100_000,
+}
+
+var StatsCommand = cli.Command{
+	Action:    stats,
+	Name:      "stats",
+	Usage:     "Print statistics of the substates and code in a substate DB",
+	ArgsUsage: "[<blockNumFirst> <blockNumLast>]",
+	Flags: []cli.Flag{
+		BucketSizeFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db stats command takes two optional arguments:
+    [<blockNumFirst> <blockNumLast>]
+<blockNumFirst> and <blockNumLast> are the first and last block of the
+inclusive range of substates to count, the whole DB by default.
+
+It prints the block range covered, the number of transactions per range of
+--bucket-size blocks, the encodings of the substates, and the number and size
+of the entries of each key prefix in the whole DB (1s: substates, 1c: code,
+1a: account states of compact substates, 1m: metadata), followed by the
+recorded ranges of the metadata.`,
+}
+
+// prefixStat is the number and total size of the entries of a key prefix
+type prefixStat struct {
+	count int64
+	size  int64
+}
+
+func stats(ctx *cli.Context) error {
+	var (
+		err   error
+		first uint64
+		last  uint64 = math.MaxUint64
+	)
+
+	switch len(ctx.Args()) {
+	case 0:
+	case 2:
+		first, last, err = parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("substate-cli db stats: %v", err)
+		}
+	default:
+		return fmt.Errorf("substate-cli db stats command requires 0 or 2 arguments")
+	}
+	bucketSize := ctx.Uint64(BucketSizeFlag.Name)
+	if bucketSize == 0 {
+		return fmt.Errorf("substate-cli db stats: --%s must be greater than 0", BucketSizeFlag.Name)
+	}
+
+	db, err := openSubstateDB(ctx, true)
+	if err != nil {
+		return fmt.Errorf("substate-cli db stats: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		prefixes  = make(map[string]*prefixStat)
+		encodings = make(map[string]int64)
+		buckets   = make(map[uint64]int64)
+
+		numTx, numBlock       int64
+		minBlock, maxBlock    uint64 = math.MaxUint64, 0
+		lastBlock             uint64
+		invalidKeys, corrupts int64
+	)
+
+	iter := db.NewRawIterator()
+	for iter.Next() {
+		key := iter.Key()
+		value := iter.Value()
+
+		prefix := fmt.Sprintf("%x", key)
+		if len(key) >= 2 {
+			prefix = string(key[:2])
+		}
+		if prefixes[prefix] == nil {
+			prefixes[prefix] = &prefixStat{}
+		}
+		prefixes[prefix].count++
+		prefixes[prefix].size += int64(len(key) + len(value))
+
+		if prefix != "1s" {
+			continue
+		}
+		block, _, err := research.DecodeStage1SubstateKey(key)
+		if err != nil {
+			invalidKeys++
+			continue
+		}
+		if block < first || block > last {
+			continue
+		}
+
+		numTx++
+		if numTx == 1 || block != lastBlock {
+			numBlock++
+			lastBlock = block
+		}
+		if block < minBlock {
+			minBlock = block
+		}
+		if block > maxBlock {
+			maxBlock = block
+		}
+		buckets[block/bucketSize]++
+
+		if _, encoding, err := db.DecodeSubstateRLP(value); err != nil {
+			corrupts++
+		} else {
+			encodings[encoding]++
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db stats: error iterating substate DB: %v", err)
+	}
+
+	if numTx == 0 {
+		fmt.Printf("substate-cli db stats: no substates found\n")
+	} else {
+		fmt.Printf("substate-cli db stats: block range = %v %v\n", minBlock, maxBlock)
+		fmt.Printf("substate-cli db stats: total #block = %v\n", numBlock)
+		fmt.Printf("substate-cli db stats: total #tx    = %v\n", numTx)
+
+		bucketNums := make([]uint64, 0, len(buckets))
+		for bucket := range buckets {
+			bucketNums = append(bucketNums, bucket)
+		}
+		sort.Slice(bucketNums, func(i, j int) bool { return bucketNums[i] < bucketNums[j] })
+		for _, bucket := range bucketNums {
+			fmt.Printf("substate-cli db stats: blocks %v-%v: #tx = %v\n",
+				bucket*bucketSize, bucket*bucketSize+bucketSize-1, buckets[bucket])
+		}
+
+		for _, encoding := range []string{
+			research.CompactSubstateEncoding,
+			research.LondonSubstateEncoding,
+			research.BerlinSubstateEncoding,
+			research.LegacySubstateEncoding,
+		} {
+			fmt.Printf("substate-cli db stats: encoding %-7s #tx = %v\n", encoding, encodings[encoding])
+		}
+		if corrupts > 0 {
+			fmt.Printf("substate-cli db stats: undecodable #tx = %v\n", corrupts)
+		}
+	}
+	if invalidKeys > 0 {
+		fmt.Printf("substate-cli db stats: invalid substate keys = %v\n", invalidKeys)
+	}
+
+	md, err := db.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db stats: %v", err)
+	}
+	if md == nil {
+		fmt.Printf("substate-cli db stats: no metadata\n")
+	} else {
+		fmt.Printf("substate-cli db stats: schema version = %v, chain ID = %v, mode = %v\n", md.SchemaVersion, md.ChainID, md.Mode)
+		fmt.Printf("substate-cli db stats: recorded ranges = %s\n", md.Ranges)
+	}
+
+	prefixNames := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		prefixNames = append(prefixNames, prefix)
+	}
+	sort.Strings(prefixNames)
+	for _, prefix := range prefixNames {
+		stat := prefixes[prefix]
+		fmt.Printf("substate-cli db stats: prefix %q: #entry = %v, size = %v bytes\n", prefix, stat.count, stat.size)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var EncodingFlag = cli.StringFlag{
+	Name:  "encoding",
+	Usage: "Target encoding of the substates: compact, or london for older readers",
+	Value: research.CompactSubstateEncoding,
+}
+
+var UpgradeEncodingCommand = cli.Command{
+	Action:    upgradeEncoding,
+	Name:      "upgrade-encoding",
+	Usage:     "Re-encode the substates of a substate DB in place",
+	ArgsUsage: "[<blockNumFirst> <blockNumLast>]",
+	Flags: []cli.Flag{
+		EncodingFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db upgrade-encoding command takes two optional arguments:
+    [<blockNumFirst> <blockNumLast>]
+<blockNumFirst> and <blockNumLast> are the first and last block of the
+inclusive range of substates to re-encode, the whole DB by default.
+
+Substates in the legacy, berlin or london encodings are rewritten in the
+compact encoding, which stores the state of each account with storage once
+under the 1a prefix and compresses substates. Readers decode every encoding,
+so a DB can be upgraded range by range. With --encoding london, compact
+substates are rewritten in the london encoding instead; db gc-code then
+deletes the account states no longer referenced.`,
+}
+
+func upgradeEncoding(ctx *cli.Context) error {
+	var (
+		err   error
+		first uint64
+		last  uint64 = math.MaxUint64
+	)
+
+	switch len(ctx.Args()) {
+	case 0:
+	case 2:
+		first, last, err = parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("substate-cli db upgrade-encoding: %v", err)
+		}
+	default:
+		return fmt.Errorf("substate-cli db upgrade-encoding command requires 0 or 2 arguments")
+	}
+	encoding := ctx.String(EncodingFlag.Name)
+
+	db, err := openSubstateDB(ctx, false)
+	if err != nil {
+		return fmt.Errorf("substate-cli db upgrade-encoding: %v", err)
+	}
+	defer db.Close()
+	if err = db.SetEncoding(encoding); err != nil {
+		return fmt.Errorf("substate-cli db upgrade-encoding: %v", err)
+	}
+	md, err := db.GetMetadata()
+	if err != nil {
+		return fmt.Errorf("substate-cli db upgrade-encoding: %v", err)
+	}
+
+	var (
+		numTx, upgraded  int64
+		oldSize, newSize int64
+		lastReport       int64
+	)
+	iter := db.NewSubstateIterator(first)
+	for iter.Next() {
+		key, value := common.CopyBytes(iter.Key()), iter.Value()
+		block, tx, err := research.DecodeStage1SubstateKey(key)
+		if err != nil {
+			continue
+		}
+		if block > last {
+			break
+		}
+		numTx++
+
+		substateRLP, oldEncoding, err := db.DecodeSubstateRLP(value)
+		if err != nil {
+			return fmt.Errorf("substate-cli db upgrade-encoding: error decoding substate %v_%v: %v", block, tx, err)
+		}
+		if oldEncoding == encoding {
+			continue
+		}
+		newValue, err := db.EncodeSubstateRLP(substateRLP, encoding)
+		if err == nil {
+			err = db.PutRaw(key, newValue)
+		}
+		if err != nil {
+			return fmt.Errorf("substate-cli db upgrade-encoding: error putting substate %v_%v: %v", block, tx, err)
+		}
+		oldSize += int64(len(value))
+		newSize += int64(len(newValue))
+		upgraded++
+
+		if upgraded-lastReport >= 100_000 {
+			fmt.Printf("substate-cli db upgrade-encoding: block %v, upgraded #tx = %v\n", block, upgraded)
+			lastReport = upgraded
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db upgrade-encoding: error iterating substate DB: %v", err)
+	}
+
+	// compact substates require the current schema version
+	if md != nil && upgraded > 0 {
+		if err = db.PutMetadata(md); err != nil {
+			return fmt.Errorf("substate-cli db upgrade-encoding: error putting metadata: %v", err)
+		}
+	}
+
+	fmt.Printf("substate-cli db upgrade-encoding: total #tx    = %v\n", numTx)
+	fmt.Printf("substate-cli db upgrade-encoding: upgraded #tx = %v\n", upgraded)
+	fmt.Printf("substate-cli db upgrade-encoding: substate size %v -> %v bytes, excluding account states\n", oldSize, newSize)
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/cmd/substate-cli/replay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/research"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	VerifyReplayFlag = cli.BoolFlag{
+		Name:  "replay",
+		Usage: "Re-execute each transaction and check its output alloc and result, as replay does",
+	}
+	VerifyReportFlag = cli.StringFlag{
+		Name:  "report",
+		Usage: "JSON file to write the bad keys to",
+	}
+	VerifyDeleteFlag = cli.BoolFlag{
+		Name:  "delete",
+		Usage: "Delete the bad keys from the substate DB",
+	}
+	VerifyQuarantineFlag = cli.StringFlag{
+		Name:  "quarantine",
+		Usage: "Move the bad keys to the LevelDB at this path",
+	}
+)
+
+var VerifyCommand = cli.Command{
+	Action:    verify,
+	Name:      "verify",
+	Usage:     "Check that the substates of a given range of blocks decode, refer to stored code and replay",
+	ArgsUsage: "<blockNumFirst> <blockNumLast>",
+	Flags: []cli.Flag{
+		research.WorkersFlag,
+		VerifyReplayFlag,
+		VerifyReportFlag,
+		VerifyDeleteFlag,
+		VerifyQuarantineFlag,
+		research.SubstateDirFlag,
+	},
+	Description: `
+The substate-cli db verify command requires two arguments:
+    <blockNumFirst> <blockNumLast>
+<blockNumFirst> and <blockNumLast> are the first and
+last block of the inclusive range of blocks to verify.
+
+Every substate key of the range must decode to a substate in one of the
+known encodings, with the account states of compact substates, and every
+code hash it refers to must be stored under the 1c prefix with matching code.
+With --replay, every transaction is also re-executed and must reproduce its
+recorded output alloc and result.
+
+Bad keys are printed, and written to --report. They are removed from the
+substate DB with --delete, or moved to another LevelDB with --quarantine.`,
+}
+
+// badSubstate is a substate key failing verification
+type badSubstate struct {
+	Key    hexutil.Bytes `json:"key"`
+	Block  uint64        `json:"block"`
+	Tx     int           `json:"tx"`
+	Errors []string      `json:"errors"`
+}
+
+// verifySubstate returns the problems of the value of a substate key
+func verifySubstate(db *research.SubstateDB, tx int, value []byte, replaySubstate bool) (errs []string) {
+	substateRLP, _, err := db.DecodeSubstateRLP(value)
+	if err != nil {
+		return []string{fmt.Sprintf("decode: %v", err)}
+	}
+	if substateRLP.Env == nil || substateRLP.Message == nil || substateRLP.Result == nil {
+		return []string{"decode: missing env, message or result"}
+	}
+	codeHashes, err := substateRLP.CodeHashes()
+	if err != nil {
+		return []string{fmt.Sprintf("decode: %v", err)}
+	}
+
+	checked := make(map[common.Hash]bool)
+	for _, codeHash := range codeHashes {
+		if checked[codeHash] {
+			continue
+		}
+		checked[codeHash] = true
+		code, err := db.GetRaw(research.Stage1CodeKey(codeHash))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("missing code %s", codeHash.Hex()))
+		} else if research.CodeHash(code) != codeHash {
+			errs = append(errs, fmt.Sprintf("code hash mismatch %s", codeHash.Hex()))
+		}
+	}
+	if len(errs) > 0 || !replaySubstate {
+		return errs
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			errs = append(errs, fmt.Sprintf("replay: panic: %v", r))
+		}
+	}()
+	substate := research.Substate{}
+	substate.SetRLP(substateRLP, db)
+	if err = replay.VerifySubstate(tx, &substate); err != nil {
+		errs = append(errs, fmt.Sprintf("replay: %v", err))
+	}
+	return errs
+}
+
+func verify(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return fmt.Errorf("substate-cli db verify command requires exactly 2 arguments")
+	}
+
+	first, last, err := parseBlockRange(ctx.Args().Get(0), ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("substate-cli db verify: %v", err)
+	}
+
+	var (
+		replaySubstate = ctx.Bool(VerifyReplayFlag.Name)
+		quarantinePath = ctx.String(VerifyQuarantineFlag.Name)
+		remove         = ctx.Bool(VerifyDeleteFlag.Name) || quarantinePath != ""
+		workers        = ctx.Int(research.WorkersFlag.Name)
+	)
+	if workers < 1 {
+		workers = 1
+	}
+
+	db, err := openSubstateDB(ctx, !remove)
+	if err != nil {
+		return fmt.Errorf("substate-cli db verify: %v", err)
+	}
+	defer db.Close()
+	warnMissingRange(db, "verify", first, last)
+
+	type substateKey struct {
+		key   []byte
+		block uint64
+		tx    int
+		value []byte
+	}
+
+	var (
+		bad     []*badSubstate
+		badLock sync.Mutex
+		numTx   int64
+	)
+	report := func(key substateKey, errs []string) {
+		badLock.Lock()
+		defer badLock.Unlock()
+		bad = append(bad, &badSubstate{Key: key.key, Block: key.block, Tx: key.tx, Errors: errs})
+	}
+
+	keyChan := make(chan substateKey, workers*10)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyChan {
+				if errs := verifySubstate(db, key.tx, key.value, replaySubstate); len(errs) > 0 {
+					report(key, errs)
+				}
+			}
+		}()
+	}
+
+	iter := db.NewSubstateIterator(first)
+	for iter.Next() {
+		key := substateKey{
+			key:   common.CopyBytes(iter.Key()),
+			value: common.CopyBytes(iter.Value()),
+		}
+		key.block, key.tx, err = research.DecodeStage1SubstateKey(key.key)
+		if err != nil {
+			report(key, []string{fmt.Sprintf("key: %v", err)})
+			continue
+		}
+		if key.block > last {
+			break
+		}
+		numTx++
+		keyChan <- key
+	}
+	close(keyChan)
+	wg.Wait()
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("substate-cli db verify: error iterating substate DB: %v", err)
+	}
+
+	sort.Slice(bad, func(i, j int) bool {
+		if bad[i].Block != bad[j].Block {
+			return bad[i].Block < bad[j].Block
+		}
+		return bad[i].Tx < bad[j].Tx
+	})
+	for _, b := range bad {
+		fmt.Printf("substate-cli db verify: %v_%v (key %s): %v\n", b.Block, b.Tx, b.Key, b.Errors)
+	}
+	fmt.Printf("substate-cli db verify: block range = %v %v\n", first, last)
+	fmt.Printf("substate-cli db verify: total #tx  = %v\n", numTx)
+	fmt.Printf("substate-cli db verify: bad #key   = %v\n", len(bad))
+
+	if path := ctx.String(VerifyReportFlag.Name); path != "" {
+		if bad == nil {
+			bad = []*badSubstate{}
+		}
+		data, err := json.MarshalIndent(bad, "", " ")
+		if err != nil {
+			return fmt.Errorf("substate-cli db verify: error encoding report: %v", err)
+		}
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("substate-cli db verify: error writing report: %v", err)
+		}
+	}
+
+	if !remove || len(bad) == 0 {
+		return nil
+	}
+	if quarantinePath != "" {
+		backend, err := rawdb.NewLevelDBDatabase(quarantinePath, 16, 16, "quarantine", false)
+		if err != nil {
+			return fmt.Errorf("substate-cli db verify: error opening %s: %v", quarantinePath, err)
+		}
+		quarantine := research.NewSubstateDB(backend)
+		defer quarantine.Close()
+		for _, b := range bad {
+			value, err := db.GetRaw(b.Key)
+			if err == nil {
+				err = quarantine.PutRaw(b.Key, value)
+			}
+			if err != nil {
+				return fmt.Errorf("substate-cli db verify: error quarantining %v_%v: %v", b.Block, b.Tx, err)
+			}
+		}
+		fmt.Printf("substate-cli db verify: quarantined %v keys in %s\n", len(bad), quarantinePath)
+	}
+	for _, b := range bad {
+		if err = db.DeleteRaw(b.Key); err != nil {
+			return fmt.Errorf("substate-cli db verify: error deleting %v_%v: %v", b.Block, b.Tx, err)
+		}
+	}
+	fmt.Printf("substate-cli db verify: deleted %v keys\n", len(bad))
+
+	// blocks with deleted substates are no longer completely recorded
+	md, err := db.GetMetadata()
+	if err != nil || md == nil {
+		return err
+	}
+	for _, b := range bad {
+		md.Ranges = md.Ranges.Remove(research.BlockRange{First: b.Block, Last: b.Block})
+	}
+	if err = db.PutMetadata(md); err != nil {
+		return fmt.Errorf("substate-cli db verify: error putting metadata: %v", err)
+	}
+
+	return nil
+}
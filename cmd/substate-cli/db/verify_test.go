@@ -0,0 +1,130 @@
+package db
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	testSender   = common.BytesToAddress([]byte("sender"))
+	testContract = common.BytesToAddress([]byte("contract"))
+	testCoinbase = common.BytesToAddress([]byte("coinbase"))
+	testCode     = []byte{0x00} // STOP
+)
+
+// newTestSubstate returns the substate of a call of testSender to
+// testContract transferring value at block 1, as replay reproduces it
+func newTestSubstate(value int64) *research.Substate {
+	to := testContract
+	inputAlloc := research.SubstateAlloc{
+		testSender:   research.NewSubstateAccount(0, big.NewInt(1000000), nil),
+		testContract: research.NewSubstateAccount(1, big.NewInt(0), testCode),
+		testCoinbase: research.NewSubstateAccount(0, big.NewInt(1), nil),
+	}
+	outputAlloc := research.SubstateAlloc{
+		testSender:   research.NewSubstateAccount(1, big.NewInt(1000000-21000-value), nil),
+		testContract: research.NewSubstateAccount(1, big.NewInt(value), testCode),
+		testCoinbase: research.NewSubstateAccount(0, big.NewInt(1+21000), nil),
+	}
+	env := &research.SubstateEnv{
+		Coinbase:    testCoinbase,
+		Difficulty:  big.NewInt(1),
+		GasLimit:    1000000,
+		Number:      1,
+		BlockHashes: map[uint64]common.Hash{},
+	}
+	msg := &research.SubstateMessage{
+		Nonce:      0,
+		CheckNonce: true,
+		GasPrice:   big.NewInt(1),
+		Gas:        50000,
+		From:       testSender,
+		To:         &to,
+		Value:      big.NewInt(value),
+		Data:       []byte{},
+		GasFeeCap:  big.NewInt(1),
+		GasTipCap:  big.NewInt(1),
+	}
+	result := &research.SubstateResult{
+		Status:  1,
+		Logs:    []*types.Log{},
+		GasUsed: 21000,
+	}
+	return research.NewSubstate(inputAlloc, outputAlloc, env, msg, result)
+}
+
+func TestVerifySubstate(t *testing.T) {
+	codeKey := research.Stage1CodeKey(research.CodeHash(testCode))
+	// recorded with another output balance than replay computes
+	diverging := newTestSubstate(5)
+	diverging.OutputAlloc[testContract].Balance = big.NewInt(6)
+
+	tests := []struct {
+		name     string
+		replay   bool
+		substate *research.Substate
+		setup    func(db *research.SubstateDB, value []byte) []byte // returns the value to verify
+		want     string                                             // prefix of the only problem, if any
+	}{
+		{"ok", false, newTestSubstate(5), nil, ""},
+		{"replayed", true, newTestSubstate(5), nil, ""},
+		{
+			name:     "undecodable",
+			substate: newTestSubstate(5),
+			setup:    func(db *research.SubstateDB, value []byte) []byte { return []byte("invalid") },
+			want:     "decode: ",
+		},
+		{
+			name:     "missing code",
+			substate: newTestSubstate(5),
+			setup: func(db *research.SubstateDB, value []byte) []byte {
+				db.DeleteRaw(codeKey)
+				return value
+			},
+			want: "missing code " + research.CodeHash(testCode).Hex(),
+		},
+		{
+			name:     "code mismatch",
+			substate: newTestSubstate(5),
+			setup: func(db *research.SubstateDB, value []byte) []byte {
+				db.PutRaw(codeKey, []byte{0x60, 0x00})
+				return value
+			},
+			want: "code hash mismatch " + research.CodeHash(testCode).Hex(),
+		},
+		{
+			name:     "replay mismatch",
+			replay:   true,
+			substate: diverging,
+			want:     "replay: inconsistent output: alloc",
+		},
+	}
+	for _, tt := range tests {
+		db := research.NewSubstateDB(rawdb.NewMemoryDatabase())
+		db.PutSubstate(1, 0, tt.substate)
+		value, err := db.GetRaw(research.Stage1SubstateKey(1, 0))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.setup != nil {
+			value = tt.setup(db, value)
+		}
+
+		errs := verifySubstate(db, 0, value, tt.replay)
+		if tt.want == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: problems %v, want none", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.HasPrefix(errs[0], tt.want) {
+			t.Errorf("%s: problems %v, want %s", tt.name, errs, tt.want)
+		}
+	}
+}
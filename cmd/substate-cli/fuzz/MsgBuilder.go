@@ -5,8 +5,6 @@ package fuzz
 
 import (
 	"log"
-
-	abi_gen "github.com/ethereum/go-ethereum/cmd/substate-cli/abi"
 )
 
 /*
@@ -26,17 +24,12 @@ func MsgBuilder(targetedContracts []string, timestamp uint64, localUsers []strin
 		addressResults []string
 		msgResults     []string
 		msgStrings     []string
-		data           []byte
 		abi            *ABI
 		err            error
 	)
 
 	for i := 0; i < len(targetedContracts); i++ {
-		path := GlobalABIPath + targetedContracts[i] + ".json"
-		if data, err = readFile(path); err != nil {
-			continue
-		}
-		if abi, err = newAbi(data); err != nil {
+		if abi, err = loadAbi(targetedContracts[i]); err != nil {
 			continue
 		}
 
@@ -48,18 +41,18 @@ func MsgBuilder(targetedContracts []string, timestamp uint64, localUsers []strin
 				continue
 			}
 
-			for j := 0; j < RAND_CASE_SCALE; j++ {
+			for j := 0; j < caseScale(targetedContracts[i], fun); j++ {
 				if len(fun.Inputs) <= 0 {
-					if hex_str, suberr := abi_gen.Parse_GenMsg(fun.Sig()); suberr == nil {
+					if hex_str, suberr := packMsg(fun.Sig()); suberr == nil {
 						addressResults = append(addressResults, targetedContracts[i])
 						msgResults = append(msgResults, hex_str)
 						msgStrings = append(msgStrings, fun.Sig())
 					}
 					break
 				}
-				if ret, err := fun.Inputs.fuzz(timestamp, localUsers, localContracts); err == nil {
-					temp := fun.Sig() + ":[" + ret.(string) + "]"
-					if hex_str, suberr := abi_gen.Parse_GenMsg(temp); suberr == nil {
+				if ret, err := fuzzArguments(targetedContracts[i], fun, j, timestamp, localUsers, localContracts); err == nil {
+					temp := fun.Sig() + ":[" + signArguments(targetedContracts[i], fun, ret.(string)) + "]"
+					if hex_str, suberr := packMsg(temp); suberr == nil {
 						addressResults = append(addressResults, targetedContracts[i])
 						msgResults = append(msgResults, hex_str)
 						msgStrings = append(msgStrings, temp)
@@ -92,17 +85,12 @@ func MsgBuilder2(targetedContract2Function map[string][]string, timestamp uint64
 		addressResults []string
 		msgResults     []string
 		msgStrings     []string
-		data           []byte
 		abi            *ABI
 		err            error
 	)
 
 	for contract, signatureList := range targetedContract2Function {
-		path := GlobalABIPath + contract + ".json"
-		if data, err = readFile(path); err != nil {
-			continue
-		}
-		if abi, err = newAbi(data); err != nil {
+		if abi, err = loadAbi(contract); err != nil {
 			continue
 		}
 
@@ -115,18 +103,18 @@ func MsgBuilder2(targetedContract2Function map[string][]string, timestamp uint64
 				continue
 			}
 
-			for j := 0; j < RAND_CASE_SCALE; j++ {
+			for j := 0; j < caseScale(contract, fun); j++ {
 				if len(fun.Inputs) <= 0 {
-					if hex_str, suberr := abi_gen.Parse_GenMsg(fun.Sig()); suberr == nil {
+					if hex_str, suberr := packMsg(fun.Sig()); suberr == nil {
 						addressResults = append(addressResults, contract)
 						msgResults = append(msgResults, hex_str)
 						msgStrings = append(msgStrings, fun.Sig())
 					}
 					break
 				}
-				if ret, err := fun.Inputs.fuzz(timestamp, localUsers, localContracts); err == nil {
-					temp := fun.Sig() + ":[" + ret.(string) + "]"
-					if hex_str, suberr := abi_gen.Parse_GenMsg(temp); suberr == nil {
+				if ret, err := fuzzArguments(contract, fun, j, timestamp, localUsers, localContracts); err == nil {
+					temp := fun.Sig() + ":[" + signArguments(contract, fun, ret.(string)) + "]"
+					if hex_str, suberr := packMsg(temp); suberr == nil {
 						addressResults = append(addressResults, contract)
 						msgResults = append(msgResults, hex_str)
 						msgStrings = append(msgStrings, temp)
@@ -144,6 +132,101 @@ func MsgBuilder2(targetedContract2Function map[string][]string, timestamp uint64
 	return addressResults, msgResults, msgStrings, nil
 }
 
+/*
+ * generate calls to the initializer and setter functions of targetedContracts
+ * addresses in the arguments are drawn from localUsers and localContracts,
+ * so that an attacker passed as the only local user claims the contract
+ */
+func AdminBuilder(targetedContracts []string, timestamp uint64, localUsers []string, localContracts []string) ([]string, []string, []string, error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println(err)
+			printCallStackIfError()
+		}
+	}()
+
+	var (
+		addressResults []string
+		msgResults     []string
+		msgStrings     []string
+		abi            *ABI
+		err            error
+	)
+
+	for _, contract := range targetedContracts {
+		if abi, err = loadAbi(contract); err != nil {
+			continue
+		}
+
+		for _, fun := range ([]*Function)(*abi) {
+			if fun.Type != "function" ||
+				fun.Constant == true ||
+				fun.Statemutability == "pure" ||
+				fun.Statemutability == "view" ||
+				!isAdminFunction(fun) {
+				continue
+			}
+
+			for j := 0; j < RAND_CASE_SCALE; j++ {
+				if len(fun.Inputs) <= 0 {
+					if hex_str, suberr := packMsg(fun.Sig()); suberr == nil {
+						addressResults = append(addressResults, contract)
+						msgResults = append(msgResults, hex_str)
+						msgStrings = append(msgStrings, fun.Sig())
+					}
+					break
+				}
+				if ret, err := fun.Inputs.fuzz(timestamp, localUsers, localContracts); err == nil {
+					temp := fun.Sig() + ":[" + signArguments(contract, fun, ret.(string)) + "]"
+					if hex_str, suberr := packMsg(temp); suberr == nil {
+						addressResults = append(addressResults, contract)
+						msgResults = append(msgResults, hex_str)
+						msgStrings = append(msgStrings, temp)
+					}
+				}
+			}
+		}
+	}
+
+	return addressResults, msgResults, msgStrings, nil
+}
+
+/*
+ * generate calls to the parameterless view functions of targetedContracts
+ * their return values describe the state exposed to external protocols
+ */
+func ViewBuilder(targetedContracts []string) ([]string, []string, []string, error) {
+	var (
+		addressResults []string
+		msgResults     []string
+		msgStrings     []string
+		abi            *ABI
+		err            error
+	)
+
+	for _, contract := range targetedContracts {
+		if abi, err = loadAbi(contract); err != nil {
+			continue
+		}
+
+		for _, fun := range ([]*Function)(*abi) {
+			if fun.Type != "function" ||
+				len(fun.Inputs) > 0 ||
+				len(fun.Outputs) == 0 ||
+				!(fun.Constant == true || fun.Statemutability == "view") {
+				continue
+			}
+			if hex_str, suberr := packMsg(fun.Sig()); suberr == nil {
+				addressResults = append(addressResults, contract)
+				msgResults = append(msgResults, hex_str)
+				msgStrings = append(msgStrings, fun.Sig())
+			}
+		}
+	}
+
+	return addressResults, msgResults, msgStrings, nil
+}
+
 func containByList(list []string, item string) bool {
 	for _, listItem := range list {
 		if item == listItem {
@@ -0,0 +1,93 @@
+package fuzz
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// number of argument seeds kept per function
+const maxArgumentSeeds = 16
+
+var (
+	// new branches and storage writes reached by the messages of each function
+	functionNovelty = make(map[string]int)
+	// messages of each function that reached new coverage
+	argumentSeeds = make(map[string][]string)
+	feedbackLock  sync.RWMutex
+)
+
+func feedbackKey(contract string, sig string) string {
+	return strings.ToLower(contract) + ":" + sig
+}
+
+/*
+ * record that the call msgString ("sig:[args]") to contract reached novelty
+ * new branches or storage writes
+ * the call becomes an argument seed of its function, whose later messages are
+ * partly mutated from it
+ */
+func RecordFeedback(contract string, msgString string, novelty int) {
+	if novelty <= 0 {
+		return
+	}
+	sig := strings.SplitN(msgString, ":", 2)[0]
+	key := feedbackKey(contract, sig)
+
+	feedbackLock.Lock()
+	defer feedbackLock.Unlock()
+	functionNovelty[key] += novelty
+	if !strings.Contains(msgString, ":") {
+		return
+	}
+	seeds := append(argumentSeeds[key], msgString)
+	if len(seeds) > maxArgumentSeeds {
+		seeds = seeds[len(seeds)-maxArgumentSeeds:]
+	}
+	argumentSeeds[key] = seeds
+}
+
+// the coverage reached so far by the messages to the function of msgString
+func FunctionNovelty(contract string, msgString string) int {
+	feedbackLock.RLock()
+	defer feedbackLock.RUnlock()
+	return functionNovelty[feedbackKey(contract, strings.SplitN(msgString, ":", 2)[0])]
+}
+
+// caseScale is the number of messages generated for fun: functions with
+// argument seeds get one more per seed, up to twice RAND_CASE_SCALE
+func caseScale(contract string, fun *Function) int {
+	feedbackLock.RLock()
+	defer feedbackLock.RUnlock()
+	bonus := len(argumentSeeds[feedbackKey(contract, fun.Sig())])
+	if bonus > RAND_CASE_SCALE {
+		bonus = RAND_CASE_SCALE
+	}
+	return RAND_CASE_SCALE + bonus
+}
+
+/*
+ * generate the arguments of the round-th call to fun of contract
+ * every other round of a function with argument seeds mutates one argument
+ * of a random seed, the other rounds sample the seed pools as usual
+ */
+func fuzzArguments(contract string, fun *Function, round int, timestamp uint64, localUsers []string, localContracts []string) (interface{}, error) {
+	feedbackLock.RLock()
+	seeds := argumentSeeds[feedbackKey(contract, fun.Sig())]
+	feedbackLock.RUnlock()
+	if round%2 == 0 || len(seeds) == 0 {
+		return fun.Inputs.fuzz(timestamp, localUsers, localContracts)
+	}
+
+	_, types, values, ok := splitMsg(seeds[rand.Intn(len(seeds))])
+	if !ok || len(types) != len(fun.Inputs) {
+		return fun.Inputs.fuzz(timestamp, localUsers, localContracts)
+	}
+	index := rand.Intn(len(types))
+	out, err := fuzz(types[index], timestamp, localUsers, localContracts)
+	if err != nil || len(out) == 0 {
+		return fun.Inputs.fuzz(timestamp, localUsers, localContracts)
+	}
+	values[index] = out[0]
+	return joinArgs(values), nil
+}
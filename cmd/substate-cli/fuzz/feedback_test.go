@@ -0,0 +1,131 @@
+package fuzz
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// restoreFeedback resets the feedback of the run, returning a function
+// restoring the previous one
+func restoreFeedback() func() {
+	novelty, seeds := functionNovelty, argumentSeeds
+	functionNovelty, argumentSeeds = make(map[string]int), make(map[string][]string)
+	return func() { functionNovelty, argumentSeeds = novelty, seeds }
+}
+
+func TestRecordFeedback(t *testing.T) {
+	defer restoreFeedback()()
+
+	contract := "0x000000000000000000000000000000000000AAAA"
+	RecordFeedback(contract, `f(uint8):["0x1"]`, 2)
+	RecordFeedback(contract, `f(uint8):["0x2"]`, 0)
+	RecordFeedback(contract, `f(uint8):["0x3"]`, -1)
+	RecordFeedback(contract, `f(uint8)`, 3)
+	RecordFeedback(contract, `g()`, 1)
+
+	if got := FunctionNovelty(strings.ToLower(contract), `f(uint8):["0x9"]`); got != 5 {
+		t.Errorf("novelty of f = %d, want 5", got)
+	}
+	if got := FunctionNovelty(contract, `g()`); got != 1 {
+		t.Errorf("novelty of g = %d, want 1", got)
+	}
+	// calls without arguments reaching no coverage are not seeds
+	if got, want := argumentSeeds[feedbackKey(contract, "f(uint8)")], []string{`f(uint8):["0x1"]`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seeds of f = %v, want %v", got, want)
+	}
+
+	// only the latest maxArgumentSeeds seeds are kept
+	for i := 0; i < maxArgumentSeeds+3; i++ {
+		RecordFeedback(contract, fmt.Sprintf(`h(uint8):["0x%x"]`, i), 1)
+	}
+	seeds := argumentSeeds[feedbackKey(contract, "h(uint8)")]
+	if len(seeds) != maxArgumentSeeds || seeds[0] != `h(uint8):["0x3"]` {
+		t.Errorf("%d seeds of h starting with %v, want %d starting with 0x3", len(seeds), seeds[0], maxArgumentSeeds)
+	}
+}
+
+func TestCaseScale(t *testing.T) {
+	defer restoreFeedback()()
+
+	contract := "0x000000000000000000000000000000000000aaaa"
+	fun := &Function{Name: "f", Type: "function", Inputs: IOput{{Type: "uint8"}}}
+	tests := []struct {
+		seeds int
+		want  int
+	}{
+		{0, RAND_CASE_SCALE},
+		{3, RAND_CASE_SCALE + 3},
+		{RAND_CASE_SCALE, 2 * RAND_CASE_SCALE},
+		{maxArgumentSeeds, 2 * RAND_CASE_SCALE},
+	}
+	for _, tt := range tests {
+		argumentSeeds = make(map[string][]string)
+		for i := 0; i < tt.seeds; i++ {
+			RecordFeedback(contract, fmt.Sprintf(`f(uint8):["0x%x"]`, i), 1)
+		}
+		if got := caseScale(contract, fun); got != tt.want {
+			t.Errorf("%d seeds: caseScale = %d, want %d", tt.seeds, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzArgumentsSeedMutation(t *testing.T) {
+	defer restoreFeedback()()
+
+	var (
+		contract  = "0x000000000000000000000000000000000000aaaa"
+		seed      = []interface{}{"0x5", "0x000000000000000000000000000000000000dead", true}
+		fun       = &Function{Name: "f", Type: "function", Inputs: IOput{{Type: "uint256"}, {Type: "address"}, {Type: "bool"}}}
+		users     = []string{"0x00000000000000000000000000000000000000aa"}
+		contracts = []string{"0x00000000000000000000000000000000000000bb"}
+	)
+	RecordFeedback(contract, joinMsg(fun.Sig(), seed), 1)
+
+	decode := func(round int, ret interface{}) []interface{} {
+		var values []interface{}
+		if err := json.Unmarshal([]byte("["+ret.(string)+"]"), &values); err != nil || len(values) != len(seed) {
+			t.Fatalf("round %d: invalid arguments %v: %v", round, ret, err)
+		}
+		return values
+	}
+	// fresh arguments never hold the seed address, which is neither a user
+	// nor a contract
+	mutated := 0
+	for round := 0; round < 40; round++ {
+		ret, err := fuzzArguments(contract, fun, round, 1, users, contracts)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		values := decode(round, ret)
+		changed := 0
+		for i := range seed {
+			if !reflect.DeepEqual(values[i], seed[i]) {
+				changed++
+			}
+		}
+		switch {
+		case round%2 == 0 && values[1] == seed[1]:
+			t.Errorf("round %d: arguments %v taken from the seed", round, values)
+		case round%2 == 1 && changed <= 1:
+			mutated++
+		case round%2 == 1 && values[1] == seed[1]:
+			t.Errorf("round %d: arguments %v differ from the seed %v in %d places", round, values, seed, changed)
+		}
+	}
+	// odd rounds mutate a single argument of the seed, unless no argument can
+	// be generated for its type
+	if mutated < 15 {
+		t.Errorf("%d of 20 odd rounds mutated the seed", mutated)
+	}
+
+	// a seed of another arity is not mutated
+	argumentSeeds[feedbackKey(contract, fun.Sig())] = []string{fun.Sig() + `:["0x5"]`}
+	ret, err := fuzzArguments(contract, fun, 1, 1, users, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(1, ret)
+}
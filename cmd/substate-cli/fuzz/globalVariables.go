@@ -25,6 +25,7 @@ var (
 	GlobalStringSeed []SeedItem
 	GlobalByteSeed   []SeedItem
 	GlobalBytesSeed  []SeedItem
+	GlobalValueSeed  []SeedItem
 	GlobalABIPath    string
 )
 
@@ -0,0 +1,23 @@
+package fuzz
+
+import (
+	abi_gen "github.com/ethereum/go-ethereum/cmd/substate-cli/abi"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	msgGeneratedMeter = metrics.NewRegisteredMeter("fuzz/msgs/generated", nil)
+	msgPackFailMeter  = metrics.NewRegisteredMeter("fuzz/msgs/packfail", nil)
+)
+
+// packMsg encodes a generated message string with abi_gen, counting the
+// messages generated and the ABI-pack failures
+func packMsg(msgString string) (string, error) {
+	hexStr, err := abi_gen.Parse_GenMsg(msgString)
+	if err != nil {
+		msgPackFailMeter.Mark(1)
+	} else {
+		msgGeneratedMeter.Mark(1)
+	}
+	return hexStr, err
+}
@@ -0,0 +1,240 @@
+package fuzz
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// implementation behind each proxy, both in lowercase hex
+	globalImplementations = make(map[string]string)
+	// abis synthesized for implementations without an abi file
+	globalSynthesizedABIs = make(map[string]*ABI)
+	proxyLock             sync.RWMutex
+
+	// selector to function of the known signatures and all abi files
+	signatureDict     map[string]*Function
+	signatureDictOnce sync.Once
+)
+
+// signatures of common token, ownership and proxy functions
+var knownSignatures = []*Function{
+	{Name: "transfer", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "uint256"}}},
+	{Name: "transferFrom", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "address"}, {Type: "uint256"}}},
+	{Name: "approve", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "uint256"}}},
+	{Name: "increaseAllowance", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "uint256"}}},
+	{Name: "decreaseAllowance", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "uint256"}}},
+	{Name: "mint", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "uint256"}}},
+	{Name: "burn", Type: "function", Inputs: IOput{{Type: "uint256"}}},
+	{Name: "deposit", Type: "function", Payable: true, Statemutability: "payable"},
+	{Name: "deposit", Type: "function", Inputs: IOput{{Type: "uint256"}}},
+	{Name: "withdraw", Type: "function", Inputs: IOput{{Type: "uint256"}}},
+	{Name: "stake", Type: "function", Inputs: IOput{{Type: "uint256"}}},
+	{Name: "claim", Type: "function"},
+	{Name: "initialize", Type: "function"},
+	{Name: "initialize", Type: "function", Inputs: IOput{{Type: "address"}}},
+	{Name: "transferOwnership", Type: "function", Inputs: IOput{{Type: "address"}}},
+	{Name: "renounceOwnership", Type: "function"},
+	{Name: "acceptOwnership", Type: "function"},
+	{Name: "grantRole", Type: "function", Inputs: IOput{{Type: "bytes32"}, {Type: "address"}}},
+	{Name: "revokeRole", Type: "function", Inputs: IOput{{Type: "bytes32"}, {Type: "address"}}},
+	{Name: "pause", Type: "function"},
+	{Name: "unpause", Type: "function"},
+	{Name: "upgradeTo", Type: "function", Inputs: IOput{{Type: "address"}}},
+	{Name: "upgradeToAndCall", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "bytes"}}, Payable: true, Statemutability: "payable"},
+	{Name: "totalSupply", Type: "function", Outputs: IOput{{Type: "uint256"}}, Statemutability: "view"},
+	{Name: "balanceOf", Type: "function", Inputs: IOput{{Type: "address"}}, Outputs: IOput{{Type: "uint256"}}, Statemutability: "view"},
+	{Name: "allowance", Type: "function", Inputs: IOput{{Type: "address"}, {Type: "address"}}, Outputs: IOput{{Type: "uint256"}}, Statemutability: "view"},
+	{Name: "owner", Type: "function", Outputs: IOput{{Type: "address"}}, Statemutability: "view"},
+	{Name: "paused", Type: "function", Outputs: IOput{{Type: "bool"}}, Statemutability: "view"},
+	{Name: "decimals", Type: "function", Outputs: IOput{{Type: "uint8"}}, Statemutability: "view"},
+	{Name: "getReserves", Type: "function", Outputs: IOput{{Type: "uint112"}, {Type: "uint112"}, {Type: "uint32"}}, Statemutability: "view"},
+	{Name: "totalAssets", Type: "function", Outputs: IOput{{Type: "uint256"}}, Statemutability: "view"},
+	{Name: "pricePerShare", Type: "function", Outputs: IOput{{Type: "uint256"}}, Statemutability: "view"},
+}
+
+func selectorOf(fun *Function) string {
+	return hex.EncodeToString(crypto.Keccak256([]byte(fun.Sig()))[:4])
+}
+
+func signatures() map[string]*Function {
+	signatureDictOnce.Do(func() {
+		signatureDict = make(map[string]*Function)
+		for _, fun := range knownSignatures {
+			signatureDict[selectorOf(fun)] = fun
+		}
+		files, err := readDir(GlobalABIPath)
+		if err != nil {
+			return
+		}
+		for _, file := range files {
+			data, err := readFile(GlobalABIPath + file)
+			if err != nil {
+				continue
+			}
+			abi, err := newAbi(data)
+			if err != nil {
+				continue
+			}
+			for _, fun := range ([]*Function)(*abi) {
+				if fun.Type == "function" {
+					signatureDict[selectorOf(fun)] = fun
+				}
+			}
+		}
+	})
+	return signatureDict
+}
+
+/*
+ * record implementation as the logic contract behind proxy
+ * messages keep targeting the proxy, but are built from the implementation abi
+ */
+func SetImplementation(proxy string, implementation string) {
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+	globalImplementations[strings.ToLower(proxy)] = strings.ToLower(implementation)
+}
+
+func GetImplementation(proxy string) string {
+	proxyLock.RLock()
+	defer proxyLock.RUnlock()
+	return globalImplementations[strings.ToLower(proxy)]
+}
+
+// check whether contract has an abi file or a synthesized abi
+func HasABI(contract string) bool {
+	contract = strings.ToLower(contract)
+	proxyLock.RLock()
+	_, synthesized := globalSynthesizedABIs[contract]
+	proxyLock.RUnlock()
+	if synthesized {
+		return true
+	}
+	_, err := readFile(GlobalABIPath + contract + ".json")
+	return err == nil
+}
+
+// opcodes comparing the selector with the calldata in dispatchers
+const (
+	opLT     = 0x10
+	opGT     = 0x11
+	opEQ     = 0x14
+	opXOR    = 0x18
+	opMLOAD  = 0x51
+	opPUSH1  = 0x60
+	opPUSH4  = 0x63
+	opPUSH32 = 0x7f
+	opDUP1   = 0x80
+	opDUP16  = 0x8f
+)
+
+// dispatchComparison tells whether the selector pushed right before next is
+// compared with the one of the calldata, either on the stack (DUPn, Solidity)
+// or in memory (PUSH1 MLOAD, Vyper), rather than e.g. encoding an external
+// call
+func dispatchComparison(code []byte, next int) bool {
+	switch {
+	case next < len(code) && code[next] >= opDUP1 && code[next] <= opDUP16:
+		next++
+	case next+2 < len(code) && code[next] == opPUSH1 && code[next+2] == opMLOAD:
+		next += 3
+	}
+	if next >= len(code) {
+		return false
+	}
+	switch code[next] {
+	case opLT, opGT, opEQ, opXOR:
+		return true
+	}
+	return false
+}
+
+/*
+ * synthesize the abi of contract from its runtime code
+ * the 4-byte immediates the dispatcher compares the calldata selector with are
+ * matched against the known signatures and the functions of all abi files;
+ * returns the number of functions found
+ */
+func SynthesizeABI(contract string, code []byte) int {
+	var (
+		abi  ABI
+		seen = make(map[string]bool)
+		dict = signatures()
+	)
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		// PUSH1..PUSH32 carry immediates that are not opcodes
+		if op < opPUSH1 || op > opPUSH32 {
+			continue
+		}
+		size := int(op) - 0x5f
+		if op == opPUSH4 && pc+size < len(code) && dispatchComparison(code, pc+size+1) {
+			selector := hex.EncodeToString(code[pc+1 : pc+1+size])
+			if fun, exist := dict[selector]; exist && !seen[selector] {
+				seen[selector] = true
+				abi = append(abi, fun)
+			}
+		}
+		pc += size
+	}
+	if len(abi) == 0 {
+		return 0
+	}
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+	globalSynthesizedABIs[strings.ToLower(contract)] = &abi
+	return len(abi)
+}
+
+func readAbi(contract string) (*ABI, error) {
+	proxyLock.RLock()
+	synthesized, exist := globalSynthesizedABIs[contract]
+	proxyLock.RUnlock()
+	// fuzzing writes into the functions, so every caller gets its own copy
+	if exist {
+		return newAbi([]byte(synthesized.String()))
+	}
+	data, err := readFile(GlobalABIPath + contract + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return newAbi(data)
+}
+
+/*
+ * load the abi of contract
+ * the functions of the implementation behind a proxy are added to the ones of
+ * the proxy itself
+ */
+func loadAbi(contract string) (*ABI, error) {
+	own, err := readAbi(contract)
+	implementation := GetImplementation(contract)
+	if implementation == "" || implementation == strings.ToLower(contract) {
+		return own, err
+	}
+	impl, implErr := readAbi(implementation)
+	if implErr != nil {
+		return own, err
+	}
+	if err != nil {
+		return impl, nil
+	}
+
+	merged := append(ABI{}, *own...)
+	sigs := make(map[string]bool)
+	for _, fun := range merged {
+		if fun.Type == "function" {
+			sigs[fun.Sig()] = true
+		}
+	}
+	for _, fun := range *impl {
+		if fun.Type == "function" && !sigs[fun.Sig()] {
+			merged = append(merged, fun)
+		}
+	}
+	return &merged, nil
+}
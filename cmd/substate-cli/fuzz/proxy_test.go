@@ -0,0 +1,66 @@
+package fuzz
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSynthesizeABI(t *testing.T) {
+	// a Solidity dispatcher with a binary search pivot and a Vyper style
+	// comparison, followed by selectors that are not dispatched on
+	code := common.FromHex(strings.Join([]string{
+		"6080604052",               // MSTORE(0x40, 0x80)
+		"600436106100a057",         // JUMPI(fallback, LT(CALLDATASIZE, 4))
+		"60003560e01c",             // SHR(0xe0, CALLDATALOAD(0))
+		"806370a08231116100505780", // DUP1 PUSH4 balanceOf GT PUSH2 JUMPI DUP1
+		"63a9059cbb1461006057",     // PUSH4 transfer EQ PUSH2 JUMPI
+		"806318160ddd1461007057",   // DUP1 PUSH4 totalSupply EQ PUSH2 JUMPI
+		"8063deadbeef1461008057",   // DUP1 PUSH4 unknown EQ PUSH2 JUMPI
+		"5b806370a082311461009057", // JUMPDEST DUP1 PUSH4 balanceOf EQ PUSH2 JUMPI
+		"638da5cb5b6000511461",     // PUSH4 owner PUSH1 0 MLOAD EQ PUSH2
+		"00b057",                   // JUMPI
+		"5b600080fd",               // fallback: REVERT(0, 0)
+		// the selector of an external call to approve
+		"5b63095ea7b360e01b600052",
+		// pause pushed by PUSH32 rather than dispatched on
+		"7f638456cb591400000000000000000000000000000000000000000000000000000000",
+		"00",
+		// truncated PUSH4 of transferFrom
+		"6323b872",
+	}, ""))
+	contract := "0xsynthesized"
+	defer func() {
+		proxyLock.Lock()
+		delete(globalSynthesizedABIs, contract)
+		proxyLock.Unlock()
+	}()
+
+	want := []string{"balanceOf", "owner", "totalSupply", "transfer"}
+	if n := SynthesizeABI(contract, code); n != len(want) {
+		t.Errorf("SynthesizeABI found %d functions, want %d", n, len(want))
+	}
+	var names []string
+	proxyLock.RLock()
+	if abi, exist := globalSynthesizedABIs[contract]; exist {
+		for _, fun := range *abi {
+			names = append(names, fun.Name)
+		}
+	}
+	proxyLock.RUnlock()
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("synthesized functions %v, want %v", names, want)
+	}
+	if !HasABI(contract) {
+		t.Errorf("no abi for %s after synthesis", contract)
+	}
+
+	// code without dispatched selectors gets no abi
+	if n := SynthesizeABI("0xnothing", common.FromHex("0x63095ea7b360e01b00")); n != 0 || HasABI("0xnothing") {
+		t.Errorf("synthesized %d functions from an external call only", n)
+	}
+}
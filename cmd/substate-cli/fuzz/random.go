@@ -63,4 +63,5 @@ var (
 	stringRand  = NewFuzzerRand()
 	addressRand = NewFuzzerRand()
 	boolRand    = NewFuzzerRand()
+	valueRand   = NewFuzzerRand()
 )
@@ -0,0 +1,91 @@
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+	// panic codes emitted by solidity >= 0.8.0
+	panicReasons = map[uint64]string{
+		0x00: "generic panic",
+		0x01: "assert(false)",
+		0x11: "arithmetic underflow or overflow",
+		0x12: "division or modulo by zero",
+		0x21: "enum overflow",
+		0x22: "invalid encoded storage byte array accessed",
+		0x31: "out-of-bounds array access; popping on an empty array",
+		0x32: "out-of-bounds access of an array or bytesN",
+		0x41: "out of memory",
+		0x51: "uninitialized function",
+	}
+
+	errorABIs     = make(map[string]*abi.ABI)
+	errorABIsLock sync.Mutex
+)
+
+// loadErrorABI parses <GlobalABIPath>/<contract>.json with the full ABI parser,
+// which unlike newAbi also understands error definitions
+func loadErrorABI(contract string) *abi.ABI {
+	errorABIsLock.Lock()
+	defer errorABIsLock.Unlock()
+
+	if parsed, exist := errorABIs[contract]; exist {
+		return parsed
+	}
+	var parsed *abi.ABI
+	if data, err := readFile(GlobalABIPath + contract + ".json"); err == nil {
+		if contractABI, err := abi.JSON(bytes.NewReader(data)); err == nil {
+			parsed = &contractABI
+		}
+	}
+	errorABIs[contract] = parsed
+	return parsed
+}
+
+/*
+ * decode revert data into a readable reason
+ * Error(string) and Panic(uint256) are decoded directly, custom errors are
+ * looked up in the ABIs of the given contracts (in order)
+ */
+func DecodeRevert(contracts []string, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return fmt.Sprintf("Error(%q)", reason)
+	}
+	if len(data) == 4+32 && bytes.Equal(data[:4], panicSelector) {
+		code := new(big.Int).SetBytes(data[4:])
+		if reason, exist := panicReasons[code.Uint64()]; exist && code.IsUint64() {
+			return fmt.Sprintf("Panic(0x%x): %s", code, reason)
+		}
+		return fmt.Sprintf("Panic(0x%x)", code)
+	}
+	if len(data) >= 4 {
+		for _, contract := range contracts {
+			contractABI := loadErrorABI(strings.ToLower(contract))
+			if contractABI == nil {
+				continue
+			}
+			for _, abiError := range contractABI.Errors {
+				if !bytes.Equal(data[:4], abiError.ID[:4]) {
+					continue
+				}
+				if args, err := abiError.Unpack(data); err == nil {
+					return fmt.Sprintf("%s%v", abiError.Name, args)
+				}
+			}
+		}
+	}
+	return "0x" + common.Bytes2Hex(data)
+}
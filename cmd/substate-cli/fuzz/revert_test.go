@@ -0,0 +1,66 @@
+package fuzz
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// encodeCall returns the selector of sig followed by the encoded args
+func encodeCall(t *testing.T, sig string, types []string, args ...interface{}) []byte {
+	var arguments abi.Arguments
+	for _, typ := range types {
+		abiType, err := abi.NewType(typ, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arguments = append(arguments, abi.Argument{Type: abiType})
+	}
+	packed, err := arguments.Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(crypto.Keccak256([]byte(sig))[:4], packed...)
+}
+
+func TestDecodeRevert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revert-abi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	errorABI := `[{"type":"error","name":"Unauthorized","inputs":[{"name":"caller","type":"address"}]}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "0xcontract.json"), []byte(errorABI), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { GlobalABIPath = path }(GlobalABIPath)
+	GlobalABIPath = dir + "/"
+
+	caller := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tests := []struct {
+		name      string
+		contracts []string
+		data      []byte
+		want      string
+	}{
+		{"no data", nil, nil, ""},
+		{"error string", nil, encodeCall(t, "Error(string)", []string{"string"}, "not owner"), `Error("not owner")`},
+		{"known panic", nil, encodeCall(t, "Panic(uint256)", []string{"uint256"}, big.NewInt(0x11)), "Panic(0x11): arithmetic underflow or overflow"},
+		{"unknown panic", nil, encodeCall(t, "Panic(uint256)", []string{"uint256"}, big.NewInt(0x99)), "Panic(0x99)"},
+		{"custom error", []string{"0xContract"}, encodeCall(t, "Unauthorized(address)", []string{"address"}, caller), "Unauthorized[" + caller.Hex() + "]"},
+		{"custom error without abi", []string{"0xother"}, common.FromHex("0x82b42900"), "0x82b42900"},
+		{"unknown selector", []string{"0xcontract"}, common.FromHex("0x12345678"), "0x12345678"},
+		{"short data", nil, []byte{0x01}, "0x01"},
+	}
+	for _, tt := range tests {
+		if got := DecodeRevert(tt.contracts, tt.data); got != tt.want {
+			t.Errorf("%s: DecodeRevert = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package fuzz
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// names of functions restricted to privileged accounts by the common access
+// control libraries; setters in general are not, e.g. setApprovalForAll
+var privilegedFunctionNames = map[string]bool{
+	"pause": true, "unpause": true,
+	"upgradeto": true, "upgradetoandcall": true, "changeadmin": true,
+	"setpendingadmin": true, "acceptadmin": true, "setadmin": true,
+	"transferownership": true, "acceptownership": true, "renounceownership": true,
+	"setowner": true, "changeowner": true,
+	"grantrole": true, "revokerole": true,
+}
+
+// name prefixes of the initializer and setter functions targeted by
+// AdminBuilder, which an attacker may call before the owner does
+var adminFunctionPrefixes = []string{
+	"set", "pause", "unpause", "upgrade", "initialize",
+	"transferownership", "acceptownership", "renounceownership",
+	"grantrole", "revokerole", "change", "enable", "disable",
+	"configure", "whitelist", "blacklist", "sweep", "rescue", "emergency",
+}
+
+/*
+ * check whether data calls an administrative function in the abi of contract
+ * a function is administrative if it modifies state and is one of the
+ * ownership, pausing, upgrade and role functions of privilegedFunctionNames
+ */
+func IsAdminCall(contract string, data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	abi, err := loadAbi(contract)
+	if err != nil {
+		return false
+	}
+	for _, fun := range ([]*Function)(*abi) {
+		if fun.Type != "function" ||
+			fun.Constant == true ||
+			fun.Statemutability == "pure" ||
+			fun.Statemutability == "view" {
+			continue
+		}
+		if !bytes.Equal(crypto.Keccak256([]byte(fun.Sig()))[:4], data[:4]) {
+			continue
+		}
+		return privilegedFunctionNames[strings.ToLower(fun.Name)]
+	}
+	return false
+}
+
+func isAdminFunction(fun *Function) bool {
+	name := strings.ToLower(fun.Name)
+	for _, prefix := range adminFunctionPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package fuzz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestIsAdminCall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "role-abi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenABI := `[
+		{"type":"function","name":"transferOwnership","inputs":[{"name":"owner","type":"address"}]},
+		{"type":"function","name":"pause","inputs":[]},
+		{"type":"function","name":"grantRole","inputs":[{"name":"role","type":"bytes32"},{"name":"account","type":"address"}]},
+		{"type":"function","name":"setApprovalForAll","inputs":[{"name":"operator","type":"address"},{"name":"approved","type":"bool"}]},
+		{"type":"function","name":"enableTrading","inputs":[]},
+		{"type":"function","name":"owner","inputs":[],"outputs":[{"name":"","type":"address"}],"stateMutability":"view"},
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}]}
+	]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "0xtoken.json"), []byte(tokenABI), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { GlobalABIPath = path }(GlobalABIPath)
+	GlobalABIPath = dir + "/"
+
+	selector := func(sig string) []byte { return crypto.Keccak256([]byte(sig))[:4] }
+	tests := []struct {
+		name     string
+		contract string
+		data     []byte
+		want     bool
+	}{
+		{"transferOwnership", "0xtoken", append(selector("transferOwnership(address)"), make([]byte, 32)...), true},
+		{"pause", "0xtoken", selector("pause()"), true},
+		{"grantRole", "0xtoken", selector("grantRole(bytes32,address)"), true},
+		{"setApprovalForAll", "0xtoken", selector("setApprovalForAll(address,bool)"), false},
+		{"enableTrading", "0xtoken", selector("enableTrading()"), false},
+		{"view function", "0xtoken", selector("owner()"), false},
+		{"user function", "0xtoken", selector("transfer(address,uint256)"), false},
+		{"unknown selector", "0xtoken", common.FromHex("0x12345678"), false},
+		{"short data", "0xtoken", []byte{0x01}, false},
+		{"no abi", "0xother", selector("pause()"), false},
+	}
+	for _, tt := range tests {
+		if got := IsAdminCall(tt.contract, tt.data); got != tt.want {
+			t.Errorf("%s: IsAdminCall = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package fuzz
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	abi_gen "github.com/ethereum/go-ethereum/cmd/substate-cli/abi"
+)
+
+// splitMsg splits msgString ("sig" or "sig:[args]") into its signature, the
+// types of its parameters and its decoded arguments
+func splitMsg(msgString string) (string, []string, []interface{}, bool) {
+	parts := strings.SplitN(msgString, ":", 2)
+	sig := parts[0]
+	start, end := strings.Index(sig, "("), strings.LastIndex(sig, ")")
+	if len(parts) != 2 || start < 0 || end < start {
+		return sig, nil, nil, false
+	}
+	// tuples are not generated by the fuzzer
+	params := sig[start+1 : end]
+	if strings.Contains(params, "(") {
+		return sig, nil, nil, false
+	}
+	types := strings.Split(params, ",")
+
+	var values []interface{}
+	decoder := json.NewDecoder(strings.NewReader(parts[1]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil || len(values) != len(types) {
+		return sig, nil, nil, false
+	}
+	return sig, types, values, true
+}
+
+// joinArgs encodes arguments as generated by IOput.fuzz
+func joinArgs(values []interface{}) string {
+	var args []string
+	for _, value := range values {
+		args = append(args, stringify(value))
+	}
+	return strings.Join(args, ",")
+}
+
+func joinMsg(sig string, values []interface{}) string {
+	return sig + ":[" + joinArgs(values) + "]"
+}
+
+// typeBits returns the size of uintN/intN types
+func typeBits(typ string, prefix string) uint {
+	if bits, err := strconv.Atoi(strings.TrimPrefix(typ, prefix)); err == nil {
+		return uint(bits)
+	}
+	return 256
+}
+
+/*
+ * simpler values of a numeric argument
+ * boundary values (zero, one, the maximum of the type) are only replaced by
+ * smaller boundaries; other values are replaced by boundaries or halved
+ */
+func shrinkNumber(typ string, value interface{}) []interface{} {
+	v := toBig(value)
+	if v.Sign() < 0 {
+		return []interface{}{hexUint(new(big.Int))}
+	}
+	one := big.NewInt(1)
+	boundaries := []*big.Int{new(big.Int), one}
+	if strings.HasPrefix(typ, "uint") {
+		boundaries = append(boundaries, new(big.Int).Sub(new(big.Int).Lsh(one, typeBits(typ, "uint")), one))
+	}
+	boundary := false
+	for _, b := range boundaries {
+		boundary = boundary || b.Cmp(v) == 0
+	}
+
+	var result []interface{}
+	for _, b := range boundaries {
+		if b.Cmp(v) < 0 || (!boundary && b.Cmp(v) != 0) {
+			result = append(result, hexUint(b))
+		}
+	}
+	if !boundary && v.Cmp(big.NewInt(3)) > 0 {
+		result = append(result, hexUint(new(big.Int).Rsh(v, 1)))
+	}
+	return result
+}
+
+/*
+ * simpler values of an address argument
+ * actors are ordered from the simplest one; an address is only replaced by
+ * actors before it
+ */
+func shrinkAddress(value interface{}, actors []string) []interface{} {
+	current := strings.ToLower(toString(value))
+	var result []interface{}
+	for _, actor := range actors {
+		actor = strings.ToLower(actor)
+		if actor == current {
+			break
+		}
+		result = append(result, actor)
+	}
+	return result
+}
+
+// shrinkValue returns the simplifications of one argument of type typ
+func shrinkValue(typ string, value interface{}, actors []string) []interface{} {
+	switch {
+	case strings.HasSuffix(typ, "]"):
+		// arrays are shortened, fixed-size ones are left as is
+		elems, ok := value.([]interface{})
+		if !ok || !strings.HasSuffix(typ, "[]") || len(elems) == 0 {
+			return nil
+		}
+		result := []interface{}{[]interface{}{}}
+		if len(elems) > 1 {
+			result = append(result, elems[:len(elems)/2])
+		}
+		return result
+	case typ == "address":
+		return shrinkAddress(value, actors)
+	case typ == "bool":
+		if value == true {
+			return []interface{}{false}
+		}
+	case strings.HasPrefix(typ, "uint") || strings.HasPrefix(typ, "int"):
+		return shrinkNumber(typ, value)
+	case typ == "string":
+		if str := toString(value); str != "" {
+			return []interface{}{"", str[:len(str)/2]}
+		}
+	case typ == "bytes":
+		if data := strings.TrimPrefix(toString(value), "0x"); data != "" {
+			return []interface{}{"0x", "0x" + data[:len(data)/4*2]}
+		}
+	case strings.HasPrefix(typ, "bytes"):
+		if data := strings.TrimPrefix(toString(value), "0x"); strings.Trim(data, "0") != "" {
+			return []interface{}{"0x" + strings.Repeat("0", len(data))}
+		}
+	}
+	return nil
+}
+
+/*
+ * generate the simplifications of the call msgString ("sig:[args]")
+ * each one changes a single argument: numbers towards zero and boundary
+ * values, addresses to actors, bools to false, bytes, strings and dynamic
+ * arrays to shorter ones
+ * return the simplified msg strings and their hex encoding, simplest first
+ */
+func ShrinkArguments(msgString string, actors []string) ([]string, []string) {
+	var (
+		msgStrings []string
+		msgResults []string
+	)
+	sig, types, values, ok := splitMsg(msgString)
+	if !ok {
+		return nil, nil
+	}
+	for i, typ := range types {
+		for _, candidate := range shrinkValue(typ, values[i], actors) {
+			shrunk := append([]interface{}{}, values...)
+			shrunk[i] = candidate
+			temp := joinMsg(sig, shrunk)
+			if temp == msgString {
+				continue
+			}
+			if hex_str, err := abi_gen.Parse_GenMsg(temp); err == nil {
+				msgStrings = append(msgStrings, temp)
+				msgResults = append(msgResults, hex_str)
+			}
+		}
+	}
+	return msgStrings, msgResults
+}
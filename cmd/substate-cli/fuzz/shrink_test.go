@@ -0,0 +1,98 @@
+package fuzz
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShrinkValue(t *testing.T) {
+	actors := []string{"0x00000000000000000000000000000000000000aa", "0x00000000000000000000000000000000000000bb"}
+	tests := []struct {
+		typ   string
+		value interface{}
+		want  []interface{}
+	}{
+		{"uint256", "0x64", []interface{}{"0x0", "0x1", "0x" + strings.Repeat("f", 64), "0x32"}},
+		{"uint8", "0x64", []interface{}{"0x0", "0x1", "0xff", "0x32"}},
+		{"uint8", "0x3", []interface{}{"0x0", "0x1", "0xff"}},
+		{"uint8", "0xff", []interface{}{"0x0", "0x1"}},
+		{"uint8", "0x1", []interface{}{"0x0"}},
+		{"uint8", "0x0", nil},
+		{"int64", "0x64", []interface{}{"0x0", "0x1", "0x32"}},
+		{"int64", "-5", []interface{}{"0x0"}},
+		{"address", "0x00000000000000000000000000000000000000CC", []interface{}{actors[0], actors[1]}},
+		{"address", actors[1], []interface{}{actors[0]}},
+		{"address", actors[0], nil},
+		{"bool", true, []interface{}{false}},
+		{"bool", false, nil},
+		{"string", "abcd", []interface{}{"", "ab"}},
+		{"string", "", nil},
+		{"bytes", "0x01020304", []interface{}{"0x", "0x0102"}},
+		{"bytes", "0x", nil},
+		{"bytes32", "0x01" + strings.Repeat("0", 62), []interface{}{"0x" + strings.Repeat("0", 64)}},
+		{"bytes32", "0x" + strings.Repeat("0", 64), nil},
+		{"uint256[]", []interface{}{"0x1", "0x2", "0x3"}, []interface{}{[]interface{}{}, []interface{}{"0x1"}}},
+		{"uint256[]", []interface{}{"0x1"}, []interface{}{[]interface{}{}}},
+		{"uint256[2]", []interface{}{"0x1", "0x2"}, nil},
+	}
+	for _, tt := range tests {
+		if got := shrinkValue(tt.typ, tt.value, actors); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shrinkValue(%s, %v) = %v, want %v", tt.typ, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestShrinkArguments(t *testing.T) {
+	actors := []string{"0x00000000000000000000000000000000000000aa"}
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{
+			msg: `f(uint8,bool):["0x5",true]`,
+			want: []string{
+				`f(uint8,bool):["0x0",true]`,
+				`f(uint8,bool):["0x1",true]`,
+				`f(uint8,bool):["0xff",true]`,
+				`f(uint8,bool):["0x2",true]`,
+				`f(uint8,bool):["0x5",false]`,
+			},
+		},
+		{msg: `f(uint8,bool):["0x0",false]`},
+		// no arguments, or tuples
+		{msg: `f()`},
+		{msg: `f((uint8,bool)):[["0x5",true]]`},
+	}
+	for _, tt := range tests {
+		got, results := ShrinkArguments(tt.msg, actors)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ShrinkArguments(%s) = %v, want %v", tt.msg, got, tt.want)
+		}
+		if len(results) != len(got) {
+			t.Errorf("ShrinkArguments(%s): %d encodings of %d messages", tt.msg, len(results), len(got))
+		}
+	}
+}
+
+// TestShrinkArgumentsFixedPoint checks that always taking a simplification
+// ends on the simplest message within a bounded number of steps
+func TestShrinkArgumentsFixedPoint(t *testing.T) {
+	actors := []string{"0x00000000000000000000000000000000000000aa"}
+	msg := `f(uint256,address,bool,bytes,string,uint16[]):["0x123456789","0x00000000000000000000000000000000000000cc",true,"0x0102030405060708","hello",["0x1","0x2","0x3"]]`
+	want := `f(uint256,address,bool,bytes,string,uint16[]):["0x0","` + actors[0] + `",false,"0x","",[]]`
+
+	for steps := 0; ; steps++ {
+		if steps > 100 {
+			t.Fatalf("no fixed point after %d steps, at %s", steps, msg)
+		}
+		msgs, _ := ShrinkArguments(msg, actors)
+		if len(msgs) == 0 {
+			break
+		}
+		msg = msgs[len(msgs)-1]
+	}
+	if msg != want {
+		t.Errorf("fixed point %s, want %s", msg, want)
+	}
+}
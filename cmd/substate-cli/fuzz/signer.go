@@ -0,0 +1,186 @@
+package fuzz
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// number of generated signing identities
+const signerCount = 4
+
+var (
+	signerKeys     []*ecdsa.PrivateKey
+	signerKeysOnce sync.Once
+
+	// DOMAIN_SEPARATOR() of inner contracts, in lowercase hex
+	globalDomainSeparators = make(map[string]common.Hash)
+	domainSeparatorLock    sync.RWMutex
+
+	eip2612Typehash = crypto.Keccak256Hash([]byte("Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)"))
+	daiTypehash     = crypto.Keccak256Hash([]byte("Permit(address holder,address spender,uint256 nonce,uint256 expiry,bool allowed)"))
+)
+
+/*
+ * the private keys owned by the fuzzer
+ * keys are derived from fixed seeds, so findings can be replayed
+ */
+func Signers() []*ecdsa.PrivateKey {
+	signerKeysOnce.Do(func() {
+		for i := 0; i < signerCount; i++ {
+			key, err := crypto.ToECDSA(crypto.Keccak256([]byte("substate-cli signer " + strconv.Itoa(i))))
+			if err != nil {
+				panic(err)
+			}
+			signerKeys = append(signerKeys, key)
+		}
+	})
+	return signerKeys
+}
+
+// the addresses of Signers in lowercase hex
+func SignerAddresses() []string {
+	var addrs []string
+	for _, key := range Signers() {
+		addrs = append(addrs, strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).String()))
+	}
+	return addrs
+}
+
+func SetDomainSeparator(contract string, separator common.Hash) {
+	domainSeparatorLock.Lock()
+	defer domainSeparatorLock.Unlock()
+	globalDomainSeparators[strings.ToLower(contract)] = separator
+}
+
+func getDomainSeparator(contract string) (common.Hash, bool) {
+	domainSeparatorLock.RLock()
+	defer domainSeparatorLock.RUnlock()
+	separator, exist := globalDomainSeparators[strings.ToLower(contract)]
+	return separator, exist
+}
+
+func inputTypes(fun *Function) string {
+	var types []string
+	for _, elem := range fun.Inputs {
+		types = append(types, elem.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+func word(value interface{}) []byte {
+	switch v := value.(type) {
+	case common.Address:
+		return common.LeftPadBytes(v.Bytes(), 32)
+	case common.Hash:
+		return v.Bytes()
+	case *big.Int:
+		return math.U256Bytes(new(big.Int).Set(v))
+	case bool:
+		if v {
+			return math.U256Bytes(big.NewInt(1))
+		}
+		return make([]byte, 32)
+	}
+	return make([]byte, 32)
+}
+
+// typedDataHash is the EIP-712 digest of the struct encoded by fields
+func typedDataHash(domain common.Hash, fields ...interface{}) []byte {
+	var encoded []byte
+	for _, field := range fields {
+		encoded = append(encoded, word(field)...)
+	}
+	return crypto.Keccak256([]byte("\x19\x01"), domain.Bytes(), crypto.Keccak256(encoded))
+}
+
+// sign returns v, r and s of the signature of digest by key
+func sign(digest []byte, key *ecdsa.PrivateKey) (uint8, common.Hash, common.Hash) {
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		return 0, common.Hash{}, common.Hash{}
+	}
+	return sig[64] + 27, common.BytesToHash(sig[:32]), common.BytesToHash(sig[32:64])
+}
+
+// argument encodings understood by Parse_GenMsg
+func hexAddress(addr common.Address) string { return strings.ToLower(addr.String()) }
+func hexUint(v *big.Int) string             { return "0x" + v.Text(16) }
+
+/*
+ * replace the signature arguments of a call to fun of contract by a valid
+ * signature of one of the Signers
+ * EIP-2612 and DAI permits are signed over their typed data; other signed
+ * structs have a type hash that cannot be derived from the abi and keep their
+ * random arguments
+ */
+func signArguments(contract string, fun *Function, args string) string {
+	domain, exist := getDomainSeparator(contract)
+	if !exist {
+		return args
+	}
+	var values []interface{}
+	decoder := json.NewDecoder(strings.NewReader("[" + args + "]"))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil || len(values) != len(fun.Inputs) {
+		return args
+	}
+
+	signers := Signers()
+	key := signers[randintOne(len(signers), 0)]
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	maxUint := math.MaxBig256
+
+	switch {
+	case fun.Name == "permit" && inputTypes(fun) == "address,address,uint256,uint256,uint8,bytes32,bytes32":
+		spender := common.HexToAddress(toString(values[1]))
+		value := toBig(values[2])
+		v, r, s := sign(typedDataHash(domain, eip2612Typehash, signer, spender, value, new(big.Int), maxUint), key)
+		values[0], values[3] = hexAddress(signer), hexUint(maxUint)
+		values[4], values[5], values[6] = hexUint(big.NewInt(int64(v))), r.Hex(), s.Hex()
+
+	case fun.Name == "permit" && inputTypes(fun) == "address,address,uint256,uint256,bool,uint8,bytes32,bytes32":
+		spender := common.HexToAddress(toString(values[1]))
+		v, r, s := sign(typedDataHash(domain, daiTypehash, signer, spender, new(big.Int), new(big.Int), true), key)
+		values[0], values[2], values[3], values[4] = hexAddress(signer), hexUint(new(big.Int)), hexUint(new(big.Int)), true
+		values[5], values[6], values[7] = hexUint(big.NewInt(int64(v))), r.Hex(), s.Hex()
+
+	default:
+		return args
+	}
+
+	var buf bytes.Buffer
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(stringify(value))
+	}
+	return buf.String()
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+func toBig(value interface{}) *big.Int {
+	str := toString(value)
+	if v, ok := new(big.Int).SetString(str, 0); ok {
+		return v
+	}
+	return new(big.Int)
+}
@@ -0,0 +1,142 @@
+package fuzz
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// permitDigest is the EIP-712 digest of the struct typ, abi encoded by
+// go-ethereum rather than by typedDataHash
+func permitDigest(t *testing.T, domain common.Hash, typ string, types []string, fields ...interface{}) []byte {
+	arguments := abi.Arguments{{Type: newAbiType(t, "bytes32")}}
+	for _, typ := range types {
+		arguments = append(arguments, abi.Argument{Type: newAbiType(t, typ)})
+	}
+	packed, err := arguments.Pack(append([]interface{}{crypto.Keccak256Hash([]byte(typ))}, fields...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.Keccak256([]byte("\x19\x01"), domain.Bytes(), crypto.Keccak256(packed))
+}
+
+func newAbiType(t *testing.T, typ string) abi.Type {
+	abiType, err := abi.NewType(typ, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abiType
+}
+
+func newTestFunction(name string, types ...string) *Function {
+	fun := &Function{Name: name, Type: "function"}
+	for _, typ := range types {
+		fun.Inputs = append(fun.Inputs, Element{Type: typ})
+	}
+	return fun
+}
+
+func TestSignArguments(t *testing.T) {
+	var (
+		contract = "0x000000000000000000000000000000000000cafe"
+		domain   = crypto.Keccak256Hash([]byte("domain"))
+		spender  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		zero     = `"` + common.Hash{}.Hex() + `"`
+		random   = `"0x00000000000000000000000000000000000000aa","0x00000000000000000000000000000000000000bb"`
+	)
+	SetDomainSeparator(contract, domain)
+
+	tests := []struct {
+		name     string
+		contract string
+		fun      *Function
+		args     string
+		vAt      int // position of v, 0 if the arguments stay unsigned
+		// digest the signature of the signed values must be over
+		digest func(values []interface{}) []byte
+	}{
+		{
+			name:     "EIP-2612 permit",
+			contract: contract,
+			fun:      newTestFunction("permit", "address", "address", "uint256", "uint256", "uint8", "bytes32", "bytes32"),
+			args:     random + `,"0x64","0x1",0,` + zero + `,` + zero,
+			vAt:      4,
+			digest: func(values []interface{}) []byte {
+				return permitDigest(t, domain, "Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)",
+					[]string{"address", "address", "uint256", "uint256", "uint256"},
+					common.HexToAddress(toString(values[0])), spender, big.NewInt(100), new(big.Int), math.MaxBig256)
+			},
+		},
+		{
+			name:     "DAI permit",
+			contract: contract,
+			fun:      newTestFunction("permit", "address", "address", "uint256", "uint256", "bool", "uint8", "bytes32", "bytes32"),
+			args:     random + `,"0x5","0x7",false,0,` + zero + `,` + zero,
+			vAt:      5,
+			digest: func(values []interface{}) []byte {
+				return permitDigest(t, domain, "Permit(address holder,address spender,uint256 nonce,uint256 expiry,bool allowed)",
+					[]string{"address", "address", "uint256", "uint256", "bool"},
+					common.HexToAddress(toString(values[0])), spender, new(big.Int), new(big.Int), true)
+			},
+		},
+		{
+			name:     "typed data of unknown type hash",
+			contract: contract,
+			fun:      newTestFunction("delegateBySig", "address", "address", "uint256", "uint8", "bytes32", "bytes32"),
+			args:     random + `,"0x2",0,` + zero + `,` + zero,
+		},
+		{
+			name:     "bytes signature",
+			contract: contract,
+			fun:      newTestFunction("execute", "address", "address", "bytes"),
+			args:     random + `,"0x"`,
+		},
+		{
+			name:     "permit without domain separator",
+			contract: "0x000000000000000000000000000000000000beef",
+			fun:      newTestFunction("permit", "address", "address", "uint256", "uint256", "uint8", "bytes32", "bytes32"),
+			args:     random + `,"0x64","0x1",0,` + zero + `,` + zero,
+		},
+	}
+	for _, tt := range tests {
+		got := signArguments(tt.contract, tt.fun, tt.args)
+		if tt.vAt == 0 {
+			if got != tt.args {
+				t.Errorf("%s: arguments %s, want them unchanged", tt.name, got)
+			}
+			continue
+		}
+		var values []interface{}
+		decoder := json.NewDecoder(strings.NewReader("[" + got + "]"))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil || len(values) != len(tt.fun.Inputs) {
+			t.Errorf("%s: invalid signed arguments %s: %v", tt.name, got, err)
+			continue
+		}
+		owner := common.HexToAddress(toString(values[0]))
+		digest := tt.digest(values)
+		sig := append(common.HexToHash(toString(values[tt.vAt+1])).Bytes(), common.HexToHash(toString(values[tt.vAt+2])).Bytes()...)
+		sig = append(sig, byte(toBig(values[tt.vAt]).Uint64()-27))
+		pub, err := crypto.SigToPub(digest, sig)
+		if err != nil {
+			t.Errorf("%s: cannot recover the signer: %v", tt.name, err)
+			continue
+		}
+		if signer := crypto.PubkeyToAddress(*pub); signer != owner {
+			t.Errorf("%s: recovered signer %s, want the owner %s", tt.name, signer.Hex(), owner.Hex())
+		}
+		found := false
+		for _, addr := range SignerAddresses() {
+			found = found || addr == strings.ToLower(owner.Hex())
+		}
+		if !found {
+			t.Errorf("%s: owner %s is not a fuzzer signer", tt.name, owner.Hex())
+		}
+	}
+}
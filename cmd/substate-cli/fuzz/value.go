@@ -0,0 +1,86 @@
+package fuzz
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	oneEther = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	oneGwei  = big.NewInt(1000000000)
+
+	// GlobalValueSeed is appended to by the replay workers
+	valueSeedLock sync.RWMutex
+)
+
+/*
+ * record the msg.value of a historical transaction as a seed
+ * zero values are not recorded, since non-payable calls always carry them
+ */
+func UpdateValueSeed(value *big.Int, block uint64) {
+	if value == nil || value.Sign() == 0 {
+		return
+	}
+	valueSeedLock.Lock()
+	GlobalValueSeed = append(GlobalValueSeed, SeedItem{"0x" + value.Text(16), block})
+	valueSeedLock.Unlock()
+}
+
+/*
+ * check whether the function called by msgString ("sig" or "sig:[args]") is
+ * payable in the abi of contract
+ */
+func IsPayable(contract string, msgString string) bool {
+	sig := strings.SplitN(msgString, ":", 2)[0]
+
+	abi, err := loadAbi(contract)
+	if err != nil {
+		return false
+	}
+	for _, fun := range ([]*Function)(*abi) {
+		if fun.Type == "function" && fun.Sig() == sig {
+			return fun.Payable || fun.Statemutability == "payable"
+		}
+	}
+	return false
+}
+
+/*
+ * generate msg.value for a call to contract
+ * non-payable functions get zero, payable functions get one of the historical
+ * msg.value seeds before timestamp or a boundary amount relative to balance
+ */
+func PayableValue(contract string, msgString string, timestamp uint64, balance *big.Int) *big.Int {
+	if !IsPayable(contract, msgString) {
+		return new(big.Int)
+	}
+
+	var result []interface{}
+	valueSeedLock.RLock()
+	for _, seedItem := range GlobalValueSeed {
+		if seedItem.Timestamp < timestamp {
+			if v, ok := new(big.Int).SetString(seedItem.Value, 0); ok {
+				result = append(result, v)
+			}
+		}
+	}
+	valueSeedLock.RUnlock()
+	result = append(result,
+		new(big.Int),
+		big.NewInt(1),
+		new(big.Int).Set(oneGwei),
+		new(big.Int).Set(oneEther))
+	if balance != nil && balance.Sign() > 0 {
+		result = append(result,
+			new(big.Int).Set(balance),
+			new(big.Int).Sub(balance, big.NewInt(1)),
+			new(big.Int).Rsh(balance, 1))
+	}
+
+	ret, err := valueRand.RandomSelect(result)
+	if err != nil || ret == nil {
+		return new(big.Int)
+	}
+	return ret.(*big.Int)
+}
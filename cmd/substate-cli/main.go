@@ -19,6 +19,17 @@ var (
 			db.UpgradeCommand,
 			db.CloneCommand,
 			db.CompactCommand,
+			db.StatsCommand,
+			db.DumpCommand,
+			db.LsCommand,
+			db.VerifyCommand,
+			db.ExportCommand,
+			db.ImportCommand,
+			db.MergeCommand,
+			db.PruneCommand,
+			db.GcCodeCommand,
+			db.UpgradeEncodingCommand,
+			db.MetadataCommand,
 		},
 	}
 )
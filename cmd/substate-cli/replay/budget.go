@@ -0,0 +1,182 @@
+package replay
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	// deadline of the whole run set by --total-time, zero if unlimited
+	runDeadline time.Time
+
+	// work skipped because of the budgets, reported in the run summary
+	skippedTxs  int64 // transactions not checked after --total-time
+	skippedMsgs int64 // generated messages dropped by --max-msgs-per-tx
+	expiredMsgs int64 // scheduled messages not replayed after --time-per-tx
+	// relations not run after --time-per-tx, by relation
+	skippedRelations     = make(map[string]int64)
+	skippedRelationsLock sync.Mutex
+
+	// number of messages scheduled for each function over the run
+	functionTrials     = make(map[string]int)
+	functionTrialsLock sync.Mutex
+)
+
+// txBudget bounds the work spent on the additional messages of one
+// transaction
+type txBudget struct {
+	maxMsgs  int
+	deadline time.Time
+	skipped  []string // relations skipped once the deadline passed
+}
+
+// newTxBudget starts the budget of a transaction; its deadline is the end of
+// --time-per-tx or of --total-time, whichever comes first
+func newTxBudget(taskPool *research.SubstateTaskPool) *txBudget {
+	budget := &txBudget{maxMsgs: taskPool.MaxMsgsPerTx}
+	if taskPool.TimePerTx > 0 {
+		budget.deadline = time.Now().Add(taskPool.TimePerTx)
+	}
+	if !runDeadline.IsZero() && (budget.deadline.IsZero() || runDeadline.Before(budget.deadline)) {
+		budget.deadline = runDeadline
+	}
+	return budget
+}
+
+func (budget *txBudget) expired() bool {
+	return !budget.deadline.IsZero() && time.Now().After(budget.deadline)
+}
+
+// skipRelation reports whether relation must be skipped because the time
+// budget of the transaction is spent. Skipped relations are recorded on the
+// budget and counted for the run summary.
+func (budget *txBudget) skipRelation(relation string) bool {
+	if !budget.expired() {
+		return false
+	}
+	budget.skipped = append(budget.skipped, relation)
+	skippedRelationsLock.Lock()
+	skippedRelations[relation]++
+	skippedRelationsLock.Unlock()
+	return true
+}
+
+// skipMsgs reports whether the remaining scheduled messages must be skipped
+// because the time budget of the transaction is spent
+func (budget *txBudget) skipMsgs(remaining int) bool {
+	if !budget.expired() {
+		return false
+	}
+	atomic.AddInt64(&expiredMsgs, int64(remaining))
+	return true
+}
+
+// functionKey identifies the function called by a generated message
+func functionKey(addr string, ret string) string {
+	return strings.ToLower(addr) + ":" + strings.SplitN(ret, ":", 2)[0]
+}
+
+/*
+ * schedule selects at most maxMsgs of the generated messages and orders them
+ * by priority, so that the messages replayed first are the most useful ones
+ * when time runs out. Functions of the contract called by the transaction
+ * come first, then the functions whose messages reached the most new coverage
+ * per message scheduled, then the ones scheduled the least often in the run.
+ * Messages are taken round-robin over the functions, spreading the budget
+ * evenly between them.
+ */
+func (budget *txBudget) schedule(substate *research.Substate, addrs, msgs, rets []string) ([]string, []string, []string) {
+	var (
+		functions []string
+		byFunc    = make(map[string][]int)
+		target    string
+	)
+	if to := substate.Message.To; to != nil {
+		target = strings.ToLower(to.String())
+	}
+	functionNovelty := make(map[string]int)
+	for index := range msgs {
+		key := functionKey(addrs[index], rets[index])
+		if _, exist := byFunc[key]; !exist {
+			functions = append(functions, key)
+			functionNovelty[key] = fuzz.FunctionNovelty(addrs[index], rets[index])
+		}
+		byFunc[key] = append(byFunc[key], index)
+	}
+
+	functionTrialsLock.Lock()
+	defer functionTrialsLock.Unlock()
+	sort.SliceStable(functions, func(i, j int) bool {
+		iTarget := strings.HasPrefix(functions[i], target+":")
+		jTarget := strings.HasPrefix(functions[j], target+":")
+		if iTarget != jTarget {
+			return iTarget
+		}
+		// functions reaching new coverage per message come next
+		iYield := float64(functionNovelty[functions[i]]) / float64(functionTrials[functions[i]]+1)
+		jYield := float64(functionNovelty[functions[j]]) / float64(functionTrials[functions[j]]+1)
+		if iYield != jYield {
+			return iYield > jYield
+		}
+		return functionTrials[functions[i]] < functionTrials[functions[j]]
+	})
+
+	limit := len(msgs)
+	if budget.maxMsgs > 0 && budget.maxMsgs < limit {
+		limit = budget.maxMsgs
+	}
+	var selAddrs, selMsgs, selRets []string
+	for round := 0; len(selMsgs) < limit; round++ {
+		for _, key := range functions {
+			if round >= len(byFunc[key]) || len(selMsgs) >= limit {
+				continue
+			}
+			index := byFunc[key][round]
+			selAddrs = append(selAddrs, addrs[index])
+			selMsgs = append(selMsgs, msgs[index])
+			selRets = append(selRets, rets[index])
+			functionTrials[key]++
+		}
+	}
+	atomic.AddInt64(&skippedMsgs, int64(len(msgs)-len(selMsgs)))
+	return selAddrs, selMsgs, selRets
+}
+
+// skipTx reports whether a transaction must be skipped because the time
+// budget of the run is spent
+func skipTx() bool {
+	if runDeadline.IsZero() || time.Now().Before(runDeadline) {
+		return false
+	}
+	atomic.AddInt64(&skippedTxs, 1)
+	return true
+}
+
+// printBudgetSummary reports the work skipped because of the budgets
+func printBudgetSummary(taskPool *research.SubstateTaskPool) {
+	fmt.Printf("%s: budget: max msgs per tx = %v, time per tx = %v, total time = %v\n",
+		taskPool.Name, taskPool.MaxMsgsPerTx, taskPool.TimePerTx, taskPool.TotalTime)
+	fmt.Printf("%s: skipped #tx        = %v\n", taskPool.Name, atomic.LoadInt64(&skippedTxs))
+	skippedRelationsLock.Lock()
+	relations := make([]string, 0, len(skippedRelations))
+	total := int64(0)
+	for relation, skipped := range skippedRelations {
+		relations = append(relations, relation)
+		total += skipped
+	}
+	sort.Strings(relations)
+	fmt.Printf("%s: skipped #relation  = %v\n", taskPool.Name, total)
+	for _, relation := range relations {
+		fmt.Printf("%s:   %-16s = %v\n", taskPool.Name, relation, skippedRelations[relation])
+	}
+	skippedRelationsLock.Unlock()
+	fmt.Printf("%s: dropped #msg       = %v\n", taskPool.Name, atomic.LoadInt64(&skippedMsgs))
+	fmt.Printf("%s: expired #msg       = %v\n", taskPool.Name, atomic.LoadInt64(&expiredMsgs))
+}
@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestTxBudgetSchedule(t *testing.T) {
+	defer func(trials map[string]int) { functionTrials = trials }(functionTrials)
+
+	var (
+		target = "0x000000000000000000000000000000000000aaaa"
+		other  = "0x000000000000000000000000000000000000bbbb"
+		novel  = "0x000000000000000000000000000000000000cccc"
+		to     = common.HexToAddress(target)
+	)
+	// the messages of novel:f() reached new coverage earlier in the run
+	fuzz.RecordFeedback(novel, "f()", 4)
+	substate := &research.Substate{Message: &research.SubstateMessage{To: &to}}
+	addrs := []string{other, target, other, novel, target, other}
+	rets := []string{"f()", "g()", "f()", "f()", "h()", "g()"}
+	msgs := []string{"0", "1", "2", "3", "4", "5"}
+
+	tests := []struct {
+		name        string
+		maxMsgs     int
+		trials      map[string]int // trials of functions earlier in the run
+		want        []string
+		wantDropped int64
+	}{
+		{
+			// target functions, novel ones, then round-robin over the others
+			name: "priority and round-robin",
+			want: []string{"1", "4", "3", "0", "5", "2"},
+		},
+		{
+			name:        "max messages",
+			maxMsgs:     3,
+			want:        []string{"1", "4", "3"},
+			wantDropped: 3,
+		},
+		{
+			name:   "least tried function first",
+			trials: map[string]int{other + ":f()": 2},
+			want:   []string{"1", "4", "3", "5", "0", "2"},
+		},
+		{
+			name:   "least tried target function first",
+			trials: map[string]int{target + ":g()": 2},
+			want:   []string{"4", "1", "3", "0", "5", "2"},
+		},
+	}
+	for _, tt := range tests {
+		functionTrials = make(map[string]int)
+		for key, trials := range tt.trials {
+			functionTrials[key] = trials
+		}
+		dropped := atomic.LoadInt64(&skippedMsgs)
+		budget := &txBudget{maxMsgs: tt.maxMsgs}
+		gotAddrs, got, gotRets := budget.schedule(substate, addrs, msgs, rets)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: scheduled %v, want %v", tt.name, got, tt.want)
+		}
+		for i, msg := range got {
+			index := int(msg[0] - '0')
+			if gotAddrs[i] != addrs[index] || gotRets[i] != rets[index] {
+				t.Errorf("%s: message %s scheduled to %s %s", tt.name, msg, gotAddrs[i], gotRets[i])
+			}
+		}
+		if n := atomic.LoadInt64(&skippedMsgs) - dropped; n != tt.wantDropped {
+			t.Errorf("%s: %d messages dropped, want %d", tt.name, n, tt.wantDropped)
+		}
+		// every scheduled message counts as a trial of its function
+		scheduled := 0
+		for key, trials := range functionTrials {
+			scheduled += trials - tt.trials[key]
+		}
+		if scheduled != len(got) {
+			t.Errorf("%s: %d trials recorded for %d messages", tt.name, scheduled, len(got))
+		}
+	}
+}
+
+func TestTxBudgetSkip(t *testing.T) {
+	defer func(skipped map[string]int64) { skippedRelations = skipped }(skippedRelations)
+	skippedRelations = make(map[string]int64)
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     bool
+	}{
+		{"no deadline", time.Time{}, false},
+		{"before deadline", time.Now().Add(time.Hour), false},
+		{"after deadline", time.Now().Add(-time.Second), true},
+	}
+	for _, tt := range tests {
+		budget := &txBudget{deadline: tt.deadline}
+		expired := atomic.LoadInt64(&expiredMsgs)
+		if got := budget.skipMsgs(5); got != tt.want {
+			t.Errorf("%s: skipMsgs = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := budget.skipRelation("TOD"); got != tt.want {
+			t.Errorf("%s: skipRelation = %v, want %v", tt.name, got, tt.want)
+		}
+		budget.skipRelation("HOOK")
+
+		wantExpired, wantSkipped := int64(0), []string(nil)
+		if tt.want {
+			wantExpired, wantSkipped = 5, []string{"TOD", "HOOK"}
+		}
+		if n := atomic.LoadInt64(&expiredMsgs) - expired; n != wantExpired {
+			t.Errorf("%s: %d messages expired, want %d", tt.name, n, wantExpired)
+		}
+		if !reflect.DeepEqual(budget.skipped, wantSkipped) {
+			t.Errorf("%s: skipped relations %v, want %v", tt.name, budget.skipped, wantSkipped)
+		}
+	}
+	if want := map[string]int64{"TOD": 1, "HOOK": 1}; !reflect.DeepEqual(skippedRelations, want) {
+		t.Errorf("skipped relations of the run %v, want %v", skippedRelations, want)
+	}
+}
+
+func TestNewTxBudget(t *testing.T) {
+	defer func(deadline time.Time) { runDeadline = deadline }(runDeadline)
+
+	tests := []struct {
+		name         string
+		timePerTx    time.Duration
+		runDeadline  time.Duration // from now, zero if unlimited
+		wantDeadline time.Duration // from now, zero if none
+	}{
+		{"unlimited", 0, 0, 0},
+		{"time per tx", time.Hour, 0, time.Hour},
+		{"total time", 0, time.Minute, time.Minute},
+		{"total time first", time.Hour, time.Minute, time.Minute},
+		{"time per tx first", time.Minute, time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		now := time.Now()
+		runDeadline = time.Time{}
+		if tt.runDeadline > 0 {
+			runDeadline = now.Add(tt.runDeadline)
+		}
+		budget := newTxBudget(&research.SubstateTaskPool{MaxMsgsPerTx: 3, TimePerTx: tt.timePerTx})
+		if budget.maxMsgs != 3 {
+			t.Errorf("%s: max msgs %d, want 3", tt.name, budget.maxMsgs)
+		}
+		if tt.wantDeadline == 0 {
+			if !budget.deadline.IsZero() {
+				t.Errorf("%s: deadline %v, want none", tt.name, budget.deadline)
+			}
+			continue
+		}
+		if d := budget.deadline.Sub(now); d < tt.wantDeadline || d > tt.wantDeadline+time.Second {
+			t.Errorf("%s: deadline in %v, want %v", tt.name, d, tt.wantDeadline)
+		}
+	}
+}
+
+func TestSkipTx(t *testing.T) {
+	defer func(deadline time.Time) { runDeadline = deadline }(runDeadline)
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     bool
+	}{
+		{"unlimited", time.Time{}, false},
+		{"before deadline", time.Now().Add(time.Hour), false},
+		{"after deadline", time.Now().Add(-time.Second), true},
+	}
+	for _, tt := range tests {
+		runDeadline = tt.deadline
+		skipped := atomic.LoadInt64(&skippedTxs)
+		if got := skipTx(); got != tt.want {
+			t.Errorf("%s: skipTx = %v, want %v", tt.name, got, tt.want)
+		}
+		wantSkipped := int64(0)
+		if tt.want {
+			wantSkipped = 1
+		}
+		if n := atomic.LoadInt64(&skippedTxs) - skipped; n != wantSkipped {
+			t.Errorf("%s: %d transactions skipped, want %d", tt.name, n, wantSkipped)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package replay
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// sloadTracer records the storage slots of contract read by SLOAD
+type sloadTracer struct {
+	contract common.Address
+	slots    []common.Hash
+}
+
+func (t *sloadTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *sloadTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	// the storage of a proxy is read by the code it delegates to
+	if op == vm.SLOAD && scope.Contract.Address() == t.contract {
+		t.slots = append(t.slots, common.Hash(scope.Stack.Back(0).Bytes32()))
+	}
+}
+
+func (t *sloadTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *sloadTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *sloadTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *sloadTracer) CaptureEnd(output []byte, gasUsed uint64, tm time.Duration, err error) {}
+
+// NewStorageProbe returns a research.StorageProbe executing static calls under
+// env, so that research can locate token mappings without depending on the EVM
+func NewStorageProbe(env *research.SubstateEnv) research.StorageProbe {
+	return func(alloc research.SubstateAlloc, contract common.Address, input []byte) ([]byte, []common.Hash, error) {
+		chainConfig := &params.ChainConfig{}
+		*chainConfig = *params.MainnetChainConfig
+		// disable DAOForkSupport, otherwise account states will be overwritten
+		chainConfig.DAOForkSupport = false
+		blockCtx := vm.BlockContext{
+			CanTransfer: core.CanTransfer,
+			Transfer:    core.Transfer,
+			Coinbase:    env.Coinbase,
+			BlockNumber: new(big.Int).SetUint64(env.Number),
+			Time:        new(big.Int).SetUint64(env.Timestamp),
+			Difficulty:  env.Difficulty,
+			GasLimit:    env.GasLimit,
+			GetHash:     func(num uint64) common.Hash { return env.BlockHashes[num] },
+		}
+		if env.BaseFee != nil {
+			blockCtx.BaseFee = new(big.Int).Set(env.BaseFee)
+		}
+		tracer := &sloadTracer{contract: contract}
+		evm := vm.NewEVM(blockCtx, vm.TxContext{GasPrice: new(big.Int)}, MakeOffTheChainStateDB(alloc), chainConfig,
+			vm.Config{Debug: true, Tracer: tracer})
+		ret, _, err := evm.StaticCall(vm.AccountRef(common.Address{}), contract, input, env.GasLimit)
+		return common.CopyBytes(ret), tracer.slots, err
+	}
+}
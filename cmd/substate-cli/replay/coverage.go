@@ -0,0 +1,209 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	// record coverage in replayRegularMsgs, set unless --skip-coverage
+	coverageEnabled bool
+
+	// code of inner contracts exercised over the run, by code address
+	globalCoverage = make(map[common.Address]*contractCoverage)
+	coverageLock   sync.Mutex
+)
+
+// branch is one outcome of a JUMPI
+type branch struct {
+	PC    uint64
+	Taken bool
+}
+
+// contractCoverage is the part of the code of a contract that was executed
+type contractCoverage struct {
+	code     []byte
+	pcs      map[uint64]struct{}
+	branches map[branch]struct{}
+	stores   map[common.Hash]struct{}
+}
+
+func newContractCoverage(code []byte) *contractCoverage {
+	return &contractCoverage{
+		code:     code,
+		pcs:      make(map[uint64]struct{}),
+		branches: make(map[branch]struct{}),
+		stores:   make(map[common.Hash]struct{}),
+	}
+}
+
+// instructions counts the instructions and JUMPIs of the code
+func (cov *contractCoverage) instructions() (int, int) {
+	var instructions, jumpis int
+	for pc := 0; pc < len(cov.code); pc++ {
+		op := vm.OpCode(cov.code[pc])
+		instructions++
+		if op == vm.JUMPI {
+			jumpis++
+		}
+		if op.IsPush() {
+			pc += int(op - vm.PUSH1 + 1)
+		}
+	}
+	return instructions, jumpis
+}
+
+// coverageTracer records the PCs, JUMPI outcomes and SSTORE slots reached in
+// inner contracts by a message
+type coverageTracer struct {
+	contracts map[common.Address]*contractCoverage
+	// whether code addresses belong to the DApp, which is looked up once
+	inner map[common.Address]bool
+}
+
+func newCoverageTracer() *coverageTracer {
+	return &coverageTracer{
+		contracts: make(map[common.Address]*contractCoverage),
+		inner:     make(map[common.Address]bool),
+	}
+}
+
+func (t *coverageTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *coverageTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	contract := scope.Contract
+	if contract.CodeAddr == nil {
+		return
+	}
+	// the implementation of an inner proxy is part of the DApp as well
+	addr := *contract.CodeAddr
+	inner, exist := t.inner[addr]
+	if !exist {
+		inner = isInnerContract(addr) || isInnerContract(contract.Address())
+		t.inner[addr] = inner
+	}
+	if !inner {
+		return
+	}
+	cov, exist := t.contracts[addr]
+	if !exist {
+		cov = newContractCoverage(contract.Code)
+		t.contracts[addr] = cov
+	}
+
+	cov.pcs[pc] = struct{}{}
+	switch op {
+	case vm.JUMPI:
+		cov.branches[branch{PC: pc, Taken: !scope.Stack.Back(1).IsZero()}] = struct{}{}
+	case vm.SSTORE:
+		cov.stores[common.Hash(scope.Stack.Back(0).Bytes32())] = struct{}{}
+	}
+}
+
+func (t *coverageTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *coverageTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *coverageTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *coverageTracer) CaptureEnd(output []byte, gasUsed uint64, tm time.Duration, err error) {}
+
+// merge adds the coverage of the message to the coverage of the run, and
+// returns the number of branches and storage slots it reached first
+func (t *coverageTracer) merge() int {
+	coverageLock.Lock()
+	defer coverageLock.Unlock()
+
+	novelty := 0
+	for addr, cov := range t.contracts {
+		global, exist := globalCoverage[addr]
+		if !exist {
+			global = newContractCoverage(cov.code)
+			globalCoverage[addr] = global
+		}
+		for pc := range cov.pcs {
+			global.pcs[pc] = struct{}{}
+		}
+		for b := range cov.branches {
+			if _, exist := global.branches[b]; !exist {
+				global.branches[b] = struct{}{}
+				novelty++
+			}
+		}
+		for slot := range cov.stores {
+			if _, exist := global.stores[slot]; !exist {
+				global.stores[slot] = struct{}{}
+				novelty++
+			}
+		}
+	}
+	return novelty
+}
+
+// novelty sums the new coverage reached by the given messages
+func novelty(outcomes ...*msgOutcome) int {
+	total := 0
+	for _, outcome := range outcomes {
+		if outcome != nil {
+			total += outcome.NewCoverage
+		}
+	}
+	return total
+}
+
+// coverageReport is the coverage of one inner contract over the run
+type coverageReport struct {
+	Contract        common.Address `json:"contract"`
+	Instructions    int            `json:"instructions"`
+	ReachedPCs      int            `json:"reachedPCs"`
+	Branches        int            `json:"branches"`
+	ReachedBranches int            `json:"reachedBranches"`
+	StoredSlots     int            `json:"storedSlots"`
+}
+
+// printCoverage reports the coverage of each inner contract, and writes it
+// to the output folder of the DApp
+func printCoverage(taskPool *research.SubstateTaskPool) {
+	coverageLock.Lock()
+	defer coverageLock.Unlock()
+
+	var reports []coverageReport
+	for addr, cov := range globalCoverage {
+		instructions, jumpis := cov.instructions()
+		reports = append(reports, coverageReport{
+			Contract:        addr,
+			Instructions:    instructions,
+			ReachedPCs:      len(cov.pcs),
+			Branches:        2 * jumpis,
+			ReachedBranches: len(cov.branches),
+			StoredSlots:     len(cov.stores),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return bytes.Compare(reports[i].Contract.Bytes(), reports[j].Contract.Bytes()) < 0
+	})
+
+	for _, report := range reports {
+		fmt.Printf("%s: coverage %s: instructions %d/%d, branches %d/%d, stored slots %d\n",
+			taskPool.Name, report.Contract.Hex(), report.ReachedPCs, report.Instructions,
+			report.ReachedBranches, report.Branches, report.StoredSlots)
+	}
+	data, err := json.MarshalIndent(reports, "", " ")
+	checkError(err)
+	if err = ioutil.WriteFile(taskPool.DappDir+"/output/coverage.json", data, 0777); err != nil {
+		fmt.Printf("%s: %v\n", taskPool.Name, err)
+	}
+}
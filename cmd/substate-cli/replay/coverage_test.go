@@ -0,0 +1,111 @@
+package replay
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestCoverageTracerMerge(t *testing.T) {
+	defer func(coverage map[common.Address]*contractCoverage) { globalCoverage = coverage }(globalCoverage)
+	globalCoverage = make(map[common.Address]*contractCoverage)
+
+	var (
+		addr1 = common.BytesToAddress([]byte("contract1"))
+		addr2 = common.BytesToAddress([]byte("contract2"))
+		slot1 = common.BigToHash(big.NewInt(1))
+		slot2 = common.BigToHash(big.NewInt(2))
+	)
+	// coverage of a message reaching pcs, branches and stores of addr
+	newTracer := func(addr common.Address, pcs []uint64, branches []branch, stores []common.Hash) *coverageTracer {
+		tracer := newCoverageTracer()
+		cov := newContractCoverage([]byte{0x00})
+		for _, pc := range pcs {
+			cov.pcs[pc] = struct{}{}
+		}
+		for _, b := range branches {
+			cov.branches[b] = struct{}{}
+		}
+		for _, slot := range stores {
+			cov.stores[slot] = struct{}{}
+		}
+		tracer.contracts[addr] = cov
+		return tracer
+	}
+
+	// tracers are merged in order into the coverage of the run
+	tests := []struct {
+		name   string
+		tracer *coverageTracer
+		want   int
+	}{
+		{"first message", newTracer(addr1, []uint64{0, 1}, []branch{{1, true}}, []common.Hash{slot1}), 2},
+		{"same coverage", newTracer(addr1, []uint64{0, 1}, []branch{{1, true}}, []common.Hash{slot1}), 0},
+		{"new pcs only", newTracer(addr1, []uint64{2, 3}, nil, nil), 0},
+		{"other outcome of a branch", newTracer(addr1, nil, []branch{{1, false}, {1, true}}, nil), 1},
+		{"new slot", newTracer(addr1, nil, nil, []common.Hash{slot1, slot2}), 1},
+		{"same slot of another contract", newTracer(addr2, nil, []branch{{1, true}}, []common.Hash{slot1}), 2},
+	}
+	for _, tt := range tests {
+		if got := tt.tracer.merge(); got != tt.want {
+			t.Errorf("%s: novelty %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	cov := globalCoverage[addr1]
+	if len(cov.pcs) != 4 || len(cov.branches) != 2 || len(cov.stores) != 2 {
+		t.Errorf("coverage of %s: %d pcs, %d branches, %d slots, want 4, 2 and 2",
+			addr1.Hex(), len(cov.pcs), len(cov.branches), len(cov.stores))
+	}
+}
+
+func TestReplayCoverage(t *testing.T) {
+	defer func(coverage map[common.Address]*contractCoverage) { globalCoverage = coverage }(globalCoverage)
+	defer func(seed []fuzz.SeedItem) { fuzz.GlobalInnerSeed = seed }(fuzz.GlobalInnerSeed)
+	globalCoverage = make(map[common.Address]*contractCoverage)
+
+	// JUMPI(store1, CALLDATASIZE); SSTORE(0, 1); STOP; store1: SSTORE(1, 1)
+	brancher := common.BytesToAddress([]byte("brancher"))
+	fuzz.GlobalInnerSeed = []fuzz.SeedItem{{Value: strings.ToLower(brancher.Hex())}}
+	alloc := newTestAlloc()
+	alloc[brancher] = research.NewSubstateAccount(1, new(big.Int), common.FromHex("0x36600a576001600055005b600160015500"))
+
+	message := func(to common.Address, data []byte) types.Message {
+		return types.NewMessage(testSender, &to, alloc[testSender].Nonce, new(big.Int), 100000, big.NewInt(1), big.NewInt(1), big.NewInt(1), data, nil, false)
+	}
+	tests := []struct {
+		name   string
+		to     common.Address
+		data   []byte
+		traced bool
+		want   int
+	}{
+		{"untraced", brancher, nil, false, 0},
+		{"branch not taken", brancher, nil, true, 2},
+		{"same branch", brancher, nil, true, 0},
+		{"branch taken", brancher, []byte{1}, true, 2},
+		{"outer contract", testCounter, nil, true, 0},
+	}
+	for _, tt := range tests {
+		_, outcome, err := replayTracedMsgs(1, 0, alloc, testEnv, message(tt.to, tt.data), nil, tt.traced)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if outcome.NewCoverage != tt.want {
+			t.Errorf("%s: new coverage %d, want %d", tt.name, outcome.NewCoverage, tt.want)
+		}
+		if got := novelty(outcome, nil); got != tt.want {
+			t.Errorf("%s: novelty %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if _, exist := globalCoverage[testCounter]; exist || len(globalCoverage) != 1 {
+		t.Errorf("coverage recorded for %d contracts, want only %s", len(globalCoverage), brancher.Hex())
+	}
+	if cov := globalCoverage[brancher]; len(cov.branches) != 2 || len(cov.stores) != 2 {
+		t.Errorf("coverage of %s: %d branches and %d slots, want 2 and 2", brancher.Hex(), len(cov.branches), len(cov.stores))
+	}
+}
@@ -0,0 +1,113 @@
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// crossBlockAlloc completes a copy of inputAlloc with the accounts and slots
+// the next transactions keys load and the original one does not, taken from
+// their own input
+func crossBlockAlloc(inputAlloc research.SubstateAlloc, nextSubstates map[int]*research.Substate, keys []int) research.SubstateAlloc {
+	alloc := inputAlloc.Copy()
+	for _, key := range keys {
+		research.UpdateSubstate(&alloc, nextSubstates[key].InputAlloc.Copy(), false, true)
+	}
+	return alloc
+}
+
+// replayWithCrossBlockMR moves the original transaction across the block
+// boundary: it compares the transaction followed by the DApp transactions of
+// the next block with the same transactions followed by the original one,
+// which then executes under the env of the next block
+func replayWithCrossBlockMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
+	inputAlloc := substate.InputAlloc
+	inputMessage := substate.Message
+
+	nextSubstates := taskPool.DB.GetBlockSubstates(block + 1)
+	var (
+		keys    []int
+		nextEnv *research.SubstateEnv
+	)
+	for nextTx, nextSubstate := range nextSubstates {
+		nextEnv = nextSubstate.Env
+		if nextSubstate.Message.To == nil ||
+			!containByList(
+				fuzz.GetInnerValueList(),
+				strings.ToLower(nextSubstate.Message.To.String())) {
+			continue
+		}
+		keys = append(keys, nextTx)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Ints(keys)
+
+	fundedAlloc := crossBlockAlloc(inputAlloc, nextSubstates, keys)
+	var (
+		nextMsgs []sequencedMsg
+		allMsgs  = []types.Message{inputMessage.AsMessage()}
+	)
+	for _, key := range keys {
+		nextMsgs = append(nextMsgs, sequencedMsg{
+			Label: "next-" + strconv.Itoa(key),
+			Env:   *nextEnv,
+			Msg:   nextSubstates[key].Message.AsMessage(),
+		})
+		allMsgs = append(allMsgs, nextSubstates[key].Message.AsMessage())
+	}
+	funding := fundSenders(fundedAlloc, allMsgs...)
+
+	// (original in its block, next block)
+	oriAlloc, oriOutcomes, err := replaySequence(block, tx, fundedAlloc,
+		append([]sequencedMsg{{Label: "original", Env: *substate.Env, Msg: inputMessage.AsMessage()}}, nextMsgs...),
+		taskPool.StrictOracle)
+	if err != nil {
+		return err
+	}
+	// (next block, original at its end)
+	mutAlloc, mutOutcomes, err := replaySequence(block+1, keys[0], fundedAlloc,
+		append(append([]sequencedMsg{}, nextMsgs...), sequencedMsg{Label: "original", Env: *nextEnv, Msg: inputMessage.AsMessage()}),
+		taskPool.StrictOracle)
+	if err != nil {
+		return err
+	}
+
+	if addr, divergence, a := siOracle(taskPool.StrictOracle, oriAlloc, mutAlloc, oriOutcomes, mutOutcomes); !a {
+		// write bug information
+		bugFile := findingFile(taskPool.DappDir, addr, substate.Env.Number, tx, inputMessage.Data, "crossblock")
+		bugDetails := &SIbug{
+			BugType:      "CROSS-BLOCK",
+			InputAlloc:   substate.InputAlloc,
+			OutputAlloc:  substate.OutputAlloc,
+			InputMessage: *inputMessage,
+			OriAlloc:     oriAlloc,
+			MutAlloc:     mutAlloc,
+			Divergence:   divergence,
+			OriOutcomes:  oriOutcomes,
+			MutOutcomes:  mutOutcomes,
+			Funding:      funding,
+			NextEnv:      nextEnv,
+		}
+		data, err := json.MarshalIndent(bugDetails, "", " ")
+		checkError(err)
+		err = ioutil.WriteFile(bugFile, data, 0777)
+		checkError(err)
+		recordFinding("CROSS-BLOCK")
+		//writh to bug log file
+		log.SetOutput(bugLogFile)
+		log.SetPrefix("[SIBugLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		log.Printf("%s differ under CROSS-BLOCK in \n%s\nin %d->%d\n", divergence, addr, block, block+1)
+	}
+	return nil
+}
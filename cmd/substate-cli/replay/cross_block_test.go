@@ -0,0 +1,60 @@
+package replay
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestCrossBlockAlloc(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		user     = common.BytesToAddress([]byte("user"))
+		other    = common.BytesToAddress([]byte("other"))
+		slot1    = common.BytesToHash([]byte{1})
+		slot2    = common.BytesToHash([]byte{2})
+	)
+	account := func(balance int64, slots map[common.Hash]byte) *research.SubstateAccount {
+		sa := research.NewSubstateAccount(1, big.NewInt(balance), nil)
+		for slot, value := range slots {
+			sa.Storage[slot] = common.BytesToHash([]byte{value})
+		}
+		return sa
+	}
+	inputAlloc := research.SubstateAlloc{
+		contract: account(10, map[common.Hash]byte{slot1: 1}),
+	}
+	nextSubstates := map[int]*research.Substate{
+		0: {InputAlloc: research.SubstateAlloc{
+			// the original transaction precedes the next ones, whose input
+			// values are stale for what it loaded
+			contract: account(20, map[common.Hash]byte{slot1: 2, slot2: 2}),
+			user:     account(5, nil),
+		}},
+		1: {InputAlloc: research.SubstateAlloc{
+			contract: account(30, map[common.Hash]byte{slot2: 3}),
+		}},
+		2: {InputAlloc: research.SubstateAlloc{
+			other: account(7, nil),
+		}},
+	}
+
+	alloc := crossBlockAlloc(inputAlloc, nextSubstates, []int{0, 1})
+	want := research.SubstateAlloc{
+		contract: account(10, map[common.Hash]byte{slot1: 1, slot2: 2}),
+		user:     account(5, nil),
+	}
+	if !alloc.Equal(want) {
+		t.Errorf("merged alloc %v, want %v", alloc, want)
+	}
+	if len(inputAlloc[contract].Storage) != 1 {
+		t.Errorf("input alloc modified")
+	}
+	// the merged accounts are copies
+	alloc[user].Balance = new(big.Int)
+	if nextSubstates[0].InputAlloc[user].Balance.Int64() != 5 {
+		t.Errorf("next substate modified")
+	}
+}
@@ -0,0 +1,212 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/research"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// forkImpactKey is a function of a contract; the selector is "create" for
+// contract creations and "fallback" for calls without a selector
+type forkImpactKey struct {
+	Contract common.Address
+	Selector string
+}
+
+// forkImpact is the behavior change of the fork on the transactions calling
+// one function
+type forkImpact struct {
+	Contract       common.Address `json:"contract"`
+	Selector       string         `json:"selector"`
+	Txs            int64          `json:"txs"`
+	GasDelta       int64          `json:"gasDelta"`       // sum of the gas used with the fork minus the recorded gas used
+	MoreGas        int64          `json:"moreGas"`        // txs using more gas with the fork
+	LessGas        int64          `json:"lessGas"`        // txs using less gas with the fork
+	NewReverts     int64          `json:"newReverts"`     // successful txs failing with the fork
+	NewSuccesses   int64          `json:"newSuccesses"`   // failed txs succeeding with the fork
+	StorageChanges int64          `json:"storageChanges"` // txs writing different storage with the fork
+	Invalid        int64          `json:"invalid"`        // txs no longer valid with the fork
+}
+
+func (impact *forkImpact) changed() bool {
+	return impact.MoreGas+impact.LessGas+impact.NewReverts+impact.NewSuccesses+impact.StorageChanges+impact.Invalid > 0
+}
+
+var (
+	forkImpacts    = make(map[forkImpactKey]*forkImpact)
+	forkImpactLock sync.Mutex
+)
+
+// forkImpactKeyOf identifies the function called by a message
+func forkImpactKeyOf(message *research.SubstateMessage, created common.Address) forkImpactKey {
+	if message.To == nil {
+		return forkImpactKey{Contract: created, Selector: "create"}
+	}
+	if len(message.Data) < 4 {
+		return forkImpactKey{Contract: *message.To, Selector: "fallback"}
+	}
+	return forkImpactKey{Contract: *message.To, Selector: hexutil.Encode(message.Data[:4])}
+}
+
+// storageChanged tells whether the storage of any account differs between the
+// recorded and the replayed post-state
+func storageChanged(outputAlloc, evmAlloc research.SubstateAlloc) bool {
+	for addr, account1 := range outputAlloc {
+		account2, exist := evmAlloc[addr]
+		if !exist {
+			if len(account1.Storage) > 0 {
+				return true
+			}
+			continue
+		}
+		if len(account1.Storage) != len(account2.Storage) {
+			return true
+		}
+		for k, v1 := range account1.Storage {
+			if v2, exist := account2.Storage[k]; !exist || v1 != v2 {
+				return true
+			}
+		}
+	}
+	for addr, account2 := range evmAlloc {
+		if _, exist := outputAlloc[addr]; !exist && len(account2.Storage) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// recordForkImpact adds one replayed transaction to the report; evmResult
+// is nil if the transaction is invalid with the fork
+func recordForkImpact(key forkImpactKey, outputResult, evmResult *research.SubstateResult, outputAlloc, evmAlloc research.SubstateAlloc) {
+	forkImpactLock.Lock()
+	defer forkImpactLock.Unlock()
+
+	impact := forkImpacts[key]
+	if impact == nil {
+		impact = &forkImpact{Contract: key.Contract, Selector: key.Selector}
+		forkImpacts[key] = impact
+	}
+	impact.Txs++
+	if evmResult == nil {
+		impact.Invalid++
+		return
+	}
+
+	delta := int64(evmResult.GasUsed) - int64(outputResult.GasUsed)
+	impact.GasDelta += delta
+	if delta > 0 {
+		impact.MoreGas++
+	} else if delta < 0 {
+		impact.LessGas++
+	}
+	switch {
+	case outputResult.Status == types.ReceiptStatusSuccessful && evmResult.Status == types.ReceiptStatusFailed:
+		impact.NewReverts++
+	case outputResult.Status == types.ReceiptStatusFailed && evmResult.Status == types.ReceiptStatusSuccessful:
+		impact.NewSuccesses++
+	}
+	if storageChanged(outputAlloc, evmAlloc) {
+		impact.StorageChanges++
+	}
+}
+
+// printForkImpacts reports the functions whose behavior changed with the
+// fork, and writes the whole report to path if it is not empty
+func printForkImpacts(path string) error {
+	forkImpactLock.Lock()
+	defer forkImpactLock.Unlock()
+
+	impacts := make([]*forkImpact, 0, len(forkImpacts))
+	for _, impact := range forkImpacts {
+		impacts = append(impacts, impact)
+	}
+	sort.Slice(impacts, func(i, j int) bool {
+		if c := bytes.Compare(impacts[i].Contract.Bytes(), impacts[j].Contract.Bytes()); c != 0 {
+			return c < 0
+		}
+		return impacts[i].Selector < impacts[j].Selector
+	})
+
+	changed := 0
+	for _, impact := range impacts {
+		if !impact.changed() {
+			continue
+		}
+		changed++
+		fmt.Printf("substate-cli replay-fork: %s %-10s txs %v, gas %+d (more %v, less %v), new reverts %v, new successes %v, storage changes %v, invalid %v\n",
+			impact.Contract.Hex(), impact.Selector, impact.Txs, impact.GasDelta, impact.MoreGas, impact.LessGas,
+			impact.NewReverts, impact.NewSuccesses, impact.StorageChanges, impact.Invalid)
+	}
+	fmt.Printf("substate-cli replay-fork: %v of %v functions changed\n", changed, len(impacts))
+
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(impacts, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// forkChainConfig returns a copy of the tests.Forks config name, so that
+// overrides do not alter the shared config
+func forkChainConfig(name string) (*params.ChainConfig, error) {
+	config, exist := tests.Forks[name]
+	if !exist {
+		return nil, fmt.Errorf("unknown fork %v", name)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	copied := &params.ChainConfig{}
+	if err = json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// overrideChainConfig sets the fields present in the JSON file path, where
+// null turns a fork off
+func overrideChainConfig(config *params.ChainConfig, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, config)
+}
+
+// parseEips parses the comma-separated list of --eips
+func parseEips(list string) ([]int, error) {
+	var eips []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(field)), "EIP-")
+		if field == "" {
+			continue
+		}
+		eip, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EIP %v", field)
+		}
+		if !vm.ValidEip(eip) {
+			return nil, fmt.Errorf("EIP %v cannot be enabled, available EIPs: %s", eip, strings.Join(vm.ActivateableEips(), ", "))
+		}
+		eips = append(eips, eip)
+	}
+	return eips, nil
+}
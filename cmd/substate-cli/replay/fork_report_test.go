@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestHardForkFlagDefault(t *testing.T) {
+	if got := HardForkFlag.Value; HardForkName[got] != "London" {
+		t.Errorf("--hard-fork default %d (%s), want London", got, HardForkName[got])
+	}
+	for num := range HardForkName {
+		if _, exist := hardForkConfig[num]; !exist {
+			t.Errorf("hard fork %s without tests.Forks config", HardForkName[num])
+		}
+	}
+}
+
+func TestParseEips(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{list: ""},
+		{list: "2929", want: []int{2929}},
+		{list: " EIP-3529, eip-1344 ,", want: []int{3529, 1344}},
+		{list: "2929,x", wantErr: true},
+		{list: "1559", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEips(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseEips(%q) error %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseEips(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestOverrideChainConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chain-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		json       string
+		wantLondon *big.Int
+		wantBerlin *big.Int
+		wantErr    bool
+	}{
+		{name: "empty", json: `{}`, wantLondon: common.Big0, wantBerlin: common.Big0},
+		{name: "London off", json: `{"londonBlock": null}`, wantBerlin: common.Big0},
+		{name: "London later", json: `{"londonBlock": 100}`, wantLondon: big.NewInt(100), wantBerlin: common.Big0},
+		{name: "invalid", json: `{"londonBlock": "x"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		config, err := forkChainConfig("London")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = overrideChainConfig(config, path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if config.LondonBlock == nil != (tt.wantLondon == nil) || config.LondonBlock != nil && config.LondonBlock.Cmp(tt.wantLondon) != 0 {
+			t.Errorf("%s: London block %v, want %v", tt.name, config.LondonBlock, tt.wantLondon)
+		}
+		if config.BerlinBlock == nil || config.BerlinBlock.Cmp(tt.wantBerlin) != 0 {
+			t.Errorf("%s: Berlin block %v, want %v", tt.name, config.BerlinBlock, tt.wantBerlin)
+		}
+	}
+	// the shared config is not altered
+	if config, _ := forkChainConfig("London"); config.LondonBlock == nil || config.LondonBlock.Sign() != 0 {
+		t.Errorf("tests.Forks London config modified: London block %v", config.LondonBlock)
+	}
+	if err := overrideChainConfig(&params.ChainConfig{}, filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("no error for a missing file")
+	}
+}
+
+func TestRecordForkImpact(t *testing.T) {
+	defer func() { forkImpacts = make(map[forkImpactKey]*forkImpact) }()
+	forkImpacts = make(map[forkImpactKey]*forkImpact)
+
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		key      = forkImpactKey{Contract: contract, Selector: "0x12345678"}
+		other    = forkImpactKey{Contract: contract, Selector: "fallback"}
+		slot     = common.BytesToHash([]byte("slot"))
+	)
+	result := func(status uint64, gas uint64) *research.SubstateResult {
+		return &research.SubstateResult{Status: status, GasUsed: gas}
+	}
+	alloc := func(value byte) research.SubstateAlloc {
+		account := research.NewSubstateAccount(1, new(big.Int), nil)
+		account.Storage[slot] = common.BytesToHash([]byte{value})
+		return research.SubstateAlloc{contract: account}
+	}
+	ok, failed := types.ReceiptStatusSuccessful, types.ReceiptStatusFailed
+
+	recordForkImpact(key, result(ok, 100), result(ok, 100), alloc(1), alloc(1))
+	recordForkImpact(key, result(ok, 100), result(ok, 150), alloc(1), alloc(1))
+	recordForkImpact(key, result(ok, 100), result(failed, 90), alloc(1), alloc(2))
+	recordForkImpact(key, result(failed, 100), result(ok, 100), alloc(1), alloc(1))
+	recordForkImpact(key, result(ok, 100), nil, alloc(1), nil)
+	recordForkImpact(other, result(ok, 100), result(ok, 100), alloc(1), alloc(1))
+
+	want := map[forkImpactKey]*forkImpact{
+		key: {
+			Contract: contract, Selector: key.Selector, Txs: 5, GasDelta: 40,
+			MoreGas: 1, LessGas: 1, NewReverts: 1, NewSuccesses: 1, StorageChanges: 1, Invalid: 1,
+		},
+		other: {Contract: contract, Selector: other.Selector, Txs: 1},
+	}
+	if !reflect.DeepEqual(forkImpacts, want) {
+		for k, impact := range forkImpacts {
+			t.Errorf("%s: %+v, want %+v", k.Selector, impact, want[k])
+		}
+	}
+	if !forkImpacts[key].changed() || forkImpacts[other].changed() {
+		t.Errorf("changed functions %v/%v, want true/false", forkImpacts[key].changed(), forkImpacts[other].changed())
+	}
+}
@@ -0,0 +1,155 @@
+package replay
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// fundingRecord is a balance credited to a sender before replaying generated
+// messages. Senders start from their real pre-state balance and are only
+// credited the shortfall, which is recorded along with any finding. Token is
+// set for token balances lent by a flash loan.
+type fundingRecord struct {
+	Address common.Address  `json:"address"`
+	Token   *common.Address `json:"token,omitempty"`
+	Before  *hexutil.Big    `json:"before"`
+	Amount  *hexutil.Big    `json:"amount"`
+}
+
+var (
+	// token balance of an attacker funded by a flash loan
+	flashLoanAmount = new(big.Int).Lsh(big.NewInt(1), 128)
+
+	// contracts whose balance mapping cannot be found
+	nonTokens     = make(map[common.Address]bool)
+	nonTokensLock sync.RWMutex
+
+	balanceOfSelector = common.FromHex("0x70a08231")
+)
+
+// msgCost is the maximum amount of wei a message may take from its sender
+func msgCost(msg types.Message) *big.Int {
+	price := msg.GasPrice()
+	if msg.GasFeeCap() != nil && msg.GasFeeCap().Cmp(price) > 0 {
+		price = msg.GasFeeCap()
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(msg.Gas()), price)
+	return cost.Add(cost, msg.Value())
+}
+
+// fundSenders credits the senders in alloc, so that each of them can pay for
+// all the given messages in any order. Senders missing from alloc are created
+// with an empty balance first.
+func fundSenders(alloc research.SubstateAlloc, msgs ...types.Message) []fundingRecord {
+	var (
+		senders []common.Address
+		costs   = make(map[common.Address]*big.Int)
+	)
+	for _, msg := range msgs {
+		if _, exist := costs[msg.From()]; !exist {
+			senders = append(senders, msg.From())
+			costs[msg.From()] = new(big.Int)
+		}
+		costs[msg.From()].Add(costs[msg.From()], msgCost(msg))
+	}
+
+	var records []fundingRecord
+	for _, sender := range senders {
+		account, exist := alloc[sender]
+		if !exist {
+			account = research.NewSubstateAccount(0, new(big.Int), nil)
+			alloc[sender] = account
+		}
+		if account.Balance.Cmp(costs[sender]) >= 0 {
+			continue
+		}
+		shortfall := new(big.Int).Sub(costs[sender], account.Balance)
+		records = append(records, fundingRecord{
+			Address: sender,
+			Before:  (*hexutil.Big)(new(big.Int).Set(account.Balance)),
+			Amount:  (*hexutil.Big)(shortfall),
+		})
+		account.Balance = new(big.Int).Add(account.Balance, shortfall)
+	}
+	return records
+}
+
+// senderBalance is the pre-state balance of sender, or nil if it does not exist
+func senderBalance(alloc research.SubstateAlloc, sender common.Address) *big.Int {
+	if account, exist := alloc[sender]; exist {
+		return account.Balance
+	}
+	return nil
+}
+
+// flashLoanTokens are the inner contracts and the well-known tokens of alloc
+func flashLoanTokens(alloc research.SubstateAlloc) []common.Address {
+	var tokens []common.Address
+	for _, contract := range fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetInnerValueList()) {
+		if common.IsHexAddress(contract) {
+			tokens = append(tokens, common.HexToAddress(contract))
+		}
+	}
+	for addr := range alloc {
+		if research.GetTokenLayout(addr).Balances != nil {
+			tokens = append(tokens, addr)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return bytes.Compare(tokens[i][:], tokens[j][:]) < 0 })
+
+	var unique []common.Address
+	for i, token := range tokens {
+		if _, exist := alloc[token]; exist && (i == 0 || token != tokens[i-1]) {
+			unique = append(unique, token)
+		}
+	}
+	return unique
+}
+
+// flashLoan credits attacker in alloc with flashLoanAmount of each of tokens,
+// as if borrowed from a flash loan repaid after the attack. Contracts whose
+// balance mapping is neither known nor found by probing balanceOf under env
+// are skipped.
+func flashLoan(alloc research.SubstateAlloc, env research.SubstateEnv, attacker common.Address, tokens []common.Address) []fundingRecord {
+	probe := NewStorageProbe(&env)
+	holderKey := common.BytesToHash(attacker.Bytes())
+
+	var records []fundingRecord
+	for _, token := range tokens {
+		nonTokensLock.RLock()
+		skip := nonTokens[token]
+		nonTokensLock.RUnlock()
+		if skip {
+			continue
+		}
+		before := new(big.Int)
+		if ret, _, err := probe(alloc, token, append(common.CopyBytes(balanceOfSelector), holderKey[:]...)); err == nil && len(ret) >= 32 {
+			before.SetBytes(ret[:32])
+		}
+		if before.Cmp(flashLoanAmount) >= 0 {
+			continue
+		}
+		if err := research.SetTokenBalance(alloc, token, attacker, flashLoanAmount, probe); err != nil {
+			nonTokensLock.Lock()
+			nonTokens[token] = true
+			nonTokensLock.Unlock()
+			continue
+		}
+		token := token
+		records = append(records, fundingRecord{
+			Address: attacker,
+			Token:   &token,
+			Before:  (*hexutil.Big)(before),
+			Amount:  (*hexutil.Big)(new(big.Int).Sub(flashLoanAmount, before)),
+		})
+	}
+	return records
+}
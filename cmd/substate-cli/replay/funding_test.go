@@ -0,0 +1,225 @@
+package replay
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestFundSenders(t *testing.T) {
+	var (
+		alice = common.BytesToAddress([]byte("alice"))
+		bob   = common.BytesToAddress([]byte("bob"))
+		to    = common.BytesToAddress([]byte("contract"))
+	)
+	// gas 100 at price 2 (fee cap feeCap if larger), sending value
+	message := func(from common.Address, value int64, feeCap int64) types.Message {
+		return types.NewMessage(from, &to, 0, big.NewInt(value), 100, big.NewInt(2), big.NewInt(feeCap), big.NewInt(1), nil, nil, false)
+	}
+	record := func(addr common.Address, before, amount int64) fundingRecord {
+		return fundingRecord{Address: addr, Before: (*hexutil.Big)(big.NewInt(before)), Amount: (*hexutil.Big)(big.NewInt(amount))}
+	}
+
+	tests := []struct {
+		name         string
+		balances     map[common.Address]int64 // pre-state balances
+		msgs         []types.Message
+		want         []fundingRecord
+		wantBalances map[common.Address]int64
+	}{
+		{
+			name:         "rich sender",
+			balances:     map[common.Address]int64{alice: 1000},
+			msgs:         []types.Message{message(alice, 5, 0)},
+			wantBalances: map[common.Address]int64{alice: 1000},
+		},
+		{
+			name:         "exact balance",
+			balances:     map[common.Address]int64{alice: 205},
+			msgs:         []types.Message{message(alice, 5, 0)},
+			wantBalances: map[common.Address]int64{alice: 205},
+		},
+		{
+			name:         "shortfall",
+			balances:     map[common.Address]int64{alice: 50},
+			msgs:         []types.Message{message(alice, 5, 0)},
+			want:         []fundingRecord{record(alice, 50, 155)},
+			wantBalances: map[common.Address]int64{alice: 205},
+		},
+		{
+			name:         "fee cap above gas price",
+			balances:     map[common.Address]int64{alice: 0},
+			msgs:         []types.Message{message(alice, 0, 3)},
+			want:         []fundingRecord{record(alice, 0, 300)},
+			wantBalances: map[common.Address]int64{alice: 300},
+		},
+		{
+			name:         "missing sender",
+			balances:     map[common.Address]int64{},
+			msgs:         []types.Message{message(bob, 1, 0)},
+			want:         []fundingRecord{record(bob, 0, 201)},
+			wantBalances: map[common.Address]int64{bob: 201},
+		},
+		{
+			name:         "messages of the same sender add up",
+			balances:     map[common.Address]int64{alice: 300},
+			msgs:         []types.Message{message(alice, 5, 0), message(alice, 10, 0)},
+			want:         []fundingRecord{record(alice, 300, 115)},
+			wantBalances: map[common.Address]int64{alice: 415},
+		},
+		{
+			name:         "several senders",
+			balances:     map[common.Address]int64{alice: 1000, bob: 0},
+			msgs:         []types.Message{message(alice, 5, 0), message(bob, 5, 0)},
+			want:         []fundingRecord{record(bob, 0, 205)},
+			wantBalances: map[common.Address]int64{alice: 1000, bob: 205},
+		},
+	}
+	for _, tt := range tests {
+		alloc := make(research.SubstateAlloc)
+		for addr, balance := range tt.balances {
+			alloc[addr] = research.NewSubstateAccount(1, big.NewInt(balance), nil)
+		}
+		got := fundSenders(alloc, tt.msgs...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: fundSenders = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if len(alloc) != len(tt.wantBalances) {
+			t.Errorf("%s: %d accounts after funding, want %d", tt.name, len(alloc), len(tt.wantBalances))
+		}
+		for addr, want := range tt.wantBalances {
+			if account, exist := alloc[addr]; !exist || account.Balance.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("%s: balance of %s = %v, want %v", tt.name, addr.Hex(), account, want)
+			}
+		}
+	}
+}
+
+var (
+	testToken      = common.BytesToAddress([]byte("token"))
+	testVyperToken = common.BytesToAddress([]byte("vyper token"))
+	testWETH       = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+)
+
+// newTokenAlloc adds to newTestAlloc testToken, whose balanceOf returns
+// SLOAD(keccak(holder . 1)), and testVyperToken, whose balanceOf returns
+// SLOAD(keccak(1 . holder))
+func newTokenAlloc() research.SubstateAlloc {
+	alloc := newTestAlloc()
+	alloc[testToken] = research.NewSubstateAccount(1, new(big.Int),
+		common.FromHex("0x600435600052600160205260406000205460005260206000f3"))
+	alloc[testVyperToken] = research.NewSubstateAccount(1, new(big.Int),
+		common.FromHex("0x600160005260043560205260406000205460005260206000f3"))
+	return alloc
+}
+
+// balanceOf calls balanceOf(holder) of token in alloc
+func balanceOf(t *testing.T, alloc research.SubstateAlloc, token, holder common.Address) *big.Int {
+	ret, _, err := NewStorageProbe(&testEnv)(alloc, token, append(common.CopyBytes(balanceOfSelector), common.LeftPadBytes(holder.Bytes(), 32)...))
+	if err != nil {
+		t.Fatalf("balanceOf(%s) of %s: %v", holder.Hex(), token.Hex(), err)
+	}
+	return new(big.Int).SetBytes(ret)
+}
+
+func TestFlashLoan(t *testing.T) {
+	defer func() {
+		nonTokensLock.Lock()
+		delete(nonTokens, testCounter)
+		nonTokensLock.Unlock()
+	}()
+	var (
+		attacker = common.BytesToAddress([]byte("attacker"))
+		token    = testToken
+		vyper    = testVyperToken
+	)
+	record := func(token common.Address, before *big.Int) fundingRecord {
+		return fundingRecord{Address: attacker, Token: &token, Before: (*hexutil.Big)(before),
+			Amount: (*hexutil.Big)(new(big.Int).Sub(flashLoanAmount, before))}
+	}
+	// slot of the vyper balance of the attacker
+	vyperSlot := research.MappingLayout{Slot: 1, Vyper: true}.EntrySlot(common.BytesToHash(attacker.Bytes()))
+
+	tests := []struct {
+		name     string
+		balances map[common.Address]*big.Int // vyper balance of the attacker
+		tokens   []common.Address
+		want     []fundingRecord
+	}{
+		{
+			name:   "solidity and vyper mappings",
+			tokens: []common.Address{token, vyper},
+			want:   []fundingRecord{record(token, new(big.Int)), record(vyper, new(big.Int))},
+		},
+		{
+			name:     "existing balance",
+			balances: map[common.Address]*big.Int{vyper: big.NewInt(5)},
+			tokens:   []common.Address{vyper},
+			want:     []fundingRecord{record(vyper, big.NewInt(5))},
+		},
+		{
+			name:     "balance above the loan",
+			balances: map[common.Address]*big.Int{vyper: new(big.Int).Add(flashLoanAmount, big.NewInt(1))},
+			tokens:   []common.Address{vyper},
+		},
+		{
+			name:   "not a token",
+			tokens: []common.Address{testCounter, token},
+			want:   []fundingRecord{record(token, new(big.Int))},
+		},
+	}
+	for _, tt := range tests {
+		alloc := newTokenAlloc()
+		for token, balance := range tt.balances {
+			alloc[token].Storage[vyperSlot] = common.BigToHash(balance)
+		}
+		got := flashLoan(alloc, testEnv, attacker, tt.tokens)
+		equal := len(got) == len(tt.want)
+		for i := 0; equal && i < len(got); i++ {
+			equal = got[i].Address == tt.want[i].Address && *got[i].Token == *tt.want[i].Token &&
+				got[i].Before.ToInt().Cmp(tt.want[i].Before.ToInt()) == 0 &&
+				got[i].Amount.ToInt().Cmp(tt.want[i].Amount.ToInt()) == 0
+		}
+		if !equal {
+			t.Errorf("%s: flashLoan = %+v, want %+v", tt.name, got, tt.want)
+		}
+		for _, record := range got {
+			if balance := balanceOf(t, alloc, *record.Token, attacker); balance.Cmp(flashLoanAmount) != 0 {
+				t.Errorf("%s: balance of %s after the loan = %v, want %v", tt.name, record.Token.Hex(), balance, flashLoanAmount)
+			}
+		}
+	}
+	nonTokensLock.RLock()
+	defer nonTokensLock.RUnlock()
+	if !nonTokens[testCounter] || nonTokens[token] || nonTokens[vyper] {
+		t.Errorf("contracts without a balance mapping: %v, want only %s", nonTokens, testCounter.Hex())
+	}
+}
+
+func TestFlashLoanTokens(t *testing.T) {
+	defer func(seed []fuzz.SeedItem) { fuzz.GlobalInnerSeed = seed }(fuzz.GlobalInnerSeed)
+	missing := common.BytesToAddress([]byte("missing"))
+	fuzz.GlobalInnerSeed = []fuzz.SeedItem{
+		{Value: strings.ToLower(testToken.Hex())},
+		{Value: strings.ToLower(testCounter.Hex())},
+		{Value: strings.ToLower(missing.Hex())},
+		// duplicate of a well-known token
+		{Value: strings.ToLower(testWETH.Hex())},
+	}
+	alloc := newTestAlloc()
+	alloc[testToken] = newTokenAlloc()[testToken]
+	alloc[testWETH] = research.NewSubstateAccount(1, new(big.Int), nil)
+
+	// inner contracts in alloc and well-known tokens, in address order
+	want := []common.Address{testToken, testCounter, testWETH}
+	if got := flashLoanTokens(alloc); !reflect.DeepEqual(got, want) {
+		t.Errorf("flashLoanTokens = %v, want %v", got, want)
+	}
+}
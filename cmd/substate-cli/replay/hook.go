@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// callSite identifies an external call made by an inner contract
+type callSite struct {
+	Op     string         `json:"op"`
+	Caller common.Address `json:"caller"`
+	Callee common.Address `json:"callee"`
+	Depth  int            `json:"depth"`
+	PC     uint64         `json:"pc"`
+}
+
+func newCallSite(frame *vm.CallFrame) *callSite {
+	return &callSite{
+		Op:     frame.Op.String(),
+		Caller: frame.Caller,
+		Callee: frame.Callee,
+		Depth:  frame.Depth,
+		PC:     frame.PC,
+	}
+}
+
+func isInnerContract(addr common.Address) bool {
+	return containByList(fuzz.GetInnerValueList(), strings.ToLower(addr.String()))
+}
+
+// externalCallFilter selects the calls from inner contracts to outer
+// addresses, i.e. the points where control leaves the DApp
+type externalCallFilter struct {
+	precompiles map[common.Address]struct{}
+}
+
+func newExternalCallFilter(precompiles []common.Address) externalCallFilter {
+	filter := externalCallFilter{precompiles: make(map[common.Address]struct{})}
+	for _, addr := range precompiles {
+		filter.precompiles[addr] = struct{}{}
+	}
+	return filter
+}
+
+func (filter externalCallFilter) isExternal(frame *vm.CallFrame) bool {
+	if !isInnerContract(frame.Caller) || isInnerContract(frame.Callee) {
+		return false
+	}
+	_, exist := filter.precompiles[frame.Callee]
+	return !exist
+}
+
+// hookInterceptor re-enters the DApp with an additional message at the
+// target-th external call of an inner contract, as a malicious callee would
+// do at the end of its execution, paying the value of the message itself. A
+// non-zero sender sends the message instead of the callee. All candidate call
+// sites are recorded, so a negative target only lists them. The sender is only
+// known at the call site and is not funded, so an injected message failing
+// (e.g. for lack of value) does not count as a re-entrance.
+type hookInterceptor struct {
+	externalCallFilter
+	target  int
+	sender  common.Address
+	vimAddr common.Address
+	msgData []byte
+	value   *big.Int
+
+	sites    []*callSite
+	hooked   *callSite
+	injected *vm.InjectedCall
+}
+
+func newHookInterceptor(precompiles []common.Address, target int, sender common.Address, vimAddr common.Address, msgData []byte, value *big.Int) *hookInterceptor {
+	return &hookInterceptor{
+		externalCallFilter: newExternalCallFilter(precompiles),
+		target:             target,
+		sender:             sender,
+		vimAddr:            vimAddr,
+		msgData:            msgData,
+		value:              value,
+	}
+}
+
+// InterceptCall implements vm.CallInterceptor
+func (hook *hookInterceptor) InterceptCall(frame *vm.CallFrame) *vm.CallInjection {
+	if frame.Op == vm.STATICCALL || !hook.isExternal(frame) {
+		return nil
+	}
+	site := newCallSite(frame)
+	hook.sites = append(hook.sites, site)
+	if len(hook.sites)-1 != hook.target {
+		return nil
+	}
+	hook.hooked = site
+
+	// the code of CALLCODE and DELEGATECALL targets runs in the inner contract
+	from := frame.Callee
+	if frame.Op != vm.CALL {
+		from = frame.Caller
+	}
+	if hook.sender != (common.Address{}) {
+		from = hook.sender
+	}
+	hook.injected = &vm.InjectedCall{From: from, To: hook.vimAddr, Input: hook.msgData, Value: hook.value}
+	return &vm.CallInjection{After: []*vm.InjectedCall{hook.injected}}
+}
+
+// reentered tells whether the message was injected at the target call site
+// and executed without error
+func (hook *hookInterceptor) reentered() bool {
+	return hook.hooked != nil && hook.injected.Executed && hook.injected.Err == nil
+}
+
+// selectHookSites parses the --hook-sites specification into the indices of
+// the call sites to hook, out of numSites candidates
+func selectHookSites(spec string, numSites int) ([]int, error) {
+	var sites []int
+	if numSites == 0 {
+		return sites, nil
+	}
+	switch spec {
+	case "", "all":
+		for i := 0; i < numSites; i++ {
+			sites = append(sites, i)
+		}
+	case "first":
+		sites = append(sites, 0)
+	case "last":
+		sites = append(sites, numSites-1)
+	default:
+		for _, field := range strings.Split(spec, ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid hook site %q", field)
+			}
+			if index < numSites {
+				sites = append(sites, index)
+			}
+		}
+	}
+	return sites, nil
+}
@@ -0,0 +1,138 @@
+package replay
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestSelectHookSites(t *testing.T) {
+	tests := []struct {
+		spec     string
+		numSites int
+		want     []int
+		wantErr  bool
+	}{
+		{"all", 3, []int{0, 1, 2}, false},
+		{"", 2, []int{0, 1}, false},
+		{"first", 3, []int{0}, false},
+		{"last", 3, []int{2}, false},
+		{"all", 0, nil, false},
+		{"last", 0, nil, false},
+		{"1", 3, []int{1}, false},
+		{"0, 2", 3, []int{0, 2}, false},
+		{"1,5", 3, []int{1}, false},
+		{"5", 3, nil, false},
+		{"-1", 3, nil, true},
+		{"1,x", 3, nil, true},
+		{"middle", 3, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := selectHookSites(tt.spec, tt.numSites)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("selectHookSites(%q, %d) error = %v, want error %v", tt.spec, tt.numSites, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectHookSites(%q, %d) = %v, want %v", tt.spec, tt.numSites, got, tt.want)
+		}
+	}
+}
+
+func TestHookInterceptorSites(t *testing.T) {
+	var (
+		inner     = common.BytesToAddress([]byte("inner"))
+		inner2    = common.BytesToAddress([]byte("inner2"))
+		outer     = common.BytesToAddress([]byte("outer"))
+		outer2    = common.BytesToAddress([]byte("outer2"))
+		precomp   = common.BytesToAddress([]byte{1})
+		sender    = common.BytesToAddress([]byte("sender"))
+		vimAddr   = inner2
+		innerSeed = []fuzz.SeedItem{{Value: strings.ToLower(inner.String())}, {Value: strings.ToLower(inner2.String())}}
+	)
+	defer func(seed []fuzz.SeedItem) { fuzz.GlobalInnerSeed = seed }(fuzz.GlobalInnerSeed)
+	fuzz.GlobalInnerSeed = innerSeed
+
+	// the external calls are the 1st, 4th and 5th frame
+	frames := []*vm.CallFrame{
+		{Op: vm.CALL, Caller: inner, Callee: outer, PC: 10},
+		{Op: vm.CALL, Caller: inner, Callee: inner2, PC: 20},
+		{Op: vm.CALL, Caller: outer, Callee: outer2, PC: 30},
+		{Op: vm.DELEGATECALL, Caller: inner2, Callee: outer2, PC: 40},
+		{Op: vm.CALL, Caller: inner, Callee: outer2, PC: 50},
+		{Op: vm.STATICCALL, Caller: inner, Callee: outer, PC: 60},
+		{Op: vm.CALL, Caller: inner, Callee: precomp, PC: 70},
+	}
+
+	tests := []struct {
+		name     string
+		target   int
+		sender   common.Address
+		wantPC   uint64 // 0 if no call site is hooked
+		wantFrom common.Address
+	}{
+		{name: "list only", target: -1},
+		{name: "first site", target: 0, wantPC: 10, wantFrom: outer},
+		{name: "delegatecall site", target: 1, wantPC: 40, wantFrom: inner2},
+		{name: "last site", target: 2, wantPC: 50, wantFrom: outer2},
+		{name: "out of range", target: 3},
+		{name: "sender", target: 0, sender: sender, wantPC: 10, wantFrom: sender},
+	}
+	for _, tt := range tests {
+		hook := newHookInterceptor([]common.Address{precomp}, tt.target, tt.sender, vimAddr, []byte{1}, big.NewInt(5))
+		var injections []*vm.CallInjection
+		for _, frame := range frames {
+			if injection := hook.InterceptCall(frame); injection != nil {
+				injections = append(injections, injection)
+			}
+		}
+		if len(hook.sites) != 3 {
+			t.Errorf("%s: %d call sites, want 3", tt.name, len(hook.sites))
+		}
+		if tt.wantPC == 0 {
+			if hook.hooked != nil || len(injections) != 0 {
+				t.Errorf("%s: hooked %+v with %d injections, want none", tt.name, hook.hooked, len(injections))
+			}
+			continue
+		}
+		if hook.hooked == nil || hook.hooked.PC != tt.wantPC {
+			t.Errorf("%s: hooked %+v, want pc %d", tt.name, hook.hooked, tt.wantPC)
+			continue
+		}
+		if len(injections) != 1 || len(injections[0].After) != 1 {
+			t.Errorf("%s: %d injections, want 1 call after the hooked call", tt.name, len(injections))
+			continue
+		}
+		call := injections[0].After[0]
+		if call.From != tt.wantFrom || call.To != vimAddr || call.Value.Cmp(big.NewInt(5)) != 0 {
+			t.Errorf("%s: injected %s -> %s value %v, want %s -> %s value 5", tt.name, call.From.Hex(), call.To.Hex(), call.Value, tt.wantFrom.Hex(), vimAddr.Hex())
+		}
+	}
+}
+
+func TestHookInterceptorReentered(t *testing.T) {
+	site := &callSite{Op: "CALL", PC: 10}
+	tests := []struct {
+		name     string
+		hooked   *callSite
+		injected *vm.InjectedCall
+		want     bool
+	}{
+		{"not hooked", nil, nil, false},
+		{"not executed", site, &vm.InjectedCall{}, false},
+		{"failed", site, &vm.InjectedCall{Executed: true, Err: vm.ErrInsufficientBalance}, false},
+		{"reverted", site, &vm.InjectedCall{Executed: true, Err: vm.ErrExecutionReverted}, false},
+		{"executed", site, &vm.InjectedCall{Executed: true}, true},
+	}
+	for _, tt := range tests {
+		hook := &hookInterceptor{hooked: tt.hooked, injected: tt.injected}
+		if got := hook.reentered(); got != tt.want {
+			t.Errorf("%s: reentered = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
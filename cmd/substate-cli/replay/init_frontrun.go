@@ -0,0 +1,277 @@
+package replay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// number of blocks after a contract creation searched for its initialization
+const initWindow = 256
+
+var (
+	// EIP-1967 implementation and beacon slots, besides the owner slots
+	proxySlots = []common.Hash{
+		common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"),
+		common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"),
+	}
+	maxConfigSlot = new(big.Int).Lsh(common.Big1, 64)
+)
+
+// slotChange is a storage slot of the created contract whose value after the
+// initialization depends on the attacker message
+type slotChange struct {
+	Slot     common.Hash `json:"slot"`
+	Owner    bool        `json:"owner"`
+	Baseline common.Hash `json:"baseline"`
+	Attacked common.Hash `json:"attacked"`
+}
+
+// isConfigSlot tells state variables from mapping and array entries, which
+// live at hashed slots, except for the well-known owner and proxy slots
+func isConfigSlot(slot common.Hash) bool {
+	for _, known := range append(append([]common.Hash{}, ownerSlots...), proxySlots...) {
+		if slot == known {
+			return true
+		}
+	}
+	return slot.Big().Cmp(maxConfigSlot) < 0
+}
+
+// configChanges lists the config slots of contract differing between two
+// post-states, the owner slots being flagged
+func configChanges(contract common.Address, baseAlloc, mutAlloc research.SubstateAlloc) []slotChange {
+	var (
+		baseStorage = make(map[common.Hash]common.Hash)
+		mutStorage  = make(map[common.Hash]common.Hash)
+		slots       = make(map[common.Hash]struct{})
+		changes     []slotChange
+	)
+	if account, exist := baseAlloc[contract]; exist {
+		baseStorage = account.Storage
+	}
+	if account, exist := mutAlloc[contract]; exist {
+		mutStorage = account.Storage
+	}
+	for slot := range baseStorage {
+		slots[slot] = struct{}{}
+	}
+	for slot := range mutStorage {
+		slots[slot] = struct{}{}
+	}
+	for slot := range slots {
+		if !isConfigSlot(slot) || baseStorage[slot] == mutStorage[slot] {
+			continue
+		}
+		change := slotChange{Slot: slot, Baseline: baseStorage[slot], Attacked: mutStorage[slot]}
+		for _, owner := range ownerSlots {
+			change.Owner = change.Owner || slot == owner
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// maximum number of blocks whose calls are kept by innerCalls
+const maxInnerCallBlocks = 4096
+
+var (
+	// successful calls to inner contracts by block, as sorted tx indices per
+	// callee, so overlapping initialization windows decode each block once
+	innerCallCache     = make(map[uint64]map[common.Address][]int)
+	innerCallCacheLock sync.RWMutex
+)
+
+// innerCalls returns the transactions of block successfully calling each
+// inner contract
+func innerCalls(taskPool *research.SubstateTaskPool, block uint64) map[common.Address][]int {
+	innerCallCacheLock.RLock()
+	calls, exist := innerCallCache[block]
+	innerCallCacheLock.RUnlock()
+	if exist {
+		return calls
+	}
+
+	calls = make(map[common.Address][]int)
+	inner := fuzz.GetInnerValueList()
+	for tx, substate := range taskPool.DB.GetBlockSubstates(block) {
+		if substate.Message.To == nil ||
+			substate.Result == nil || substate.Result.Status != types.ReceiptStatusSuccessful ||
+			!containByList(inner, strings.ToLower(substate.Message.To.String())) {
+			continue
+		}
+		calls[*substate.Message.To] = append(calls[*substate.Message.To], tx)
+	}
+	for _, txs := range calls {
+		sort.Ints(txs)
+	}
+
+	innerCallCacheLock.Lock()
+	defer innerCallCacheLock.Unlock()
+	if len(innerCallCache) >= maxInnerCallBlocks {
+		innerCallCache = make(map[uint64]map[common.Address][]int)
+	}
+	innerCallCache[block] = calls
+	return calls
+}
+
+// initSearchEnd returns the last block searched for the initialization of a
+// contract created in block: initWindow blocks ahead, stopping at the end of
+// the recorded range of block, or of the replayed blocks for DBs without
+// metadata
+func initSearchEnd(taskPool *research.SubstateTaskPool, block uint64) uint64 {
+	last := block + initWindow
+	md, err := taskPool.DB.GetMetadata()
+	if err != nil || md == nil {
+		if taskPool.Last >= block && taskPool.Last < last {
+			last = taskPool.Last
+		}
+		return last
+	}
+	recorded := md.Ranges.Intersect(research.BlockRange{First: block, Last: last})
+	if len(recorded) == 0 || recorded[0].First != block {
+		return block
+	}
+	return recorded[0].Last
+}
+
+// findInitialization returns the first successful call to contract after its
+// creation at (block, tx), searching up to initSearchEnd
+func findInitialization(taskPool *research.SubstateTaskPool, block uint64, tx int, contract common.Address) *research.Substate {
+	last := initSearchEnd(taskPool, block)
+	for current := block; current <= last; current++ {
+		for _, callTx := range innerCalls(taskPool, current)[contract] {
+			if current == block && callTx <= tx {
+				continue
+			}
+			return taskPool.DB.GetSubstate(current, callTx)
+		}
+	}
+	return nil
+}
+
+// replayWithInitMR inserts attacker calls to the initializer and setter
+// functions of a created inner contract between its creation and its
+// legitimate initialization, and reports the calls that go through and change
+// the owner or config slots resulting from the initialization
+func replayWithInitMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget) error {
+	env := substate.Env
+	contract := substate.Result.ContractAddress
+	addr := strings.ToLower(contract.String())
+
+	// the state right after the creation
+	deployAlloc := substate.OutputAlloc.Copy()
+	research.UpdateSubstate(&deployAlloc, substate.InputAlloc.Copy(), false, true)
+
+	initSubstate := findInitialization(taskPool, block, tx, contract)
+	var initMsgs []sequencedMsg
+	if initSubstate != nil {
+		research.UpdateSubstate(&deployAlloc, initSubstate.InputAlloc.Copy(), false, true)
+		initMsgs = append(initMsgs, sequencedMsg{Label: "initialization", Env: *initSubstate.Env, Msg: initSubstate.Message.AsMessage()})
+	}
+
+	attacker := newRoleModel(block, substate, nil, []senderRole{roleAttacker}).attacker
+	addrs, msgs, rets, err := fuzz.AdminBuilder([]string{addr}, block, []string{strings.ToLower(attacker.String())}, nil)
+	if err != nil {
+		return fmt.Errorf("error in generating msgs")
+	}
+	addrs, msgs, rets = budget.schedule(substate, addrs, msgs, rets)
+
+	for index, msg := range msgs {
+		if budget.skipMsgs(len(msgs) - index) {
+			break
+		}
+		toAddress := common.HexToAddress(addrs[index])
+		msgData, _ := hex.DecodeString(msg[2:])
+		// the attacker message carries value if its function is payable
+		value := fuzz.PayableValue(addrs[index], rets[index], block, senderBalance(deployAlloc, attacker))
+		attackMsg := types.NewMessage(
+			attacker,
+			&toAddress,
+			0,
+			value,
+			env.GasLimit/2,
+			substate.Message.GasPrice,
+			substate.Message.GasFeeCap,
+			substate.Message.GasTipCap,
+			msgData,
+			nil,
+			false,
+		)
+		fundedAlloc := deployAlloc.Copy()
+		allMsgs := []types.Message{attackMsg}
+		for _, init := range initMsgs {
+			allMsgs = append(allMsgs, init.Msg)
+		}
+		funding := fundSenders(fundedAlloc, allMsgs...)
+
+		// (creation, initialization)
+		baseAlloc, oriOutcomes, err := replaySequence(block, tx+1, fundedAlloc, initMsgs, taskPool.StrictOracle)
+		if err != nil {
+			return err
+		}
+		// (creation, attack, initialization)
+		mutAlloc, mutOutcomes, err := replaySequence(block, tx+1, fundedAlloc,
+			append([]sequencedMsg{{Label: "attack", Env: *env, Msg: attackMsg}}, initMsgs...),
+			taskPool.StrictOracle)
+		if err != nil {
+			return err
+		}
+		if mutOutcomes["attack"].Failed {
+			continue
+		}
+		changes := configChanges(contract, baseAlloc, mutAlloc)
+		if len(changes) == 0 {
+			continue
+		}
+
+		// write bug information, one file per attacker message
+		bugFile := findingFile(taskPool.DappDir, addr, env.Number, tx, msgData, "init")
+		bugDetails := &SIbug{
+			BugType:           "INIT-FRONTRUN",
+			InputAlloc:        substate.InputAlloc,
+			OutputAlloc:       substate.OutputAlloc,
+			InputMessage:      *substate.Message,
+			AdditMessageFrom:  attacker.String(),
+			AdditMessageTo:    toAddress.String(),
+			AdditMessageData:  rets[index],
+			AdditMessageValue: value.String(),
+			OriAlloc:          baseAlloc,
+			MutAlloc:          mutAlloc,
+			Divergence:        "config slots",
+			OriOutcomes:       oriOutcomes,
+			MutOutcomes:       mutOutcomes,
+			Funding:           funding,
+			Role:              roleAttacker.String(),
+			Slots:             changes,
+		}
+		if initSubstate != nil {
+			bugDetails.InitMessage = initSubstate.Message
+		}
+		data, err := json.MarshalIndent(bugDetails, "", " ")
+		checkError(err)
+		err = ioutil.WriteFile(bugFile, data, 0777)
+		checkError(err)
+		recordFinding("INIT-FRONTRUN")
+		//writh to bug log file
+		log.SetOutput(bugLogFile)
+		log.SetPrefix("[SIBugLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		for _, change := range changes {
+			log.Printf("slot %s (owner %v) differ under INIT-FRONTRUN by %s in \n%s\nin %d\n",
+				change.Slot.Hex(), change.Owner, rets[index], addr, block)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestIsConfigSlot(t *testing.T) {
+	tests := []struct {
+		name string
+		slot common.Hash
+		want bool
+	}{
+		{"slot 0", common.Hash{}, true},
+		{"small slot", common.BigToHash(big.NewInt(7)), true},
+		{"largest config slot", common.BigToHash(new(big.Int).Sub(maxConfigSlot, common.Big1)), true},
+		{"mapping entry", crypto.Keccak256Hash(make([]byte, 64)), false},
+		{"array entry", common.BigToHash(maxConfigSlot), false},
+		{"EIP-1967 admin", ownerSlots[2], true},
+		{"EIP-1967 implementation", proxySlots[0], true},
+		{"EIP-1967 beacon", proxySlots[1], true},
+	}
+	for _, tt := range tests {
+		if got := isConfigSlot(tt.slot); got != tt.want {
+			t.Errorf("%s: isConfigSlot(%s) = %v, want %v", tt.name, tt.slot.Hex(), got, tt.want)
+		}
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		config   = common.BigToHash(big.NewInt(3))
+		mapping  = crypto.Keccak256Hash(make([]byte, 64))
+		value1   = common.BytesToHash([]byte{1})
+		value2   = common.BytesToHash([]byte{2})
+	)
+	alloc := func(slots map[common.Hash]common.Hash) research.SubstateAlloc {
+		account := research.NewSubstateAccount(1, new(big.Int), nil)
+		for slot, value := range slots {
+			account.Storage[slot] = value
+		}
+		return research.SubstateAlloc{contract: account}
+	}
+	tests := []struct {
+		name      string
+		base, mut research.SubstateAlloc
+		want      []slotChange
+	}{
+		{
+			name: "unchanged",
+			base: alloc(map[common.Hash]common.Hash{config: value1}),
+			mut:  alloc(map[common.Hash]common.Hash{config: value1}),
+		},
+		{
+			name: "config slot",
+			base: alloc(map[common.Hash]common.Hash{config: value1}),
+			mut:  alloc(map[common.Hash]common.Hash{config: value2}),
+			want: []slotChange{{Slot: config, Baseline: value1, Attacked: value2}},
+		},
+		{
+			name: "owner slot written by the attack only",
+			base: alloc(nil),
+			mut:  alloc(map[common.Hash]common.Hash{ownerSlots[0]: value1}),
+			want: []slotChange{{Slot: ownerSlots[0], Owner: true, Attacked: value1}},
+		},
+		{
+			name: "mapping entry",
+			base: alloc(map[common.Hash]common.Hash{mapping: value1}),
+			mut:  alloc(map[common.Hash]common.Hash{mapping: value2}),
+		},
+		{
+			name: "contract missing",
+			base: research.SubstateAlloc{},
+			mut:  alloc(map[common.Hash]common.Hash{config: value2}),
+			want: []slotChange{{Slot: config, Attacked: value2}},
+		},
+	}
+	for _, tt := range tests {
+		if got := configChanges(contract, tt.base, tt.mut); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: configChanges = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindInitialization(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		other    = common.BytesToAddress([]byte("other"))
+	)
+	defer func(seed []fuzz.SeedItem) { fuzz.GlobalInnerSeed = seed }(fuzz.GlobalInnerSeed)
+	fuzz.GlobalInnerSeed = []fuzz.SeedItem{{Value: strings.ToLower(contract.String())}, {Value: strings.ToLower(other.String())}}
+
+	call := func(to common.Address, status uint64, data byte) *research.Substate {
+		return research.NewSubstate(research.SubstateAlloc{}, research.SubstateAlloc{},
+			&research.SubstateEnv{Difficulty: big.NewInt(1), GasLimit: 1000000, BlockHashes: map[uint64]common.Hash{}},
+			&research.SubstateMessage{GasPrice: big.NewInt(1), To: &to, Value: new(big.Int), Data: []byte{data}, GasFeeCap: big.NewInt(1), GasTipCap: big.NewInt(1)},
+			&research.SubstateResult{Status: status})
+	}
+	type substateKey struct {
+		block uint64
+		tx    int
+	}
+	tests := []struct {
+		name      string
+		substates map[substateKey]*research.Substate
+		ranges    research.BlockRanges // nil for no metadata
+		last      uint64
+		want      byte // data of the initialization, 0 if none
+	}{
+		{
+			name: "same block",
+			substates: map[substateKey]*research.Substate{
+				{100, 0}: call(contract, types.ReceiptStatusSuccessful, 1),
+				{100, 2}: call(contract, types.ReceiptStatusSuccessful, 2),
+				{100, 3}: call(contract, types.ReceiptStatusSuccessful, 3),
+			},
+			last: 200,
+			want: 2,
+		},
+		{
+			name: "failed and other calls skipped",
+			substates: map[substateKey]*research.Substate{
+				{100, 2}: call(contract, types.ReceiptStatusFailed, 1),
+				{101, 0}: call(other, types.ReceiptStatusSuccessful, 2),
+				{102, 5}: call(contract, types.ReceiptStatusSuccessful, 3),
+				{102, 7}: call(contract, types.ReceiptStatusSuccessful, 4),
+			},
+			last: 200,
+			want: 3,
+		},
+		{
+			name: "beyond the window",
+			substates: map[substateKey]*research.Substate{
+				{100 + initWindow + 1, 0}: call(contract, types.ReceiptStatusSuccessful, 1),
+			},
+			last: 1000,
+		},
+		{
+			name: "beyond the replayed blocks",
+			substates: map[substateKey]*research.Substate{
+				{105, 0}: call(contract, types.ReceiptStatusSuccessful, 1),
+			},
+			last: 104,
+		},
+		{
+			name: "within the recorded range",
+			substates: map[substateKey]*research.Substate{
+				{105, 0}: call(contract, types.ReceiptStatusSuccessful, 1),
+			},
+			ranges: research.BlockRanges{{First: 90, Last: 110}},
+			last:   104,
+			want:   1,
+		},
+		{
+			name: "beyond the recorded range",
+			substates: map[substateKey]*research.Substate{
+				{105, 0}: call(contract, types.ReceiptStatusSuccessful, 1),
+			},
+			ranges: research.BlockRanges{{First: 90, Last: 103}, {First: 105, Last: 110}},
+			last:   200,
+		},
+	}
+	for _, tt := range tests {
+		innerCallCache = make(map[uint64]map[common.Address][]int)
+		backend, err := research.OpenBackend("memory://", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := research.NewSubstateDB(backend)
+		for key, substate := range tt.substates {
+			db.PutSubstate(key.block, key.tx, substate)
+		}
+		if tt.ranges != nil {
+			md := research.NewSubstateMetadata("test")
+			md.Ranges = tt.ranges
+			if err := db.PutMetadata(md); err != nil {
+				t.Fatal(err)
+			}
+		}
+		taskPool := &research.SubstateTaskPool{DB: db, First: 100, Last: tt.last}
+
+		got := findInitialization(taskPool, 100, 1, contract)
+		switch {
+		case tt.want == 0 && got != nil:
+			t.Errorf("%s: found initialization %x, want none", tt.name, got.Message.Data)
+		case tt.want != 0 && (got == nil || got.Message.Data[0] != tt.want):
+			t.Errorf("%s: found initialization %v, want data %x", tt.name, got, tt.want)
+		}
+		db.Close()
+	}
+	innerCallCache = make(map[uint64]map[common.Address][]int)
+}
@@ -0,0 +1,31 @@
+package replay
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// relationTimers measure the execution count and latency of each metamorphic
+// relation of replay-SI
+var relationTimers = map[string]metrics.Timer{
+	"ENV":           metrics.NewRegisteredTimer("replay/relation/env", nil),
+	"TOD":           metrics.NewRegisteredTimer("replay/relation/tod", nil),
+	"HOOK":          metrics.NewRegisteredTimer("replay/relation/hook", nil),
+	"SANDWICH":      metrics.NewRegisteredTimer("replay/relation/sandwich", nil),
+	"CROSS-BLOCK":   metrics.NewRegisteredTimer("replay/relation/crossblock", nil),
+	"RO-REENTRANCY": metrics.NewRegisteredTimer("replay/relation/roreentrancy", nil),
+	"INIT-FRONTRUN": metrics.NewRegisteredTimer("replay/relation/initfrontrun", nil),
+}
+
+// timeRelation records an execution of a relation started at start
+func timeRelation(relation string, start time.Time) {
+	relationTimers[relation].UpdateSince(start)
+}
+
+// recordFinding counts a finding reported to the SI bug log by bug type
+func recordFinding(bugType string) {
+	name := "replay/findings/" + strings.ToLower(strings.ReplaceAll(bugType, "-", ""))
+	metrics.GetOrRegisterCounter(name, nil).Inc(1)
+}
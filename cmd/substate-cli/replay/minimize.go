@@ -0,0 +1,297 @@
+package replay
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// maximum number of re-executions spent minimizing a single finding, which
+// also stops when the time budget of its transaction is spent
+const maxMinimizeChecks = 256
+
+// minimizedCall is an additional message of a minimized finding
+type minimizedCall struct {
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Msg   string         `json:"msg"`
+	Input hexutil.Bytes  `json:"input"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+// reproducer is the smallest input alloc and additional messages found to
+// still trigger a finding
+type reproducer struct {
+	InputAlloc research.SubstateAlloc `json:"inputAlloc"`
+	Calls      []minimizedCall        `json:"calls"`
+	Accounts   int                    `json:"accounts"`
+	Slots      int                    `json:"slots"`
+	Checks     int                    `json:"checks"`
+	// minimization stopped on its check limit or the transaction deadline
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// reproduceFunc re-executes a finding on a candidate input alloc and
+// additional messages, and reports whether the same divergence shows up
+type reproduceFunc func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error)
+
+// divergenceKey identifies the divergence of a finding, so that minimization
+// does not drift to a different one
+type divergenceKey struct {
+	divergence string
+	accounts   map[common.Address]struct{}
+}
+
+// divergentAccounts lists the accounts whose state differs between two
+// post-states, as compared by siOracle
+func divergentAccounts(strict bool, oriAlloc, mutAlloc research.SubstateAlloc) map[common.Address]struct{} {
+	accounts := make(map[common.Address]struct{})
+	for addr, account := range oriAlloc {
+		if strict && !account.StrictStateEqual(mutAlloc[addr]) ||
+			!strict && !account.StateEqual(mutAlloc[addr]) {
+			accounts[addr] = struct{}{}
+		}
+	}
+	if strict {
+		for addr, account := range mutAlloc {
+			if _, exist := oriAlloc[addr]; !exist && !account.IsEmpty() {
+				accounts[addr] = struct{}{}
+			}
+		}
+	}
+	return accounts
+}
+
+func newDivergenceKey(strict bool, divergence string, oriAlloc, mutAlloc research.SubstateAlloc) *divergenceKey {
+	return &divergenceKey{
+		divergence: divergence,
+		accounts:   divergentAccounts(strict, oriAlloc, mutAlloc),
+	}
+}
+
+// matches tells whether a re-execution shows the same divergence: the same
+// message outcome differs, or the state of one of the same accounts does
+func (key *divergenceKey) matches(strict bool, divergence string, oriAlloc, mutAlloc research.SubstateAlloc) bool {
+	if divergence != key.divergence {
+		return false
+	}
+	if divergence != "alloc" {
+		return true
+	}
+	for addr := range divergentAccounts(strict, oriAlloc, mutAlloc) {
+		if _, exist := key.accounts[addr]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// minimizer shrinks a finding step by step, keeping every step after which
+// the finding still reproduces
+type minimizer struct {
+	reproduce reproduceFunc
+	budget    *txBudget
+	actors    []string
+	checks    int
+	truncated bool
+
+	alloc research.SubstateAlloc
+	calls []minimizedCall
+}
+
+// exhausted reports whether the checks or the time of the transaction are
+// spent
+func (m *minimizer) exhausted() bool {
+	if m.checks >= maxMinimizeChecks || m.budget.expired() {
+		m.truncated = true
+	}
+	return m.truncated
+}
+
+// try keeps the candidate if it still triggers the finding. A candidate
+// failing to execute does not reproduce it.
+func (m *minimizer) try(alloc research.SubstateAlloc, calls []minimizedCall) bool {
+	if m.exhausted() {
+		return false
+	}
+	m.checks++
+	if ok, err := m.reproduce(alloc, calls); err != nil || !ok {
+		return false
+	}
+	m.alloc, m.calls = alloc, calls
+	return true
+}
+
+// reduce removes as many of n items as possible by trying to drop chunks of
+// halving size
+func (m *minimizer) reduce(n int, try func(keep []int) bool) {
+	keep := make([]int, n)
+	for i := range keep {
+		keep[i] = i
+	}
+	for chunk := (n + 1) / 2; chunk >= 1 && !m.exhausted(); chunk /= 2 {
+		for start := 0; start < len(keep); {
+			end := start + chunk
+			if end > len(keep) {
+				end = len(keep)
+			}
+			candidate := append(append([]int{}, keep[:start]...), keep[end:]...)
+			if try(candidate) {
+				keep = candidate
+				continue
+			}
+			start = end
+		}
+	}
+}
+
+// shrinkArguments simplifies the arguments and value of each message
+func (m *minimizer) shrinkArguments() {
+	for i := range m.calls {
+		for shrunk := true; shrunk; {
+			shrunk = false
+			msgStrings, msgResults := fuzz.ShrinkArguments(m.calls[i].Msg, m.actors)
+			for j, msgString := range msgStrings {
+				candidate := append([]minimizedCall{}, m.calls...)
+				candidate[i].Msg = msgString
+				candidate[i].Input = common.FromHex(msgResults[j])
+				if shrunk = m.try(m.alloc, candidate); shrunk {
+					break
+				}
+			}
+		}
+		// the value goes to zero, or is halved as long as it reproduces
+		for value := m.calls[i].Value.ToInt(); value.Sign() > 0; value = m.calls[i].Value.ToInt() {
+			candidate := append([]minimizedCall{}, m.calls...)
+			candidate[i].Value = (*hexutil.Big)(new(big.Int))
+			if m.try(m.alloc, candidate) {
+				break
+			}
+			candidate[i].Value = (*hexutil.Big)(new(big.Int).Rsh(value, 1))
+			if !m.try(m.alloc, candidate) {
+				break
+			}
+		}
+	}
+}
+
+// dropAccounts removes the accounts of the input alloc not needed to
+// trigger the finding
+func (m *minimizer) dropAccounts() {
+	alloc := m.alloc
+	addrs := sortedAccounts(alloc)
+	m.reduce(len(addrs), func(keep []int) bool {
+		candidate := make(research.SubstateAlloc)
+		for _, i := range keep {
+			candidate[addrs[i]] = alloc[addrs[i]]
+		}
+		return m.try(candidate, m.calls)
+	})
+}
+
+// dropSlots removes the storage slots of each remaining account not needed
+// to trigger the finding
+func (m *minimizer) dropSlots() {
+	for _, addr := range sortedAccounts(m.alloc) {
+		account := m.alloc[addr]
+		slots := make([]common.Hash, 0, len(account.Storage))
+		for slot := range account.Storage {
+			slots = append(slots, slot)
+		}
+		sort.Slice(slots, func(i, j int) bool {
+			return bytes.Compare(slots[i].Bytes(), slots[j].Bytes()) < 0
+		})
+		m.reduce(len(slots), func(keep []int) bool {
+			reduced := research.NewSubstateAccount(account.Nonce, account.Balance, account.Code)
+			for _, i := range keep {
+				reduced.Storage[slots[i]] = account.Storage[slots[i]]
+			}
+			candidate := make(research.SubstateAlloc)
+			for other, otherAccount := range m.alloc {
+				candidate[other] = otherAccount
+			}
+			candidate[addr] = reduced
+			return m.try(candidate, m.calls)
+		})
+	}
+}
+
+func sortedAccounts(alloc research.SubstateAlloc) []common.Address {
+	addrs := make([]common.Address, 0, len(alloc))
+	for addr := range alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+	return addrs
+}
+
+func countSlots(alloc research.SubstateAlloc) int {
+	slots := 0
+	for _, account := range alloc {
+		slots += len(account.Storage)
+	}
+	return slots
+}
+
+// minimizeFinding shrinks a finding by delta debugging: the arguments of its
+// additional messages are simplified towards zero, boundary values and the
+// actors of the finding, then the accounts and storage slots of the input
+// alloc are dropped. Findings are triggered by a single additional message,
+// which is never dropped. Every step is re-checked with reproduce, and rounds
+// are repeated as long as one of them shrinks the finding, within the time
+// budget of the transaction and maxMinimizeChecks re-executions.
+func minimizeFinding(budget *txBudget, alloc research.SubstateAlloc, calls []minimizedCall, actors []common.Address, reproduce reproduceFunc) *reproducer {
+	m := &minimizer{
+		reproduce: reproduce,
+		budget:    budget,
+		alloc:     alloc,
+		calls:     calls,
+	}
+	seen := make(map[string]bool)
+	for _, actor := range actors {
+		addr := strings.ToLower(actor.String())
+		if actor != (common.Address{}) && !seen[addr] {
+			seen[addr] = true
+			m.actors = append(m.actors, addr)
+		}
+	}
+
+	for !m.exhausted() {
+		accounts, slots, before := len(m.alloc), countSlots(m.alloc), m.calls
+		m.shrinkArguments()
+		m.dropAccounts()
+		m.dropSlots()
+		if len(m.alloc) == accounts && countSlots(m.alloc) == slots && callsEqual(m.calls, before) {
+			break
+		}
+	}
+
+	return &reproducer{
+		InputAlloc: m.alloc,
+		Calls:      m.calls,
+		Accounts:   len(m.alloc),
+		Slots:      countSlots(m.alloc),
+		Checks:     m.checks,
+		Truncated:  m.truncated,
+	}
+}
+
+func callsEqual(x, y []minimizedCall) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i].Msg != y[i].Msg || x[i].Value.ToInt().Cmp(y[i].Value.ToInt()) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package replay
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	abi_gen "github.com/ethereum/go-ethereum/cmd/substate-cli/abi"
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// newMinimizeAlloc returns n accounts holding two slots each
+func newMinimizeAlloc(n int) research.SubstateAlloc {
+	alloc := make(research.SubstateAlloc)
+	for i := 0; i < n; i++ {
+		account := research.NewSubstateAccount(1, new(big.Int), nil)
+		account.Storage[common.BigToHash(big.NewInt(int64(i)))] = common.BigToHash(big.NewInt(1))
+		account.Storage[common.BigToHash(big.NewInt(int64(i+n)))] = common.BigToHash(big.NewInt(2))
+		alloc[common.BigToAddress(big.NewInt(int64(0x1000+i)))] = account
+	}
+	return alloc
+}
+
+func newMinimizedCall(t *testing.T, msg string, value int64) minimizedCall {
+	input, err := abi_gen.Parse_GenMsg(msg)
+	if err != nil {
+		t.Fatalf("%s: %v", msg, err)
+	}
+	return minimizedCall{
+		From:  testSender,
+		To:    testCounter,
+		Msg:   msg,
+		Input: common.FromHex(input),
+		Value: (*hexutil.Big)(big.NewInt(value)),
+	}
+}
+
+func TestMinimizeFinding(t *testing.T) {
+	var (
+		needed     = common.BigToAddress(big.NewInt(0x1002))
+		neededSlot = common.BigToHash(big.NewInt(2))
+		actor      = common.BytesToAddress([]byte("actor"))
+	)
+	// the finding reproduces with needed holding neededSlot, a first argument
+	// between 10 and 1000 and a value of at least 100
+	reproduce := func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error) {
+		if len(calls) != 1 {
+			return false, fmt.Errorf("%d calls", len(calls))
+		}
+		account, exist := alloc[needed]
+		if !exist {
+			return false, nil
+		}
+		if _, exist := account.Storage[neededSlot]; !exist {
+			return false, nil
+		}
+		arg := new(big.Int).SetBytes(calls[0].Input[4:36])
+		return arg.Cmp(big.NewInt(10)) >= 0 && arg.Cmp(big.NewInt(1000)) <= 0 &&
+			calls[0].Value.ToInt().Cmp(big.NewInt(100)) >= 0, nil
+	}
+	msg := `f(uint256,address,bool):["0x64","0x00000000000000000000000000000000000000ff",true]`
+	got := minimizeFinding(&txBudget{}, newMinimizeAlloc(8), []minimizedCall{newMinimizedCall(t, msg, 1000)},
+		[]common.Address{actor, {}, actor}, reproduce)
+
+	// 100 is halved down to 12, the address replaced by the first actor
+	wantMsg := `f(uint256,address,bool):["0xc","` + strings.ToLower(actor.Hex()) + `",false]`
+	if len(got.Calls) != 1 || got.Calls[0].Msg != wantMsg {
+		t.Fatalf("minimized calls %+v, want %s", got.Calls, wantMsg)
+	}
+	if value := got.Calls[0].Value.ToInt(); value.Cmp(big.NewInt(125)) != 0 {
+		t.Errorf("minimized value %v, want 125", value)
+	}
+	if got.Accounts != 1 || got.Slots != 1 || got.InputAlloc[needed] == nil {
+		t.Errorf("minimized alloc of %d accounts and %d slots, want %s and its slot", got.Accounts, got.Slots, needed.Hex())
+	}
+	if got.Truncated || got.Checks == 0 || got.Checks >= maxMinimizeChecks {
+		t.Errorf("%d checks, truncated %v", got.Checks, got.Truncated)
+	}
+	if ok, _ := reproduce(got.InputAlloc, got.Calls); !ok {
+		t.Errorf("minimized finding does not reproduce")
+	}
+
+	// no simplification of the result reproduces
+	msgStrings, msgResults := fuzz.ShrinkArguments(got.Calls[0].Msg, []string{strings.ToLower(actor.Hex())})
+	for i, msgString := range msgStrings {
+		call := got.Calls[0]
+		call.Msg, call.Input = msgString, common.FromHex(msgResults[i])
+		if ok, _ := reproduce(got.InputAlloc, []minimizedCall{call}); ok {
+			t.Errorf("minimized finding still shrinks to %s", msgString)
+		}
+	}
+}
+
+func TestMinimizeFindingBudget(t *testing.T) {
+	msg := `f(uint256):["0x64"]`
+	always := func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error) { return true, nil }
+	// every account is needed, so dropping them exceeds the checks
+	allAccounts := func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error) {
+		return len(alloc) == 300, nil
+	}
+
+	tests := []struct {
+		name          string
+		budget        *txBudget
+		accounts      int
+		reproduce     reproduceFunc
+		wantTruncated bool
+		wantChecks    int // if truncated
+		wantAlloc     int
+	}{
+		{"expired deadline", &txBudget{deadline: time.Now().Add(-time.Second)}, 4, always, true, 0, 4},
+		{"check limit", &txBudget{}, 300, allAccounts, true, maxMinimizeChecks, 300},
+		{"no deadline", &txBudget{}, 4, always, false, 0, 0},
+	}
+	for _, tt := range tests {
+		got := minimizeFinding(tt.budget, newMinimizeAlloc(tt.accounts), []minimizedCall{newMinimizedCall(t, msg, 0)}, nil, tt.reproduce)
+		if got.Truncated != tt.wantTruncated {
+			t.Errorf("%s: truncated %v, want %v", tt.name, got.Truncated, tt.wantTruncated)
+		}
+		if tt.wantTruncated && got.Checks != tt.wantChecks {
+			t.Errorf("%s: %d checks, want %d", tt.name, got.Checks, tt.wantChecks)
+		}
+		if got.Accounts != tt.wantAlloc {
+			t.Errorf("%s: %d accounts left, want %d", tt.name, got.Accounts, tt.wantAlloc)
+		}
+	}
+}
+
+func TestDivergenceKeyMatches(t *testing.T) {
+	var (
+		addr1 = common.BytesToAddress([]byte("account1"))
+		addr2 = common.BytesToAddress([]byte("account2"))
+	)
+	alloc := func(balances ...int64) research.SubstateAlloc {
+		return research.SubstateAlloc{
+			addr1: research.NewSubstateAccount(1, big.NewInt(balances[0]), nil),
+			addr2: research.NewSubstateAccount(1, big.NewInt(balances[1]), nil),
+		}
+	}
+	key := newDivergenceKey(false, "alloc", alloc(1, 1), alloc(2, 1))
+
+	tests := []struct {
+		name       string
+		divergence string
+		mutAlloc   research.SubstateAlloc
+		want       bool
+	}{
+		{"same account", "alloc", alloc(3, 1), true},
+		{"same account and another one", "alloc", alloc(3, 2), true},
+		{"other account", "alloc", alloc(1, 2), false},
+		{"other divergence", "original message: status", alloc(2, 1), false},
+	}
+	for _, tt := range tests {
+		if got := key.matches(false, tt.divergence, alloc(1, 1), tt.mutAlloc); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// msgOutcome is everything a replayed message exposes besides its post-state
+type msgOutcome struct {
+	To         common.Address   `json:"to"`
+	Failed     bool             `json:"failed"`
+	Err        string           `json:"err,omitempty"`
+	ReturnData hexutil.Bytes    `json:"returnData"`
+	Logs       []*types.Log     `json:"logs"`
+	Deleted    []common.Address `json:"deleted,omitempty"`
+	// branches and storage slots of inner contracts reached first
+	NewCoverage int `json:"-"`
+}
+
+func newMsgOutcome(message types.Message, result *core.ExecutionResult, logs []*types.Log, preAlloc, postAlloc research.SubstateAlloc) *msgOutcome {
+	outcome := &msgOutcome{
+		Failed:     result.Failed(),
+		ReturnData: common.CopyBytes(result.ReturnData),
+		Logs:       logs,
+	}
+	if to := message.To(); to != nil {
+		outcome.To = *to
+	}
+	if result.Err != nil {
+		outcome.Err = result.Err.Error()
+	}
+	// accounts loaded by the message but missing from the post-state were
+	// destructed (or cleared as empty) during execution
+	for addr := range preAlloc {
+		if _, exist := postAlloc[addr]; !exist {
+			outcome.Deleted = append(outcome.Deleted, addr)
+		}
+	}
+	return outcome
+}
+
+// Equal compares status, return data and emitted logs of two outcomes, and
+// returns a short description of the first difference found. Logs are
+// compared in emission order if ordered, and as a multiset otherwise.
+func (x *msgOutcome) Equal(y *msgOutcome, ordered bool) (string, bool) {
+	if x == y {
+		return "", true
+	}
+	if x == nil || y == nil {
+		return "missing outcome", false
+	}
+	if x.Failed != y.Failed {
+		return fmt.Sprintf("status %v/%v", x.Failed, y.Failed), false
+	}
+	if !bytes.Equal(x.ReturnData, y.ReturnData) {
+		return "return data", false
+	}
+	if len(x.Logs) != len(y.Logs) {
+		return fmt.Sprintf("#logs %d/%d", len(x.Logs), len(y.Logs)), false
+	}
+	xLogs, yLogs := x.Logs, y.Logs
+	if !ordered {
+		xLogs, yLogs = sortedLogs(xLogs), sortedLogs(yLogs)
+	}
+	for i, xl := range xLogs {
+		if !logEqual(xl, yLogs[i]) {
+			return fmt.Sprintf("log of %s", xl.Address.Hex()), false
+		}
+	}
+	return "", true
+}
+
+func logEqual(x *types.Log, y *types.Log) bool {
+	if x.Address != y.Address ||
+		len(x.Topics) != len(y.Topics) ||
+		!bytes.Equal(x.Data, y.Data) {
+		return false
+	}
+	for i, xt := range x.Topics {
+		if xt != y.Topics[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedLogs orders logs by content, so that the same set of events emitted
+// in a different interleaving still compares equal
+func sortedLogs(logs []*types.Log) []*types.Log {
+	sorted := make([]*types.Log, len(logs))
+	copy(sorted, logs)
+	key := func(l *types.Log) []byte {
+		k := append([]byte{}, l.Address.Bytes()...)
+		for _, t := range l.Topics {
+			k = append(k, t.Bytes()...)
+		}
+		return append(k, l.Data...)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(key(sorted[i]), key(sorted[j])) < 0
+	})
+	return sorted
+}
+
+// mergePostAlloc completes the touched-only post-state of a message with the
+// untouched accounts of its pre-state. In strict mode accounts deleted by the
+// message are not resurrected from the pre-state.
+func mergePostAlloc(postAlloc *research.SubstateAlloc, preAlloc research.SubstateAlloc, outcome *msgOutcome, strict bool) {
+	research.UpdateSubstate(postAlloc, preAlloc, false, true)
+	if strict && outcome != nil {
+		for _, addr := range outcome.Deleted {
+			delete(*postAlloc, addr)
+		}
+	}
+}
+
+// siOracle decides whether two executions of the same messages are consistent.
+// The default oracle compares the storage and balance of accounts in oriAlloc;
+// the strict oracle compares both allocs symmetrically and the outcome of each
+// message, including the emission order of its logs. It returns the divergent address and a description of the divergence.
+func siOracle(strict bool, oriAlloc, mutAlloc research.SubstateAlloc, oriOutcomes, mutOutcomes map[string]*msgOutcome) (string, string, bool) {
+	if !strict {
+		addr, equal := oriAlloc.AllStateEqual(mutAlloc)
+		return addr, "alloc", equal
+	}
+
+	if addr, equal := oriAlloc.StrictStateEqual(mutAlloc); !equal {
+		return addr, "alloc", false
+	}
+
+	labels := make([]string, 0, len(oriOutcomes))
+	for label := range oriOutcomes {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		oriOutcome := oriOutcomes[label]
+		if reason, equal := oriOutcome.Equal(mutOutcomes[label], true); !equal {
+			return oriOutcome.To.String(), label + " message: " + reason, false
+		}
+	}
+	return "", "", true
+}
+
+// revertRecord describes a message whose success depends on the ordering
+type revertRecord struct {
+	Message  string        `json:"message"`
+	Ordering string        `json:"revertedIn"`
+	Reason   string        `json:"reason"`
+	Data     hexutil.Bytes `json:"data"`
+}
+
+// revertDivergence lists the messages that revert in exactly one of the two
+// orderings, with their revert data decoded against the ABIs of contracts
+func revertDivergence(oriOrdering, mutOrdering string, oriOutcomes, mutOutcomes map[string]*msgOutcome, contracts []string) []revertRecord {
+	var records []revertRecord
+
+	labels := make([]string, 0, len(oriOutcomes))
+	for label := range oriOutcomes {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		oriOutcome, mutOutcome := oriOutcomes[label], mutOutcomes[label]
+		if mutOutcome == nil || oriOutcome.Failed == mutOutcome.Failed {
+			continue
+		}
+		reverted, ordering := oriOutcome, oriOrdering
+		if mutOutcome.Failed {
+			reverted, ordering = mutOutcome, mutOrdering
+		}
+		reason := fuzz.DecodeRevert(append([]string{strings.ToLower(reverted.To.String())}, contracts...), reverted.ReturnData)
+		if reason == "" {
+			reason = reverted.Err
+		}
+		records = append(records, revertRecord{
+			Message:  label,
+			Ordering: ordering,
+			Reason:   reason,
+			Data:     reverted.ReturnData,
+		})
+	}
+	return records
+}
@@ -0,0 +1,223 @@
+package replay
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestSIOracle(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		created  = common.BytesToAddress([]byte("created"))
+		slot     = common.BytesToHash([]byte("slot"))
+	)
+	account := func(nonce uint64, balance int64, value byte) *research.SubstateAccount {
+		sa := research.NewSubstateAccount(nonce, big.NewInt(balance), nil)
+		if value != 0 {
+			sa.Storage[slot] = common.BytesToHash([]byte{value})
+		}
+		return sa
+	}
+	outcome := func(failed bool, ret string, logs ...*types.Log) map[string]*msgOutcome {
+		return map[string]*msgOutcome{
+			"original": {To: contract, Failed: failed, ReturnData: common.FromHex(ret), Logs: logs},
+		}
+	}
+	log1 := &types.Log{Address: contract, Topics: []common.Hash{slot}}
+	log2 := &types.Log{Address: contract, Data: []byte{1}}
+
+	tests := []struct {
+		name                 string
+		oriAlloc, mutAlloc   research.SubstateAlloc
+		oriOutcomes          map[string]*msgOutcome
+		mutOutcomes          map[string]*msgOutcome
+		wantDefault          bool
+		wantStrict           bool
+		wantStrictDivergence string
+	}{
+		{
+			name:        "consistent",
+			oriAlloc:    research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:    research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes: outcome(false, "0x01", log1, log2),
+			mutOutcomes: outcome(false, "0x01", log1, log2),
+			wantDefault: true,
+			wantStrict:  true,
+		},
+		{
+			name:                 "reordered logs",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, "0x01", log1, log2),
+			mutOutcomes:          outcome(false, "0x01", log2, log1),
+			wantDefault:          true,
+			wantStrictDivergence: "original message: log of " + contract.Hex(),
+		},
+		{
+			name:                 "storage",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 2)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          outcome(false, ""),
+			wantStrictDivergence: "alloc",
+		},
+		{
+			name:                 "slot written on the mutated side only",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 0)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          outcome(false, ""),
+			wantDefault:          true,
+			wantStrictDivergence: "alloc",
+		},
+		{
+			name:                 "account created on the mutated side only",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1), created: account(1, 0, 0)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          outcome(false, ""),
+			wantDefault:          true,
+			wantStrictDivergence: "alloc",
+		},
+		{
+			name:                 "nonce",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(2, 10, 1)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          outcome(false, ""),
+			wantDefault:          true,
+			wantStrictDivergence: "alloc",
+		},
+		{
+			name:                 "status",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          outcome(true, ""),
+			wantDefault:          true,
+			wantStrictDivergence: "original message: status false/true",
+		},
+		{
+			name:                 "return data",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, "0x01"),
+			mutOutcomes:          outcome(false, "0x02"),
+			wantDefault:          true,
+			wantStrictDivergence: "original message: return data",
+		},
+		{
+			name:                 "logs",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, "", log1),
+			mutOutcomes:          outcome(false, "", log2),
+			wantDefault:          true,
+			wantStrictDivergence: "original message: log of " + contract.Hex(),
+		},
+		{
+			name:                 "missing outcome",
+			oriAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			mutAlloc:             research.SubstateAlloc{contract: account(1, 10, 1)},
+			oriOutcomes:          outcome(false, ""),
+			mutOutcomes:          map[string]*msgOutcome{},
+			wantDefault:          true,
+			wantStrictDivergence: "original message: missing outcome",
+		},
+	}
+	for _, tt := range tests {
+		if _, _, consistent := siOracle(false, tt.oriAlloc, tt.mutAlloc, tt.oriOutcomes, tt.mutOutcomes); consistent != tt.wantDefault {
+			t.Errorf("%s: default oracle consistent = %v, want %v", tt.name, consistent, tt.wantDefault)
+		}
+		_, divergence, consistent := siOracle(true, tt.oriAlloc, tt.mutAlloc, tt.oriOutcomes, tt.mutOutcomes)
+		if consistent != tt.wantStrict {
+			t.Errorf("%s: strict oracle consistent = %v, want %v", tt.name, consistent, tt.wantStrict)
+		}
+		if divergence != tt.wantStrictDivergence {
+			t.Errorf("%s: strict oracle divergence %q, want %q", tt.name, divergence, tt.wantStrictDivergence)
+		}
+	}
+}
+
+func TestMsgOutcomeEqualLogOrder(t *testing.T) {
+	contract := common.BytesToAddress([]byte("contract"))
+	log1 := &types.Log{Address: contract, Data: []byte{1}}
+	log2 := &types.Log{Address: contract, Data: []byte{2}}
+	tests := []struct {
+		name    string
+		x, y    []*types.Log
+		ordered bool
+		want    bool
+	}{
+		{"same order", []*types.Log{log1, log2}, []*types.Log{log1, log2}, true, true},
+		{"reordered", []*types.Log{log1, log2}, []*types.Log{log2, log1}, true, false},
+		{"reordered, unordered", []*types.Log{log1, log2}, []*types.Log{log2, log1}, false, true},
+		{"duplicated, unordered", []*types.Log{log1, log1}, []*types.Log{log1, log2}, false, false},
+	}
+	for _, tt := range tests {
+		x, y := &msgOutcome{To: contract, Logs: tt.x}, &msgOutcome{To: contract, Logs: tt.y}
+		if _, equal := x.Equal(y, tt.ordered); equal != tt.want {
+			t.Errorf("%s: Equal = %v, want %v", tt.name, equal, tt.want)
+		}
+	}
+}
+
+func TestRevertDivergence(t *testing.T) {
+	contract := common.BytesToAddress([]byte("contract"))
+	outcomes := func(original, additional bool) map[string]*msgOutcome {
+		outcomes := map[string]*msgOutcome{"original": {To: contract, Failed: original}}
+		if additional {
+			outcomes["additional"] = &msgOutcome{To: contract, Failed: true, ReturnData: common.FromHex("0x12345678")}
+		} else {
+			outcomes["additional"] = &msgOutcome{To: contract}
+		}
+		return outcomes
+	}
+
+	tests := []struct {
+		name        string
+		oriOutcomes map[string]*msgOutcome
+		mutOutcomes map[string]*msgOutcome
+		want        []revertRecord
+	}{
+		{
+			name:        "no reverts",
+			oriOutcomes: outcomes(false, false),
+			mutOutcomes: outcomes(false, false),
+		},
+		{
+			name:        "reverts in both orderings",
+			oriOutcomes: outcomes(true, true),
+			mutOutcomes: outcomes(true, true),
+		},
+		{
+			name:        "additional reverts when sent first",
+			oriOutcomes: outcomes(false, false),
+			mutOutcomes: outcomes(false, true),
+			want:        []revertRecord{{Message: "additional", Ordering: "additional-first", Reason: "0x12345678", Data: common.FromHex("0x12345678")}},
+		},
+		{
+			name:        "original reverts when sent first",
+			oriOutcomes: outcomes(true, false),
+			mutOutcomes: outcomes(false, false),
+			want:        []revertRecord{{Message: "original", Ordering: "original-first"}},
+		},
+		{
+			name:        "original not replayed",
+			oriOutcomes: outcomes(false, false),
+			mutOutcomes: map[string]*msgOutcome{"additional": {To: contract, Failed: true}},
+			want:        []revertRecord{{Message: "additional", Ordering: "additional-first"}},
+		},
+	}
+	for _, tt := range tests {
+		got := revertDivergence("original-first", "additional-first", tt.oriOutcomes, tt.mutOutcomes, nil)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: revertDivergence = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
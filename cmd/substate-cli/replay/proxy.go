@@ -0,0 +1,149 @@
+package replay
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	// slots holding the implementation of EIP-1967, EIP-1822 (UUPS) and
+	// legacy ZeppelinOS proxies
+	implementationSlots = []common.Hash{
+		common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"),
+		common.HexToHash("0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7"),
+		common.HexToHash("0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3"),
+	}
+	// slot holding the beacon of EIP-1967 beacon proxies
+	beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+	// implementation() of beacons
+	implementationSelector = common.FromHex("0x5c60da1b")
+)
+
+// delegateRecorder records the DELEGATECALLs forwarding the calldata an inner
+// contract was called with, as a proxy does
+type delegateRecorder struct {
+	inputs          map[common.Address][][]byte
+	implementations map[common.Address]common.Address
+}
+
+// InterceptCall implements vm.CallInterceptor
+func (rec *delegateRecorder) InterceptCall(frame *vm.CallFrame) *vm.CallInjection {
+	if frame.Op != vm.DELEGATECALL {
+		rec.inputs[frame.Callee] = append(rec.inputs[frame.Callee], frame.Input)
+		return nil
+	}
+	if !isInnerContract(frame.Caller) {
+		return nil
+	}
+	for _, input := range rec.inputs[frame.Caller] {
+		if len(input) >= 4 && bytes.Equal(input, frame.Input) {
+			rec.implementations[frame.Caller] = frame.Callee
+			break
+		}
+	}
+	return nil
+}
+
+// slotAddress reads an address stored in slot of account
+func slotAddress(account *research.SubstateAccount, slot common.Hash) (common.Address, bool) {
+	value, exist := account.Storage[slot]
+	if !exist || value == (common.Hash{}) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(value[12:]), true
+}
+
+var (
+	// implementation of each resolved proxy, or the zero address for inner
+	// contracts seen not to forward their calls
+	resolvedProxies     = make(map[common.Address]common.Address)
+	resolvedProxiesLock sync.RWMutex
+)
+
+func resolvedProxy(addr common.Address) bool {
+	resolvedProxiesLock.RLock()
+	defer resolvedProxiesLock.RUnlock()
+	_, exist := resolvedProxies[addr]
+	return exist
+}
+
+// resolveProxies detects the inner contracts of substate that are proxies,
+// from their implementation and beacon slots or else from the DELEGATECALLs of
+// the transaction. Each proxy is resolved once, the first time it is loaded or
+// called. Messages to a proxy are then built from the abi of its
+// implementation, which is synthesized from the code if it has no abi file.
+func resolveProxies(block uint64, tx int, substate *research.Substate) error {
+	alloc := substate.InputAlloc
+	implementations := make(map[common.Address]common.Address)
+	probe := NewStorageProbe(substate.Env)
+	for addr, account := range alloc {
+		if len(account.Code) == 0 || !isInnerContract(addr) || resolvedProxy(addr) {
+			continue
+		}
+		for _, slot := range implementationSlots {
+			if impl, exist := slotAddress(account, slot); exist {
+				implementations[addr] = impl
+				break
+			}
+		}
+		if _, exist := implementations[addr]; exist {
+			continue
+		}
+		if beacon, exist := slotAddress(account, beaconSlot); exist {
+			ret, _, err := probe(alloc, beacon, implementationSelector)
+			if err == nil && len(ret) == 32 {
+				implementations[addr] = common.BytesToAddress(ret[12:])
+			}
+		}
+	}
+
+	// proxies with a custom layout are seen forwarding calls, in a replay
+	// without coverage as it is not a fuzzing message
+	msg := substate.Message
+	if msg.To != nil && isInnerContract(*msg.To) && !resolvedProxy(*msg.To) {
+		rec := &delegateRecorder{
+			inputs:          map[common.Address][][]byte{*msg.To: {msg.Data}},
+			implementations: make(map[common.Address]common.Address),
+		}
+		recorderAlloc := alloc.Copy()
+		fundSenders(recorderAlloc, msg.AsMessage())
+		if _, _, err := replayTracedMsgs(block, tx, recorderAlloc, *substate.Env, msg.AsMessage(), rec, false); err != nil {
+			return err
+		}
+		for proxy, impl := range rec.implementations {
+			if _, exist := implementations[proxy]; !exist && !resolvedProxy(proxy) {
+				implementations[proxy] = impl
+			}
+		}
+		if _, exist := implementations[*msg.To]; !exist {
+			implementations[*msg.To] = common.Address{}
+		}
+	}
+
+	resolvedProxiesLock.Lock()
+	defer resolvedProxiesLock.Unlock()
+	for proxy, impl := range implementations {
+		if impl == (common.Address{}) {
+			resolvedProxies[proxy] = impl
+			continue
+		}
+		implAddr := strings.ToLower(impl.String())
+		fuzz.SetImplementation(strings.ToLower(proxy.String()), implAddr)
+		if !fuzz.HasABI(implAddr) {
+			// the implementation is loaded by later transactions otherwise
+			account, exist := alloc[impl]
+			if !exist || len(account.Code) == 0 {
+				continue
+			}
+			fuzz.SynthesizeABI(implAddr, account.Code)
+		}
+		resolvedProxies[proxy] = impl
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package replay
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// newForwardingProxy returns the code of a proxy forwarding its calldata to
+// impl with DELEGATECALL
+func newForwardingProxy(impl common.Address) []byte {
+	// CALLDATACOPY(0, 0, CALLDATASIZE) PUSH1 0 DUP1 CALLDATASIZE DUP2 PUSH20 impl
+	code := append(common.FromHex("0x3660008037600080368173"), impl.Bytes()...)
+	return append(code, 0x5a, 0xf4, 0x50, 0x00) // DELEGATECALL(GAS, impl, 0, CALLDATASIZE, 0, 0) STOP
+}
+
+func TestResolveProxies(t *testing.T) {
+	var (
+		slotProxy     = common.BytesToAddress([]byte("slot proxy"))
+		slotImpl      = common.BytesToAddress([]byte("slot impl"))
+		upgradedImpl  = common.BytesToAddress([]byte("upgraded impl"))
+		customProxy   = common.BytesToAddress([]byte("custom proxy"))
+		customImpl    = common.BytesToAddress([]byte("custom impl"))
+		notProxy      = common.BytesToAddress([]byte("not proxy"))
+		dispatchBytes = common.FromHex("0x6370a08231801450") // PUSH4 balanceOf DUP1 EQ POP
+	)
+	defer func(seed []fuzz.SeedItem, enabled bool) {
+		fuzz.GlobalInnerSeed, coverageEnabled = seed, enabled
+		resolvedProxies = make(map[common.Address]common.Address)
+		globalCoverage = make(map[common.Address]*contractCoverage)
+	}(fuzz.GlobalInnerSeed, coverageEnabled)
+	for _, addr := range []common.Address{slotProxy, customProxy, notProxy} {
+		fuzz.GlobalInnerSeed = append(fuzz.GlobalInnerSeed, fuzz.SeedItem{Value: strings.ToLower(addr.String())})
+	}
+	coverageEnabled = true
+	resolvedProxies = make(map[common.Address]common.Address)
+	globalCoverage = make(map[common.Address]*contractCoverage)
+
+	newSubstate := func(to common.Address, impl common.Address) *research.Substate {
+		alloc := newTestAlloc()
+		alloc[slotProxy] = research.NewSubstateAccount(1, new(big.Int), []byte{0x00})
+		alloc[slotProxy].Storage[implementationSlots[0]] = common.BytesToHash(impl.Bytes())
+		alloc[slotImpl] = research.NewSubstateAccount(1, new(big.Int), append(dispatchBytes, 0x00))
+		alloc[customProxy] = research.NewSubstateAccount(1, new(big.Int), newForwardingProxy(customImpl))
+		alloc[customImpl] = research.NewSubstateAccount(1, new(big.Int), append(dispatchBytes, 0x00))
+		alloc[notProxy] = research.NewSubstateAccount(1, new(big.Int), []byte{0x00})
+		msg := newTestMsg(testSender, to)
+		message := research.NewSubstateMessage(&msg)
+		message.Nonce = alloc[testSender].Nonce
+		message.Data = common.FromHex("0x70a08231") // balanceOf, forwarded by the custom proxy
+		env := testEnv
+		env.Number = 5000000 // DELEGATECALL
+		return research.NewSubstate(alloc, research.SubstateAlloc{}, &env, message, &research.SubstateResult{Status: 1})
+	}
+
+	if err := resolveProxies(1, 0, newSubstate(customProxy, slotImpl)); err != nil {
+		t.Fatalf("resolveProxies error %v", err)
+	}
+	if err := resolveProxies(1, 1, newSubstate(notProxy, slotImpl)); err != nil {
+		t.Fatalf("resolveProxies error %v", err)
+	}
+	// proxies are resolved once
+	if err := resolveProxies(2, 0, newSubstate(customProxy, upgradedImpl)); err != nil {
+		t.Fatalf("resolveProxies error %v", err)
+	}
+
+	for proxy, want := range map[common.Address]common.Address{slotProxy: slotImpl, customProxy: customImpl} {
+		if got := fuzz.GetImplementation(strings.ToLower(proxy.String())); got != strings.ToLower(want.String()) {
+			t.Errorf("implementation of %s = %s, want %s", proxy.Hex(), got, want.Hex())
+		}
+		if !fuzz.HasABI(strings.ToLower(want.String())) {
+			t.Errorf("no abi synthesized for %s", want.Hex())
+		}
+	}
+	if impl, exist := resolvedProxies[notProxy]; !exist || impl != (common.Address{}) {
+		t.Errorf("contract without forwarding resolved to %s (resolved %v)", impl.Hex(), exist)
+	}
+	if got := fuzz.GetImplementation(strings.ToLower(notProxy.String())); got != "" {
+		t.Errorf("implementation %s set for a contract without forwarding", got)
+	}
+	// the forwarding replay is no fuzzing feedback
+	if len(globalCoverage) != 0 {
+		t.Errorf("coverage of %d contracts recorded while resolving proxies", len(globalCoverage))
+	}
+}
@@ -22,13 +22,17 @@ var ReplayCommand = cli.Command{
 	Name:      "replay",
 	Usage:     "executes full state transitions and check output consistency",
 	ArgsUsage: "<blockNumFirst> <blockNumLast>",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		research.WorkersFlag,
 		research.SkipTransferTxsFlag,
 		research.SkipCallTxsFlag,
 		research.SkipCreateTxsFlag,
 		research.SubstateDirFlag,
-	},
+		research.SubstateCacheFlag,
+		research.SubstateHandlesFlag,
+		research.BlockCacheFlag,
+		research.PrefetchFlag,
+	}, research.MetricsFlags...),
 	Description: `
 The substate-cli replay command requires two arguments:
 <blockNumFirst> <blockNumLast>
@@ -37,16 +41,14 @@ The substate-cli replay command requires two arguments:
 last block of the inclusive range of blocks to replay transactions.`,
 }
 
-// replayTask replays a transaction substate
-func replayTask(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
+// replaySubstate executes the message of a transaction substate on its input
+// alloc, and returns the result and post-state of the EVM
+func replaySubstate(tx int, substate *research.Substate) (*research.SubstateResult, research.SubstateAlloc, error) {
 
 	inputAlloc := substate.InputAlloc
 	inputEnv := substate.Env
 	inputMessage := substate.Message
 
-	outputAlloc := substate.OutputAlloc
-	outputResult := substate.Result
-
 	var (
 		vmConfig    vm.Config
 		chainConfig *params.ChainConfig
@@ -106,7 +108,7 @@ func replayTask(block uint64, tx int, substate *research.Substate, taskPool *res
 
 	tracer, err := getTracerFn(txIndex, txHash)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	vmConfig.Tracer = tracer
 	vmConfig.Debug = (tracer != nil)
@@ -123,11 +125,11 @@ func replayTask(block uint64, tx int, substate *research.Substate, taskPool *res
 
 	if err != nil {
 		statedb.RevertToSnapshot(snapshot)
-		return err
+		return nil, nil, err
 	}
 
 	if hashError != nil {
-		return hashError
+		return nil, nil, hashError
 	}
 
 	if chainConfig.IsByzantium(blockCtx.BlockNumber) {
@@ -151,6 +153,24 @@ func replayTask(block uint64, tx int, substate *research.Substate, taskPool *res
 
 	evmAlloc := statedb.ResearchPostAlloc
 
+	return evmResult, evmAlloc, nil
+}
+
+// replayTask replays a transaction substate
+func replayTask(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
+
+	inputAlloc := substate.InputAlloc
+	inputEnv := substate.Env
+	inputMessage := substate.Message
+
+	outputAlloc := substate.OutputAlloc
+	outputResult := substate.Result
+
+	evmResult, evmAlloc, err := replaySubstate(tx, substate)
+	if err != nil {
+		return err
+	}
+
 	r := outputResult.Equal(evmResult)
 	a := outputAlloc.Equal(evmAlloc)
 	if !(r && a) {
@@ -181,6 +201,22 @@ func replayTask(block uint64, tx int, substate *research.Substate, taskPool *res
 	return nil
 }
 
+// VerifySubstate re-executes a transaction substate, and checks that the EVM
+// reproduces its recorded result and output alloc
+func VerifySubstate(tx int, substate *research.Substate) error {
+	evmResult, evmAlloc, err := replaySubstate(tx, substate)
+	if err != nil {
+		return err
+	}
+	if !substate.Result.Equal(evmResult) {
+		return fmt.Errorf("inconsistent output: result")
+	}
+	if !substate.OutputAlloc.Equal(evmAlloc) {
+		return fmt.Errorf("inconsistent output: alloc")
+	}
+	return nil
+}
+
 // record-replay: func replayAction for replay command
 func replayAction(ctx *cli.Context) error {
 	var err error
@@ -202,6 +238,9 @@ func replayAction(ctx *cli.Context) error {
 	}
 
 	research.SetSubstateFlags(ctx)
+	if err = research.SetupMetrics(ctx); err != nil {
+		return fmt.Errorf("substate-cli replay: %v", err)
+	}
 	research.OpenSubstateDBReadOnly()
 	defer research.CloseSubstateDB()
 
@@ -27,14 +27,22 @@ var ReplayForkCommand = cli.Command{
 	Name:      "replay-fork",
 	Usage:     "executes and check output consistency of all transactions in the range with the given hard-fork",
 	ArgsUsage: "<blockNumFirst> <blockNumLast>",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		research.WorkersFlag,
 		research.SkipTransferTxsFlag,
 		research.SkipCallTxsFlag,
 		research.SkipCreateTxsFlag,
 		HardForkFlag,
+		ForkFlag,
+		ChainConfigFlag,
+		EipsFlag,
+		ForkReportFlag,
 		research.SubstateDirFlag,
-	},
+		research.SubstateCacheFlag,
+		research.SubstateHandlesFlag,
+		research.BlockCacheFlag,
+		research.PrefetchFlag,
+	}, research.MetricsFlags...),
 	Description: `
 The replay-fork command requires two arguments:
 <blockNumFirst> <blockNumLast>
@@ -42,7 +50,12 @@ The replay-fork command requires two arguments:
 <blockNumFirst> and <blockNumLast> are the first and
 last block of the inclusive range of blocks to replay transactions.
 
---hard-fork parameter is recommended for this command.`,
+--hard-fork parameter is recommended for this command. Any fork of tests.Forks
+can be selected by name with --fork instead, and adjusted with --chain-config
+and --eips.
+
+Besides the aggregate error counts, a report of the gas deltas, new reverts
+and storage changes is printed for each contract and function selector.`,
 }
 
 var HardForkName = map[int64]string{
@@ -55,19 +68,31 @@ var HardForkName = map[int64]string{
 	9_069_000:  "Istanbul",
 	12_244_000: "Berlin",
 	12_965_000: "London",
+	13_773_000: "Arrow Glacier",
+}
+
+// the tests.Forks config of each HardForkName
+var hardForkConfig = map[int64]string{
+	1:          "Frontier",
+	1_150_000:  "Homestead",
+	2_463_000:  "EIP150", // Tangerine Whistle
+	2_675_000:  "EIP158", // Spurious Dragon
+	4_370_000:  "Byzantium",
+	7_280_000:  "ConstantinopleFix",
+	9_069_000:  "Istanbul",
+	12_244_000: "Berlin",
+	12_965_000: "London",
+	13_773_000: "ArrowGlacier",
 }
 
+// the --hard-fork default, kept at London when later forks are added
+const hardForkDefault int64 = 12_965_000
+
 func hardForkFlagDefault() int64 {
-	var v int64 = 0
-	for num64 := range HardForkName {
-		if num64 > v {
-			v = num64
-		}
-	}
-	if v <= 0 {
-		panic(fmt.Errorf("substate-cli replay-fork: corrupted --hard-fork default value: %v", v))
+	if _, exist := HardForkName[hardForkDefault]; !exist {
+		panic(fmt.Errorf("substate-cli replay-fork: corrupted --hard-fork default value: %v", hardForkDefault))
 	}
-	return v
+	return hardForkDefault
 }
 
 var HardForkFlag = cli.Int64Flag{
@@ -89,8 +114,38 @@ var HardForkFlag = cli.Int64Flag{
 	Value: hardForkFlagDefault(),
 }
 
+var ForkFlag = cli.StringFlag{
+	Name: "fork",
+	Usage: func() string {
+		names := make([]string, 0, len(tests.Forks))
+		for name := range tests.Forks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "Fork rules of tests.Forks to replay with, overriding --hard-fork: " + strings.Join(names, ", ")
+	}(),
+}
+
+var ChainConfigFlag = cli.StringFlag{
+	Name:  "chain-config",
+	Usage: "JSON file of chain config fields overriding the fork, e.g. {\"londonBlock\": null} to turn London off",
+}
+
+var EipsFlag = cli.StringFlag{
+	Name:  "eips",
+	Usage: "Comma-separated EIPs to enable on top of the fork: " + strings.Join(vm.ActivateableEips(), ", "),
+}
+
+var ForkReportFlag = cli.StringFlag{
+	Name:  "fork-report",
+	Usage: "JSON file to write the per-contract and per-selector impact report to",
+}
+
 var ReplayForkChainConfig *params.ChainConfig = &params.ChainConfig{}
 
+// EIPs enabled on top of ReplayForkChainConfig
+var ReplayForkExtraEips []int
+
 type ReplayForkStat struct {
 	Count  int64
 	ErrStr string
@@ -126,7 +181,7 @@ func replayForkTask(block uint64, tx int, substate *research.Substate, taskPool
 		getTracerFn func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error)
 	)
 
-	vmConfig = vm.Config{}
+	vmConfig = vm.Config{ExtraEips: append([]int{}, ReplayForkExtraEips...)}
 
 	getTracerFn = func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error) {
 		return nil, nil
@@ -190,8 +245,10 @@ func replayForkTask(block uint64, tx int, substate *research.Substate, taskPool
 	snapshot := statedb.Snapshot()
 	msgResult, err := core.ApplyMessage(evm, msg, gaspool)
 
+	impactKey := forkImpactKeyOf(inputMessage, outputResult.ContractAddress)
 	if err != nil {
 		statedb.RevertToSnapshot(snapshot)
+		recordForkImpact(impactKey, outputResult, nil, outputAlloc, nil)
 		stat = &ReplayForkStat{
 			Count:  1,
 			ErrStr: strings.Split(err.Error(), ":")[0],
@@ -219,6 +276,7 @@ func replayForkTask(block uint64, tx int, substate *research.Substate, taskPool
 	evmResult.GasUsed = msgResult.UsedGas
 
 	evmAlloc := statedb.ResearchPostAlloc
+	recordForkImpact(impactKey, outputResult, evmResult, outputAlloc, evmAlloc)
 
 	if r, a := outputResult.Equal(evmResult), outputAlloc.Equal(evmAlloc); !(r && a) {
 		if outputResult.Status == types.ReceiptStatusSuccessful &&
@@ -350,33 +408,40 @@ func replayForkAction(ctx *cli.Context) error {
 	}
 
 	hardFork := ctx.Int64(HardForkFlag.Name)
-	if hardForkName, exist := HardForkName[hardFork]; !exist {
-		return fmt.Errorf("substate-cli replay-fork: invalid hard-fork block number %v", hardFork)
+	forkName := ctx.String(ForkFlag.Name)
+	if forkName == "" {
+		if hardForkName, exist := HardForkName[hardFork]; !exist {
+			return fmt.Errorf("substate-cli replay-fork: invalid hard-fork block number %v", hardFork)
+		} else {
+			fmt.Printf("substate-cli replay-fork: hard-fork: block %v (%s)\n", hardFork, hardForkName)
+		}
+		forkName = hardForkConfig[hardFork]
 	} else {
-		fmt.Printf("substate-cli replay-fork: hard-fork: block %v (%s)\n", hardFork, hardForkName)
+		fmt.Printf("substate-cli replay-fork: fork: %s\n", forkName)
 	}
-	switch hardFork {
-	case 1:
-		*ReplayForkChainConfig = *tests.Forks["Frontier"]
-	case 1_150_000:
-		*ReplayForkChainConfig = *tests.Forks["Homestead"]
-	case 2_463_000:
-		*ReplayForkChainConfig = *tests.Forks["EIP150"] // Tangerine Whistle
-	case 2_675_000:
-		*ReplayForkChainConfig = *tests.Forks["EIP158"] // Spurious Dragon
-	case 4_370_000:
-		*ReplayForkChainConfig = *tests.Forks["Byzantium"]
-	case 7_280_000:
-		*ReplayForkChainConfig = *tests.Forks["ConstantinopleFix"]
-	case 9_069_000:
-		*ReplayForkChainConfig = *tests.Forks["Istanbul"]
-	case 12_244_000:
-		*ReplayForkChainConfig = *tests.Forks["Berlin"]
-	case 12_965_000:
-		*ReplayForkChainConfig = *tests.Forks["London"]
+	chainConfig, err := forkChainConfig(forkName)
+	if err != nil {
+		return fmt.Errorf("substate-cli replay-fork: %v", err)
+	}
+	if path := ctx.String(ChainConfigFlag.Name); path != "" {
+		if err = overrideChainConfig(chainConfig, path); err != nil {
+			return fmt.Errorf("substate-cli replay-fork: error in parsing --chain-config: %v", err)
+		}
+		fmt.Printf("substate-cli replay-fork: chain config: %v\n", chainConfig)
+	}
+	*ReplayForkChainConfig = *chainConfig
+	ReplayForkExtraEips, err = parseEips(ctx.String(EipsFlag.Name))
+	if err != nil {
+		return fmt.Errorf("substate-cli replay-fork: %v", err)
+	}
+	if len(ReplayForkExtraEips) > 0 {
+		fmt.Printf("substate-cli replay-fork: extra EIPs: %v\n", ReplayForkExtraEips)
 	}
 
 	research.SetSubstateFlags(ctx)
+	if err = research.SetupMetrics(ctx); err != nil {
+		return fmt.Errorf("substate-cli replay-fork: %v", err)
+	}
 	research.OpenSubstateDBReadOnly()
 	defer research.CloseSubstateDB()
 
@@ -416,5 +481,9 @@ func replayForkAction(ctx *cli.Context) error {
 		fmt.Printf("substate-cli replay-fork: %12v %s\n", count, errstr)
 	}
 
+	if reportErr := printForkImpacts(ctx.String(ForkReportFlag.Name)); reportErr != nil && err == nil {
+		err = fmt.Errorf("substate-cli replay-fork: error in writing --fork-report: %v", reportErr)
+	}
+
 	return err
 }
@@ -18,12 +18,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/research"
 	cli "gopkg.in/urfave/cli.v1"
@@ -35,17 +38,34 @@ var ReplaySICommand = cli.Command{
 	Name:      "replay-SI",
 	Usage:     "executes full state transitions and check state consistency",
 	ArgsUsage: "<blockNumFirst> <blockNumLast> --dappDir <path-to-dapp.dir> --substateDir <path-to-recorder.datadir>",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		research.WorkersFlag,
 		research.SkipEnvFlag,
 		research.SkipTodFlag,
 		research.SkipManiFlag,
 		research.SkipHookFlag,
+		research.HookSitesFlag,
+		research.SenderRolesFlag,
+		research.SkipRoReentrancyFlag,
+		research.SkipSandwichFlag,
+		research.SkipCrossBlockFlag,
+		research.SkipInitFlag,
+		research.SkipMinimizeFlag,
+		research.MaxMsgsPerTxFlag,
+		research.TimePerTxFlag,
+		research.TotalTimeFlag,
+		research.SkipCoverageFlag,
+		research.StrictOracleFlag,
+		research.FlashLoanFlag,
 		research.RichInfoFlag,
 		research.GigahorseFlag,
 		research.SubstateDirFlag,
+		research.SubstateCacheFlag,
+		research.SubstateHandlesFlag,
+		research.BlockCacheFlag,
+		research.PrefetchFlag,
 		research.DappDirFlag,
-	},
+	}, research.MetricsFlags...),
 	Description: `
 The substate-cli replay-mt command requires four arguments:
 <blockNumFirst> <blockNumLast> <path-to-dapp.dir> <path-to-recorder.datadir>
@@ -58,7 +78,6 @@ and the path of substate that previously replay`,
 }
 
 var (
-	tenEther        *big.Int
 	errorLogFile    *os.File
 	bugLogFile      *os.File
 	icyStateLogFile *os.File
@@ -66,15 +85,43 @@ var (
 )
 
 type SIbug struct {
-	BugType          string                   `json:"BugType"`
-	InputAlloc       research.SubstateAlloc   `json:"inputAlloc"`
-	OutputAlloc      research.SubstateAlloc   `json:"outputAlloc"`
-	InputMessage     research.SubstateMessage `json:"inputMessage"`
-	AdditMessageFrom string                   `json:"additMessageFrom"`
-	AdditMessageTo   string                   `json:"additMessageTo"`
-	AdditMessageData string                   `json:"additMessageData"`
-	OriAlloc         research.SubstateAlloc   `json:"oriAlloc"`
-	MutAlloc         research.SubstateAlloc   `json:"mutAlloc"`
+	BugType           string                    `json:"BugType"`
+	InputAlloc        research.SubstateAlloc    `json:"inputAlloc"`
+	OutputAlloc       research.SubstateAlloc    `json:"outputAlloc"`
+	InputMessage      research.SubstateMessage  `json:"inputMessage"`
+	AdditMessageFrom  string                    `json:"additMessageFrom"`
+	AdditMessageTo    string                    `json:"additMessageTo"`
+	AdditMessageData  string                    `json:"additMessageData"`
+	AdditMessageValue string                    `json:"additMessageValue,omitempty"`
+	BackMessageTo     string                    `json:"backMessageTo,omitempty"`
+	BackMessageData   string                    `json:"backMessageData,omitempty"`
+	BackMessageValue  string                    `json:"backMessageValue,omitempty"`
+	NextEnv           *research.SubstateEnv     `json:"nextEnv,omitempty"`
+	OriAlloc          research.SubstateAlloc    `json:"oriAlloc"`
+	MutAlloc          research.SubstateAlloc    `json:"mutAlloc"`
+	Divergence        string                    `json:"divergence,omitempty"`
+	OriOutcomes       map[string]*msgOutcome    `json:"oriOutcomes,omitempty"`
+	MutOutcomes       map[string]*msgOutcome    `json:"mutOutcomes,omitempty"`
+	Reverts           []revertRecord            `json:"reverts,omitempty"`
+	Views             []viewDivergence          `json:"views,omitempty"`
+	CallSite          *callSite                 `json:"callSite,omitempty"`
+	Funding           []fundingRecord           `json:"funding,omitempty"`
+	Role              string                    `json:"role,omitempty"`
+	Victim            *victimOutcome            `json:"victim,omitempty"`
+	InitMessage       *research.SubstateMessage `json:"initMessage,omitempty"`
+	Slots             []slotChange              `json:"slots,omitempty"`
+	Minimized         *reproducer               `json:"minimized,omitempty"`
+}
+
+// findingFile names the output file of a finding on addr in transaction
+// block_tx. parts and a hash of the additional message data keep findings of
+// the same transaction under different call sites, roles or messages apart.
+func findingFile(dappDir string, addr string, block uint64, tx int, data []byte, parts ...string) string {
+	name := addr + "_" + strconv.FormatUint(block, 10) + "_" + strconv.Itoa(tx)
+	for _, part := range parts {
+		name += "_" + part
+	}
+	return dappDir + "/output/" + name + fmt.Sprintf("_%x.json", crypto.Keccak256(data)[:4])
 }
 
 // record-replay: func replayAction for replay command
@@ -98,12 +145,24 @@ func replaySIAction(ctx *cli.Context) error {
 	}
 
 	research.SetSubstateFlags(ctx)
+	if err = research.SetupMetrics(ctx); err != nil {
+		return fmt.Errorf("substate-cli replay-mt: %v", err)
+	}
 	research.OpenSubstateDBReadOnly()
 	defer research.CloseSubstateDB()
 
 	taskPool := research.NewSubstateTaskPool("substate-cli replay-SI", replaySITask, uint64(first), uint64(last), ctx)
+	taskPool.IncludeCreate = !taskPool.SkipInit
 	initGlobalEnv(ctx, taskPool)
+	if taskPool.TotalTime > 0 {
+		runDeadline = time.Now().Add(taskPool.TotalTime)
+	}
+	coverageEnabled = !taskPool.SkipCoverage
 	err = taskPool.Execute()
+	printBudgetSummary(taskPool)
+	if coverageEnabled {
+		printCoverage(taskPool)
+	}
 	return err
 }
 
@@ -116,11 +175,20 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 		err            error
 	)
 
+	// contract creations are only checked for initialization front-running
+	if substate.Message.To == nil {
+		return replayCreationTask(block, tx, substate, taskPool)
+	}
+
 	// return if toAddr not in inner
 	if !containByList(fuzz.GetInnerValueList(),
 		strings.ToLower(substate.Message.To.String())) {
 		return fmt.Errorf("not inner")
 	}
+	if skipTx() {
+		return nil
+	}
+	budget := newTxBudget(taskPool)
 
 	// rich InputAlloc if richInfoFlag is true
 	if taskPool.RichInfo {
@@ -161,13 +229,15 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 		}
 	}
 
+	// msg.value of the transaction seeds payable additional messages
+	fuzz.UpdateValueSeed(substate.Message.Value, block)
+	// a successful admin call makes its sender privileged
+	recordAdminCall(substate, block)
+
 	for add, acc := range substate.InputAlloc {
-		acc0, exist := substate.OutputAlloc[add]
-		if exist == false {
+		if _, exist := substate.OutputAlloc[add]; exist == false {
 			continue
 		}
-		acc.Balance.Add(tenEther, acc.Balance)
-		acc0.Balance.Add(tenEther, acc0.Balance)
 
 		if acc.Code == nil {
 			localUsers = append(localUsers, strings.ToLower(add.String()))
@@ -192,8 +262,17 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 		}
 	}
 
-	if !taskPool.SkipEnv {
+	// messages to proxies are built from the abi of their implementation
+	if err = resolveProxies(block, tx, substate); err != nil {
+		errorstrings = append(errorstrings, err.Error())
+	}
+	// signature-gated functions are signed by the keys of the fuzzer
+	registerDomainSeparators(substate)
+
+	if !taskPool.SkipEnv && !budget.skipRelation("ENV") {
+		start := time.Now()
 		err = replayWithEnvMR(block, tx, substate, taskPool)
+		timeRelation("ENV", start)
 		if err != nil &&
 			strings.Index(err.Error(), "inconsistent output") == -1 &&
 			strings.Index(err.Error(), "insufficient funds") == -1 {
@@ -201,8 +280,10 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 		}
 	}
 
-	if !taskPool.SkipTod {
-		err = replayWithTodMR(block, tx, substate, taskPool, localUsers, localContracts)
+	if !taskPool.SkipTod && !budget.skipRelation("TOD") {
+		start := time.Now()
+		err = replayWithTodMR(block, tx, substate, taskPool, budget, localUsers, localContracts)
+		timeRelation("TOD", start)
 		if err != nil &&
 			strings.Index(err.Error(), "inconsistent output") == -1 &&
 			strings.Index(err.Error(), "insufficient funds") == -1 {
@@ -219,8 +300,21 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 	// 	}
 	// }
 
-	if !taskPool.SkipHook {
-		err = replayWithHook(block, tx, substate, taskPool, localUsers, localContracts)
+	if !taskPool.SkipHook && !budget.skipRelation("HOOK") {
+		start := time.Now()
+		err = replayWithHook(block, tx, substate, taskPool, budget, localUsers, localContracts)
+		timeRelation("HOOK", start)
+		if err != nil &&
+			strings.Index(err.Error(), "inconsistent output") == -1 &&
+			strings.Index(err.Error(), "insufficient funds") == -1 {
+			errorstrings = append(errorstrings, err.Error())
+		}
+	}
+
+	if !taskPool.SkipSandwich && !budget.skipRelation("SANDWICH") {
+		start := time.Now()
+		err = replayWithSandwichMR(block, tx, substate, taskPool, budget, localUsers, localContracts)
+		timeRelation("SANDWICH", start)
 		if err != nil &&
 			strings.Index(err.Error(), "inconsistent output") == -1 &&
 			strings.Index(err.Error(), "insufficient funds") == -1 {
@@ -228,6 +322,33 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 		}
 	}
 
+	if !taskPool.SkipCrossBlock && !budget.skipRelation("CROSS-BLOCK") {
+		start := time.Now()
+		err = replayWithCrossBlockMR(block, tx, substate, taskPool)
+		timeRelation("CROSS-BLOCK", start)
+		if err != nil &&
+			strings.Index(err.Error(), "inconsistent output") == -1 &&
+			strings.Index(err.Error(), "insufficient funds") == -1 {
+			errorstrings = append(errorstrings, err.Error())
+		}
+	}
+
+	if !taskPool.SkipRoReentrancy && !budget.skipRelation("RO-REENTRANCY") {
+		start := time.Now()
+		err = replayWithRoReentrancyMR(block, tx, substate, taskPool)
+		timeRelation("RO-REENTRANCY", start)
+		if err != nil &&
+			strings.Index(err.Error(), "inconsistent output") == -1 &&
+			strings.Index(err.Error(), "insufficient funds") == -1 {
+			errorstrings = append(errorstrings, err.Error())
+		}
+	}
+
+	if len(budget.skipped) > 0 {
+		errorstrings = append(errorstrings, fmt.Sprintf("%d_%d: time budget spent, skipped %s",
+			block, tx, strings.Join(budget.skipped, ", ")))
+	}
+
 	if len(errorstrings) == 0 {
 		return nil
 	} else {
@@ -239,14 +360,41 @@ func replaySITask(block uint64, tx int, substate *research.Substate, taskPool *r
 	}
 }
 
+// replayCreationTask checks the creation of an inner contract
+func replayCreationTask(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
+	if substate.Result == nil ||
+		!containByList(fuzz.GetInnerValueList(),
+			strings.ToLower(substate.Result.ContractAddress.String())) {
+		return fmt.Errorf("not inner")
+	}
+
+	if skipTx() {
+		return nil
+	}
+	start := time.Now()
+	err := replayWithInitMR(block, tx, substate, taskPool, newTxBudget(taskPool))
+	timeRelation("INIT-FRONTRUN", start)
+	if err != nil &&
+		strings.Index(err.Error(), "inconsistent output") == -1 &&
+		strings.Index(err.Error(), "insufficient funds") == -1 {
+		log.SetOutput(errorLogFile)
+		log.SetPrefix("[ErrorLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		log.Printf(err.Error())
+	}
+	return nil
+}
+
 func replayWithEnvMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
 
 	inputAlloc := substate.InputAlloc
 	inputMessage := substate.Message
 	var (
-		oriAlloc research.SubstateAlloc
-		mutAlloc research.SubstateAlloc
-		err      error
+		oriAlloc    research.SubstateAlloc
+		mutAlloc    research.SubstateAlloc
+		oriOutcomes = make(map[string]*msgOutcome)
+		mutOutcomes = make(map[string]*msgOutcome)
+		err         error
 	)
 
 	oriEnv := substate.Env
@@ -260,14 +408,18 @@ func replayWithEnvMR(block uint64, tx int, substate *research.Substate, taskPool
 		BaseFee:     new(big.Int).SetUint64(oriEnv.BaseFee.Uint64()),
 	}
 
-	if oriAlloc, err = replayRegularMsgs(block, tx, inputAlloc, *oriEnv, inputMessage.AsMessage()); err != nil {
+	if oriAlloc, oriOutcomes["original"], err = replayRegularMsgs(block, tx, inputAlloc, *oriEnv, inputMessage.AsMessage()); err != nil {
 		return err
 	}
-	if mutAlloc, err = replayRegularMsgs(block, tx, inputAlloc, *mutEnv, inputMessage.AsMessage()); err != nil {
+	if mutAlloc, mutOutcomes["original"], err = replayRegularMsgs(block, tx, inputAlloc, *mutEnv, inputMessage.AsMessage()); err != nil {
 		return err
 	}
+	if taskPool.StrictOracle {
+		mergePostAlloc(&oriAlloc, inputAlloc, oriOutcomes["original"], true)
+		mergePostAlloc(&mutAlloc, inputAlloc, mutOutcomes["original"], true)
+	}
 
-	if addr, a := oriAlloc.AllStateEqual(mutAlloc); !a {
+	if addr, divergence, a := siOracle(taskPool.StrictOracle, oriAlloc, mutAlloc, oriOutcomes, mutOutcomes); !a {
 		// write bug detailed information
 		bugFile := taskPool.DappDir + "/output/" + addr + "_" +
 			strconv.FormatUint(oriEnv.Number, 10) + ".json"
@@ -281,25 +433,27 @@ func replayWithEnvMR(block uint64, tx int, substate *research.Substate, taskPool
 			AdditMessageData: "",
 			OriAlloc:         oriAlloc,
 			MutAlloc:         mutAlloc,
+			Divergence:       divergence,
+			OriOutcomes:      oriOutcomes,
+			MutOutcomes:      mutOutcomes,
 		}
 		data, err := json.MarshalIndent(bugDetails, "", " ")
 		checkError(err)
 		err = ioutil.WriteFile(bugFile, data, 0777)
 		checkError(err)
+		recordFinding("ENV")
 		// write to log file
 		log.SetOutput(bugLogFile)
 		log.SetPrefix("[SIBugLog]")
 		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-		log.Printf("alloc differ under ENV in \n%s\nin %d\n", addr, block)
+		log.Printf("%s differ under ENV in \n%s\nin %d\n", divergence, addr, block)
 	}
 	return nil
 }
 
-func replayWithTodMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, localUsers []string, localContracts []string) error {
+func replayWithTodMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget, localUsers []string, localContracts []string) error {
 	// collect original information
-	env := substate.Env
 	inputAlloc := substate.InputAlloc
-	originalMessage := substate.Message
 
 	// generate additional messages
 	var (
@@ -334,86 +488,75 @@ func replayWithTodMR(block uint64, tx int, substate *research.Substate, taskPool
 	// 	return fmt.Errorf("error in generating msgs")
 	// }
 
+	roles, err := parseSenderRoles(taskPool.SenderRoles)
+	if err != nil {
+		return err
+	}
+	model := newRoleModel(block, substate, localUsers, roles)
+	addrs, msgs, rets = budget.schedule(substate, addrs, msgs, rets)
+
 	// replay original & additional messages
 	for index, msg := range msgs {
-		var (
-			tempAlloc     research.SubstateAlloc
-			fromAddress   common.Address
-			toAddress     common.Address
-			tempEnv       research.SubstateEnv
-			originalMsg   types.Message
-			additionalMsg types.Message
-			err           error
-			obverseAlloc  research.SubstateAlloc
-			reverseAlloc  research.SubstateAlloc
-		)
-		msgData, _ := hex.DecodeString(msg[2:])
-
-		if len(localUsers) <= 1 {
-			Users := fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetUserValueList())
-			fromAddress = common.HexToAddress(Users[int(rand.Uint64()/2)%len(Users)])
-		} else {
-			fromAddress = common.HexToAddress(localUsers[int(rand.Uint64()/2)%len(localUsers)])
+		if budget.skipMsgs(len(msgs) - index) {
+			break
 		}
-		toAddress = common.HexToAddress(addrs[index])
-		// if from address does not exist, generate one
-		if fromAccount, exist := inputAlloc[fromAddress]; exist != true {
-			fromAccount = &research.SubstateAccount{}
-			fromAccount.Balance = new(big.Int).SetUint64(math.MaxUint64)
-			inputAlloc[fromAddress] = fromAccount
+		// senders are tried from the least privileged one, so that findings
+		// are labeled with the minimum privilege needed to trigger them
+		for _, sender := range model.senders(common.HexToAddress(addrs[index])) {
+			found, err := replayTodMsg(block, tx, substate, taskPool, budget, addrs[index], msg, rets[index], sender)
+			if err != nil {
+				return err
+			}
+			if found {
+				break
+			}
 		}
+	}
 
-		// (original, additional)
-		tempAlloc = inputAlloc.Copy()
-		tempEnv = *env
-		originalMsg = types.NewMessage(
-			originalMessage.From,
-			originalMessage.To,
-			tempAlloc[originalMessage.From].Nonce,
-			originalMessage.Value,
-			originalMessage.Gas,
-			originalMessage.GasPrice,
-			originalMessage.GasFeeCap,
-			originalMessage.GasTipCap,
-			originalMessage.Data,
-			originalMessage.AccessList,
-			false,
-		)
-		// execute original msg
-		if obverseAlloc, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
-			return err
-		}
-		research.UpdateSubstate(&obverseAlloc, tempAlloc, false, true)
+	return nil
+}
 
-		tempAlloc = obverseAlloc.Copy()
-		tempEnv = *env
-		additionalMsg = types.NewMessage(
-			fromAddress,
-			&toAddress,
-			tempAlloc[fromAddress].Nonce,
-			new(big.Int),
-			env.GasLimit-originalMessage.Gas,
-			originalMessage.GasPrice,
-			originalMessage.GasFeeCap,
-			originalMessage.GasTipCap,
-			msgData,
-			originalMessage.AccessList,
-			false,
-		)
-		// execute additional msg
-		if obverseAlloc, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, additionalMsg); err != nil {
-			return err
+// todRun is the replay of the original and an additional message in both
+// orders
+type todRun struct {
+	obverseAlloc  research.SubstateAlloc
+	reverseAlloc  research.SubstateAlloc
+	oriOutcomes   map[string]*msgOutcome
+	mutOutcomes   map[string]*msgOutcome
+	additionalMsg types.Message
+	funding       []fundingRecord
+	// the additional message first leaves the state unchanged
+	useless bool
+}
+
+// runTod replays the original message of substate and the additional message
+// from fromAddress in both orders on top of inputAlloc. With lendTokens, the
+// additional sender is funded by a flash loan of the inner tokens.
+func runTod(block uint64, tx int, substate *research.Substate, inputAlloc research.SubstateAlloc, strict bool, lendTokens bool, fromAddress common.Address, toAddress common.Address, value *big.Int, msgData []byte) (*todRun, error) {
+	// collect original information
+	env := substate.Env
+	originalMessage := substate.Message
+
+	var (
+		tempAlloc   research.SubstateAlloc
+		tempEnv     research.SubstateEnv
+		originalMsg types.Message
+		err         error
+		run         = &todRun{
+			oriOutcomes: make(map[string]*msgOutcome),
+			mutOutcomes: make(map[string]*msgOutcome),
 		}
-		research.UpdateSubstate(&obverseAlloc, tempAlloc, false, true)
+	)
 
-		// (additional, original)
-		tempAlloc = inputAlloc.Copy()
-		tempEnv = *env
-		additionalMsg = types.NewMessage(
+	// fund senders (generating missing ones) for both orderings up front
+	fundedAlloc := inputAlloc.Copy()
+	run.funding = fundSenders(fundedAlloc,
+		originalMessage.AsMessage(),
+		types.NewMessage(
 			fromAddress,
 			&toAddress,
-			tempAlloc[fromAddress].Nonce,
-			new(big.Int),
+			0,
+			value,
 			env.GasLimit-originalMessage.Gas,
 			originalMessage.GasPrice,
 			originalMessage.GasFeeCap,
@@ -421,66 +564,224 @@ func replayWithTodMR(block uint64, tx int, substate *research.Substate, taskPool
 			msgData,
 			originalMessage.AccessList,
 			false,
-		)
-		// execute additional msg
-		if reverseAlloc, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, additionalMsg); err != nil {
-			return err
-		}
-		research.UpdateSubstate(&reverseAlloc, tempAlloc, false, true)
+		))
+	if lendTokens {
+		run.funding = append(run.funding, flashLoan(fundedAlloc, *env, fromAddress, flashLoanTokens(fundedAlloc))...)
+	}
 
-		// additional check if additional msg is useless
-		if _, flag := reverseAlloc.AllStateEqual(inputAlloc); flag == true {
-			continue
-		}
+	// (original, additional)
+	tempAlloc = fundedAlloc.Copy()
+	tempEnv = *env
+	originalMsg = types.NewMessage(
+		originalMessage.From,
+		originalMessage.To,
+		tempAlloc[originalMessage.From].Nonce,
+		originalMessage.Value,
+		originalMessage.Gas,
+		originalMessage.GasPrice,
+		originalMessage.GasFeeCap,
+		originalMessage.GasTipCap,
+		originalMessage.Data,
+		originalMessage.AccessList,
+		false,
+	)
+	// execute original msg
+	if run.obverseAlloc, run.oriOutcomes["original"], err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&run.obverseAlloc, tempAlloc, run.oriOutcomes["original"], strict)
+
+	tempAlloc = run.obverseAlloc.Copy()
+	tempEnv = *env
+	run.additionalMsg = types.NewMessage(
+		fromAddress,
+		&toAddress,
+		tempAlloc[fromAddress].Nonce,
+		value,
+		env.GasLimit-originalMessage.Gas,
+		originalMessage.GasPrice,
+		originalMessage.GasFeeCap,
+		originalMessage.GasTipCap,
+		msgData,
+		originalMessage.AccessList,
+		false,
+	)
+	// execute additional msg
+	if run.obverseAlloc, run.oriOutcomes["additional"], err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, run.additionalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&run.obverseAlloc, tempAlloc, run.oriOutcomes["additional"], strict)
+
+	// (additional, original)
+	tempAlloc = fundedAlloc.Copy()
+	tempEnv = *env
+	run.additionalMsg = types.NewMessage(
+		fromAddress,
+		&toAddress,
+		tempAlloc[fromAddress].Nonce,
+		value,
+		env.GasLimit-originalMessage.Gas,
+		originalMessage.GasPrice,
+		originalMessage.GasFeeCap,
+		originalMessage.GasTipCap,
+		msgData,
+		originalMessage.AccessList,
+		false,
+	)
+	// execute additional msg
+	if run.reverseAlloc, run.mutOutcomes["additional"], err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, run.additionalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&run.reverseAlloc, tempAlloc, run.mutOutcomes["additional"], strict)
 
-		tempAlloc = reverseAlloc.Copy()
-		originalMsg = types.NewMessage(
-			originalMessage.From,
-			originalMessage.To,
-			tempAlloc[originalMessage.From].Nonce,
-			originalMessage.Value,
-			originalMessage.Gas,
-			originalMessage.GasPrice,
-			originalMessage.GasFeeCap,
-			originalMessage.GasTipCap,
-			originalMessage.Data,
-			originalMessage.AccessList,
-			false,
-		)
-		// execute original msg
-		if reverseAlloc, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, originalMsg); err != nil {
-			return err
+	// additional check if additional msg is useless
+	if _, flag := run.reverseAlloc.AllStateEqual(fundedAlloc); flag == true {
+		run.useless = true
+		return run, nil
+	}
+
+	tempAlloc = run.reverseAlloc.Copy()
+	originalMsg = types.NewMessage(
+		originalMessage.From,
+		originalMessage.To,
+		tempAlloc[originalMessage.From].Nonce,
+		originalMessage.Value,
+		originalMessage.Gas,
+		originalMessage.GasPrice,
+		originalMessage.GasFeeCap,
+		originalMessage.GasTipCap,
+		originalMessage.Data,
+		originalMessage.AccessList,
+		false,
+	)
+	// execute original msg
+	if run.reverseAlloc, run.mutOutcomes["original"], err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, originalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&run.reverseAlloc, tempAlloc, run.mutOutcomes["original"], strict)
+	return run, nil
+}
+
+// replayTodMsg replays the original message and the additional message msg
+// from sender in both orders, and reports whether a finding was written
+func replayTodMsg(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget, contract string, msg string, ret string, sender roleSender) (bool, error) {
+	// collect original information
+	env := substate.Env
+	inputAlloc := substate.InputAlloc
+	originalMessage := substate.Message
+
+	msgData, _ := hex.DecodeString(msg[2:])
+	fromAddress := sender.Address
+	toAddress := common.HexToAddress(contract)
+	// the additional message carries value if its function is payable
+	value := fuzz.PayableValue(contract, ret, block, senderBalance(inputAlloc, fromAddress))
+
+	run, err := runTod(block, tx, substate, inputAlloc, taskPool.StrictOracle, taskPool.FlashLoan, fromAddress, toAddress, value, msgData)
+	if err != nil {
+		return false, err
+	}
+	// arguments reaching new branches or slots seed later messages
+	fuzz.RecordFeedback(contract, ret, novelty(run.oriOutcomes["additional"], run.mutOutcomes["additional"]))
+	obverseAlloc, reverseAlloc := run.obverseAlloc, run.reverseAlloc
+	oriOutcomes, mutOutcomes := run.oriOutcomes, run.mutOutcomes
+	additionalMsg, funding := run.additionalMsg, run.funding
+
+	found := false
+	// a message reverting in only one ordering is reported even if the
+	// final states agree, or the additional message changes nothing when
+	// sent first
+	if reverts := revertDivergence("original-first", "additional-first", oriOutcomes, mutOutcomes,
+		fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetInnerValueList())); len(reverts) > 0 {
+		found = true
+		addr := strings.ToLower(toAddress.String())
+		// write bug information
+		bugFile := findingFile(taskPool.DappDir, addr, env.Number, tx, msgData, "revert", sender.Role.String())
+		bugDetails := &SIbug{
+			BugType:           "TOD-REVERT",
+			InputAlloc:        substate.InputAlloc,
+			OutputAlloc:       substate.OutputAlloc,
+			InputMessage:      *originalMessage,
+			AdditMessageFrom:  additionalMsg.From().String(),
+			AdditMessageTo:    additionalMsg.To().String(),
+			AdditMessageData:  ret,
+			AdditMessageValue: value.String(),
+			OriAlloc:          obverseAlloc,
+			MutAlloc:          reverseAlloc,
+			OriOutcomes:       oriOutcomes,
+			MutOutcomes:       mutOutcomes,
+			Funding:           funding,
+			Role:              sender.Role.String(),
+			Reverts:           reverts,
 		}
-		research.UpdateSubstate(&reverseAlloc, tempAlloc, false, true)
+		data, err := json.MarshalIndent(bugDetails, "", " ")
+		checkError(err)
+		err = ioutil.WriteFile(bugFile, data, 0777)
+		checkError(err)
+		recordFinding("TOD-REVERT")
+		//writh to bug log file
+		log.SetOutput(bugLogFile)
+		log.SetPrefix("[SIBugLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		for _, revert := range reverts {
+			log.Printf("%s message reverts only in %s order under TOD-REVERT as %s in \n%s\nin %d: %s\n",
+				revert.Message, revert.Ordering, sender.Role, addr, block, revert.Reason)
+		}
+	}
 
-		if addr, a := obverseAlloc.AllStateEqual(reverseAlloc); !a {
-			// write bug information
-			bugFile := taskPool.DappDir + "/output/" + addr + "_" +
-				strconv.FormatUint(env.Number, 10) + ".json"
-			bugDetails := &SIbug{
-				BugType:          "TOD",
-				InputAlloc:       substate.InputAlloc,
-				OutputAlloc:      substate.OutputAlloc,
-				InputMessage:     *originalMessage,
-				AdditMessageFrom: additionalMsg.From().String(),
-				AdditMessageTo:   additionalMsg.To().String(),
-				AdditMessageData: rets[index],
-				OriAlloc:         obverseAlloc,
-				MutAlloc:         reverseAlloc,
-			}
-			data, err := json.MarshalIndent(bugDetails, "", " ")
-			checkError(err)
-			err = ioutil.WriteFile(bugFile, data, 0777)
-			checkError(err)
-			//writh to bug log file
-			log.SetOutput(bugLogFile)
-			log.SetPrefix("[SIBugLog]")
-			log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-			log.Printf("alloc differ under TOD in \n%s\nin %d\n", addr, block)
+	if run.useless {
+		return found, nil
+	}
+	if addr, divergence, a := siOracle(taskPool.StrictOracle, obverseAlloc, reverseAlloc, oriOutcomes, mutOutcomes); !a {
+		found = true
+		var minimized *reproducer
+		if !taskPool.SkipMinimize {
+			key := newDivergenceKey(taskPool.StrictOracle, divergence, obverseAlloc, reverseAlloc)
+			minimized = minimizeFinding(budget, inputAlloc,
+				[]minimizedCall{{From: fromAddress, To: toAddress, Msg: ret, Input: msgData, Value: (*hexutil.Big)(value)}},
+				[]common.Address{fromAddress, originalMessage.From, toAddress, *originalMessage.To},
+				func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error) {
+					call := calls[0]
+					run, err := runTod(block, tx, substate, alloc, taskPool.StrictOracle, taskPool.FlashLoan, call.From, call.To, call.Value.ToInt(), call.Input)
+					if err != nil || run.useless {
+						return false, err
+					}
+					_, divergence, a := siOracle(taskPool.StrictOracle, run.obverseAlloc, run.reverseAlloc, run.oriOutcomes, run.mutOutcomes)
+					return !a && key.matches(taskPool.StrictOracle, divergence, run.obverseAlloc, run.reverseAlloc), nil
+				})
+		}
+		// write bug information
+		bugFile := findingFile(taskPool.DappDir, addr, env.Number, tx, msgData, "tod", sender.Role.String())
+		bugDetails := &SIbug{
+			BugType:           "TOD",
+			InputAlloc:        substate.InputAlloc,
+			OutputAlloc:       substate.OutputAlloc,
+			InputMessage:      *originalMessage,
+			AdditMessageFrom:  additionalMsg.From().String(),
+			AdditMessageTo:    additionalMsg.To().String(),
+			AdditMessageData:  ret,
+			AdditMessageValue: value.String(),
+			OriAlloc:          obverseAlloc,
+			MutAlloc:          reverseAlloc,
+			Divergence:        divergence,
+			OriOutcomes:       oriOutcomes,
+			MutOutcomes:       mutOutcomes,
+			Funding:           funding,
+			Role:              sender.Role.String(),
+			Minimized:         minimized,
 		}
+		data, err := json.MarshalIndent(bugDetails, "", " ")
+		checkError(err)
+		err = ioutil.WriteFile(bugFile, data, 0777)
+		checkError(err)
+		recordFinding("TOD")
+		//writh to bug log file
+		log.SetOutput(bugLogFile)
+		log.SetPrefix("[SIBugLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		log.Printf("%s differ under TOD as %s in \n%s\nin %d\n", divergence, sender.Role, addr, block)
 	}
 
-	return nil
+	return found, nil
 }
 
 func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, localUsers []string, localContracts []string) error {
@@ -530,19 +831,34 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			err           error
 			obverseAlloc  research.SubstateAlloc
 			reverseAlloc  research.SubstateAlloc
+			oriOutcomes   = make(map[string]*msgOutcome)
+			mutOutcomes   = make(map[string]*msgOutcome)
 		)
 		msgData, _ := hex.DecodeString(msg[2:])
 		fromAddress = originalMessage.From
 		toAddress = common.HexToAddress(addrs[index])
-		// if from address does not exist, generate one (dead code for now)
-		if fromAccount, exist := inputAlloc[fromAddress]; exist != true {
-			fromAccount = &research.SubstateAccount{}
-			fromAccount.Balance = new(big.Int).SetUint64(math.MaxUint64)
-			inputAlloc[fromAddress] = fromAccount
-		}
+		// the additional message carries value if its function is payable
+		value := fuzz.PayableValue(addrs[index], rets[index], block, senderBalance(inputAlloc, fromAddress))
+		// fund senders (generating missing ones) for both orderings up front
+		fundedAlloc := inputAlloc.Copy()
+		funding := fundSenders(fundedAlloc,
+			originalMessage.AsMessage(),
+			types.NewMessage(
+				fromAddress,
+				&toAddress,
+				0,
+				value,
+				env.GasLimit-originalMessage.Gas,
+				originalMessage.GasPrice,
+				originalMessage.GasFeeCap,
+				originalMessage.GasTipCap,
+				msgData,
+				originalMessage.AccessList,
+				false,
+			))
 
 		// (original, additional)
-		tempAlloc = inputAlloc.Copy()
+		tempAlloc = fundedAlloc.Copy()
 		tempEnv = *env
 		originalMsg = types.NewMessage(
 			originalMessage.From,
@@ -558,10 +874,10 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			false,
 		)
 		// execute original msg
-		if obverseAlloc, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
+		if obverseAlloc, oriOutcomes["original"], err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
 			return err
 		}
-		research.UpdateSubstate(&obverseAlloc, tempAlloc, false, true)
+		mergePostAlloc(&obverseAlloc, tempAlloc, oriOutcomes["original"], taskPool.StrictOracle)
 
 		tempAlloc = obverseAlloc.Copy()
 		tempEnv = *env
@@ -569,7 +885,7 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			fromAddress,
 			&toAddress,
 			tempAlloc[fromAddress].Nonce,
-			new(big.Int),
+			value,
 			env.GasLimit-originalMessage.Gas,
 			originalMessage.GasPrice,
 			originalMessage.GasFeeCap,
@@ -579,19 +895,19 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			false,
 		)
 		// execute additional msg
-		if obverseAlloc, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, additionalMsg); err != nil {
+		if obverseAlloc, oriOutcomes["additional"], err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, additionalMsg); err != nil {
 			return err
 		}
-		research.UpdateSubstate(&obverseAlloc, tempAlloc, false, true)
+		mergePostAlloc(&obverseAlloc, tempAlloc, oriOutcomes["additional"], taskPool.StrictOracle)
 
 		// (additional, original)
-		tempAlloc = inputAlloc.Copy()
+		tempAlloc = fundedAlloc.Copy()
 		tempEnv = *env
 		additionalMsg = types.NewMessage(
 			fromAddress,
 			&toAddress,
 			tempAlloc[fromAddress].Nonce,
-			new(big.Int),
+			value,
 			env.GasLimit-originalMessage.Gas,
 			originalMessage.GasPrice,
 			originalMessage.GasFeeCap,
@@ -600,13 +916,13 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			originalMessage.AccessList,
 			false,
 		)
-		if reverseAlloc, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, additionalMsg); err != nil {
+		if reverseAlloc, mutOutcomes["additional"], err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, additionalMsg); err != nil {
 			return err
 		}
-		research.UpdateSubstate(&reverseAlloc, tempAlloc, false, true)
+		mergePostAlloc(&reverseAlloc, tempAlloc, mutOutcomes["additional"], taskPool.StrictOracle)
 
 		// additional check if additional msg is useless
-		if _, flag := reverseAlloc.AllStateEqual(inputAlloc); flag == true {
+		if _, flag := reverseAlloc.AllStateEqual(fundedAlloc); flag == true {
 			continue
 		}
 
@@ -624,35 +940,41 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 			originalMessage.AccessList,
 			false,
 		)
-		if reverseAlloc, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, originalMsg); err != nil {
+		if reverseAlloc, mutOutcomes["original"], err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, originalMsg); err != nil {
 			return err
 		}
-		research.UpdateSubstate(&reverseAlloc, tempAlloc, false, true)
+		mergePostAlloc(&reverseAlloc, tempAlloc, mutOutcomes["original"], taskPool.StrictOracle)
 
-		if addr, a := obverseAlloc.AllStateEqual(reverseAlloc); !a {
+		if addr, divergence, a := siOracle(taskPool.StrictOracle, obverseAlloc, reverseAlloc, oriOutcomes, mutOutcomes); !a {
 			// write bug information
 			bugFile := taskPool.DappDir + "/output/" + addr + "_" +
 				strconv.FormatUint(env.Number, 10) + ".json"
 			bugDetails := &SIbug{
-				BugType:          "MANI",
-				InputAlloc:       substate.InputAlloc,
-				OutputAlloc:      substate.OutputAlloc,
-				InputMessage:     *originalMessage,
-				AdditMessageFrom: additionalMsg.From().String(),
-				AdditMessageTo:   additionalMsg.To().String(),
-				AdditMessageData: rets[index],
-				OriAlloc:         obverseAlloc,
-				MutAlloc:         reverseAlloc,
+				BugType:           "MANI",
+				InputAlloc:        substate.InputAlloc,
+				OutputAlloc:       substate.OutputAlloc,
+				InputMessage:      *originalMessage,
+				AdditMessageFrom:  additionalMsg.From().String(),
+				AdditMessageTo:    additionalMsg.To().String(),
+				AdditMessageData:  rets[index],
+				AdditMessageValue: value.String(),
+				OriAlloc:          obverseAlloc,
+				MutAlloc:          reverseAlloc,
+				Divergence:        divergence,
+				OriOutcomes:       oriOutcomes,
+				MutOutcomes:       mutOutcomes,
+				Funding:           funding,
 			}
 			data, err := json.MarshalIndent(bugDetails, "", " ")
 			checkError(err)
 			err = ioutil.WriteFile(bugFile, data, 0777)
 			checkError(err)
+			recordFinding("MANI")
 			//writh to log file
 			log.SetOutput(bugLogFile)
 			log.SetPrefix("[SIBugLog]")
 			log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-			log.Printf("alloc differ under MANI in \n%s\nin %d\n", addr, block)
+			log.Printf("%s differ under MANI in \n%s\nin %d\n", divergence, addr, block)
 		}
 	}
 
@@ -660,38 +982,12 @@ func replayWithManiMR(block uint64, tx int, substate *research.Substate, taskPoo
 }
 
 // no CALL in hook and successfully execute additional msg -> inconsisitency (false alarm)
-func replayWithHook(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, localUsers []string, localContracts []string) error {
+func replayWithHook(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget, localUsers []string, localContracts []string) error {
 
 	inputAlloc := substate.InputAlloc
 	inputEnv := substate.Env
 	inputMessage := substate.Message
 
-	var (
-		vmConfig    vm.Config
-		chainConfig *params.ChainConfig
-		getTracerFn func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error)
-	)
-	vmConfig = vm.Config{}
-	chainConfig = &params.ChainConfig{}
-	*chainConfig = *params.MainnetChainConfig
-	// disable DAOForkSupport, otherwise account states will be overwritten
-	chainConfig.DAOForkSupport = false
-	getTracerFn = func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error) {
-		return nil, nil
-	}
-	var hashError error
-	getHash := func(num uint64) common.Hash {
-		if inputEnv.BlockHashes == nil {
-			hashError = fmt.Errorf("getHash(%d) invoked, no blockhashes provided", num)
-			return common.Hash{}
-		}
-		h, ok := inputEnv.BlockHashes[num]
-		if !ok {
-			hashError = fmt.Errorf("getHash(%d) invoked, blockhash for that block not provided", num)
-		}
-		return h
-	}
-
 	var (
 		targetedAddress []string
 		msgs            []string
@@ -725,172 +1021,305 @@ func replayWithHook(block uint64, tx int, substate *research.Substate, taskPool
 	// 	return fmt.Errorf("error in generating msgs")
 	// }
 
+	// the hooked message may use the whole block gas limit
+	temp := inputMessage.Gas
+	inputMessage.Gas = inputEnv.GasLimit
+	inputMsg := inputMessage.AsMessage()
+	inputMessage.Gas = temp
+
+	// list the candidate external call sites of the original execution
+	precompiles := vm.ActivePrecompiles(params.MainnetChainConfig.Rules(new(big.Int).SetUint64(inputEnv.Number)))
+	recorder := newHookInterceptor(precompiles, -1, common.Address{}, common.Address{}, nil, nil)
+	recorderAlloc := inputAlloc.Copy()
+	fundSenders(recorderAlloc, inputMsg)
+	if _, _, err = replayInterceptedMsgs(block, tx, recorderAlloc, *inputEnv, inputMsg, recorder); err != nil {
+		return err
+	}
+	sites, err := selectHookSites(taskPool.HookSites, len(recorder.sites))
+	if err != nil {
+		return err
+	}
+	if len(sites) == 0 {
+		return nil
+	}
+
+	roles, err := parseSenderRoles(taskPool.SenderRoles)
+	if err != nil {
+		return err
+	}
+	model := newRoleModel(block, substate, localUsers, roles)
+	targetedAddress, msgs, rets = budget.schedule(substate, targetedAddress, msgs, rets)
+
 	for index, msg := range msgs {
-		var (
-			hookAlloc research.SubstateAlloc
-			outAlloc  research.SubstateAlloc
-		)
-		// Apply message without hook
-		tempAlloc := inputAlloc.Copy()
-		tempEnv := *inputEnv
-		originalMsg := types.NewMessage(
-			inputMessage.From,
-			inputMessage.To,
-			tempAlloc[inputMessage.From].Nonce,
-			inputMessage.Value,
-			inputMessage.Gas,
-			inputMessage.GasPrice,
-			inputMessage.GasFeeCap,
-			inputMessage.GasTipCap,
-			inputMessage.Data,
-			inputMessage.AccessList,
-			false,
-		)
-		if outAlloc, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
-			return err
+		if budget.skipMsgs(len(msgs) - index) {
+			break
 		}
-		research.UpdateSubstate(&outAlloc, tempAlloc, false, true)
-
-		tempAlloc = outAlloc.Copy()
-		tempEnv = *inputEnv
-		toAddress := common.HexToAddress(targetedAddress[index])
-		data, _ := hex.DecodeString(msg[2:])
-		additionalMsg := types.NewMessage(
-			inputMessage.From,
+		// senders are tried from the least privileged one, so that findings
+		// are labeled with the minimum privilege needed to trigger them
+		for _, sender := range model.senders(common.HexToAddress(targetedAddress[index])) {
+			found, err := replayHookMsg(block, tx, substate, taskPool, budget, precompiles, sites, inputMsg, targetedAddress[index], msg, rets[index], sender)
+			if err != nil {
+				return err
+			}
+			if found {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// hookRun is the replay of the original message followed by an additional
+// message, the baseline hooked executions are compared with
+type hookRun struct {
+	fundedAlloc   research.SubstateAlloc
+	outAlloc      research.SubstateAlloc
+	oriOutcomes   map[string]*msgOutcome
+	additionalMsg types.Message
+	additOutcome  *msgOutcome
+	funding       []fundingRecord
+}
+
+// runHookBaseline replays the original message of substate followed by the
+// additional message from sender on top of inputAlloc
+func runHookBaseline(block uint64, tx int, substate *research.Substate, inputAlloc research.SubstateAlloc, strict bool, sender common.Address, toAddress common.Address, value *big.Int, data []byte) (*hookRun, error) {
+	inputEnv := substate.Env
+	inputMessage := substate.Message
+
+	var (
+		outAlloc        research.SubstateAlloc
+		originalOutcome *msgOutcome
+		additOutcome    *msgOutcome
+		err             error
+		run             = &hookRun{}
+	)
+	// fund the sender up front, the hooked message uses the gas of both
+	run.fundedAlloc = inputAlloc.Copy()
+	run.funding = fundSenders(run.fundedAlloc,
+		inputMessage.AsMessage(),
+		types.NewMessage(
+			sender,
 			&toAddress,
-			tempAlloc[inputMessage.From].Nonce,
-			new(big.Int),
-			tempEnv.GasLimit-inputMessage.Gas,
+			0,
+			value,
+			inputEnv.GasLimit-inputMessage.Gas,
 			inputMessage.GasPrice,
 			inputMessage.GasFeeCap,
 			inputMessage.GasTipCap,
 			data,
 			inputMessage.AccessList,
 			false,
-		)
-		if outAlloc, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, additionalMsg); err != nil {
-			return err
-		}
-		research.UpdateSubstate(&outAlloc, tempAlloc, false, true)
+		))
+
+	// Apply message without hook
+	tempAlloc := run.fundedAlloc.Copy()
+	tempEnv := *inputEnv
+	originalMsg := types.NewMessage(
+		inputMessage.From,
+		inputMessage.To,
+		tempAlloc[inputMessage.From].Nonce,
+		inputMessage.Value,
+		inputMessage.Gas,
+		inputMessage.GasPrice,
+		inputMessage.GasFeeCap,
+		inputMessage.GasTipCap,
+		inputMessage.Data,
+		inputMessage.AccessList,
+		false,
+	)
+	if outAlloc, originalOutcome, err = replayRegularMsgs(block, tx, tempAlloc, tempEnv, originalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&outAlloc, tempAlloc, originalOutcome, strict)
+
+	tempAlloc = outAlloc.Copy()
+	tempEnv = *inputEnv
+	run.additionalMsg = types.NewMessage(
+		sender,
+		&toAddress,
+		tempAlloc[sender].Nonce,
+		value,
+		tempEnv.GasLimit-inputMessage.Gas,
+		inputMessage.GasPrice,
+		inputMessage.GasFeeCap,
+		inputMessage.GasTipCap,
+		data,
+		inputMessage.AccessList,
+		false,
+	)
+	if outAlloc, additOutcome, err = replayRegularMsgs(block, tx+1, tempAlloc, tempEnv, run.additionalMsg); err != nil {
+		return nil, err
+	}
+	mergePostAlloc(&outAlloc, tempAlloc, additOutcome, strict)
+	run.outAlloc, run.additOutcome = outAlloc, additOutcome
+
+	// the hooked transaction runs both messages at once, so it is compared
+	// against the status of the original message and the logs of both
+	run.oriOutcomes = map[string]*msgOutcome{
+		"original": &msgOutcome{
+			To:         originalOutcome.To,
+			Failed:     originalOutcome.Failed,
+			Err:        originalOutcome.Err,
+			ReturnData: originalOutcome.ReturnData,
+			Logs:       append(append([]*types.Log{}, originalOutcome.Logs...), additOutcome.Logs...),
+		},
+	}
+	return run, nil
+}
 
-		// Apply Message with hook
-		var (
-			statedb = MakeOffTheChainStateDB(inputAlloc)
-			gaspool = new(core.GasPool)
-			txHash  = common.Hash{0x02}
-			txIndex = tx
-		)
-		gaspool.AddGas(inputEnv.GasLimit)
-		blockCtx := vm.BlockContext{
-			CanTransfer: core.CanTransfer,
-			Transfer:    core.Transfer,
-			Coinbase:    inputEnv.Coinbase,
-			BlockNumber: new(big.Int).SetUint64(inputEnv.Number),
-			Time:        new(big.Int).SetUint64(inputEnv.Timestamp),
-			Difficulty:  inputEnv.Difficulty,
-			GasLimit:    inputEnv.GasLimit,
-			GetHash:     getHash,
-		}
-		// If currentBaseFee is defined, add it to the vmContext.
-		if inputEnv.BaseFee != nil {
-			blockCtx.BaseFee = new(big.Int).Set(inputEnv.BaseFee)
-		}
-		temp := inputMessage.Gas
-		inputMessage.Gas = inputEnv.GasLimit
-		inputMsg := inputMessage.AsMessage()
-		inputMessage.Gas = temp
-		tracer, err := getTracerFn(txIndex, txHash)
-		if err != nil {
-			return err
-		}
-		vmConfig.Tracer = tracer
-		vmConfig.Debug = (tracer != nil)
-		statedb.Prepare(txHash, txIndex)
-		txCtx := vm.TxContext{
-			GasPrice: inputMsg.GasPrice(),
-			Origin:   inputMsg.From(),
-		}
-		evm := vm.NewEVM(blockCtx, txCtx, statedb, chainConfig, vmConfig)
-		snapshot := statedb.Snapshot()
-		msg = msg[2:]
-		hookResult, err, isHook := core.ApplyMessageWithHook(
-			evm,
-			inputMsg,
-			gaspool,
-			fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetInnerValueList()),
-			targetedAddress[index],
-			msg)
+// hook replays the original message hooked by hook, returning the
+// post-state and outcome to compare with the baseline
+func (run *hookRun) hook(block uint64, tx int, substate *research.Substate, strict bool, inputMsg types.Message, hook *hookInterceptor) (research.SubstateAlloc, map[string]*msgOutcome, error) {
+	hookAlloc, hookOutcome, err := replayInterceptedMsgs(block, tx, run.fundedAlloc, *substate.Env, inputMsg, hook)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strict {
+		mergePostAlloc(&hookAlloc, run.fundedAlloc, hookOutcome, true)
+	}
+	return hookAlloc, map[string]*msgOutcome{"original": hookOutcome}, nil
+}
 
-		if err != nil || isHook == false {
-			statedb.RevertToSnapshot(snapshot)
-			return err
-		} else if hashError != nil {
-			return hashError
+// replayHookMsg compares the original message followed by the additional
+// message msg from sender with the original message hooked by it at each of
+// sites, and reports whether a finding was written
+func replayHookMsg(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget, precompiles []common.Address, sites []int, inputMsg types.Message, contract string, msg string, ret string, sender roleSender) (bool, error) {
+	inputAlloc := substate.InputAlloc
+	inputEnv := substate.Env
+	inputMessage := substate.Message
+
+	toAddress := common.HexToAddress(contract)
+	data, _ := hex.DecodeString(msg[2:])
+	// the additional message carries value if its function is payable
+	value := fuzz.PayableValue(contract, ret, block, senderBalance(inputAlloc, sender.Address))
+	run, err := runHookBaseline(block, tx, substate, inputAlloc, taskPool.StrictOracle, sender.Address, toAddress, value, data)
+	if err != nil {
+		return false, err
+	}
+	// arguments reaching new branches or slots seed later messages
+	fuzz.RecordFeedback(contract, ret, novelty(run.additOutcome))
+	outAlloc, oriOutcomes := run.outAlloc, run.oriOutcomes
+	additionalMsg, funding := run.additionalMsg, run.funding
+
+	// the attacker re-enters as the malicious callee itself, other roles
+	// are called back by it
+	var hookSender common.Address
+	if sender.Role != roleAttacker {
+		hookSender = sender.Address
+	}
+
+	// Apply Message with hook at each selected call site
+	found := false
+	for _, site := range sites {
+		hook := newHookInterceptor(precompiles, site, hookSender, toAddress, data, value)
+		hookAlloc, mutOutcomes, err := run.hook(block, tx, substate, taskPool.StrictOracle, inputMsg, hook)
+		if err != nil {
+			return false, err
 		}
-		if chainConfig.IsByzantium(blockCtx.BlockNumber) {
-			statedb.Finalise(true)
-		} else {
-			statedb.IntermediateRoot(chainConfig.IsEIP158(blockCtx.BlockNumber))
+		// divergences without a successful re-entrance are artifacts, e.g.
+		// of an unfunded callee sending value
+		if !hook.reentered() {
+			continue
 		}
-		hookAlloc = statedb.ResearchPostAlloc
-
-		if addr, a := outAlloc.AllStateEqual(hookAlloc); !a && hookResult.Err == nil {
-			// write bug information
-			bugDir := taskPool.DappDir + "/output/" + addr + "_" +
-				strconv.FormatUint(inputEnv.Number, 10) + ".json"
+		hookOutcome := mutOutcomes["original"]
+
+		if addr, divergence, a := siOracle(taskPool.StrictOracle, outAlloc, hookAlloc, oriOutcomes, mutOutcomes); !a && !hookOutcome.Failed {
+			found = true
+			var minimized *reproducer
+			if !taskPool.SkipMinimize {
+				key := newDivergenceKey(taskPool.StrictOracle, divergence, outAlloc, hookAlloc)
+				hooked := *hook.hooked
+				site := site
+				minimized = minimizeFinding(budget, inputAlloc,
+					[]minimizedCall{{From: sender.Address, To: toAddress, Msg: ret, Input: data, Value: (*hexutil.Big)(value)}},
+					[]common.Address{sender.Address, inputMessage.From, toAddress, *inputMessage.To, hooked.Callee},
+					func(alloc research.SubstateAlloc, calls []minimizedCall) (bool, error) {
+						call := calls[0]
+						run, err := runHookBaseline(block, tx, substate, alloc, taskPool.StrictOracle, call.From, call.To, call.Value.ToInt(), call.Input)
+						if err != nil {
+							return false, err
+						}
+						// the message must re-enter at the same call site
+						hook := newHookInterceptor(precompiles, site, hookSender, call.To, call.Input, call.Value.ToInt())
+						hookAlloc, mutOutcomes, err := run.hook(block, tx, substate, taskPool.StrictOracle, inputMsg, hook)
+						if err != nil || !hook.reentered() || *hook.hooked != hooked || mutOutcomes["original"].Failed {
+							return false, err
+						}
+						_, divergence, a := siOracle(taskPool.StrictOracle, run.outAlloc, hookAlloc, run.oriOutcomes, mutOutcomes)
+						return !a && key.matches(taskPool.StrictOracle, divergence, run.outAlloc, hookAlloc), nil
+					})
+			}
+			// write bug information, one file per transaction, call site, role
+			// and additional message
+			bugDir := findingFile(taskPool.DappDir, addr, inputEnv.Number, tx, data,
+				fmt.Sprintf("hook%d", site), fmt.Sprintf("pc%d", hook.hooked.PC), sender.Role.String())
 			bugDetails := &SIbug{
-				BugType:          "HOOK",
-				InputAlloc:       substate.InputAlloc,
-				OutputAlloc:      substate.OutputAlloc,
-				InputMessage:     *inputMessage,
-				AdditMessageFrom: additionalMsg.From().String(),
-				AdditMessageTo:   additionalMsg.To().String(),
-				AdditMessageData: rets[index],
-				OriAlloc:         outAlloc,
-				MutAlloc:         hookAlloc,
+				BugType:           "HOOK",
+				InputAlloc:        substate.InputAlloc,
+				OutputAlloc:       substate.OutputAlloc,
+				InputMessage:      *inputMessage,
+				AdditMessageFrom:  additionalMsg.From().String(),
+				AdditMessageTo:    additionalMsg.To().String(),
+				AdditMessageData:  ret,
+				AdditMessageValue: value.String(),
+				OriAlloc:          outAlloc,
+				MutAlloc:          hookAlloc,
+				Divergence:        divergence,
+				OriOutcomes:       oriOutcomes,
+				MutOutcomes:       mutOutcomes,
+				CallSite:          hook.hooked,
+				Funding:           funding,
+				Role:              sender.Role.String(),
+				Minimized:         minimized,
 			}
 			data, err := json.MarshalIndent(bugDetails, "", " ")
 			checkError(err)
 			err = ioutil.WriteFile(bugDir, data, 0777)
 			checkError(err)
+			recordFinding("HOOK")
 			//writh to log file
 			log.SetOutput(bugLogFile)
 			log.SetPrefix("[SIBugLog]")
 			log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
-			log.Printf("alloc differ under HOOK in \n%s\nin %d\n", addr, block)
+			log.Printf("%s differ under HOOK as %s in \n%s\nin %d at %s %s->%s depth %d pc %d\n",
+				divergence, sender.Role, addr, block, hook.hooked.Op, hook.hooked.Caller.Hex(), hook.hooked.Callee.Hex(),
+				hook.hooked.Depth, hook.hooked.PC)
 		}
 	}
 
-	return nil
+	return found, nil
+}
+
+func replayRegularMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc, inputEnv research.SubstateEnv, message types.Message) (research.SubstateAlloc, *msgOutcome, error) {
+	return replayInterceptedMsgs(block, tx, inputAlloc, inputEnv, message, nil)
+}
+
+// replayInterceptedMsgs applies message on inputAlloc, consulting interceptor
+// (if any) on every external call
+func replayInterceptedMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc, inputEnv research.SubstateEnv, message types.Message, interceptor vm.CallInterceptor) (research.SubstateAlloc, *msgOutcome, error) {
+	return replayTracedMsgs(block, tx, inputAlloc, inputEnv, message, interceptor, coverageEnabled)
 }
 
-func replayRegularMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc, inputEnv research.SubstateEnv, message types.Message) (research.SubstateAlloc, error) {
+// replayTracedMsgs is replayInterceptedMsgs collecting coverage only if
+// traced, so that analysis replays do not count as fuzzing feedback
+func replayTracedMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc, inputEnv research.SubstateEnv, message types.Message, interceptor vm.CallInterceptor, traced bool) (research.SubstateAlloc, *msgOutcome, error) {
 	//Set up Executing Environment
 	var (
 		vmConfig    vm.Config
-		chainConfig *params.ChainConfig
+		chainConfig = newReplayChainConfig()
 		getTracerFn func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error)
 	)
 	vmConfig = vm.Config{}
-	chainConfig = &params.ChainConfig{}
-	*chainConfig = *params.MainnetChainConfig
-	// disable DAOForkSupport, otherwise account states will be overwritten
-	chainConfig.DAOForkSupport = false
+	var coverage *coverageTracer
 	getTracerFn = func(txIndex int, txHash common.Hash) (tracer vm.EVMLogger, err error) {
-		return nil, nil
-	}
-	var hashError error
-	getHash := func(num uint64) common.Hash {
-		if inputEnv.BlockHashes == nil {
-			hashError = fmt.Errorf("getHash(%d) invoked, no blockhashes provided", num)
-			return common.Hash{}
-		}
-		h, ok := inputEnv.BlockHashes[num]
-		if !ok {
-			hashError = fmt.Errorf("getHash(%d) invoked, blockhash for that block not provided", num)
+		if !traced {
+			return nil, nil
 		}
-		return h
+		coverage = newCoverageTracer()
+		return coverage, nil
 	}
+	var hashError error
 
 	// Apply Message
 	var (
@@ -900,26 +1329,14 @@ func replayRegularMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc,
 		txIndex = tx
 	)
 	gaspool.AddGas(inputEnv.GasLimit)
-	blockCtx := vm.BlockContext{
-		CanTransfer: core.CanTransfer,
-		Transfer:    core.Transfer,
-		Coinbase:    inputEnv.Coinbase,
-		BlockNumber: new(big.Int).SetUint64(inputEnv.Number),
-		Time:        new(big.Int).SetUint64(inputEnv.Timestamp),
-		Difficulty:  inputEnv.Difficulty,
-		GasLimit:    inputEnv.GasLimit,
-		GetHash:     getHash,
-	}
-	// If currentBaseFee is defined, add it to the vmContext.
-	if inputEnv.BaseFee != nil {
-		blockCtx.BaseFee = new(big.Int).Set(inputEnv.BaseFee)
-	}
+	blockCtx := newReplayBlockContext(inputEnv, &hashError)
 	tracer, err := getTracerFn(txIndex, txHash)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	vmConfig.Tracer = tracer
 	vmConfig.Debug = (tracer != nil)
+	vmConfig.CallInterceptor = interceptor
 	statedb.Prepare(txHash, txIndex)
 	txCtx := vm.TxContext{
 		GasPrice: message.GasPrice(),
@@ -927,15 +1344,15 @@ func replayRegularMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc,
 	}
 	evm := vm.NewEVM(blockCtx, txCtx, statedb, chainConfig, vmConfig)
 	snapshot := statedb.Snapshot()
-	_, err = core.ApplyMessage(evm, message, gaspool)
+	msgResult, err := core.ApplyMessage(evm, message, gaspool)
 
 	if err != nil {
 		statedb.RevertToSnapshot(snapshot)
-		return nil, err
+		return nil, nil, err
 	}
 
 	if hashError != nil {
-		return nil, hashError
+		return nil, nil, hashError
 	}
 
 	if chainConfig.IsByzantium(blockCtx.BlockNumber) {
@@ -945,8 +1362,52 @@ func replayRegularMsgs(block uint64, tx int, inputAlloc research.SubstateAlloc,
 	}
 
 	evmAlloc := statedb.ResearchPostAlloc
+	outcome := newMsgOutcome(message, msgResult, statedb.GetLogs(txHash, common.Hash{}), statedb.ResearchPreAlloc, evmAlloc)
+	if coverage != nil {
+		outcome.NewCoverage = coverage.merge()
+	}
+
+	return evmAlloc, outcome, nil
+}
 
-	return evmAlloc, nil
+// newReplayChainConfig returns the chain config messages are replayed under
+func newReplayChainConfig() *params.ChainConfig {
+	chainConfig := &params.ChainConfig{}
+	*chainConfig = *params.MainnetChainConfig
+	// disable DAOForkSupport, otherwise account states will be overwritten
+	chainConfig.DAOForkSupport = false
+	return chainConfig
+}
+
+// newReplayBlockContext returns the block context of inputEnv. Looking up a
+// block hash missing from inputEnv sets hashError.
+func newReplayBlockContext(inputEnv research.SubstateEnv, hashError *error) vm.BlockContext {
+	getHash := func(num uint64) common.Hash {
+		if inputEnv.BlockHashes == nil {
+			*hashError = fmt.Errorf("getHash(%d) invoked, no blockhashes provided", num)
+			return common.Hash{}
+		}
+		h, ok := inputEnv.BlockHashes[num]
+		if !ok {
+			*hashError = fmt.Errorf("getHash(%d) invoked, blockhash for that block not provided", num)
+		}
+		return h
+	}
+	blockCtx := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    inputEnv.Coinbase,
+		BlockNumber: new(big.Int).SetUint64(inputEnv.Number),
+		Time:        new(big.Int).SetUint64(inputEnv.Timestamp),
+		Difficulty:  inputEnv.Difficulty,
+		GasLimit:    inputEnv.GasLimit,
+		GetHash:     getHash,
+	}
+	// If currentBaseFee is defined, add it to the vmContext.
+	if inputEnv.BaseFee != nil {
+		blockCtx.BaseFee = new(big.Int).Set(inputEnv.BaseFee)
+	}
+	return blockCtx
 }
 
 // parsing address varients from addressdir
@@ -961,8 +1422,6 @@ func initGlobalEnv(ctx *cli.Context, taskPool *research.SubstateTaskPool) error
 		os.O_RDWR|os.O_CREATE|os.O_APPEND,
 		0766)
 	checkError(err)
-	// set up a global variable
-	tenEther, _ = new(big.Int).SetString("10000000000000000000", 0)
 	// readline from address.txt
 	addressDir := taskPool.DappDir + "/address.txt"
 	fmt.Printf("record-replay: --addressdir=%s\n", addressDir)
@@ -988,6 +1447,10 @@ func initGlobalEnv(ctx *cli.Context, taskPool *research.SubstateTaskPool) error
 	}
 
 	fuzz.GlobalABIPath = taskPool.DappDir + "/abi/"
+	// optional solc storage layouts of tokens, named after their address
+	if err = research.LoadStorageLayouts(taskPool.DappDir + "/layout/"); err != nil {
+		return err
+	}
 
 	// read from richInfo
 	if taskPool.RichInfo {
@@ -1026,6 +1489,8 @@ func initGlobalEnv(ctx *cli.Context, taskPool *research.SubstateTaskPool) error
 					continue
 				}
 				fuzz.UpdateGlobalSeeds(substate.Message.Data, pastBlock)
+				fuzz.UpdateValueSeed(substate.Message.Value, pastBlock)
+				recordAdminCall(substate, pastBlock)
 			}
 		}
 	}
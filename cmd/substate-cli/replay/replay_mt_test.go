@@ -0,0 +1,28 @@
+package replay
+
+import "testing"
+
+func TestFindingFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		tx    int
+		data  []byte
+		parts []string
+		want  string
+	}{
+		{"no parts", 0, nil, nil, "dapp/output/0xabc_100_0_c5d24601.json"},
+		{"tod", 3, []byte{1}, []string{"tod", "attacker"}, "dapp/output/0xabc_100_3_tod_attacker_5fe7f977.json"},
+		{"other message", 3, []byte{2}, []string{"tod", "attacker"}, "dapp/output/0xabc_100_3_tod_attacker_f2ee15ea.json"},
+	}
+	seen := make(map[string]string)
+	for _, tt := range tests {
+		got := findingFile("dapp", "0xabc", 100, tt.tx, tt.data, tt.parts...)
+		if got != tt.want {
+			t.Errorf("%s: findingFile = %s, want %s", tt.name, got, tt.want)
+		}
+		if other, exist := seen[got]; exist {
+			t.Errorf("%s: same file as %s", tt.name, other)
+		}
+		seen[got] = tt.name
+	}
+}
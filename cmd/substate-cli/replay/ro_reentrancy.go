@@ -0,0 +1,197 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// viewCall is a parameterless view function of an inner contract
+type viewCall struct {
+	Contract  common.Address
+	Signature string
+	Input     []byte
+}
+
+// viewDivergence is a view whose value read at an external call point of the
+// transaction matches neither its value before nor after the transaction
+type viewDivergence struct {
+	Contract  common.Address `json:"contract"`
+	Signature string         `json:"signature"`
+	CallSite  *callSite      `json:"callSite"`
+	Before    hexutil.Bytes  `json:"before"`
+	During    hexutil.Bytes  `json:"during"`
+	After     hexutil.Bytes  `json:"after"`
+}
+
+// roReentrancyInterceptor reads all views whenever an inner contract calls
+// out, i.e. when an external protocol could read them mid-update
+type roReentrancyInterceptor struct {
+	externalCallFilter
+	views []viewCall
+	gas   uint64
+
+	sites []*callSite
+	reads [][]*vm.InjectedCall
+}
+
+// InterceptCall implements vm.CallInterceptor
+func (ro *roReentrancyInterceptor) InterceptCall(frame *vm.CallFrame) *vm.CallInjection {
+	if !ro.isExternal(frame) {
+		return nil
+	}
+	reads := make([]*vm.InjectedCall, len(ro.views))
+	for i, view := range ro.views {
+		reads[i] = &vm.InjectedCall{
+			From:   frame.Callee,
+			To:     view.Contract,
+			Input:  view.Input,
+			Gas:    ro.gas,
+			Static: true,
+		}
+	}
+	ro.sites = append(ro.sites, newCallSite(frame))
+	ro.reads = append(ro.reads, reads)
+	return &vm.CallInjection{Before: reads}
+}
+
+// readViews calls views from from on top of alloc, under the block context
+// of inputEnv
+func readViews(alloc research.SubstateAlloc, inputEnv research.SubstateEnv, from common.Address, views []viewCall, gas uint64) ([][]byte, []error) {
+	var hashError error
+	blockCtx := newReplayBlockContext(inputEnv, &hashError)
+	txCtx := vm.TxContext{Origin: from, GasPrice: new(big.Int)}
+	evm := vm.NewEVM(blockCtx, txCtx, MakeOffTheChainStateDB(alloc), newReplayChainConfig(), vm.Config{})
+
+	rets := make([][]byte, len(views))
+	errs := make([]error, len(views))
+	for i, view := range views {
+		ret, _, err := evm.StaticCall(vm.AccountRef(from), view.Contract, view.Input, gas)
+		rets[i], errs[i] = common.CopyBytes(ret), err
+		if hashError != nil {
+			errs[i], hashError = hashError, nil
+		}
+	}
+	return rets, errs
+}
+
+// roReentrancyDivergences replays message on inputAlloc, reads views at every
+// external call of an inner contract and returns those matching neither their
+// value before nor after the message
+func roReentrancyDivergences(block uint64, tx int, inputAlloc research.SubstateAlloc, inputEnv research.SubstateEnv, message types.Message, views []viewCall) ([]viewDivergence, error) {
+	ro := &roReentrancyInterceptor{
+		externalCallFilter: newExternalCallFilter(vm.ActivePrecompiles(newReplayChainConfig().Rules(new(big.Int).SetUint64(inputEnv.Number)))),
+		views:              views,
+		gas:                inputEnv.GasLimit,
+	}
+
+	// views before the message
+	beforeRets, beforeErrs := readViews(inputAlloc, inputEnv, message.From(), views, inputEnv.GasLimit)
+
+	// views during the message
+	outputAlloc, outcome, err := replayInterceptedMsgs(block, tx, inputAlloc, inputEnv, message, ro)
+	if err != nil {
+		return nil, err
+	}
+	if len(ro.sites) == 0 {
+		return nil, nil
+	}
+	mergePostAlloc(&outputAlloc, inputAlloc, outcome, true)
+
+	// views after the message
+	afterRets, afterErrs := readViews(outputAlloc, inputEnv, message.From(), views, inputEnv.GasLimit)
+
+	var divergences []viewDivergence
+	for i, site := range ro.sites {
+		for j, read := range ro.reads[i] {
+			// a view guarded against reentrancy reverts, which is not a bug
+			if !read.Executed || read.Err != nil || beforeErrs[j] != nil || afterErrs[j] != nil {
+				continue
+			}
+			if bytes.Equal(read.Ret, beforeRets[j]) || bytes.Equal(read.Ret, afterRets[j]) {
+				continue
+			}
+			divergences = append(divergences, viewDivergence{
+				Contract:  views[j].Contract,
+				Signature: views[j].Signature,
+				CallSite:  site,
+				Before:    beforeRets[j],
+				During:    read.Ret,
+				After:     afterRets[j],
+			})
+		}
+	}
+	return divergences, nil
+}
+
+// replayWithRoReentrancyMR replays the original transaction, reads the views
+// of the DApp at every external call and compares them with the views before
+// and after the transaction
+func replayWithRoReentrancyMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool) error {
+	inputEnv := substate.Env
+	inputMessage := substate.Message
+
+	addrs, msgs, sigs, err := fuzz.ViewBuilder(fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetInnerValueList()))
+	if err != nil {
+		return fmt.Errorf("error in generating view calls")
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	views := make([]viewCall, 0, len(msgs))
+	for i, msg := range msgs {
+		input, err := hex.DecodeString(msg[2:])
+		if err != nil {
+			continue
+		}
+		views = append(views, viewCall{
+			Contract:  common.HexToAddress(addrs[i]),
+			Signature: sigs[i],
+			Input:     input,
+		})
+	}
+
+	divergences, err := roReentrancyDivergences(block, tx, substate.InputAlloc, *inputEnv, inputMessage.AsMessage(), views)
+	if err != nil || len(divergences) == 0 {
+		return err
+	}
+
+	// write bug information, one file per transaction
+	addr := strings.ToLower(divergences[0].Contract.String())
+	bugFile := findingFile(taskPool.DappDir, addr, inputEnv.Number, tx, inputMessage.Data, "ro")
+	bugDetails := &SIbug{
+		BugType:      "RO-REENTRANCY",
+		InputAlloc:   substate.InputAlloc,
+		OutputAlloc:  substate.OutputAlloc,
+		InputMessage: *inputMessage,
+		Views:        divergences,
+	}
+	data, err := json.MarshalIndent(bugDetails, "", " ")
+	checkError(err)
+	err = ioutil.WriteFile(bugFile, data, 0777)
+	checkError(err)
+	recordFinding("RO-REENTRANCY")
+	//writh to bug log file
+	log.SetOutput(bugLogFile)
+	log.SetPrefix("[SIBugLog]")
+	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+	for _, divergence := range divergences {
+		log.Printf("view %s differ under RO-REENTRANCY in \n%s\nat %s %s->%s pc %d in %d\n",
+			divergence.Signature, strings.ToLower(divergence.Contract.String()),
+			divergence.CallSite.Op, divergence.CallSite.Caller.Hex(), divergence.CallSite.Callee.Hex(),
+			divergence.CallSite.PC, block)
+	}
+	return nil
+}
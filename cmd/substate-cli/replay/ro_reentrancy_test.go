@@ -0,0 +1,80 @@
+package replay
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// newUpdatingContract returns the code of a contract returning slot 0 when
+// called with data; otherwise it sets slot 0 to mid, calls callee and sets
+// slot 0 to final
+func newUpdatingContract(mid, final byte, callee common.Address) []byte {
+	code := []byte{
+		0x36, 0x60, 0x2d, 0x57, // JUMPI(view, CALLDATASIZE)
+		0x60, mid, 0x60, 0x00, 0x55, // SSTORE(0, mid)
+		0x60, 0x00, 0x80, 0x80, 0x80, 0x80, 0x73, // CALL(GAS, callee, 0, 0, 0, 0, 0)
+	}
+	code = append(code, callee.Bytes()...)
+	code = append(code,
+		0x5a, 0xf1, 0x50,
+		0x60, final, 0x60, 0x00, 0x55, 0x00, // SSTORE(0, final) STOP
+		0x5b, 0x60, 0x00, 0x54, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3, // view: RETURN(SLOAD(0))
+	)
+	return code
+}
+
+func TestRoReentrancyDivergences(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		inner    = common.BytesToAddress([]byte("inner"))
+		outer    = common.BytesToAddress([]byte("outer"))
+		views    = []viewCall{{Contract: contract, Signature: "value()", Input: []byte{1}}}
+	)
+	defer func(seed []fuzz.SeedItem) { fuzz.GlobalInnerSeed = seed }(fuzz.GlobalInnerSeed)
+	fuzz.GlobalInnerSeed = []fuzz.SeedItem{{Value: strings.ToLower(contract.String())}, {Value: strings.ToLower(inner.String())}}
+	env := testEnv
+	env.Number = 5000000 // Byzantium
+
+	tests := []struct {
+		name       string
+		code       []byte
+		wantDuring byte // 0 if no divergence
+	}{
+		{"updated after the external call", newUpdatingContract(1, 2, outer), 1},
+		{"updated before the external call", newUpdatingContract(1, 1, outer), 0},
+		{"call to an inner contract", newUpdatingContract(1, 2, inner), 0},
+	}
+	for _, tt := range tests {
+		alloc := research.SubstateAlloc{
+			testSender: research.NewSubstateAccount(0, big.NewInt(1000000000), nil),
+			contract:   research.NewSubstateAccount(1, new(big.Int), tt.code),
+		}
+		divergences, err := roReentrancyDivergences(1, 0, alloc, env, newTestMsg(testSender, contract), views)
+		if err != nil {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if tt.wantDuring == 0 {
+			if len(divergences) != 0 {
+				t.Errorf("%s: divergences %+v, want none", tt.name, divergences)
+			}
+			continue
+		}
+		if len(divergences) != 1 {
+			t.Errorf("%s: %d divergences, want 1", tt.name, len(divergences))
+			continue
+		}
+		divergence := divergences[0]
+		if divergence.CallSite.Callee != outer ||
+			new(big.Int).SetBytes(divergence.Before).Int64() != 0 ||
+			new(big.Int).SetBytes(divergence.During).Int64() != int64(tt.wantDuring) ||
+			new(big.Int).SetBytes(divergence.After).Int64() != 2 {
+			t.Errorf("%s: divergence %+v, want view 0 -> %d -> 2 at the call to %s", tt.name, divergence, tt.wantDuring, outer.Hex())
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package replay
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// senderRole is the identity an additional message is sent under. Roles are
+// ordered by privilege, so findings are labeled with the least privileged role
+// able to trigger them.
+type senderRole int
+
+const (
+	roleAttacker senderRole = iota
+	roleVictim
+	rolePrivileged
+)
+
+var senderRoleNames = map[senderRole]string{
+	roleAttacker:   "attacker",
+	roleVictim:     "victim",
+	rolePrivileged: "privileged",
+}
+
+func (role senderRole) String() string {
+	return senderRoleNames[role]
+}
+
+// parseSenderRoles parses the --sender-roles specification into roles sorted
+// by privilege
+func parseSenderRoles(spec string) ([]senderRole, error) {
+	enabled := make(map[senderRole]bool)
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		found := false
+		for role, name := range senderRoleNames {
+			if name == field {
+				enabled[role], found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid sender role %q", field)
+		}
+	}
+	var roles []senderRole
+	for _, role := range []senderRole{roleAttacker, roleVictim, rolePrivileged} {
+		if enabled[role] {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// roleSender is an additional message sender together with its role
+type roleSender struct {
+	Role    senderRole
+	Address common.Address
+}
+
+var (
+	// storage slots holding the owner of Ownable, OwnableUpgradeable and the
+	// EIP-1967 admin of proxies
+	ownerSlots = []common.Hash{
+		common.BigToHash(big.NewInt(0)),
+		common.BigToHash(big.NewInt(51)),
+		common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"),
+	}
+	// well-known AccessControl roles, DEFAULT_ADMIN_ROLE being zero
+	accessControlRoles = []common.Hash{
+		{},
+		crypto.Keccak256Hash([]byte("MINTER_ROLE")),
+		crypto.Keccak256Hash([]byte("PAUSER_ROLE")),
+		crypto.Keccak256Hash([]byte("ADMIN_ROLE")),
+		crypto.Keccak256Hash([]byte("OPERATOR_ROLE")),
+		crypto.Keccak256Hash([]byte("UPGRADER_ROLE")),
+	}
+	// slots of the members mappings of accessControlRoles, for every position
+	// of the _roles mapping
+	roleMemberSlots     []common.Hash
+	roleMemberSlotsOnce sync.Once
+
+	// first block of a successful admin call per sender and inner contract
+	adminSenders   = make(map[common.Address]map[common.Address]uint64)
+	adminSendersMu sync.Mutex
+)
+
+func memberSlots() []common.Hash {
+	roleMemberSlotsOnce.Do(func() {
+		for position := int64(0); position < 256; position++ {
+			slot := common.BigToHash(big.NewInt(position))
+			for _, role := range accessControlRoles {
+				roleMemberSlots = append(roleMemberSlots, crypto.Keccak256Hash(role[:], slot[:]))
+			}
+		}
+	})
+	return roleMemberSlots
+}
+
+// recordAdminCall remembers the sender of a successful admin call to an inner
+// contract in block as privileged
+func recordAdminCall(substate *research.Substate, block uint64) {
+	msg := substate.Message
+	if msg.To == nil || substate.Result == nil || substate.Result.Status != types.ReceiptStatusSuccessful {
+		return
+	}
+	if !fuzz.IsAdminCall(strings.ToLower(msg.To.String()), msg.Data) {
+		return
+	}
+	adminSendersMu.Lock()
+	defer adminSendersMu.Unlock()
+	if adminSenders[*msg.To] == nil {
+		adminSenders[*msg.To] = make(map[common.Address]uint64)
+	}
+	if first, exist := adminSenders[*msg.To][msg.From]; !exist || block < first {
+		adminSenders[*msg.To][msg.From] = block
+	}
+}
+
+// historicalAdmins lists the admin senders of contract recorded up to block
+func historicalAdmins(contract common.Address, block uint64) []common.Address {
+	adminSendersMu.Lock()
+	defer adminSendersMu.Unlock()
+	var admins []common.Address
+	for admin, first := range adminSenders[contract] {
+		if first <= block {
+			admins = append(admins, admin)
+		}
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Hex() < admins[j].Hex() })
+	return admins
+}
+
+// storedOwners reads the owner slots of account, skipping values that do not
+// look like addresses
+func storedOwners(account *research.SubstateAccount) []common.Address {
+	var owners []common.Address
+	for _, slot := range ownerSlots {
+		value, exist := account.Storage[slot]
+		if !exist {
+			continue
+		}
+		// small integers and packed words are not addresses
+		if new(big.Int).SetBytes(value[:12]).Sign() != 0 ||
+			new(big.Int).SetBytes(value[12:]).BitLen() <= 128 {
+			continue
+		}
+		owners = append(owners, common.BytesToAddress(value[12:]))
+	}
+	return owners
+}
+
+// hasAccessControlRole checks whether account is a member of a well-known
+// AccessControl role in the storage of contract
+func hasAccessControlRole(contract *research.SubstateAccount, account common.Address) bool {
+	key := common.BytesToHash(account.Bytes())
+	for _, members := range memberSlots() {
+		slot := crypto.Keccak256Hash(key[:], members[:])
+		if value, exist := contract.Storage[slot]; exist && value.Big().Cmp(common.Big1) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// roleModel assigns the sender identities of additional messages for one
+// transaction: the victim is its original sender, the attacker an unrelated
+// user and the privileged account one detected for the target contract
+type roleModel struct {
+	roles    []senderRole
+	block    uint64
+	alloc    research.SubstateAlloc
+	victim   common.Address
+	attacker common.Address
+	users    []common.Address
+}
+
+func newRoleModel(block uint64, substate *research.Substate, localUsers []string, roles []senderRole) *roleModel {
+	model := &roleModel{
+		roles:  roles,
+		block:  block,
+		alloc:  substate.InputAlloc,
+		victim: substate.Message.From,
+	}
+	for _, user := range localUsers {
+		model.users = append(model.users, common.HexToAddress(user))
+	}
+
+	var candidates []common.Address
+	for _, user := range model.users {
+		if user != model.victim && !model.isPrivileged(user) {
+			candidates = append(candidates, user)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, user := range fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetUserValueList()) {
+			addr := common.HexToAddress(user)
+			if addr != model.victim && !model.isPrivileged(addr) {
+				candidates = append(candidates, addr)
+			}
+		}
+	}
+	// without other users, the attacker is a key owned by the fuzzer
+	if len(candidates) == 0 {
+		model.attacker = common.HexToAddress(fuzz.SignerAddresses()[0])
+	} else {
+		model.attacker = candidates[int(rand.Uint64()/2)%len(candidates)]
+	}
+	return model
+}
+
+// privileged returns the privileged accounts of contract able to send
+// messages, historical admins first
+func (model *roleModel) privileged(contract common.Address) []common.Address {
+	account, exist := model.alloc[contract]
+	if !exist {
+		return nil
+	}
+	var (
+		accounts []common.Address
+		seen     = make(map[common.Address]bool)
+	)
+	add := func(addr common.Address) {
+		// messages can only be sent from externally owned accounts
+		if seen[addr] || (model.alloc[addr] != nil && len(model.alloc[addr].Code) > 0) {
+			return
+		}
+		seen[addr] = true
+		accounts = append(accounts, addr)
+	}
+	for _, admin := range historicalAdmins(contract, model.block) {
+		add(admin)
+	}
+	for _, owner := range storedOwners(account) {
+		add(owner)
+	}
+	for _, user := range append(append([]common.Address{}, model.users...), model.victim) {
+		if hasAccessControlRole(account, user) {
+			add(user)
+		}
+	}
+	return accounts
+}
+
+// isPrivileged checks whether addr is privileged in any inner contract
+func (model *roleModel) isPrivileged(addr common.Address) bool {
+	for _, inner := range fuzz.ConvertInterfaceSlice2StringSlice(fuzz.GetInnerValueList()) {
+		contract := common.HexToAddress(inner)
+		account, exist := model.alloc[contract]
+		if !exist {
+			continue
+		}
+		adminSendersMu.Lock()
+		first, admin := adminSenders[contract][addr]
+		adminSendersMu.Unlock()
+		if admin && first <= model.block {
+			return true
+		}
+		for _, owner := range storedOwners(account) {
+			if owner == addr {
+				return true
+			}
+		}
+		if hasAccessControlRole(account, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// senders lists the senders of additional messages to contract, from the
+// least privileged one
+func (model *roleModel) senders(contract common.Address) []roleSender {
+	var senders []roleSender
+	for _, role := range model.roles {
+		switch role {
+		case roleAttacker:
+			senders = append(senders, roleSender{Role: role, Address: model.attacker})
+		case roleVictim:
+			senders = append(senders, roleSender{Role: role, Address: model.victim})
+		case rolePrivileged:
+			// the victim being privileged is already covered
+			for _, addr := range model.privileged(contract) {
+				if addr != model.victim {
+					senders = append(senders, roleSender{Role: role, Address: addr})
+					break
+				}
+			}
+		}
+	}
+	return senders
+}
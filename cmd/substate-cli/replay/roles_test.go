@@ -0,0 +1,179 @@
+package replay
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	testOwner  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	testMinter = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	testAdmin  = common.HexToAddress("0x3333333333333333333333333333333333333333")
+	testUser   = common.HexToAddress("0x4444444444444444444444444444444444444444")
+	testVictim = common.HexToAddress("0x5555555555555555555555555555555555555555")
+)
+
+// roleMemberSlot returns the slot of the membership of account in role, for
+// the _roles mapping at position
+func roleMemberSlot(role common.Hash, position int64, account common.Address) common.Hash {
+	roleSlot := crypto.Keccak256Hash(role[:], common.BigToHash(big.NewInt(position)).Bytes())
+	return crypto.Keccak256Hash(common.BytesToHash(account.Bytes()).Bytes(), roleSlot[:])
+}
+
+func TestParseSenderRoles(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []senderRole
+		wantErr bool
+	}{
+		{"attacker", []senderRole{roleAttacker}, false},
+		{"attacker,victim,privileged", []senderRole{roleAttacker, roleVictim, rolePrivileged}, false},
+		{"privileged, attacker", []senderRole{roleAttacker, rolePrivileged}, false},
+		{"victim,victim", []senderRole{roleVictim}, false},
+		{"", nil, true},
+		{"attacker,", nil, true},
+		{"owner", nil, true},
+		{"Attacker", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSenderRoles(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSenderRoles(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSenderRoles(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestStoredOwners(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots map[common.Hash]common.Hash
+		want  []common.Address
+	}{
+		{name: "no owner"},
+		{name: "Ownable", slots: map[common.Hash]common.Hash{ownerSlots[0]: testOwner.Hash()}, want: []common.Address{testOwner}},
+		{name: "OwnableUpgradeable", slots: map[common.Hash]common.Hash{ownerSlots[1]: testOwner.Hash()}, want: []common.Address{testOwner}},
+		{name: "EIP-1967 admin", slots: map[common.Hash]common.Hash{ownerSlots[2]: testAdmin.Hash()}, want: []common.Address{testAdmin}},
+		{
+			name:  "several slots",
+			slots: map[common.Hash]common.Hash{ownerSlots[0]: testOwner.Hash(), ownerSlots[2]: testAdmin.Hash()},
+			want:  []common.Address{testOwner, testAdmin},
+		},
+		{name: "small integer", slots: map[common.Hash]common.Hash{ownerSlots[0]: common.BigToHash(big.NewInt(1000))}},
+		{name: "packed word", slots: map[common.Hash]common.Hash{ownerSlots[0]: common.HexToHash("0x0100000000000000000000001111111111111111111111111111111111111111")}},
+		{name: "other slot", slots: map[common.Hash]common.Hash{common.BigToHash(big.NewInt(1)): testOwner.Hash()}},
+	}
+	for _, tt := range tests {
+		account := research.NewSubstateAccount(1, new(big.Int), []byte{0x00})
+		for slot, value := range tt.slots {
+			account.Storage[slot] = value
+		}
+		if got := storedOwners(account); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: storedOwners = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasAccessControlRole(t *testing.T) {
+	minterRole := crypto.Keccak256Hash([]byte("MINTER_ROLE"))
+	tests := []struct {
+		name  string
+		slot  common.Hash
+		value int64
+		want  bool
+	}{
+		{"default admin", roleMemberSlot(common.Hash{}, 0, testMinter), 1, true},
+		{"minter of an upgradeable contract", roleMemberSlot(minterRole, 101, testMinter), 1, true},
+		{"revoked", roleMemberSlot(minterRole, 0, testMinter), 0, false},
+		{"not a boolean", roleMemberSlot(minterRole, 0, testMinter), 2, false},
+		{"unknown role", roleMemberSlot(crypto.Keccak256Hash([]byte("OTHER_ROLE")), 0, testMinter), 1, false},
+		{"other account", roleMemberSlot(minterRole, 0, testUser), 1, false},
+	}
+	for _, tt := range tests {
+		contract := research.NewSubstateAccount(1, new(big.Int), []byte{0x00})
+		contract.Storage[tt.slot] = common.BigToHash(big.NewInt(tt.value))
+		if got := hasAccessControlRole(contract, testMinter); got != tt.want {
+			t.Errorf("%s: hasAccessControlRole = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoleModel(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		later    = common.HexToAddress("0x6666666666666666666666666666666666666666")
+		block    = uint64(10)
+	)
+	defer func(seed []fuzz.SeedItem) {
+		fuzz.GlobalInnerSeed = seed
+		adminSenders = make(map[common.Address]map[common.Address]uint64)
+	}(fuzz.GlobalInnerSeed)
+	fuzz.GlobalInnerSeed = []fuzz.SeedItem{{Value: strings.ToLower(contract.String())}}
+	// testAdmin called an admin function before block, later only after it
+	adminSenders = map[common.Address]map[common.Address]uint64{contract: {testAdmin: 5, later: 20}}
+
+	account := research.NewSubstateAccount(1, new(big.Int), []byte{0x00})
+	account.Storage[ownerSlots[0]] = testOwner.Hash()
+	account.Storage[roleMemberSlot(common.Hash{}, 0, testMinter)] = common.BigToHash(common.Big1)
+	alloc := research.SubstateAlloc{contract: account}
+	for _, addr := range []common.Address{testOwner, testMinter, testAdmin, testUser, testVictim, later} {
+		alloc[addr] = research.NewSubstateAccount(0, big.NewInt(1000), nil)
+	}
+	substate := research.NewSubstate(alloc, research.SubstateAlloc{}, &research.SubstateEnv{},
+		&research.SubstateMessage{From: testVictim, To: &contract}, &research.SubstateResult{Status: 1})
+
+	// role members are only known among the users
+	tests := []struct {
+		name           string
+		users          []common.Address
+		wantAttacker   common.Address
+		wantPrivileged []common.Address
+	}{
+		{
+			name:           "plain user",
+			users:          []common.Address{testOwner, testMinter, testAdmin, testUser, testVictim},
+			wantAttacker:   testUser,
+			wantPrivileged: []common.Address{testAdmin, testOwner, testMinter},
+		},
+		{
+			name:           "admin after the block",
+			users:          []common.Address{testOwner, testVictim, later},
+			wantAttacker:   later,
+			wantPrivileged: []common.Address{testAdmin, testOwner},
+		},
+		{
+			name:           "privileged users only",
+			users:          []common.Address{testOwner, testMinter, testAdmin},
+			wantAttacker:   common.HexToAddress(fuzz.SignerAddresses()[0]),
+			wantPrivileged: []common.Address{testAdmin, testOwner, testMinter},
+		},
+	}
+	for _, tt := range tests {
+		var users []string
+		for _, user := range tt.users {
+			users = append(users, strings.ToLower(user.Hex()))
+		}
+		model := newRoleModel(block, substate, users, []senderRole{roleAttacker, roleVictim, rolePrivileged})
+		if model.attacker != tt.wantAttacker {
+			t.Errorf("%s: attacker %s, want %s", tt.name, model.attacker.Hex(), tt.wantAttacker.Hex())
+		}
+		// historical admins first, then owners and role members
+		if got, want := model.privileged(contract), tt.wantPrivileged; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: privileged %v, want %v", tt.name, got, want)
+		}
+		want := []roleSender{{roleAttacker, tt.wantAttacker}, {roleVictim, testVictim}, {rolePrivileged, testAdmin}}
+		if got := model.senders(contract); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: senders %v, want %v", tt.name, got, want)
+		}
+	}
+}
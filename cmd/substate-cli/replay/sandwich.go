@@ -0,0 +1,210 @@
+package replay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// victimOutcome compares the sender of the original transaction executing
+// alone before the attacker messages with it being sandwiched by them
+type victimOutcome struct {
+	Victim            common.Address `json:"victim"`
+	Attacker          common.Address `json:"attacker"`
+	BalanceAlone      *hexutil.Big   `json:"balanceAlone"`
+	BalanceSandwiched *hexutil.Big   `json:"balanceSandwiched"`
+	AttackerGain      *hexutil.Big   `json:"attackerGain"`
+}
+
+func allocBalance(alloc research.SubstateAlloc, addr common.Address) *big.Int {
+	if account, exist := alloc[addr]; exist && account.Balance != nil {
+		return account.Balance
+	}
+	return new(big.Int)
+}
+
+func newVictimOutcome(victim, attacker common.Address, aloneAlloc, sandwichAlloc research.SubstateAlloc) *victimOutcome {
+	return &victimOutcome{
+		Victim:            victim,
+		Attacker:          attacker,
+		BalanceAlone:      (*hexutil.Big)(allocBalance(aloneAlloc, victim)),
+		BalanceSandwiched: (*hexutil.Big)(allocBalance(sandwichAlloc, victim)),
+		AttackerGain:      (*hexutil.Big)(new(big.Int).Sub(allocBalance(sandwichAlloc, attacker), allocBalance(aloneAlloc, attacker))),
+	}
+}
+
+// divergence compares the outcome of the victim message alone with the one
+// sandwiched. Balance differences within gasSlack come from gas refunds
+// rather than from the attacker.
+func (outcome *victimOutcome) divergence(alone, sandwiched *msgOutcome, gasSlack *big.Int, strict bool) (string, bool) {
+	if divergence, equal := alone.Equal(sandwiched, strict); !equal {
+		return divergence, false
+	}
+	loss := new(big.Int).Sub(outcome.BalanceAlone.ToInt(), outcome.BalanceSandwiched.ToInt())
+	if loss.CmpAbs(gasSlack) > 0 {
+		return "balance", false
+	}
+	return "", true
+}
+
+// replayWithSandwichMR wraps the original transaction with a front-run and a
+// back-run message of the attacker, and compares the outcome of the victim with
+// the one of the original transaction executing before both messages
+func replayWithSandwichMR(block uint64, tx int, substate *research.Substate, taskPool *research.SubstateTaskPool, budget *txBudget, localUsers []string, localContracts []string) error {
+	env := substate.Env
+	inputAlloc := substate.InputAlloc
+	originalMessage := substate.Message
+
+	var (
+		addrs []string
+		msgs  []string
+		rets  []string
+		err   error
+	)
+
+	contracts2IndexList := make(map[string][]int)
+	// identify storage index dependency
+	for contract, account := range inputAlloc {
+		for key, _ := range account.Storage {
+			keyInt, _ := strconv.ParseInt(key.Hex(), 16, 0)
+			contracts2IndexList[contract.Hex()] = append(contracts2IndexList[contract.Hex()], int(keyInt))
+		}
+	}
+	if addrs, msgs, rets, err = msgbuilder(
+		block,
+		localUsers,
+		contracts2IndexList,
+		taskPool); err != nil {
+		return fmt.Errorf("error in generating msgs")
+	}
+	addrs, msgs, rets = budget.schedule(substate, addrs, msgs, rets)
+
+	attacker := newRoleModel(block, substate, localUsers, []senderRole{roleAttacker}).attacker
+	victim := originalMessage.From
+	gas := (env.GasLimit - originalMessage.Gas) / 2
+	gasSlack := new(big.Int).Sub(msgCost(originalMessage.AsMessage()), originalMessage.Value)
+	attackerMsg := func(index int) (types.Message, *big.Int) {
+		toAddress := common.HexToAddress(addrs[index])
+		msgData, _ := hex.DecodeString(msgs[index][2:])
+		// the attacker message carries value if its function is payable
+		value := fuzz.PayableValue(addrs[index], rets[index], block, senderBalance(inputAlloc, attacker))
+		return types.NewMessage(
+			attacker,
+			&toAddress,
+			0,
+			value,
+			gas,
+			originalMessage.GasPrice,
+			originalMessage.GasFeeCap,
+			originalMessage.GasTipCap,
+			msgData,
+			originalMessage.AccessList,
+			false,
+		), value
+	}
+
+	for front := range msgs {
+		if budget.skipMsgs(len(msgs) - front) {
+			break
+		}
+		// the back-run message targets the contract of the front-run message
+		var candidates []int
+		for index := range msgs {
+			if addrs[index] == addrs[front] {
+				candidates = append(candidates, index)
+			}
+		}
+		back := candidates[int(rand.Uint64()/2)%len(candidates)]
+
+		frontMsg, frontValue := attackerMsg(front)
+		backMsg, backValue := attackerMsg(back)
+		fundedAlloc := inputAlloc.Copy()
+		funding := fundSenders(fundedAlloc, originalMessage.AsMessage(), frontMsg, backMsg)
+		if taskPool.FlashLoan {
+			funding = append(funding, flashLoan(fundedAlloc, *env, attacker, flashLoanTokens(fundedAlloc))...)
+		}
+
+		original := sequencedMsg{Label: "original", Env: *env, Msg: originalMessage.AsMessage()}
+		frontRun := sequencedMsg{Label: "front-run", Env: *env, Msg: frontMsg}
+		backRun := sequencedMsg{Label: "back-run", Env: *env, Msg: backMsg}
+
+		// (original, front-run, back-run)
+		aloneAlloc, oriOutcomes, err := replaySequence(block, tx, fundedAlloc,
+			[]sequencedMsg{original, frontRun, backRun}, taskPool.StrictOracle)
+		if err != nil {
+			return err
+		}
+		// (front-run, original, back-run)
+		sandwichAlloc, mutOutcomes, err := replaySequence(block, tx, fundedAlloc,
+			[]sequencedMsg{frontRun, original, backRun}, taskPool.StrictOracle)
+		if err != nil {
+			return err
+		}
+		// arguments reaching new branches or slots seed later messages
+		fuzz.RecordFeedback(addrs[front], rets[front], novelty(oriOutcomes["front-run"], mutOutcomes["front-run"]))
+		fuzz.RecordFeedback(addrs[back], rets[back], novelty(oriOutcomes["back-run"], mutOutcomes["back-run"]))
+
+		// the front-run message has to go through to affect the victim
+		if mutOutcomes["front-run"].Failed {
+			continue
+		}
+
+		outcome := newVictimOutcome(victim, attacker, aloneAlloc, sandwichAlloc)
+		divergence, equal := outcome.divergence(oriOutcomes["original"], mutOutcomes["original"], gasSlack, taskPool.StrictOracle)
+		if equal {
+			continue
+		}
+
+		// write bug information, one file per transaction and pair of
+		// attacker messages
+		addr := strings.ToLower(originalMessage.To.String())
+		bugFile := findingFile(taskPool.DappDir, addr, env.Number, tx,
+			append(common.CopyBytes(frontMsg.Data()), backMsg.Data()...), "sandwich")
+		bugDetails := &SIbug{
+			BugType:           "SANDWICH",
+			InputAlloc:        substate.InputAlloc,
+			OutputAlloc:       substate.OutputAlloc,
+			InputMessage:      *originalMessage,
+			AdditMessageFrom:  attacker.String(),
+			AdditMessageTo:    frontMsg.To().String(),
+			AdditMessageData:  rets[front],
+			AdditMessageValue: frontValue.String(),
+			BackMessageTo:     backMsg.To().String(),
+			BackMessageData:   rets[back],
+			BackMessageValue:  backValue.String(),
+			OriAlloc:          aloneAlloc,
+			MutAlloc:          sandwichAlloc,
+			Divergence:        "victim " + divergence,
+			OriOutcomes:       oriOutcomes,
+			MutOutcomes:       mutOutcomes,
+			Funding:           funding,
+			Role:              roleAttacker.String(),
+			Victim:            outcome,
+		}
+		data, err := json.MarshalIndent(bugDetails, "", " ")
+		checkError(err)
+		err = ioutil.WriteFile(bugFile, data, 0777)
+		checkError(err)
+		recordFinding("SANDWICH")
+		//writh to bug log file
+		log.SetOutput(bugLogFile)
+		log.SetPrefix("[SIBugLog]")
+		log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
+		log.Printf("victim %s differ under SANDWICH in \n%s\nin %d, attacker gain %s\n",
+			divergence, addr, block, outcome.AttackerGain.ToInt().String())
+	}
+
+	return nil
+}
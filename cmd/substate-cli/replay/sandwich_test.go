@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+func TestVictimOutcomeDivergence(t *testing.T) {
+	var (
+		victim   = common.BytesToAddress([]byte("victim"))
+		attacker = common.BytesToAddress([]byte("attacker"))
+		gasSlack = big.NewInt(10)
+	)
+	alloc := func(victimBalance, attackerBalance int64) research.SubstateAlloc {
+		return research.SubstateAlloc{
+			victim:   research.NewSubstateAccount(1, big.NewInt(victimBalance), nil),
+			attacker: research.NewSubstateAccount(1, big.NewInt(attackerBalance), nil),
+		}
+	}
+	succeeded := &msgOutcome{To: victim}
+	failed := &msgOutcome{To: victim, Failed: true}
+
+	tests := []struct {
+		name           string
+		alone          research.SubstateAlloc
+		sandwiched     research.SubstateAlloc
+		sandwichedMsg  *msgOutcome
+		wantDivergence string
+		wantGain       int64
+	}{
+		{name: "same balance", alone: alloc(100, 50), sandwiched: alloc(100, 50), sandwichedMsg: succeeded},
+		{name: "loss within gas slack", alone: alloc(100, 50), sandwiched: alloc(90, 50), sandwichedMsg: succeeded},
+		{name: "gain within gas slack", alone: alloc(100, 50), sandwiched: alloc(110, 50), sandwichedMsg: succeeded},
+		{name: "loss", alone: alloc(100, 50), sandwiched: alloc(89, 61), sandwichedMsg: succeeded, wantDivergence: "balance", wantGain: 11},
+		{name: "victim missing when sandwiched", alone: alloc(100, 50), sandwiched: research.SubstateAlloc{}, sandwichedMsg: succeeded, wantDivergence: "balance", wantGain: -50},
+		{name: "status", alone: alloc(100, 50), sandwiched: alloc(100, 50), sandwichedMsg: failed, wantDivergence: "status false/true"},
+	}
+	for _, tt := range tests {
+		outcome := newVictimOutcome(victim, attacker, tt.alone, tt.sandwiched)
+		divergence, equal := outcome.divergence(succeeded, tt.sandwichedMsg, gasSlack, true)
+		if equal != (tt.wantDivergence == "") || divergence != tt.wantDivergence {
+			t.Errorf("%s: divergence %q (equal %v), want %q", tt.name, divergence, equal, tt.wantDivergence)
+		}
+		if gain := outcome.AttackerGain.ToInt().Int64(); gain != tt.wantGain {
+			t.Errorf("%s: attacker gain %d, want %d", tt.name, gain, tt.wantGain)
+		}
+	}
+}
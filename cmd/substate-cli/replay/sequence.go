@@ -0,0 +1,53 @@
+package replay
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// sequencedMsg is a message replayed as part of a sequence, under its own env
+type sequencedMsg struct {
+	Label string
+	Env   research.SubstateEnv
+	Msg   types.Message
+}
+
+// replaySequence applies msgs in order on top of inputAlloc with
+// replayRegularMsgs. Each message takes the nonce of its sender at that point
+// of the sequence, so the same messages can be replayed in any order. It
+// returns the merged post-state and the outcome of each message by label.
+func replaySequence(block uint64, tx int, inputAlloc research.SubstateAlloc, msgs []sequencedMsg, strict bool) (research.SubstateAlloc, map[string]*msgOutcome, error) {
+	var (
+		alloc    = inputAlloc.Copy()
+		outcomes = make(map[string]*msgOutcome)
+	)
+	for i, seq := range msgs {
+		var (
+			nonce    uint64
+			outAlloc research.SubstateAlloc
+			err      error
+		)
+		if account, exist := alloc[seq.Msg.From()]; exist {
+			nonce = account.Nonce
+		}
+		msg := types.NewMessage(
+			seq.Msg.From(),
+			seq.Msg.To(),
+			nonce,
+			seq.Msg.Value(),
+			seq.Msg.Gas(),
+			seq.Msg.GasPrice(),
+			seq.Msg.GasFeeCap(),
+			seq.Msg.GasTipCap(),
+			seq.Msg.Data(),
+			seq.Msg.AccessList(),
+			seq.Msg.IsFake(),
+		)
+		if outAlloc, outcomes[seq.Label], err = replayRegularMsgs(block, tx+i, alloc, seq.Env, msg); err != nil {
+			return nil, nil, err
+		}
+		mergePostAlloc(&outAlloc, alloc, outcomes[seq.Label], strict)
+		alloc = outAlloc
+	}
+	return alloc, outcomes, nil
+}
@@ -0,0 +1,90 @@
+package replay
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+var (
+	testSender   = common.BytesToAddress([]byte("sender"))
+	testCounter  = common.BytesToAddress([]byte("counter"))
+	testReverter = common.BytesToAddress([]byte("reverter"))
+	testEnv      = research.SubstateEnv{
+		Coinbase:   common.BytesToAddress([]byte("coinbase")),
+		Difficulty: big.NewInt(1),
+		GasLimit:   10000000,
+		Number:     1,
+		Timestamp:  1,
+	}
+)
+
+// newTestAlloc returns a funded testSender, a testCounter contract
+// incrementing slot 0 on each call and a testReverter contract always
+// reverting
+func newTestAlloc() research.SubstateAlloc {
+	return research.SubstateAlloc{
+		testSender: research.NewSubstateAccount(5, big.NewInt(1000000000), nil),
+		// SSTORE(0, SLOAD(0) + 1)
+		testCounter: research.NewSubstateAccount(1, new(big.Int), common.FromHex("0x600054600101600055")),
+		// REVERT(0, 0)
+		testReverter: research.NewSubstateAccount(1, new(big.Int), common.FromHex("0x600080fd")),
+	}
+}
+
+// newTestMsg returns a message from from to to; its nonce is set by
+// replaySequence
+func newTestMsg(from common.Address, to common.Address) types.Message {
+	return types.NewMessage(from, &to, 0, new(big.Int), 100000, big.NewInt(1), big.NewInt(1), big.NewInt(1), nil, nil, false)
+}
+
+func TestReplaySequence(t *testing.T) {
+	tests := []struct {
+		name        string
+		to          []common.Address
+		wantCounter int64
+		wantFailed  []bool
+	}{
+		{"single", []common.Address{testCounter}, 1, []bool{false}},
+		{"two messages", []common.Address{testCounter, testCounter}, 2, []bool{false, false}},
+		{"reverting first", []common.Address{testReverter, testCounter}, 1, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		var msgs []sequencedMsg
+		labels := []string{"first", "second"}
+		for i, to := range tt.to {
+			msgs = append(msgs, sequencedMsg{Label: labels[i], Env: testEnv, Msg: newTestMsg(testSender, to)})
+		}
+		inputAlloc := newTestAlloc()
+		alloc, outcomes, err := replaySequence(1, 0, inputAlloc, msgs, true)
+		if err != nil {
+			t.Errorf("%s: replaySequence error %v", tt.name, err)
+			continue
+		}
+		if len(outcomes) != len(msgs) {
+			t.Errorf("%s: %d outcomes, want %d", tt.name, len(outcomes), len(msgs))
+		}
+		for i, want := range tt.wantFailed {
+			if outcome := outcomes[labels[i]]; outcome == nil || outcome.Failed != want {
+				t.Errorf("%s: %s message outcome %+v, want failed %v", tt.name, labels[i], outcome, want)
+			}
+		}
+		// each message takes the nonce of the sender after the previous one
+		if nonce := alloc[testSender].Nonce; nonce != 5+uint64(len(msgs)) {
+			t.Errorf("%s: sender nonce %d, want %d", tt.name, nonce, 5+len(msgs))
+		}
+		if got := alloc[testCounter].Storage[common.Hash{}].Big().Int64(); got != tt.wantCounter {
+			t.Errorf("%s: counter %d, want %d", tt.name, got, tt.wantCounter)
+		}
+		// untouched accounts are merged from the input
+		if _, exist := alloc[testReverter]; !exist {
+			t.Errorf("%s: untouched account missing from the post-state", tt.name)
+		}
+		if !inputAlloc.Equal(newTestAlloc()) {
+			t.Errorf("%s: input alloc modified", tt.name)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package replay
+
+import (
+	"strings"
+
+	fuzz "github.com/ethereum/go-ethereum/cmd/substate-cli/fuzz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/research"
+)
+
+// DOMAIN_SEPARATOR() of EIP-712 contracts
+var domainSeparatorSelector = common.FromHex("0x3644e515")
+
+// registerDomainSeparators reads the EIP-712 domain separator of the inner
+// contracts of substate, so the fuzzer can sign typed data for them
+func registerDomainSeparators(substate *research.Substate) {
+	probe := NewStorageProbe(substate.Env)
+	for addr, account := range substate.InputAlloc {
+		if len(account.Code) == 0 || !isInnerContract(addr) {
+			continue
+		}
+		ret, _, err := probe(substate.InputAlloc, addr, domainSeparatorSelector)
+		if err != nil || len(ret) != 32 || common.BytesToHash(ret) == (common.Hash{}) {
+			continue
+		}
+		fuzz.SetDomainSeparator(strings.ToLower(addr.String()), common.BytesToHash(ret))
+	}
+}
@@ -109,6 +109,9 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
 
+	// record-replay: all substates of the block are saved
+	research.RecordBlock(p.config, block.NumberU64())
+
 	return receipts, allLogs, *usedGas, nil
 }
 
@@ -17,7 +17,6 @@
 package vm
 
 import (
-	"encoding/hex"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -694,68 +693,19 @@ func opCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byt
 		bigVal = value.ToBig()
 	}
 
-	ret, returnGas, err := interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal)
-
-	if err != nil {
-		temp.Clear()
+	var (
+		ret       []byte
+		returnGas uint64
+		err       error
+	)
+	if interpreter.cfg.CallInterceptor != nil && !interpreter.intercepting {
+		frame := &CallFrame{Op: CALL, Caller: scope.Contract.Address(), Callee: toAddr, Depth: interpreter.evm.depth, PC: *pc, Input: args, Value: bigVal, Gas: gas}
+		ret, returnGas, err = interpreter.interceptCall(frame, func() ([]byte, uint64, error) {
+			return interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal)
+		})
 	} else {
-		temp.SetOne()
-	}
-	stack.push(&temp)
-	if err == nil || err == ErrExecutionReverted {
-		ret = common.CopyBytes(ret)
-		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	}
-	scope.Contract.Gas += returnGas
-
-	interpreter.returnData = ret
-	return ret, nil
-}
-
-func opCallInHook(interpreter *EVMInterpreter, scope *ScopeContext, vimAddr string, msgData string) ([]byte, error) {
-	// Pop gas. The actual gas in interpreter.evm.callGasTemp.
-	// We can use this as a temporary value
-	gas := interpreter.evm.callGasTemp
-	toAddr := common.HexToAddress(vimAddr)
-	var bigVal = big0
-
-	input, err := hex.DecodeString(msgData)
-	ret, returnGas, err := interpreter.evm.Call(scope.Contract, toAddr, input, gas, bigVal)
-
-	if err == nil || err == ErrExecutionReverted {
-		ret = common.CopyBytes(ret)
+		ret, returnGas, err = interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal)
 	}
-	scope.Contract.Gas += returnGas
-
-	interpreter.returnData = ret
-	return ret, nil
-}
-
-func opCallWithHook(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext, dappInner []string, vimAddr string, msgData string) ([]byte, error, bool) {
-	stack := scope.Stack
-	// Pop gas. The actual gas in interpreter.evm.callGasTemp.
-	// We can use this as a temporary value
-	temp := stack.pop()
-	gas := interpreter.evm.callGasTemp
-	// Pop other call parameters.
-	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	toAddr := common.Address(addr.Bytes20())
-	// Get the arguments from the memory.
-	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	if interpreter.readOnly && !value.IsZero() {
-		return nil, ErrWriteProtection, false
-	}
-	var bigVal = big0
-	//TODO: use uint256.Int instead of converting with toBig()
-	// By using big0 here, we save an alloc for the most common case (non-ether-transferring contract calls),
-	// but it would make more sense to extend the usage of uint256.Int
-	if !value.IsZero() {
-		gas += params.CallStipend
-		bigVal = value.ToBig()
-	}
-
-	ret, returnGas, err, isHook := interpreter.evm.CallWithHook(scope.Contract, toAddr, args, gas, bigVal, dappInner, vimAddr, msgData)
 
 	if err != nil {
 		temp.Clear()
@@ -770,7 +720,7 @@ func opCallWithHook(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 	scope.Contract.Gas += returnGas
 
 	interpreter.returnData = ret
-	return ret, nil, isHook
+	return ret, nil
 }
 
 func opCallCode(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
@@ -792,43 +742,19 @@ func opCallCode(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([
 		bigVal = value.ToBig()
 	}
 
-	ret, returnGas, err := interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
-	if err != nil {
-		temp.Clear()
+	var (
+		ret       []byte
+		returnGas uint64
+		err       error
+	)
+	if interpreter.cfg.CallInterceptor != nil && !interpreter.intercepting {
+		frame := &CallFrame{Op: CALLCODE, Caller: scope.Contract.Address(), Callee: toAddr, Depth: interpreter.evm.depth, PC: *pc, Input: args, Value: bigVal, Gas: gas}
+		ret, returnGas, err = interpreter.interceptCall(frame, func() ([]byte, uint64, error) {
+			return interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
+		})
 	} else {
-		temp.SetOne()
-	}
-	stack.push(&temp)
-	if err == nil || err == ErrExecutionReverted {
-		ret = common.CopyBytes(ret)
-		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
-	}
-	scope.Contract.Gas += returnGas
-
-	interpreter.returnData = ret
-	return ret, nil
-}
-
-func opCallCodeWithHook(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext, dappInner []string, vimAddr string, msgData string) ([]byte, error, bool) {
-	// Pop gas. The actual gas is in interpreter.evm.callGasTemp.
-	stack := scope.Stack
-	// We use it as a temporary value
-	temp := stack.pop()
-	gas := interpreter.evm.callGasTemp
-	// Pop other call parameters.
-	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	toAddr := common.Address(addr.Bytes20())
-	// Get arguments from the memory.
-	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	//TODO: use uint256.Int instead of converting with toBig()
-	var bigVal = big0
-	if !value.IsZero() {
-		gas += params.CallStipend
-		bigVal = value.ToBig()
+		ret, returnGas, err = interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
 	}
-
-	ret, returnGas, err, isHook := interpreter.evm.CallCodeWithHook(scope.Contract, toAddr, args, gas, bigVal, dappInner, vimAddr, msgData)
 	if err != nil {
 		temp.Clear()
 	} else {
@@ -842,7 +768,7 @@ func opCallCodeWithHook(pc *uint64, interpreter *EVMInterpreter, scope *ScopeCon
 	scope.Contract.Gas += returnGas
 
 	interpreter.returnData = ret
-	return ret, nil, isHook
+	return ret, nil
 }
 
 func opDelegateCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
@@ -857,36 +783,19 @@ func opDelegateCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 	// Get arguments from the memory.
 	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
 
-	ret, returnGas, err := interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
-	if err != nil {
-		temp.Clear()
+	var (
+		ret       []byte
+		returnGas uint64
+		err       error
+	)
+	if interpreter.cfg.CallInterceptor != nil && !interpreter.intercepting {
+		frame := &CallFrame{Op: DELEGATECALL, Caller: scope.Contract.Address(), Callee: toAddr, Depth: interpreter.evm.depth, PC: *pc, Input: args, Gas: gas}
+		ret, returnGas, err = interpreter.interceptCall(frame, func() ([]byte, uint64, error) {
+			return interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
+		})
 	} else {
-		temp.SetOne()
-	}
-	stack.push(&temp)
-	if err == nil || err == ErrExecutionReverted {
-		ret = common.CopyBytes(ret)
-		scope.Memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+		ret, returnGas, err = interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
 	}
-	scope.Contract.Gas += returnGas
-
-	interpreter.returnData = ret
-	return ret, nil
-}
-
-func opDelegateCallWithHook(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext, dappInner []string, vimAddr string, msgData string) ([]byte, error, bool) {
-	stack := scope.Stack
-	// Pop gas. The actual gas is in interpreter.evm.callGasTemp.
-	// We use it as a temporary value
-	temp := stack.pop()
-	gas := interpreter.evm.callGasTemp
-	// Pop other call parameters.
-	addr, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	toAddr := common.Address(addr.Bytes20())
-	// Get arguments from the memory.
-	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
-
-	ret, returnGas, err, isHook := interpreter.evm.DelegateCallWithHook(scope.Contract, toAddr, args, gas, dappInner, vimAddr, msgData)
 	if err != nil {
 		temp.Clear()
 	} else {
@@ -900,7 +809,7 @@ func opDelegateCallWithHook(pc *uint64, interpreter *EVMInterpreter, scope *Scop
 	scope.Contract.Gas += returnGas
 
 	interpreter.returnData = ret
-	return ret, nil, isHook
+	return ret, nil
 }
 
 func opStaticCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
@@ -915,7 +824,19 @@ func opStaticCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext)
 	// Get arguments from the memory.
 	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
 
-	ret, returnGas, err := interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
+	var (
+		ret       []byte
+		returnGas uint64
+		err       error
+	)
+	if interpreter.cfg.CallInterceptor != nil && !interpreter.intercepting {
+		frame := &CallFrame{Op: STATICCALL, Caller: scope.Contract.Address(), Callee: toAddr, Depth: interpreter.evm.depth, PC: *pc, Input: args, Gas: gas}
+		ret, returnGas, err = interpreter.interceptCall(frame, func() ([]byte, uint64, error) {
+			return interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
+		})
+	} else {
+		ret, returnGas, err = interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
+	}
 	if err != nil {
 		temp.Clear()
 	} else {
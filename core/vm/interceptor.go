@@ -0,0 +1,125 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CallInterceptor is consulted by the interpreter on every CALL, CALLCODE,
+// DELEGATECALL and STATICCALL opcode. It may inject messages before, instead
+// of, or after the intercepted call.
+type CallInterceptor interface {
+	// InterceptCall is invoked before the call frame is entered. A nil
+	// injection leaves the call untouched.
+	InterceptCall(frame *CallFrame) *CallInjection
+}
+
+// CallFrame describes a call about to be made by a CALL-family opcode.
+type CallFrame struct {
+	Op     OpCode         // CALL, CALLCODE, DELEGATECALL or STATICCALL
+	Caller common.Address // address of the executing contract
+	Callee common.Address // address whose code is called
+	Depth  int            // depth of the calling frame
+	PC     uint64         // program counter of the opcode in the caller
+	Input  []byte         // call data, must not be modified
+	Value  *big.Int       // transferred value (nil for DELEGATECALL and STATICCALL)
+	Gas    uint64         // gas forwarded to the call
+}
+
+// InjectedCall is a message executed on behalf of a CallInterceptor. The
+// result fields are filled in once the message has been executed.
+type InjectedCall struct {
+	From   common.Address // sender, defaults to the callee of the frame
+	To     common.Address
+	Input  []byte
+	Value  *big.Int // nil means no value
+	Gas    uint64   // zero means the gas forwarded to the intercepted call
+	Static bool     // execute as STATICCALL
+
+	Executed bool
+	Ret      []byte
+	Err      error
+}
+
+// CallInjection tells the interpreter which messages to execute around an
+// intercepted call.
+//
+// Injected messages are not charged to the calling contract, so the gas
+// accounting of the original execution is preserved. If Instead is non-nil
+// the intercepted call is not executed; the outcome of the last message in
+// Instead is returned to the caller, and an empty Instead drops the call as
+// if it had succeeded without return data.
+type CallInjection struct {
+	Before  []*InjectedCall
+	Instead []*InjectedCall
+	After   []*InjectedCall
+}
+
+// interceptCall consults the configured CallInterceptor about a call and
+// executes the call surrounded by the injected messages. Interception is
+// suspended while the injected messages run.
+func (in *EVMInterpreter) interceptCall(frame *CallFrame, call func() ([]byte, uint64, error)) (ret []byte, leftOverGas uint64, err error) {
+	injection := in.cfg.CallInterceptor.InterceptCall(frame)
+	if injection == nil {
+		return call()
+	}
+	in.runInjected(frame, injection.Before)
+	if injection.Instead != nil {
+		in.runInjected(frame, injection.Instead)
+		ret, leftOverGas = nil, frame.Gas
+		if n := len(injection.Instead); n > 0 {
+			ret, err = injection.Instead[n-1].Ret, injection.Instead[n-1].Err
+		}
+	} else {
+		ret, leftOverGas, err = call()
+	}
+	in.runInjected(frame, injection.After)
+	return ret, leftOverGas, err
+}
+
+func (in *EVMInterpreter) runInjected(frame *CallFrame, calls []*InjectedCall) {
+	if len(calls) == 0 {
+		return
+	}
+	in.intercepting = true
+	defer func() { in.intercepting = false }()
+
+	for _, call := range calls {
+		from := call.From
+		if from == (common.Address{}) {
+			from = frame.Callee
+		}
+		gas := call.Gas
+		if gas == 0 {
+			gas = frame.Gas
+		}
+		if call.Static {
+			call.Ret, _, call.Err = in.evm.StaticCall(AccountRef(from), call.To, call.Input, gas)
+		} else {
+			value := call.Value
+			if value == nil {
+				value = big0
+			}
+			call.Ret, _, call.Err = in.evm.Call(AccountRef(from), call.To, call.Input, gas, value)
+		}
+		call.Ret = common.CopyBytes(call.Ret)
+		call.Executed = true
+	}
+}
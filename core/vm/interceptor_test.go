@@ -0,0 +1,147 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+type testInterceptor struct {
+	frames    []CallFrame
+	injection func(frame *CallFrame) *CallInjection
+}
+
+func (t *testInterceptor) InterceptCall(frame *CallFrame) *CallInjection {
+	t.frames = append(t.frames, *frame)
+	return t.injection(frame)
+}
+
+func TestCallInterceptor(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		callee = common.BytesToAddress([]byte("callee"))
+		victim = common.BytesToAddress([]byte("victim"))
+		slot   = common.Hash{}
+	)
+	// caller: call(gas, callee, 0, 0, 0, 0, 0) stop
+	callerCode := append(common.Hex2Bytes("60006000600060006000"+"73"), callee.Bytes()...)
+	callerCode = append(callerCode, byte(GAS), byte(CALL), byte(STOP))
+	// callee: sstore(0, 1) stop
+	calleeCode := common.Hex2Bytes("600160005500")
+	// victim: sstore(0, add(sload(0), 1)) stop
+	victimCode := common.Hex2Bytes("600054600101600055" + "00")
+
+	tests := []struct {
+		name        string
+		injection   func(frame *CallFrame) *CallInjection
+		calleeSlot  common.Hash
+		victimSlot  common.Hash
+		numExecuted int
+	}{
+		{
+			name:       "none",
+			injection:  func(*CallFrame) *CallInjection { return nil },
+			calleeSlot: common.BigToHash(big.NewInt(1)),
+		},
+		{
+			name: "before and after",
+			injection: func(*CallFrame) *CallInjection {
+				return &CallInjection{
+					Before: []*InjectedCall{{To: victim}},
+					After:  []*InjectedCall{{To: victim}, {To: victim}},
+				}
+			},
+			calleeSlot:  common.BigToHash(big.NewInt(1)),
+			victimSlot:  common.BigToHash(big.NewInt(3)),
+			numExecuted: 3,
+		},
+		{
+			name: "instead",
+			injection: func(*CallFrame) *CallInjection {
+				return &CallInjection{Instead: []*InjectedCall{{To: victim}}}
+			},
+			victimSlot:  common.BigToHash(big.NewInt(1)),
+			numExecuted: 1,
+		},
+		{
+			name: "static",
+			injection: func(*CallFrame) *CallInjection {
+				return &CallInjection{After: []*InjectedCall{{To: victim, Static: true}}}
+			},
+			// the victim write is rejected in a static context
+			calleeSlot: common.BigToHash(big.NewInt(1)),
+		},
+	}
+	for _, tt := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.SetCode(caller, callerCode)
+		statedb.SetCode(callee, calleeCode)
+		statedb.SetCode(victim, victimCode)
+		statedb.Finalise(true)
+
+		var injected []*InjectedCall
+		interceptor := &testInterceptor{injection: func(frame *CallFrame) *CallInjection {
+			injection := tt.injection(frame)
+			if injection != nil {
+				injected = append(append(append(injected, injection.Before...), injection.Instead...), injection.After...)
+			}
+			return injection
+		}}
+		vmctx := BlockContext{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: new(big.Int),
+		}
+		evm := NewEVM(vmctx, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{CallInterceptor: interceptor})
+		if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 10000000, new(big.Int)); err != nil {
+			t.Fatalf("%s: call failed: %v", tt.name, err)
+		}
+
+		// injected messages must not be intercepted themselves
+		if len(interceptor.frames) != 1 {
+			t.Fatalf("%s: have %d intercepted frames, want 1", tt.name, len(interceptor.frames))
+		}
+		frame := interceptor.frames[0]
+		if frame.Op != CALL || frame.Caller != caller || frame.Callee != callee || frame.Depth != 1 || frame.PC != 32 {
+			t.Errorf("%s: unexpected frame %+v", tt.name, frame)
+		}
+		numExecuted := 0
+		for _, call := range injected {
+			if !call.Executed {
+				t.Errorf("%s: injected call not executed", tt.name)
+			}
+			if call.Err == nil {
+				numExecuted++
+			}
+		}
+		if numExecuted != tt.numExecuted {
+			t.Errorf("%s: have %d successful injected calls, want %d", tt.name, numExecuted, tt.numExecuted)
+		}
+		if have := statedb.GetState(callee, slot); have != tt.calleeSlot {
+			t.Errorf("%s: callee slot: have %x, want %x", tt.name, have, tt.calleeSlot)
+		}
+		if have := statedb.GetState(victim, slot); have != tt.victimSlot {
+			t.Errorf("%s: victim slot: have %x, want %x", tt.name, have, tt.victimSlot)
+		}
+	}
+}
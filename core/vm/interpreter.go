@@ -34,6 +34,8 @@ type Config struct {
 	JumpTable *JumpTable // EVM instruction table, automatically populated if unset
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	CallInterceptor CallInterceptor // Injects messages around CALL-family opcodes
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
@@ -60,8 +62,9 @@ type EVMInterpreter struct {
 	hasher    keccakState // Keccak256 hasher instance shared across opcodes
 	hasherBuf common.Hash // Keccak256 hasher result array shared aross opcodes
 
-	readOnly   bool   // Whether to throw on stateful modifications
-	returnData []byte // Last CALL's return data for subsequent reuse
+	readOnly     bool   // Whether to throw on stateful modifications
+	returnData   []byte // Last CALL's return data for subsequent reuse
+	intercepting bool   // Whether injected messages are being executed
 }
 
 // NewEVMInterpreter returns a new instance of the Interpreter.
@@ -243,324 +246,3 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 
 	return res, err
 }
-
-func (in *EVMInterpreter) RunInHook(contract *Contract, input []byte, readOnly bool, vimAddr string, msgData string) (ret []byte, err error) {
-
-	// Increment the call depth which is restricted to 1024
-	in.evm.depth++
-	defer func() { in.evm.depth-- }()
-
-	// Make sure the readOnly is only set if we aren't in readOnly yet.
-	// This also makes sure that the readOnly flag isn't removed for child calls.
-	if readOnly && !in.readOnly {
-		in.readOnly = true
-		defer func() { in.readOnly = false }()
-	}
-
-	// Reset the previous call's return data. It's unimportant to preserve the old buffer
-	// as every returning call will return new data anyway.
-	in.returnData = nil
-
-	// Don't bother with the execution if there's no code.
-	if len(contract.Code) == 0 {
-		// reenter inner contract in outer contract
-		// return nil, nil
-		// mem := NewMemory()  // bound memory
-		// stack := newstack() // local stack
-		// callContext := &ScopeContext{
-		// 	Memory:   mem,
-		// 	Stack:    stack,
-		// 	Contract: contract,
-		// }
-		// defer func() {
-		// 	returnStack(stack)
-		// }()
-		// contract.Input = input
-		// // reenter inner contract in outer contract
-		// var temp = new(uint256.Int)
-		// res, returnGas, err := in.evm.Call(callContext.Contract, common.HexToAddress(vimAddr), []byte(msgData), contract.Gas, big0)
-		// if err != nil {
-		// 	stack.push(temp.Clear())
-		// } else {
-		// 	stack.push(temp.SetOne())
-		// }
-		// if err == nil || err == ErrExecutionReverted {
-		// 	res = common.CopyBytes(res)
-		// 	// callContext.Memory.Set()
-		// }
-		// callContext.Contract.Gas += returnGas
-		// in.returnData = res
-		// return res, err
-	}
-
-	var (
-		op          OpCode        // current opcode
-		mem         = NewMemory() // bound memory
-		stack       = newstack()  // local stack
-		callContext = &ScopeContext{
-			Memory:   mem,
-			Stack:    stack,
-			Contract: contract,
-		}
-		// For optimisation reason we're using uint64 as the program counter.
-		// It's theoretically possible to go above 2^64. The YP defines the PC
-		// to be uint256. Practically much less so feasible.
-		pc   = uint64(0) // program counter
-		cost uint64
-		// copies used by tracer
-		pcCopy  uint64 // needed for the deferred EVMLogger
-		gasCopy uint64 // for EVMLogger to log gas remaining before execution
-		logged  bool   // deferred EVMLogger should ignore already logged steps
-		res     []byte // result of the opcode execution function
-	)
-	// Don't move this deferrred function, it's placed before the capturestate-deferred method,
-	// so that it get's executed _after_: the capturestate needs the stacks before
-	// they are returned to the pools
-	defer func() {
-		returnStack(stack)
-	}()
-	contract.Input = input
-
-	if in.cfg.Debug {
-		defer func() {
-			if err != nil {
-				if !logged {
-					in.cfg.Tracer.CaptureState(pcCopy, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-				} else {
-					in.cfg.Tracer.CaptureFault(pcCopy, op, gasCopy, cost, callContext, in.evm.depth, err)
-				}
-			}
-		}()
-	}
-	// The Interpreter main run loop (contextual). This loop runs until either an
-	// explicit STOP, RETURN or SELFDESTRUCT is executed, an error occurred during
-	// the execution of one of the operations or until the done flag is set by the
-	// parent context.
-	for {
-		if len(contract.Code) == 0 {
-			break
-		}
-		if in.cfg.Debug {
-			// Capture pre-execution values for tracing.
-			logged, pcCopy, gasCopy = false, pc, contract.Gas
-		}
-		// Get the operation from the jump table and validate the stack to ensure there are
-		// enough stack items available to perform the operation.
-		op = contract.GetOp(pc)
-		operation := in.cfg.JumpTable[op]
-		cost = operation.constantGas // For tracing
-		// Validate stack
-		if sLen := stack.len(); sLen < operation.minStack {
-			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
-		} else if sLen > operation.maxStack {
-			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
-		}
-		if !contract.UseGas(cost) {
-			return nil, ErrOutOfGas
-		}
-		if operation.dynamicGas != nil {
-			// All ops with a dynamic memory usage also has a dynamic gas cost.
-			var memorySize uint64
-			// calculate the new memory size and expand the memory to fit
-			// the operation
-			// Memory check needs to be done prior to evaluating the dynamic gas portion,
-			// to detect calculation overflows
-			if operation.memorySize != nil {
-				memSize, overflow := operation.memorySize(stack)
-				if overflow {
-					return nil, ErrGasUintOverflow
-				}
-				// memory is expanded in words of 32 bytes. Gas
-				// is also calculated in words.
-				if memorySize, overflow = math.SafeMul(toWordSize(memSize), 32); overflow {
-					return nil, ErrGasUintOverflow
-				}
-			}
-			// Consume the gas and return an error if not enough gas is available.
-			// cost is explicitly set so that the capture state defer method can get the proper cost
-			var dynamicCost uint64
-			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
-			cost += dynamicCost // for tracing
-			if err != nil || !contract.UseGas(dynamicCost) {
-				return nil, ErrOutOfGas
-			}
-			if memorySize > 0 {
-				mem.Resize(memorySize)
-			}
-		}
-		if in.cfg.Debug {
-			in.cfg.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-			logged = true
-		}
-		// execute the operation
-		res, err = operation.execute(&pc, in, callContext)
-		if err != nil {
-			break
-		}
-		pc++
-	}
-
-	if err == errStopToken {
-		err = nil // clear stop token error
-	}
-
-	// reenter inner contract in outer contract
-	res, err = opCallInHook(in, callContext, vimAddr, msgData)
-
-	return res, err
-}
-
-func (in *EVMInterpreter) RunWithHook(contract *Contract, input []byte, readOnly bool, dappInner []string, vimAddr string, msgData string) (ret []byte, err error, isHook bool) {
-	isHook = false
-
-	// Increment the call depth which is restricted to 1024
-	in.evm.depth++
-	defer func() { in.evm.depth-- }()
-
-	// Make sure the readOnly is only set if we aren't in readOnly yet.
-	// This also makes sure that the readOnly flag isn't removed for child calls.
-	if readOnly && !in.readOnly {
-		in.readOnly = true
-		defer func() { in.readOnly = false }()
-	}
-
-	// Reset the previous call's return data. It's unimportant to preserve the old buffer
-	// as every returning call will return new data anyway.
-	in.returnData = nil
-
-	// Don't bother with the execution if there's no code.
-	if len(contract.Code) == 0 {
-		return nil, nil, isHook
-	}
-
-	var (
-		op          OpCode        // current opcode
-		mem         = NewMemory() // bound memory
-		stack       = newstack()  // local stack
-		callContext = &ScopeContext{
-			Memory:   mem,
-			Stack:    stack,
-			Contract: contract,
-		}
-		// For optimisation reason we're using uint64 as the program counter.
-		// It's theoretically possible to go above 2^64. The YP defines the PC
-		// to be uint256. Practically much less so feasible.
-		pc   = uint64(0) // program counter
-		cost uint64
-		// copies used by tracer
-		pcCopy  uint64 // needed for the deferred EVMLogger
-		gasCopy uint64 // for EVMLogger to log gas remaining before execution
-		logged  bool   // deferred EVMLogger should ignore already logged steps
-		res     []byte // result of the opcode execution function
-	)
-	// Don't move this deferrred function, it's placed before the capturestate-deferred method,
-	// so that it get's executed _after_: the capturestate needs the stacks before
-	// they are returned to the pools
-	defer func() {
-		returnStack(stack)
-	}()
-	contract.Input = input
-
-	if in.cfg.Debug {
-		defer func() {
-			if err != nil {
-				if !logged {
-					in.cfg.Tracer.CaptureState(pcCopy, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-				} else {
-					in.cfg.Tracer.CaptureFault(pcCopy, op, gasCopy, cost, callContext, in.evm.depth, err)
-				}
-			}
-		}()
-	}
-	// The Interpreter main run loop (contextual). This loop runs until either an
-	// explicit STOP, RETURN or SELFDESTRUCT is executed, an error occurred during
-	// the execution of one of the operations or until the done flag is set by the
-	// parent context.
-	for {
-		if in.cfg.Debug {
-			// Capture pre-execution values for tracing.
-			logged, pcCopy, gasCopy = false, pc, contract.Gas
-		}
-		// Get the operation from the jump table and validate the stack to ensure there are
-		// enough stack items available to perform the operation.
-		op = contract.GetOp(pc)
-		operation := in.cfg.JumpTable[op]
-		cost = operation.constantGas // For tracing
-		// Validate stack
-		if sLen := stack.len(); sLen < operation.minStack {
-			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}, isHook
-		} else if sLen > operation.maxStack {
-			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}, isHook
-		}
-		if !contract.UseGas(cost) {
-			return nil, ErrOutOfGas, isHook
-		}
-		if operation.dynamicGas != nil {
-			// All ops with a dynamic memory usage also has a dynamic gas cost.
-			var memorySize uint64
-			// calculate the new memory size and expand the memory to fit
-			// the operation
-			// Memory check needs to be done prior to evaluating the dynamic gas portion,
-			// to detect calculation overflows
-			if operation.memorySize != nil {
-				memSize, overflow := operation.memorySize(stack)
-				if overflow {
-					return nil, ErrGasUintOverflow, isHook
-				}
-				// memory is expanded in words of 32 bytes. Gas
-				// is also calculated in words.
-				if memorySize, overflow = math.SafeMul(toWordSize(memSize), 32); overflow {
-					return nil, ErrGasUintOverflow, isHook
-				}
-			}
-			// Consume the gas and return an error if not enough gas is available.
-			// cost is explicitly set so that the capture state defer method can get the proper cost
-			var dynamicCost uint64
-			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
-			cost += dynamicCost // for tracing
-			if err != nil || !contract.UseGas(dynamicCost) {
-				return nil, ErrOutOfGas, isHook
-			}
-			if memorySize > 0 {
-				mem.Resize(memorySize)
-			}
-		}
-		if in.cfg.Debug {
-			in.cfg.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-			logged = true
-		}
-		// execute the operation
-		switch op.String() {
-		case "CALL":
-			if isHook == true {
-				res, err, _ = opCallWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			} else {
-				res, err, isHook = opCallWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			}
-		case "CALLCODE":
-			if isHook == true {
-				res, err, _ = opCallCodeWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			} else {
-				res, err, isHook = opCallCodeWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			}
-		case "DELEGATECALL":
-			if isHook == true {
-				res, err, _ = opDelegateCallWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			} else {
-				res, err, isHook = opDelegateCallWithHook(&pc, in, callContext, dappInner, vimAddr, msgData)
-			}
-		default:
-			res, err = operation.execute(&pc, in, callContext)
-		}
-		if err != nil {
-			break
-		}
-		pc++
-	}
-
-	if err == errStopToken {
-		err = nil // clear stop token error
-	}
-
-	return res, err, isHook
-}
@@ -2,43 +2,94 @@ package research
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
 	"gopkg.in/urfave/cli.v1"
 )
 
 var (
 	SubstateDirFlag = cli.StringFlag{
 		Name:  "substateDir",
-		Usage: "Data directory for substate recorder/replayer",
+		Usage: "Data directory for substate recorder/replayer: a LevelDB directory, leveldb://<dir>, memory://<file> of substates exported by substate-cli db export, or read-only shards://<dir>,<dir>...",
 		Value: "substate.ethereum",
 	}
+	SubstateEncodingFlag = cli.StringFlag{
+		Name:  "substate-encoding",
+		Usage: "Encoding of the recorded substates: london, or compact to deduplicate account states",
+		Value: LondonSubstateEncoding,
+	}
+	SubstateCacheFlag = cli.IntFlag{
+		Name:  "substate-cache",
+		Usage: "Megabytes of memory allocated to the LevelDB cache of the substate DB",
+		Value: 1024,
+	}
+	SubstateHandlesFlag = cli.IntFlag{
+		Name:  "substate-handles",
+		Usage: "Number of file handles of the substate DB",
+		Value: 100,
+	}
+	BlockCacheFlag = cli.IntFlag{
+		Name:  "block-cache",
+		Usage: "Number of blocks whose decoded substates are kept in memory, shared by all workers (0 to disable)",
+		Value: 128,
+	}
 	substateDir      = SubstateDirFlag.Value
+	substateEncoding = SubstateEncodingFlag.Value
+	substateCache    = SubstateCacheFlag.Value
+	substateHandles  = SubstateHandlesFlag.Value
+	blockCacheSize   = BlockCacheFlag.Value
 	staticSubstateDB *SubstateDB
+
+	// metadata of staticSubstateDB, updated by RecordBlock
+	staticMetadata     *SubstateMetadata
+	staticMetadataLock sync.Mutex
+	pendingBlocks      int // blocks recorded since the metadata was last put
 )
 
+// number of recorded blocks after which the metadata is put into the DB
+const metadataFlushBlocks = 1000
+
 func OpenSubstateDB() {
 	fmt.Println("record-replay: OpenSubstateDB")
-	backend, err := rawdb.NewLevelDBDatabase(substateDir, 1024, 100, "substatedir", false)
+	backend, err := OpenBackend(substateDir, false)
 	if err != nil {
 		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
 	}
 	staticSubstateDB = NewSubstateDB(backend)
+	if err = staticSubstateDB.SetEncoding(substateEncoding); err != nil {
+		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
+	}
+	staticMetadata, err = staticSubstateDB.GetMetadata()
+	if err != nil {
+		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
+	}
+	if staticMetadata == nil {
+		staticMetadata = NewSubstateMetadata("geth import")
+	}
 }
 
 func OpenSubstateDBReadOnly() {
 	fmt.Println("record-replay: OpenSubstateDB")
-	backend, err := rawdb.NewLevelDBDatabase(substateDir, 1024, 100, "substatedir", true)
+	backend, err := OpenBackend(substateDir, true)
 	if err != nil {
 		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
 	}
 	staticSubstateDB = NewSubstateDB(backend)
+	if _, err = staticSubstateDB.GetMetadata(); err != nil {
+		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
+	}
+	if err = staticSubstateDB.SetBlockCache(blockCacheSize); err != nil {
+		panic(fmt.Errorf("error opening substate leveldb %s: %v", substateDir, err))
+	}
 }
 
 func CloseSubstateDB() {
 	defer fmt.Println("record-replay: CloseSubstateDB")
 
+	flushMetadata()
 	err := staticSubstateDB.Close()
 	if err != nil {
 		panic(fmt.Errorf("error closing substate leveldb %s: %v", substateDir, err))
@@ -55,6 +106,49 @@ func CompactSubstateDB() {
 	}
 }
 
+// RecordBlock marks a block as recorded in the metadata of the substate DB,
+// once all its substates were put
+func RecordBlock(config *params.ChainConfig, block uint64) {
+	staticMetadataLock.Lock()
+	defer staticMetadataLock.Unlock()
+	if staticSubstateDB == nil || staticMetadata == nil {
+		return
+	}
+
+	if staticMetadata.ChainID == nil {
+		staticMetadata.ChainID = config.ChainID
+		staticMetadata.ChainConfig = config
+	} else if config.ChainID != nil && staticMetadata.ChainID.Cmp(config.ChainID) != 0 {
+		panic(fmt.Errorf("record-replay: recording chain ID %v into substate DB of chain ID %v", config.ChainID, staticMetadata.ChainID))
+	}
+	staticMetadata.Ranges = staticMetadata.Ranges.Add(BlockRange{First: block, Last: block})
+	pendingBlocks++
+	if pendingBlocks >= metadataFlushBlocks {
+		putMetadata()
+	}
+}
+
+func flushMetadata() {
+	staticMetadataLock.Lock()
+	defer staticMetadataLock.Unlock()
+	if staticMetadata != nil && pendingBlocks > 0 {
+		putMetadata()
+	}
+}
+
+func putMetadata() {
+	if err := staticSubstateDB.PutMetadata(staticMetadata); err != nil {
+		panic(fmt.Errorf("error putting substate DB metadata: %v", err))
+	}
+	pendingBlocks = 0
+}
+
+// ValidateRange checks that the blocks first to last were recorded in the
+// substate DB
+func ValidateRange(first, last uint64) error {
+	return staticSubstateDB.ValidateRange(first, last)
+}
+
 func OpenFakeSubstateDB() {
 	backend := rawdb.NewMemoryDatabase()
 	staticSubstateDB = NewSubstateDB(backend)
@@ -67,6 +161,22 @@ func CloseFakeSubstateDB() {
 func SetSubstateFlags(ctx *cli.Context) {
 	substateDir = ctx.String(SubstateDirFlag.Name)
 	fmt.Printf("record-replay: --substatedir=%s\n", substateDir)
+	if ctx.IsSet(SubstateEncodingFlag.Name) {
+		substateEncoding = ctx.String(SubstateEncodingFlag.Name)
+		fmt.Printf("record-replay: --substate-encoding=%s\n", substateEncoding)
+	}
+	if ctx.IsSet(SubstateCacheFlag.Name) {
+		substateCache = ctx.Int(SubstateCacheFlag.Name)
+		fmt.Printf("record-replay: --substate-cache=%v\n", substateCache)
+	}
+	if ctx.IsSet(SubstateHandlesFlag.Name) {
+		substateHandles = ctx.Int(SubstateHandlesFlag.Name)
+		fmt.Printf("record-replay: --substate-handles=%v\n", substateHandles)
+	}
+	if ctx.IsSet(BlockCacheFlag.Name) {
+		blockCacheSize = ctx.Int(BlockCacheFlag.Name)
+		fmt.Printf("record-replay: --block-cache=%v\n", blockCacheSize)
+	}
 }
 
 func HasCode(codeHash common.Hash) bool {
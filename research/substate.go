@@ -48,6 +48,55 @@ func (x *SubstateAccount) StateEqual(y *SubstateAccount) bool {
 	return true
 }
 
+// StrictStateEqual is the symmetric counterpart of StateEqual. Nonce, code and
+// every storage slot present on either side are compared; a slot missing on
+// one side is taken as zero, and a missing account as an empty one.
+func (x *SubstateAccount) StrictStateEqual(y *SubstateAccount) bool {
+	if x == y {
+		return true
+	}
+
+	if x == nil {
+		return y.IsEmpty()
+	}
+	if y == nil {
+		return x.IsEmpty()
+	}
+
+	equal := (x.Nonce == y.Nonce &&
+		x.Balance.Cmp(y.Balance) == 0 &&
+		bytes.Equal(x.Code, y.Code))
+	if !equal {
+		return false
+	}
+
+	for k, xv := range x.Storage {
+		if y.Storage[k] != xv {
+			return false
+		}
+	}
+	for k, yv := range y.Storage {
+		if x.Storage[k] != yv {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsEmpty reports whether the account carries no state at all
+func (sa *SubstateAccount) IsEmpty() bool {
+	if sa.Nonce != 0 || sa.Balance.Sign() != 0 || len(sa.Code) != 0 {
+		return false
+	}
+	for _, v := range sa.Storage {
+		if v != (common.Hash{}) {
+			return false
+		}
+	}
+	return true
+}
+
 func (x *SubstateAccount) Equal(y *SubstateAccount) bool {
 	if x == y {
 		return true
@@ -115,6 +164,25 @@ func (x SubstateAlloc) AllStateEqual(y SubstateAlloc) (string, bool) {
 	return "", true
 }
 
+// StrictStateEqual compares every account present in either alloc, so that
+// accounts created or deleted on one side only are reported as well.
+func (x SubstateAlloc) StrictStateEqual(y SubstateAlloc) (string, bool) {
+	for k, xv := range x {
+		if !xv.StrictStateEqual(y[k]) {
+			return k.String(), false
+		}
+	}
+	for k, yv := range y {
+		if _, exist := x[k]; exist {
+			continue
+		}
+		if !yv.IsEmpty() {
+			return k.String(), false
+		}
+	}
+	return "", true
+}
+
 func (x SubstateAlloc) Equal(y SubstateAlloc) bool {
 	if len(x) != len(y) {
 		return false
@@ -433,6 +501,25 @@ func (x *Substate) Equal(y *Substate) bool {
 	return equal
 }
 
+// Copy returns a copy of the substate whose allocs can be modified. Env,
+// message and result are shallow copies, nil if missing in the substate.
+func (substate *Substate) Copy() *Substate {
+	substateCopy := NewSubstate(substate.InputAlloc.Copy(), substate.OutputAlloc.Copy(), nil, nil, nil)
+	if substate.Env != nil {
+		env := *substate.Env
+		substateCopy.Env = &env
+	}
+	if substate.Message != nil {
+		msg := *substate.Message
+		substateCopy.Message = &msg
+	}
+	if substate.Result != nil {
+		result := *substate.Result
+		substateCopy.Result = &result
+	}
+	return substateCopy
+}
+
 func containByList(list []interface{}, item interface{}) bool {
 	for _, listItem := range list {
 		if item == listItem {
@@ -0,0 +1,295 @@
+package research
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+/*
+ * The substate DB backend is chosen by the scheme of --substateDir:
+ *
+ *   <dir> or leveldb://<dir>        a LevelDB directory
+ *   memory://[<file>]               an in-memory DB, loaded from the substates
+ *                                   of <file> in the format of db export
+ *   shards://<dir>,<dir>...         LevelDB directories opened together as one
+ *                                   read-only DB, e.g. recordings of disjoint
+ *                                   block ranges; a <dir> may be a glob pattern
+ */
+
+const (
+	levelDBScheme = "leveldb://"
+	memoryScheme  = "memory://"
+	shardsScheme  = "shards://"
+)
+
+var errShardsReadOnly = errors.New("sharded substate DB is read-only")
+
+// OpenBackend opens the substate DB backend of a --substateDir value, with
+// the cache and handles of --substate-cache and --substate-handles
+func OpenBackend(url string, readonly bool) (BackendDatabase, error) {
+	switch {
+	case strings.HasPrefix(url, memoryScheme):
+		return openMemoryBackend(strings.TrimPrefix(url, memoryScheme))
+	case strings.HasPrefix(url, shardsScheme):
+		if !readonly {
+			return nil, errShardsReadOnly
+		}
+		return openShardedBackend(strings.TrimPrefix(url, shardsScheme))
+	default:
+		return rawdb.NewLevelDBDatabase(strings.TrimPrefix(url, levelDBScheme), substateCache, substateHandles, "substatedir", readonly)
+	}
+}
+
+// openMemoryBackend returns an in-memory DB with the substates of path
+func openMemoryBackend(path string) (BackendDatabase, error) {
+	backend := rawdb.NewMemoryDatabase()
+	if path == "" {
+		return backend, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := NewSubstateDB(backend)
+	err = ReadSubstatesJSON(file, func(block uint64, tx int, substate *Substate) error {
+		db.PutSubstate(block, tx, substate)
+		return nil
+	})
+	if err != nil {
+		backend.Close()
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	return backend, nil
+}
+
+// openShardedBackend opens the comma-separated LevelDB directories of list
+func openShardedBackend(list string) (BackendDatabase, error) {
+	var paths []string
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no substate DB matches %s", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no substate DB shards")
+	}
+
+	sdb := &shardedDatabase{}
+	for _, path := range paths {
+		shard, err := rawdb.NewLevelDBDatabase(path, substateCache/len(paths), substateHandles/len(paths), "substatedir", true)
+		if err != nil {
+			sdb.Close()
+			return nil, fmt.Errorf("error opening shard %s: %v", path, err)
+		}
+		sdb.shards = append(sdb.shards, shard)
+		sdb.paths = append(sdb.paths, path)
+	}
+	return sdb, nil
+}
+
+// shardedDatabase is a read-only union of substate DBs. Keys found in several
+// shards, like code, are read from the first one. The metadata is merged.
+type shardedDatabase struct {
+	shards []ethdb.KeyValueStore
+	paths  []string
+}
+
+func (sdb *shardedDatabase) Has(key []byte) (bool, error) {
+	if IsMetadataKey(key) {
+		md, err := sdb.metadata()
+		return md != nil, err
+	}
+	for _, shard := range sdb.shards {
+		if has, err := shard.Has(key); err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+func (sdb *shardedDatabase) Get(key []byte) ([]byte, error) {
+	if IsMetadataKey(key) {
+		md, err := sdb.metadata()
+		if err != nil {
+			return nil, err
+		}
+		if md == nil {
+			return nil, fmt.Errorf("not found")
+		}
+		return json.Marshal(md)
+	}
+	var err error
+	for _, shard := range sdb.shards {
+		var value []byte
+		if value, err = shard.Get(key); err == nil {
+			return value, nil
+		}
+	}
+	return nil, err
+}
+
+// metadata returns the recorded ranges of all shards, or nil if a shard has
+// no metadata
+func (sdb *shardedDatabase) metadata() (*SubstateMetadata, error) {
+	var merged *SubstateMetadata
+	for i, shard := range sdb.shards {
+		md, err := NewSubstateDB(shard).GetMetadata()
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %v", sdb.paths[i], err)
+		}
+		if md == nil {
+			return nil, nil
+		}
+		if merged == nil {
+			merged = md.Copy()
+			continue
+		}
+		if err = merged.Compatible(md); err != nil {
+			return nil, fmt.Errorf("shard %s: %v", sdb.paths[i], err)
+		}
+		for _, r := range md.Ranges {
+			merged.Ranges = merged.Ranges.Add(r)
+		}
+	}
+	return merged, nil
+}
+
+func (sdb *shardedDatabase) Put(key []byte, value []byte) error {
+	return errShardsReadOnly
+}
+
+func (sdb *shardedDatabase) Delete(key []byte) error {
+	return errShardsReadOnly
+}
+
+func (sdb *shardedDatabase) NewBatch() ethdb.Batch {
+	return &readOnlyBatch{}
+}
+
+func (sdb *shardedDatabase) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	it := &shardedIterator{}
+	for _, shard := range sdb.shards {
+		it.iters = append(it.iters, shard.NewIterator(prefix, start))
+	}
+	return it
+}
+
+func (sdb *shardedDatabase) Stat(property string) (string, error) {
+	var stats []string
+	for i, shard := range sdb.shards {
+		stat, err := shard.Stat(property)
+		if err != nil {
+			return "", err
+		}
+		stats = append(stats, fmt.Sprintf("%s:\n%s", sdb.paths[i], stat))
+	}
+	return strings.Join(stats, "\n"), nil
+}
+
+func (sdb *shardedDatabase) Compact(start []byte, limit []byte) error {
+	return errShardsReadOnly
+}
+
+func (sdb *shardedDatabase) Close() error {
+	var err error
+	for _, shard := range sdb.shards {
+		if cerr := shard.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// readOnlyBatch is the batch of a sharded DB, which cannot be written
+type readOnlyBatch struct{}
+
+func (b *readOnlyBatch) Put(key []byte, value []byte) error  { return errShardsReadOnly }
+func (b *readOnlyBatch) Delete(key []byte) error             { return errShardsReadOnly }
+func (b *readOnlyBatch) ValueSize() int                      { return 0 }
+func (b *readOnlyBatch) Write() error                        { return errShardsReadOnly }
+func (b *readOnlyBatch) Reset()                              {}
+func (b *readOnlyBatch) Replay(w ethdb.KeyValueWriter) error { return nil }
+
+// shardedIterator merges the iterators of the shards in key order, skipping
+// the keys already returned by an earlier shard
+type shardedIterator struct {
+	iters   []ethdb.Iterator
+	valid   []bool
+	started bool
+
+	key   []byte
+	value []byte
+}
+
+func (it *shardedIterator) Next() bool {
+	if !it.started {
+		it.started = true
+		it.valid = make([]bool, len(it.iters))
+		for i, iter := range it.iters {
+			it.valid[i] = iter.Next()
+		}
+	} else {
+		for i, iter := range it.iters {
+			if it.valid[i] && bytes.Equal(iter.Key(), it.key) {
+				it.valid[i] = iter.Next()
+			}
+		}
+	}
+
+	next := -1
+	for i, iter := range it.iters {
+		if it.valid[i] && (next < 0 || bytes.Compare(iter.Key(), it.iters[next].Key()) < 0) {
+			next = i
+		}
+	}
+	if next < 0 {
+		it.key, it.value = nil, nil
+		return false
+	}
+	it.key = common.CopyBytes(it.iters[next].Key())
+	it.value = common.CopyBytes(it.iters[next].Value())
+	return true
+}
+
+func (it *shardedIterator) Error() error {
+	for _, iter := range it.iters {
+		if err := iter.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *shardedIterator) Key() []byte {
+	return it.key
+}
+
+func (it *shardedIterator) Value() []byte {
+	return it.value
+}
+
+func (it *shardedIterator) Release() {
+	for _, iter := range it.iters {
+		iter.Release()
+	}
+}
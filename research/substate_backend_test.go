@@ -0,0 +1,166 @@
+package research
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+// newTestShard creates a LevelDB substate DB in dir with a substate for each
+// of blocks and the given recorded ranges, if any
+func newTestShard(t *testing.T, dir string, blocks []uint64, ranges BlockRanges) {
+	backend, err := rawdb.NewLevelDBDatabase(dir, 16, 16, "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewSubstateDB(backend)
+	defer db.Close()
+	for _, block := range blocks {
+		db.PutSubstate(block, 0, newTestSubstate(byte(block)))
+	}
+	if ranges != nil {
+		md := NewSubstateMetadata("test")
+		md.Ranges = ranges
+		if err := db.PutMetadata(md); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "substate-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	export := filepath.Join(dir, "export.jsonl")
+	input := substateEntry(t, 1, 0, newTestSubstate(1)) + "\n" + substateEntry(t, 2, 0, newTestSubstate(2)) + "\n"
+	if err := ioutil.WriteFile(export, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.jsonl")
+	if err := ioutil.WriteFile(invalid, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		want    []uint64
+		wantErr bool
+	}{
+		{url: "memory://"},
+		{url: "memory://" + export, want: []uint64{1, 2}},
+		{url: "memory://" + filepath.Join(dir, "missing.jsonl"), wantErr: true},
+		{url: "memory://" + invalid, wantErr: true},
+	}
+	for _, tt := range tests {
+		backend, err := OpenBackend(tt.url, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.url, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		db := NewSubstateDB(backend)
+		if n := countKeys(db, stage1SubstatePrefix); n != len(tt.want) {
+			t.Errorf("%s: %d substates, want %d", tt.url, n, len(tt.want))
+		}
+		for _, block := range tt.want {
+			if !db.HasSubstate(block, 0) || !db.GetSubstate(block, 0).Equal(newTestSubstate(byte(block))) {
+				t.Errorf("%s: substate %d_0 not loaded", tt.url, block)
+			}
+		}
+		// memory DBs are writable
+		db.PutSubstate(3, 0, newTestSubstate(3))
+		if !db.HasSubstate(3, 0) {
+			t.Errorf("%s: substate put into the DB is missing", tt.url)
+		}
+		db.Close()
+	}
+}
+
+func TestShardedBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "substate-shards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		shard1 = filepath.Join(dir, "shard-1")
+		shard2 = filepath.Join(dir, "shard-2")
+		shard3 = filepath.Join(dir, "nometa")
+	)
+	newTestShard(t, shard1, []uint64{1, 3, 5}, BlockRanges{{1, 5}})
+	newTestShard(t, shard2, []uint64{3, 4, 6}, BlockRanges{{6, 10}})
+	newTestShard(t, shard3, []uint64{20}, nil)
+
+	tests := []struct {
+		name       string
+		url        string
+		readonly   bool
+		wantBlocks []uint64 // in iteration order
+		wantRanges BlockRanges
+		wantErr    bool
+	}{
+		{name: "list", url: "shards://" + shard1 + "," + shard2, readonly: true, wantBlocks: []uint64{1, 3, 4, 5, 6}, wantRanges: BlockRanges{{1, 10}}},
+		{name: "glob", url: "shards://" + filepath.Join(dir, "shard-*"), readonly: true, wantBlocks: []uint64{1, 3, 4, 5, 6}, wantRanges: BlockRanges{{1, 10}}},
+		{name: "shard without metadata", url: "shards://" + shard1 + "," + shard3, readonly: true, wantBlocks: []uint64{1, 3, 5, 20}},
+		{name: "writable", url: "shards://" + shard1, wantErr: true},
+		{name: "no match", url: "shards://" + filepath.Join(dir, "missing-*"), readonly: true, wantErr: true},
+		{name: "no shards", url: "shards://", readonly: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		backend, err := OpenBackend(tt.url, tt.readonly)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		db := NewSubstateDB(backend)
+
+		var blocks []uint64
+		it := db.NewSubstateIterator(0)
+		for it.Next() {
+			block, tx, err := DecodeStage1SubstateKey(it.Key())
+			if err != nil || tx != 0 {
+				t.Errorf("%s: invalid substate key %x", tt.name, it.Key())
+				continue
+			}
+			blocks = append(blocks, block)
+		}
+		it.Release()
+		if !reflect.DeepEqual(blocks, tt.wantBlocks) {
+			t.Errorf("%s: iterated blocks %v, want %v", tt.name, blocks, tt.wantBlocks)
+		}
+		for _, block := range tt.wantBlocks {
+			if !db.GetSubstate(block, 0).Equal(newTestSubstate(byte(block))) {
+				t.Errorf("%s: substate %d_0 differs", tt.name, block)
+			}
+		}
+
+		md, err := db.GetMetadata()
+		if err != nil {
+			t.Errorf("%s: error getting metadata: %v", tt.name, err)
+		}
+		switch {
+		case tt.wantRanges == nil && md != nil:
+			t.Errorf("%s: metadata %s, want none", tt.name, md.Ranges)
+		case tt.wantRanges != nil && (md == nil || md.Ranges.String() != tt.wantRanges.String()):
+			t.Errorf("%s: metadata %+v, want ranges %s", tt.name, md, tt.wantRanges)
+		}
+
+		if err := backend.Put([]byte("key"), nil); err != errShardsReadOnly {
+			t.Errorf("%s: put error %v, want %v", tt.name, err, errShardsReadOnly)
+		}
+		if stat, err := backend.Stat("leveldb.stats"); err != nil || !strings.Contains(stat, shard1) {
+			t.Errorf("%s: stats without %s (error %v)", tt.name, shard1, err)
+		}
+		db.Close()
+	}
+}
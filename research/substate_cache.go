@@ -0,0 +1,74 @@
+package research
+
+import (
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// blockCache is an LRU of decoded block substates shared by all readers of a
+// SubstateDB. Cached substates are never modified; readers get copies.
+type blockCache struct {
+	blocks *lru.Cache // block -> map[int]*Substate
+
+	hits   int64
+	misses int64
+}
+
+// SetBlockCache keeps the decoded substates of the size most recently read
+// blocks, or disables the cache if size is 0
+func (db *SubstateDB) SetBlockCache(size int) error {
+	if size <= 0 {
+		db.blockCache = nil
+		return nil
+	}
+	blocks, err := lru.New(size)
+	if err != nil {
+		return err
+	}
+	db.blockCache = &blockCache{blocks: blocks}
+	return nil
+}
+
+// HasBlockCache tells whether decoded block substates are cached
+func (db *SubstateDB) HasBlockCache() bool {
+	return db.blockCache != nil
+}
+
+// BlockCacheStats returns the number of GetBlockSubstates calls served from
+// the block cache and decoded from the DB
+func (db *SubstateDB) BlockCacheStats() (hits int64, misses int64) {
+	if db.blockCache == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&db.blockCache.hits), atomic.LoadInt64(&db.blockCache.misses)
+}
+
+func (db *SubstateDB) getCachedBlockSubstates(block uint64) map[int]*Substate {
+	var txSubstate map[int]*Substate
+	if cached, ok := db.blockCache.blocks.Get(block); ok {
+		atomic.AddInt64(&db.blockCache.hits, 1)
+		blockCacheHitMeter.Mark(1)
+		txSubstate = cached.(map[int]*Substate)
+	} else {
+		atomic.AddInt64(&db.blockCache.misses, 1)
+		blockCacheMisMeter.Mark(1)
+		txSubstate = db.decodeBlockSubstates(block)
+		db.blockCache.blocks.Add(block, txSubstate)
+	}
+
+	copies := make(map[int]*Substate, len(txSubstate))
+	for tx, substate := range txSubstate {
+		copies[tx] = substate.Copy()
+	}
+	return copies
+}
+
+// PrefetchBlockSubstates decodes the substates of a block into the block
+// cache, unless they are cached already
+func (db *SubstateDB) PrefetchBlockSubstates(block uint64) {
+	if db.blockCache == nil || db.blockCache.blocks.Contains(block) {
+		return
+	}
+	db.blockCache.blocks.Add(block, db.decodeBlockSubstates(block))
+}
@@ -0,0 +1,72 @@
+package research
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestBlockCache(t *testing.T) {
+	type op struct {
+		prefetch bool
+		block    uint64
+	}
+	get := func(block uint64) op { return op{block: block} }
+	prefetch := func(block uint64) op { return op{prefetch: true, block: block} }
+
+	tests := []struct {
+		name       string
+		size       int
+		ops        []op
+		wantHits   int64
+		wantMisses int64
+	}{
+		{"disabled", 0, []op{get(1), get(1), prefetch(2), get(2)}, 0, 0},
+		{"repeated reads", 2, []op{get(1), get(1), get(1)}, 2, 1},
+		{"evicted", 2, []op{get(1), get(2), get(3), get(1)}, 0, 4},
+		{"recently used kept", 2, []op{get(1), get(2), get(1), get(3), get(1)}, 2, 3},
+		{"prefetched", 2, []op{prefetch(1), prefetch(2), get(1), get(2)}, 2, 0},
+		{"prefetched twice", 2, []op{prefetch(1), get(1), prefetch(1), get(1)}, 2, 0},
+		{"empty block", 2, []op{get(9), get(9)}, 1, 1},
+	}
+	for _, tt := range tests {
+		db := NewSubstateDB(rawdb.NewMemoryDatabase())
+		for block := uint64(1); block <= 3; block++ {
+			db.PutSubstate(block, 0, newTestSubstate(byte(block)))
+			db.PutSubstate(block, 1, newTestSubstate(byte(block+10)))
+		}
+		if err := db.SetBlockCache(tt.size); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if db.HasBlockCache() != (tt.size > 0) {
+			t.Errorf("%s: HasBlockCache = %v", tt.name, db.HasBlockCache())
+		}
+		for _, op := range tt.ops {
+			if op.prefetch {
+				db.PrefetchBlockSubstates(op.block)
+				continue
+			}
+			txSubstate := db.GetBlockSubstates(op.block)
+			if op.block > 3 {
+				if len(txSubstate) != 0 {
+					t.Errorf("%s: %d substates in empty block %d", tt.name, len(txSubstate), op.block)
+				}
+				continue
+			}
+			if len(txSubstate) != 2 ||
+				!txSubstate[0].Equal(newTestSubstate(byte(op.block))) ||
+				!txSubstate[1].Equal(newTestSubstate(byte(op.block+10))) {
+				t.Errorf("%s: substates of block %d differ", tt.name, op.block)
+			}
+			// readers get copies they can modify
+			txSubstate[0].InputAlloc[testAddr1].Balance = big.NewInt(0)
+			txSubstate[0].OutputAlloc[testAddr2].Storage[testSlot] = testSlot
+			delete(txSubstate[1].InputAlloc, testAddr1)
+		}
+		if hits, misses := db.BlockCacheStats(); hits != tt.wantHits || misses != tt.wantMisses {
+			t.Errorf("%s: %d hits, %d misses, want %d hits, %d misses", tt.name, hits, misses, tt.wantHits, tt.wantMisses)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,270 @@
+package research
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MappingLayout locates the entries of a mapping in contract storage
+type MappingLayout struct {
+	Slot  uint64 `json:"slot"`
+	Vyper bool   `json:"vyper,omitempty"` // slot hashed before the key
+}
+
+// EntrySlot is the storage slot of the entry at keys of a (nested) mapping
+func (layout MappingLayout) EntrySlot(keys ...common.Hash) common.Hash {
+	slot := common.BigToHash(new(big.Int).SetUint64(layout.Slot))
+	for _, key := range keys {
+		if layout.Vyper {
+			slot = crypto.Keccak256Hash(slot[:], key[:])
+		} else {
+			slot = crypto.Keccak256Hash(key[:], slot[:])
+		}
+	}
+	return slot
+}
+
+// TokenLayout is the storage layout of the ERC20 mappings of a token
+type TokenLayout struct {
+	Balances   *MappingLayout `json:"balances,omitempty"`
+	Allowances *MappingLayout `json:"allowances,omitempty"`
+}
+
+// StorageProbe executes input on contract in alloc and returns the returned
+// data along with the storage slots of contract read during the call
+type StorageProbe func(alloc SubstateAlloc, contract common.Address, input []byte) ([]byte, []common.Hash, error)
+
+var (
+	// layouts of well-known mainnet tokens
+	knownTokenLayouts = map[common.Address]TokenLayout{
+		// WETH9
+		common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"): {&MappingLayout{Slot: 3}, &MappingLayout{Slot: 4}},
+		// USDC (FiatTokenV2 behind a proxy)
+		common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"): {&MappingLayout{Slot: 9}, &MappingLayout{Slot: 10}},
+		// USDT
+		common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"): {&MappingLayout{Slot: 2}, &MappingLayout{Slot: 5}},
+		// DAI
+		common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"): {&MappingLayout{Slot: 2}, &MappingLayout{Slot: 3}},
+	}
+	// layouts loaded from storage-layout files or found by probing
+	tokenLayouts   = make(map[common.Address]TokenLayout)
+	tokenLayoutsMu sync.Mutex
+
+	// labels of the balance and allowance mappings in storage-layout files
+	balanceLabels   = []string{"_balances", "balances", "balanceOf", "_balanceOf"}
+	allowanceLabels = []string{"_allowances", "allowances", "allowance", "_allowance", "allowed", "_allowed"}
+
+	// ERC20 selectors used for probing
+	balanceOfSelector = common.FromHex("0x70a08231")
+	allowanceSelector = common.FromHex("0xdd62ed3e")
+
+	// highest mapping position tried when probing
+	maxProbeSlot uint64 = 256
+)
+
+// GetTokenLayout returns the registered layout of token, falling back to the
+// built-in layouts of well-known tokens
+func GetTokenLayout(token common.Address) TokenLayout {
+	tokenLayoutsMu.Lock()
+	layout, exist := tokenLayouts[token]
+	tokenLayoutsMu.Unlock()
+	known := knownTokenLayouts[token]
+	if !exist {
+		return known
+	}
+	if layout.Balances == nil {
+		layout.Balances = known.Balances
+	}
+	if layout.Allowances == nil {
+		layout.Allowances = known.Allowances
+	}
+	return layout
+}
+
+// RegisterTokenLayout sets the layout of token, keeping the mappings of an
+// earlier registration that layout leaves unset
+func RegisterTokenLayout(token common.Address, layout TokenLayout) {
+	tokenLayoutsMu.Lock()
+	defer tokenLayoutsMu.Unlock()
+	old := tokenLayouts[token]
+	if layout.Balances == nil {
+		layout.Balances = old.Balances
+	}
+	if layout.Allowances == nil {
+		layout.Allowances = old.Allowances
+	}
+	tokenLayouts[token] = layout
+}
+
+// storageLayoutJSON is the storageLayout output of solc
+type storageLayoutJSON struct {
+	Storage []struct {
+		Label string `json:"label"`
+		Slot  string `json:"slot"`
+		Type  string `json:"type"`
+	} `json:"storage"`
+}
+
+// LoadStorageLayout registers the balance and allowance mappings found in the
+// solc storage-layout file at path as the layout of token
+func LoadStorageLayout(token common.Address, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file storageLayoutJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid storage layout %s: %v", path, err)
+	}
+	var layout TokenLayout
+	for _, entry := range file.Storage {
+		if !strings.HasPrefix(entry.Type, "t_mapping") {
+			continue
+		}
+		slot, err := strconv.ParseUint(entry.Slot, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid slot %q of %s in %s", entry.Slot, entry.Label, path)
+		}
+		if layout.Balances == nil && containsString(balanceLabels, entry.Label) {
+			layout.Balances = &MappingLayout{Slot: slot}
+		}
+		if layout.Allowances == nil && containsString(allowanceLabels, entry.Label) {
+			layout.Allowances = &MappingLayout{Slot: slot}
+		}
+	}
+	if layout.Balances == nil && layout.Allowances == nil {
+		return fmt.Errorf("no token mapping in storage layout %s", path)
+	}
+	RegisterTokenLayout(token, layout)
+	return nil
+}
+
+// LoadStorageLayouts loads every <address>.json storage-layout file in dir
+func LoadStorageLayouts(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		address := strings.TrimSuffix(name, ".json")
+		if !common.IsHexAddress(address) {
+			continue
+		}
+		if err := LoadStorageLayout(common.HexToAddress(address), filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMappingEntry sets the entry at keys of the mapping of contract to value
+func SetMappingEntry(alloc SubstateAlloc, contract common.Address, layout MappingLayout, value common.Hash, keys ...common.Hash) error {
+	account, exist := alloc[contract]
+	if !exist {
+		return fmt.Errorf("contract %s not in alloc", contract.Hex())
+	}
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]common.Hash)
+	}
+	account.Storage[layout.EntrySlot(keys...)] = value
+	return nil
+}
+
+// FindMappingLayout locates the mapping read by calling input on contract,
+// whose entry at keys is returned by the call. Every slot read by the call is
+// matched against the mapping positions up to maxProbeSlot, and a match is
+// confirmed by writing a marker into the entry and probing again.
+func FindMappingLayout(alloc SubstateAlloc, contract common.Address, input []byte, keys []common.Hash, probe StorageProbe) (*MappingLayout, error) {
+	if probe == nil {
+		return nil, fmt.Errorf("no layout of %s and no probe", contract.Hex())
+	}
+	_, slots, err := probe(alloc, contract, input)
+	if err != nil {
+		return nil, err
+	}
+	read := make(map[common.Hash]bool)
+	for _, slot := range slots {
+		read[slot] = true
+	}
+	marker := crypto.Keccak256Hash([]byte("substate mapping marker"))
+	for position := uint64(0); position <= maxProbeSlot; position++ {
+		for _, vyper := range []bool{false, true} {
+			layout := MappingLayout{Slot: position, Vyper: vyper}
+			if !read[layout.EntrySlot(keys...)] {
+				continue
+			}
+			probeAlloc := alloc.Copy()
+			if err := SetMappingEntry(probeAlloc, contract, layout, marker, keys...); err != nil {
+				return nil, err
+			}
+			ret, _, err := probe(probeAlloc, contract, input)
+			if err == nil && bytes.Equal(ret, marker[:]) {
+				return &layout, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("mapping of %s not found", contract.Hex())
+}
+
+// SetTokenBalance sets the ERC20 balance of holder in token to amount. The
+// balance mapping is taken from the registered or well-known layouts, or else
+// probed through balanceOf. The total supply is left untouched, as is the case
+// for tokens lent by a flash loan.
+func SetTokenBalance(alloc SubstateAlloc, token, holder common.Address, amount *big.Int, probe StorageProbe) error {
+	layout := GetTokenLayout(token).Balances
+	holderKey := common.BytesToHash(holder.Bytes())
+	if layout == nil {
+		input := append(append([]byte{}, balanceOfSelector...), holderKey[:]...)
+		found, err := FindMappingLayout(alloc, token, input, []common.Hash{holderKey}, probe)
+		if err != nil {
+			return err
+		}
+		RegisterTokenLayout(token, TokenLayout{Balances: found})
+		layout = found
+	}
+	return SetMappingEntry(alloc, token, *layout, common.BigToHash(amount), holderKey)
+}
+
+// SetTokenAllowance sets the ERC20 allowance of spender over the tokens of
+// owner to amount, locating the allowance mapping like SetTokenBalance
+func SetTokenAllowance(alloc SubstateAlloc, token, owner, spender common.Address, amount *big.Int, probe StorageProbe) error {
+	layout := GetTokenLayout(token).Allowances
+	ownerKey := common.BytesToHash(owner.Bytes())
+	spenderKey := common.BytesToHash(spender.Bytes())
+	if layout == nil {
+		input := append(append(append([]byte{}, allowanceSelector...), ownerKey[:]...), spenderKey[:]...)
+		found, err := FindMappingLayout(alloc, token, input, []common.Hash{ownerKey, spenderKey}, probe)
+		if err != nil {
+			return err
+		}
+		RegisterTokenLayout(token, TokenLayout{Allowances: found})
+		layout = found
+	}
+	return SetMappingEntry(alloc, token, *layout, common.BigToHash(amount), ownerKey, spenderKey)
+}
@@ -0,0 +1,220 @@
+package research
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// solidityEntry is keccak(key . slot), the slot of a Solidity mapping entry
+func solidityEntry(key common.Hash, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(key[:], common.BigToHash(new(big.Int).SetUint64(slot)).Bytes())
+}
+
+// newMappingProbe returns a probe of a token whose balanceOf and allowance
+// read the entries of the mapping at layout, after an unrelated slot
+func newMappingProbe(layout MappingLayout) StorageProbe {
+	return func(alloc SubstateAlloc, contract common.Address, input []byte) ([]byte, []common.Hash, error) {
+		account, exist := alloc[contract]
+		if !exist {
+			return nil, nil, fmt.Errorf("no contract %s", contract.Hex())
+		}
+		var keys []common.Hash
+		for i := 4; i+32 <= len(input); i += 32 {
+			keys = append(keys, common.BytesToHash(input[i:i+32]))
+		}
+		slot := layout.EntrySlot(keys...)
+		value := account.Storage[slot]
+		return value[:], []common.Hash{testSlot, slot}, nil
+	}
+}
+
+func TestMappingLayoutEntrySlot(t *testing.T) {
+	var (
+		key1 = common.BytesToHash(testAddr1.Bytes())
+		key2 = common.BytesToHash(testAddr2.Bytes())
+		slot = common.BigToHash(big.NewInt(7))
+	)
+	tests := []struct {
+		name   string
+		layout MappingLayout
+		keys   []common.Hash
+		want   common.Hash
+	}{
+		{"solidity", MappingLayout{Slot: 7}, []common.Hash{key1}, crypto.Keccak256Hash(key1[:], slot[:])},
+		{"vyper", MappingLayout{Slot: 7, Vyper: true}, []common.Hash{key1}, crypto.Keccak256Hash(slot[:], key1[:])},
+		{"solidity nested", MappingLayout{Slot: 7}, []common.Hash{key1, key2},
+			crypto.Keccak256Hash(key2[:], crypto.Keccak256(key1[:], slot[:]))},
+		{"vyper nested", MappingLayout{Slot: 7, Vyper: true}, []common.Hash{key1, key2},
+			crypto.Keccak256Hash(crypto.Keccak256(slot[:], key1[:]), key2[:])},
+	}
+	for _, tt := range tests {
+		if got := tt.layout.EntrySlot(tt.keys...); got != tt.want {
+			t.Errorf("%s: entry slot %s, want %s", tt.name, got.Hex(), tt.want.Hex())
+		}
+	}
+}
+
+func TestSetTokenBalanceKnownLayouts(t *testing.T) {
+	var (
+		holder    = common.BytesToHash(testAddr1.Bytes())
+		spender   = common.BytesToHash(testAddr2.Bytes())
+		amount    = big.NewInt(1000)
+		amountKey = common.BigToHash(amount)
+	)
+	tests := []struct {
+		name                       string
+		token                      string
+		balanceSlot, allowanceSlot uint64
+	}{
+		{"WETH", "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", 3, 4},
+		{"USDC", "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", 9, 10},
+		{"USDT", "0xdAC17F958D2ee523a2206206994597C13D831ec7", 2, 5},
+		{"DAI", "0x6B175474E89094C44Da98b954EedeAC495271d0F", 2, 3},
+	}
+	for _, tt := range tests {
+		token := common.HexToAddress(tt.token)
+		alloc := SubstateAlloc{token: newTestAccount(1, 0, []byte{0x60, 0x00}, common.Hash{})}
+		// no probe, the built-in layout must be used
+		if err := SetTokenBalance(alloc, token, testAddr1, amount, nil); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if err := SetTokenAllowance(alloc, token, testAddr1, testAddr2, amount, nil); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		balanceSlot := solidityEntry(holder, tt.balanceSlot)
+		allowanceSlot := crypto.Keccak256Hash(spender[:], solidityEntry(holder, tt.allowanceSlot).Bytes())
+		if got := alloc[token].Storage[balanceSlot]; got != amountKey {
+			t.Errorf("%s: balance slot %s holds %s, want %s", tt.name, balanceSlot.Hex(), got.Hex(), amountKey.Hex())
+		}
+		if got := alloc[token].Storage[allowanceSlot]; got != amountKey {
+			t.Errorf("%s: allowance slot %s holds %s, want %s", tt.name, allowanceSlot.Hex(), got.Hex(), amountKey.Hex())
+		}
+		if len(alloc[token].Storage) != 2 {
+			t.Errorf("%s: %d slots set, want 2", tt.name, len(alloc[token].Storage))
+		}
+	}
+}
+
+func TestLoadStorageLayouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		token   = common.BytesToAddress([]byte("layout token"))
+		partial = common.BytesToAddress([]byte("layout partial"))
+		files   = map[string]string{
+			token.Hex() + ".json": `{"storage": [
+				{"label": "_owner", "slot": "0", "type": "t_address"},
+				{"label": "_balances", "slot": "5", "type": "t_mapping(t_address,t_uint256)"},
+				{"label": "_allowances", "slot": "6", "type": "t_mapping(t_address,t_mapping(t_address,t_uint256))"}
+			]}`,
+			partial.Hex() + ".json": `{"storage": [
+				{"label": "balanceOf", "slot": "1", "type": "t_mapping(t_address,t_uint256)"}
+			]}`,
+			// neither named after an address nor a json file
+			"token.json": `{}`,
+			"README.txt": "layouts",
+		}
+	)
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LoadStorageLayouts(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetTokenLayout(token); got.Balances == nil || *got.Balances != (MappingLayout{Slot: 5}) ||
+		got.Allowances == nil || *got.Allowances != (MappingLayout{Slot: 6}) {
+		t.Errorf("layout of %s: %+v", token.Hex(), got)
+	}
+	if got := GetTokenLayout(partial); got.Balances == nil || *got.Balances != (MappingLayout{Slot: 1}) || got.Allowances != nil {
+		t.Errorf("layout of %s: %+v", partial.Hex(), got)
+	}
+	if err := LoadStorageLayouts(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing layout directory: %v", err)
+	}
+
+	// a layout without token mappings is an error
+	invalid := filepath.Join(dir, "invalid.json")
+	ioutil.WriteFile(invalid, []byte(`{"storage": [{"label": "_owner", "slot": "0", "type": "t_address"}]}`), 0644)
+	if err := LoadStorageLayout(token, invalid); err == nil {
+		t.Errorf("loaded a storage layout without token mappings")
+	}
+}
+
+func TestFindMappingLayout(t *testing.T) {
+	var (
+		holder  = common.BytesToHash(testAddr1.Bytes())
+		spender = common.BytesToHash(testAddr2.Bytes())
+		amount  = big.NewInt(1000)
+	)
+	tests := []struct {
+		name      string
+		layout    MappingLayout // layout of the probed token
+		allowance bool
+		wantErr   bool
+	}{
+		{name: "solidity balance", layout: MappingLayout{Slot: 3}},
+		{name: "vyper balance", layout: MappingLayout{Slot: 3, Vyper: true}},
+		{name: "solidity allowance", layout: MappingLayout{Slot: 1}, allowance: true},
+		{name: "vyper allowance", layout: MappingLayout{Slot: 2, Vyper: true}, allowance: true},
+		{name: "beyond probed slots", layout: MappingLayout{Slot: maxProbeSlot + 1}, wantErr: true},
+	}
+	for i, tt := range tests {
+		token := common.BigToAddress(big.NewInt(int64(0xdead00 + i)))
+		alloc := SubstateAlloc{token: newTestAccount(1, 0, []byte{0x60, 0x00}, common.Hash{})}
+		probe := newMappingProbe(tt.layout)
+
+		var (
+			err  error
+			keys = []common.Hash{holder}
+		)
+		if tt.allowance {
+			keys = append(keys, spender)
+			err = SetTokenAllowance(alloc, token, testAddr1, testAddr2, amount, probe)
+		} else {
+			err = SetTokenBalance(alloc, token, testAddr1, amount, probe)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: found a mapping beyond the probed slots", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := alloc[token].Storage[tt.layout.EntrySlot(keys...)]; got != common.BigToHash(amount) {
+			t.Errorf("%s: entry holds %s, want %d", tt.name, got.Hex(), amount)
+		}
+		// the layout found is registered for later calls
+		registered := GetTokenLayout(token).Balances
+		if tt.allowance {
+			registered = GetTokenLayout(token).Allowances
+		}
+		if registered == nil || *registered != tt.layout {
+			t.Errorf("%s: registered layout %+v, want %+v", tt.name, registered, tt.layout)
+		}
+	}
+
+	// without a known layout, a probe is needed
+	token := common.BytesToAddress([]byte("unprobed token"))
+	alloc := SubstateAlloc{token: newTestAccount(1, 0, []byte{0x60, 0x00}, common.Hash{})}
+	if err := SetTokenBalance(alloc, token, testAddr1, amount, nil); err == nil {
+		t.Errorf("set a balance without layout and probe")
+	}
+}
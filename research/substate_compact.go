@@ -0,0 +1,226 @@
+package research
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+)
+
+/*
+ * Compact substates deduplicate account states by content hash, in the way
+ * code is deduplicated under stage1CodePrefix. The state (nonce, balance, code
+ * hash and storage) of an account with storage is stored once under
+ * stage1AccountPrefix, and substates refer to it by hash. Accounts without
+ * storage are cheaper to inline. Substate values and account states are
+ * compressed with snappy.
+ *
+ * A compact substate value is compactSubstateVersion followed by the
+ * compressed compactSubstateRLP. No RLP list starts with this byte, so the
+ * other encodings are never mistaken for it.
+ */
+
+const (
+	stage1AccountPrefix = "1a" // stage1AccountPrefix + stateHash (256-bit) -> compressed SubstateAccountRLP
+
+	compactSubstateVersion byte = 0x01
+)
+
+func Stage1AccountKey(stateHash common.Hash) []byte {
+	prefix := []byte(stage1AccountPrefix)
+	return append(prefix, stateHash.Bytes()...)
+}
+
+func DecodeStage1AccountKey(key []byte) (stateHash common.Hash, err error) {
+	prefix := stage1AccountPrefix
+	if len(key) != len(prefix)+32 {
+		err = fmt.Errorf("invalid length of stage1 account key: %v", len(key))
+		return
+	}
+	if p := string(key[:2]); p != prefix {
+		err = fmt.Errorf("invalid prefix of stage1 account key: %#x", p)
+		return
+	}
+	stateHash = common.BytesToHash(key[len(prefix):])
+	return
+}
+
+// compactAccountRLP is either the hash of an account state stored under
+// stage1AccountPrefix, or an inlined account state
+type compactAccountRLP struct {
+	StateHash *common.Hash        `rlp:"nil"`
+	State     *SubstateAccountRLP `rlp:"nil"`
+}
+
+type compactAllocRLP struct {
+	Addresses []common.Address
+	Accounts  []*compactAccountRLP
+}
+
+type compactSubstateRLP struct {
+	InputAlloc  compactAllocRLP
+	OutputAlloc compactAllocRLP
+	Env         *SubstateEnvRLP
+	Message     *SubstateMessageRLP
+	Result      *SubstateResultRLP
+}
+
+func (db *SubstateDB) putAccountRLP(saRLP *SubstateAccountRLP) (common.Hash, error) {
+	value, err := rlp.EncodeToBytes(saRLP)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	stateHash := crypto.Keccak256Hash(value)
+	key := Stage1AccountKey(stateHash)
+	if has, err := db.backend.Has(key); err != nil || has {
+		return stateHash, err
+	}
+	return stateHash, db.backend.Put(key, snappy.Encode(nil, value))
+}
+
+func (db *SubstateDB) getAccountRLP(stateHash common.Hash) (*SubstateAccountRLP, error) {
+	compressed, err := db.backend.Get(Stage1AccountKey(stateHash))
+	if err != nil {
+		return nil, fmt.Errorf("missing account state %s: %v", stateHash.Hex(), err)
+	}
+	value, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing account state %s: %v", stateHash.Hex(), err)
+	}
+	saRLP := SubstateAccountRLP{}
+	if err = rlp.DecodeBytes(value, &saRLP); err != nil {
+		return nil, fmt.Errorf("error decoding account state %s: %v", stateHash.Hex(), err)
+	}
+	return &saRLP, nil
+}
+
+func (db *SubstateDB) newCompactAllocRLP(allocRLP SubstateAllocRLP) (compactAllocRLP, error) {
+	callocRLP := compactAllocRLP{
+		Addresses: allocRLP.Addresses,
+		Accounts:  []*compactAccountRLP{},
+	}
+	for _, saRLP := range allocRLP.Accounts {
+		if len(saRLP.Storage) == 0 {
+			callocRLP.Accounts = append(callocRLP.Accounts, &compactAccountRLP{State: saRLP})
+			continue
+		}
+		stateHash, err := db.putAccountRLP(saRLP)
+		if err != nil {
+			return callocRLP, err
+		}
+		callocRLP.Accounts = append(callocRLP.Accounts, &compactAccountRLP{StateHash: &stateHash})
+	}
+	return callocRLP, nil
+}
+
+func (db *SubstateDB) setCompactAllocRLP(allocRLP *SubstateAllocRLP, callocRLP compactAllocRLP) error {
+	if len(callocRLP.Addresses) != len(callocRLP.Accounts) {
+		return fmt.Errorf("%v addresses for %v accounts in alloc", len(callocRLP.Addresses), len(callocRLP.Accounts))
+	}
+	allocRLP.Addresses = callocRLP.Addresses
+	allocRLP.Accounts = []*SubstateAccountRLP{}
+	for _, caRLP := range callocRLP.Accounts {
+		switch {
+		case caRLP.StateHash != nil:
+			saRLP, err := db.getAccountRLP(*caRLP.StateHash)
+			if err != nil {
+				return err
+			}
+			allocRLP.Accounts = append(allocRLP.Accounts, saRLP)
+		case caRLP.State != nil:
+			allocRLP.Accounts = append(allocRLP.Accounts, caRLP.State)
+		default:
+			return fmt.Errorf("empty account in alloc")
+		}
+	}
+	return nil
+}
+
+func decodeCompactSubstateRLP(value []byte) (*compactSubstateRLP, error) {
+	if len(value) == 0 || value[0] != compactSubstateVersion {
+		return nil, fmt.Errorf("not a compact substate")
+	}
+	decompressed, err := snappy.Decode(nil, value[1:])
+	if err != nil {
+		return nil, err
+	}
+	csubstateRLP := compactSubstateRLP{}
+	if err = rlp.DecodeBytes(decompressed, &csubstateRLP); err != nil {
+		return nil, err
+	}
+	return &csubstateRLP, nil
+}
+
+// encodeCompactSubstateRLP stores the account states of a substate and
+// returns its compact value
+func (db *SubstateDB) encodeCompactSubstateRLP(substateRLP *SubstateRLP) ([]byte, error) {
+	var err error
+
+	csubstateRLP := compactSubstateRLP{
+		Env:     substateRLP.Env,
+		Message: substateRLP.Message,
+		Result:  substateRLP.Result,
+	}
+	if csubstateRLP.InputAlloc, err = db.newCompactAllocRLP(substateRLP.InputAlloc); err != nil {
+		return nil, err
+	}
+	if csubstateRLP.OutputAlloc, err = db.newCompactAllocRLP(substateRLP.OutputAlloc); err != nil {
+		return nil, err
+	}
+	value, err := rlp.EncodeToBytes(&csubstateRLP)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{compactSubstateVersion}, snappy.Encode(nil, value)...), nil
+}
+
+// decodeCompactSubstateRLP resolves the account states of a compact substate
+func (db *SubstateDB) decodeCompactSubstateRLP(csubstateRLP *compactSubstateRLP) (*SubstateRLP, error) {
+	substateRLP := SubstateRLP{
+		Env:     csubstateRLP.Env,
+		Message: csubstateRLP.Message,
+		Result:  csubstateRLP.Result,
+	}
+	if err := db.setCompactAllocRLP(&substateRLP.InputAlloc, csubstateRLP.InputAlloc); err != nil {
+		return nil, err
+	}
+	if err := db.setCompactAllocRLP(&substateRLP.OutputAlloc, csubstateRLP.OutputAlloc); err != nil {
+		return nil, err
+	}
+	return &substateRLP, nil
+}
+
+// EncodeSubstateRLP returns the value of a substateRLP in the given encoding,
+// storing the account states of compact substates
+func (db *SubstateDB) EncodeSubstateRLP(substateRLP *SubstateRLP, encoding string) ([]byte, error) {
+	switch encoding {
+	case CompactSubstateEncoding:
+		return db.encodeCompactSubstateRLP(substateRLP)
+	case LondonSubstateEncoding, "":
+		return rlp.EncodeToBytes(substateRLP)
+	default:
+		return nil, fmt.Errorf("cannot encode substates as %v", encoding)
+	}
+}
+
+// SubstateReferences returns the hashes of the code and the account states a
+// substate value refers to
+func (db *SubstateDB) SubstateReferences(value []byte) (codeHashes []common.Hash, stateHashes []common.Hash, err error) {
+	if csubstateRLP, cerr := decodeCompactSubstateRLP(value); cerr == nil {
+		for _, callocRLP := range []compactAllocRLP{csubstateRLP.InputAlloc, csubstateRLP.OutputAlloc} {
+			for _, caRLP := range callocRLP.Accounts {
+				if caRLP != nil && caRLP.StateHash != nil {
+					stateHashes = append(stateHashes, *caRLP.StateHash)
+				}
+			}
+		}
+	}
+	substateRLP, _, err := db.DecodeSubstateRLP(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	codeHashes, err = substateRLP.CodeHashes()
+	return codeHashes, stateHashes, err
+}
@@ -0,0 +1,148 @@
+package research
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newTestSubstate returns a substate calling testAddr2 from testAddr1 that
+// sets a slot of testAddr2 to value
+func newTestSubstate(value byte) *Substate {
+	to := testAddr2
+	inputAlloc := SubstateAlloc{
+		testAddr1: newTestAccount(1, 1000, nil, common.Hash{}),
+		testAddr2: newTestAccount(1, 0, []byte{0x60, 0x00}, common.Hash{}),
+	}
+	outputAlloc := SubstateAlloc{
+		testAddr1: newTestAccount(2, 900, nil, common.Hash{}),
+		testAddr2: newTestAccount(1, 0, []byte{0x60, 0x00}, common.BytesToHash([]byte{value})),
+	}
+	env := &SubstateEnv{
+		Coinbase:    testAddr1,
+		Difficulty:  big.NewInt(1),
+		GasLimit:    1000000,
+		Number:      100,
+		BlockHashes: map[uint64]common.Hash{},
+	}
+	msg := &SubstateMessage{
+		Nonce:     1,
+		GasPrice:  big.NewInt(1),
+		Gas:       50000,
+		From:      testAddr1,
+		To:        &to,
+		Value:     big.NewInt(0),
+		Data:      []byte{value},
+		GasFeeCap: big.NewInt(1),
+		GasTipCap: big.NewInt(1),
+	}
+	result := &SubstateResult{Status: 1, GasUsed: 100}
+	return NewSubstate(inputAlloc, outputAlloc, env, msg, result)
+}
+
+// countKeys returns the number of keys of db with the given prefix
+func countKeys(db *SubstateDB, prefix string) int {
+	it := db.backend.NewIterator([]byte(prefix), nil)
+	defer it.Release()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	return n
+}
+
+func TestCompactSubstateEncoding(t *testing.T) {
+	codeHash := crypto.Keccak256Hash([]byte{0x60, 0x00})
+	tests := []struct {
+		encoding        string
+		values          []byte // slot values of the substates put, one per tx
+		wantEncoding    string
+		wantStates      int // account states stored under stage1AccountPrefix
+		wantStateHashes int // account states referred to by the first substate
+	}{
+		{"", []byte{1}, LondonSubstateEncoding, 0, 0},
+		{LondonSubstateEncoding, []byte{1, 2}, LondonSubstateEncoding, 0, 0},
+		{CompactSubstateEncoding, []byte{1}, CompactSubstateEncoding, 1, 1},
+		{CompactSubstateEncoding, []byte{1, 1, 1}, CompactSubstateEncoding, 1, 1},
+		{CompactSubstateEncoding, []byte{1, 2, 1}, CompactSubstateEncoding, 2, 1},
+	}
+	for _, tt := range tests {
+		db := NewSubstateDB(rawdb.NewMemoryDatabase())
+		if tt.encoding != "" {
+			if err := db.SetEncoding(tt.encoding); err != nil {
+				t.Fatalf("%q: %v", tt.encoding, err)
+			}
+		}
+		for tx, value := range tt.values {
+			db.PutSubstate(100, tx, newTestSubstate(value))
+		}
+
+		for tx, value := range tt.values {
+			if got := db.GetSubstate(100, tx); !got.Equal(newTestSubstate(value)) {
+				t.Errorf("%q: substate 100_%d differs after decoding", tt.encoding, tx)
+			}
+		}
+		if n := countKeys(db, stage1AccountPrefix); n != tt.wantStates {
+			t.Errorf("%q: %d account states stored, want %d", tt.encoding, n, tt.wantStates)
+		}
+
+		value, err := db.backend.Get(Stage1SubstateKey(100, 0))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.encoding, err)
+		}
+		if _, encoding, err := db.DecodeSubstateRLP(value); err != nil || encoding != tt.wantEncoding {
+			t.Errorf("%q: decoded as %q (error %v), want %q", tt.encoding, encoding, err, tt.wantEncoding)
+		}
+		codeHashes, stateHashes, err := db.SubstateReferences(value)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.encoding, err)
+		}
+		if len(codeHashes) != 2 || codeHashes[0] != codeHash || codeHashes[1] != codeHash {
+			t.Errorf("%q: code references %v, want the code of %s twice", tt.encoding, codeHashes, testAddr2.Hex())
+		}
+		if len(stateHashes) != tt.wantStateHashes {
+			t.Errorf("%q: %d account state references, want %d", tt.encoding, len(stateHashes), tt.wantStateHashes)
+		}
+		for _, stateHash := range stateHashes {
+			if has, _ := db.backend.Has(Stage1AccountKey(stateHash)); !has {
+				t.Errorf("%q: account state %s is referred to but not stored", tt.encoding, stateHash.Hex())
+			}
+		}
+		db.Close()
+	}
+}
+
+func TestCompactSubstateMissingState(t *testing.T) {
+	db := NewSubstateDB(rawdb.NewMemoryDatabase())
+	if err := db.SetEncoding(CompactSubstateEncoding); err != nil {
+		t.Fatal(err)
+	}
+	db.PutSubstate(100, 0, newTestSubstate(1))
+
+	it := db.backend.NewIterator([]byte(stage1AccountPrefix), nil)
+	for it.Next() {
+		db.backend.Delete(common.CopyBytes(it.Key()))
+	}
+	it.Release()
+
+	value, _ := db.backend.Get(Stage1SubstateKey(100, 0))
+	if _, _, err := db.DecodeSubstateRLP(value); err == nil {
+		t.Errorf("decoded a compact substate whose account state is missing")
+	}
+	if _, stateHashes, err := db.SubstateReferences(value); err == nil || len(stateHashes) != 0 {
+		t.Errorf("references of a compact substate whose account state is missing: %v, error %v", stateHashes, err)
+	}
+}
+
+func TestCompactSubstateEncodingUnknown(t *testing.T) {
+	db := NewSubstateDB(rawdb.NewMemoryDatabase())
+	if err := db.SetEncoding("zip"); err == nil {
+		t.Errorf("SetEncoding accepted an unknown encoding")
+	}
+	if _, err := db.EncodeSubstateRLP(NewSubstateRLP(newTestSubstate(1)), BerlinSubstateEncoding); err == nil {
+		t.Errorf("EncodeSubstateRLP encoded substates as berlin")
+	}
+}
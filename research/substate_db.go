@@ -82,12 +82,28 @@ type BackendDatabase interface {
 
 type SubstateDB struct {
 	backend BackendDatabase
+
+	encoding string // encoding of the substates put into the DB
+
+	blockCache *blockCache // decoded substates of recently read blocks
 }
 
 func NewSubstateDB(backend BackendDatabase) *SubstateDB {
 	return &SubstateDB{backend: backend}
 }
 
+// SetEncoding sets the encoding of the substates put into the DB, london by
+// default
+func (db *SubstateDB) SetEncoding(encoding string) error {
+	switch encoding {
+	case LondonSubstateEncoding, CompactSubstateEncoding:
+		db.encoding = encoding
+		return nil
+	default:
+		return fmt.Errorf("cannot encode substates as %v", encoding)
+	}
+}
+
 func (db *SubstateDB) Compact(start []byte, limit []byte) error {
 	return db.backend.Compact(start, limit)
 }
@@ -144,45 +160,105 @@ func (db *SubstateDB) HasSubstate(block uint64, tx int) bool {
 	return has
 }
 
-func (db *SubstateDB) GetSubstate(block uint64, tx int) *Substate {
-	var err error
+// encodings of substateRLP, from the latest one
+const (
+	CompactSubstateEncoding = "compact"
+	LondonSubstateEncoding  = "london"
+	BerlinSubstateEncoding  = "berlin"
+	LegacySubstateEncoding  = "legacy"
+)
 
-	key := Stage1SubstateKey(block, tx)
-	value, err := db.backend.Get(key)
-	if err != nil {
-		panic(fmt.Errorf("record-replay: error getting substate %v_%v from substate DB: %v,", block, tx, err))
+// DecodeSubstateRLP decodes a substateRLP of any encoding, and returns the
+// encoding it was stored with
+func (db *SubstateDB) DecodeSubstateRLP(value []byte) (*SubstateRLP, string, error) {
+	// try decoding as compact substates
+	if len(value) > 0 && value[0] == compactSubstateVersion {
+		csubstateRLP, err := decodeCompactSubstateRLP(value)
+		if err != nil {
+			return nil, "", err
+		}
+		substateRLP, err := db.decodeCompactSubstateRLP(csubstateRLP)
+		if err != nil {
+			return nil, "", err
+		}
+		return substateRLP, CompactSubstateEncoding, nil
 	}
 
 	// try decoding as substates from latest hard forks
 	substateRLP := SubstateRLP{}
-	err = rlp.DecodeBytes(value, &substateRLP)
+	err := rlp.DecodeBytes(value, &substateRLP)
+	if err == nil {
+		return &substateRLP, LondonSubstateEncoding, nil
+	}
 
+	// try decoding as legacy substates between Berlin and London hard forks
+	berlinRLP := berlinSubstateRLP{}
+	err = rlp.DecodeBytes(value, &berlinRLP)
+	if err == nil {
+		substateRLP.setBerlinRLP(&berlinRLP)
+		return &substateRLP, BerlinSubstateEncoding, nil
+	}
+
+	// try decoding as legacy substates before Berlin hard fork
+	legacyRLP := legacySubstateRLP{}
+	err = rlp.DecodeBytes(value, &legacyRLP)
 	if err != nil {
-		// try decoding as legacy substates between Berlin and London hard forks
-		berlinRLP := berlinSubstateRLP{}
-		err = rlp.DecodeBytes(value, &berlinRLP)
-		if err == nil {
-			substateRLP.setBerlinRLP(&berlinRLP)
-		}
+		return nil, "", err
 	}
+	substateRLP.setLegacyRLP(&legacyRLP)
+	return &substateRLP, LegacySubstateEncoding, nil
+}
+
+func (db *SubstateDB) GetSubstate(block uint64, tx int) *Substate {
+	var err error
 
+	key := Stage1SubstateKey(block, tx)
+	value, err := db.backend.Get(key)
 	if err != nil {
-		// try decoding as legacy substates before Berlin hard fork
-		legacyRLP := legacySubstateRLP{}
-		err = rlp.DecodeBytes(value, &legacyRLP)
-		if err != nil {
-			panic(fmt.Errorf("error decoding substateRLP %v_%v: %v", block, tx, err))
-		}
-		substateRLP.setLegacyRLP(&legacyRLP)
+		panic(fmt.Errorf("record-replay: error getting substate %v_%v from substate DB: %v,", block, tx, err))
+	}
+
+	substateRLP, _, err := db.DecodeSubstateRLP(value)
+	if err != nil {
+		panic(fmt.Errorf("error decoding substateRLP %v_%v: %v", block, tx, err))
 	}
 
 	substate := Substate{}
-	substate.SetRLP(&substateRLP, db)
+	substate.SetRLP(substateRLP, db)
 
 	return &substate
 }
 
+// NewSubstateIterator iterates over the substateRLPs from the given block
+func (db *SubstateDB) NewSubstateIterator(block uint64) ethdb.Iterator {
+	start := Stage1SubstateBlockPrefix(block)[len(stage1SubstatePrefix):]
+	return db.backend.NewIterator([]byte(stage1SubstatePrefix), start)
+}
+
+// NewCodeIterator iterates over all the code
+func (db *SubstateDB) NewCodeIterator() ethdb.Iterator {
+	return db.backend.NewIterator([]byte(stage1CodePrefix), nil)
+}
+
+// NewAccountIterator iterates over all the account states of compact
+// substates
+func (db *SubstateDB) NewAccountIterator() ethdb.Iterator {
+	return db.backend.NewIterator([]byte(stage1AccountPrefix), nil)
+}
+
+// NewRawIterator iterates over all the keys of the DB
+func (db *SubstateDB) NewRawIterator() ethdb.Iterator {
+	return db.backend.NewIterator(nil, nil)
+}
+
 func (db *SubstateDB) GetBlockSubstates(block uint64) map[int]*Substate {
+	if db.blockCache != nil {
+		return db.getCachedBlockSubstates(block)
+	}
+	return db.decodeBlockSubstates(block)
+}
+
+func (db *SubstateDB) decodeBlockSubstates(block uint64) map[int]*Substate {
 	var err error
 
 	txSubstate := make(map[int]*Substate)
@@ -203,31 +279,13 @@ func (db *SubstateDB) GetBlockSubstates(block uint64) map[int]*Substate {
 			panic(fmt.Errorf("record-replay: GetBlockSubstates(%v) iterated substates from block %v", block, b))
 		}
 
-		// try decoding as substates from latest hard forks
-		substateRLP := SubstateRLP{}
-		err = rlp.DecodeBytes(value, &substateRLP)
-
-		if err != nil {
-			// try decoding as legacy substates between Berlin and London hard forks
-			berlinRLP := berlinSubstateRLP{}
-			err = rlp.DecodeBytes(value, &berlinRLP)
-			if err == nil {
-				substateRLP.setBerlinRLP(&berlinRLP)
-			}
-		}
-
+		substateRLP, _, err := db.DecodeSubstateRLP(value)
 		if err != nil {
-			// try decoding as legacy substates before Berlin hard fork
-			legacyRLP := legacySubstateRLP{}
-			err = rlp.DecodeBytes(value, &legacyRLP)
-			if err != nil {
-				panic(fmt.Errorf("error decoding substateRLP %v_%v: %v", block, tx, err))
-			}
-			substateRLP.setLegacyRLP(&legacyRLP)
+			panic(fmt.Errorf("error decoding substateRLP %v_%v: %v", block, tx, err))
 		}
 
 		substate := Substate{}
-		substate.SetRLP(&substateRLP, db)
+		substate.SetRLP(substateRLP, db)
 
 		txSubstate[tx] = &substate
 	}
@@ -262,7 +320,7 @@ func (db *SubstateDB) PutSubstate(block uint64, tx int, substate *Substate) {
 	}()
 
 	substateRLP := NewSubstateRLP(substate)
-	value, err := rlp.EncodeToBytes(substateRLP)
+	value, err := db.EncodeSubstateRLP(substateRLP, db.encoding)
 	if err != nil {
 		panic(err)
 	}
@@ -280,3 +338,18 @@ func (db *SubstateDB) DeleteSubstate(block uint64, tx int) {
 		panic(err)
 	}
 }
+
+// GetRaw returns the value of any key of the DB, as stored
+func (db *SubstateDB) GetRaw(key []byte) ([]byte, error) {
+	return db.backend.Get(key)
+}
+
+// PutRaw stores a value under any key of the DB, as is
+func (db *SubstateDB) PutRaw(key []byte, value []byte) error {
+	return db.backend.Put(key, value)
+}
+
+// DeleteRaw removes any key of the DB
+func (db *SubstateDB) DeleteRaw(key []byte) error {
+	return db.backend.Delete(key)
+}
@@ -0,0 +1,91 @@
+package research
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestStage1KeyRoundTrip(t *testing.T) {
+	block, tx, err := DecodeStage1SubstateKey(Stage1SubstateKey(100, 3))
+	if err != nil || block != 100 || tx != 3 {
+		t.Errorf("substate key decoded to %v_%v, %v, want 100_3", block, tx, err)
+	}
+	codeHash := CodeHash([]byte{0x60, 0x00})
+	if got, err := DecodeStage1CodeKey(Stage1CodeKey(codeHash)); err != nil || got != codeHash {
+		t.Errorf("code key decoded to %s, %v, want %s", got.Hex(), err, codeHash.Hex())
+	}
+
+	// keys of the other prefix or length are rejected
+	if _, _, err := DecodeStage1SubstateKey(Stage1CodeKey(codeHash)); err == nil {
+		t.Errorf("code key decoded as a substate key")
+	}
+	if _, err := DecodeStage1CodeKey(Stage1SubstateKey(100, 3)); err == nil {
+		t.Errorf("substate key decoded as a code key")
+	}
+	if _, _, err := DecodeStage1SubstateKey(Stage1SubstateBlockPrefix(100)); err == nil {
+		t.Errorf("block prefix decoded as a substate key")
+	}
+}
+
+func TestSubstateIterators(t *testing.T) {
+	db := NewSubstateDB(rawdb.NewMemoryDatabase())
+	for _, key := range [][2]int{{99, 0}, {100, 1}, {100, 0}, {101, 0}, {256, 2}} {
+		if err := db.PutRaw(Stage1SubstateKey(uint64(key[0]), key[1]), []byte{0x01}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	codes := [][]byte{{0x60, 0x00}, {0x60, 0x01}}
+	for _, code := range codes {
+		db.PutCode(code)
+	}
+
+	tests := []struct {
+		block uint64
+		want  []string
+	}{
+		{0, []string{"99_0", "100_0", "100_1", "101_0", "256_2"}},
+		{100, []string{"100_0", "100_1", "101_0", "256_2"}},
+		{102, []string{"256_2"}},
+		{257, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		iter := db.NewSubstateIterator(tt.block)
+		for iter.Next() {
+			block, tx, err := DecodeStage1SubstateKey(iter.Key())
+			if err != nil {
+				t.Fatalf("from block %v: %v", tt.block, err)
+			}
+			got = append(got, fmt.Sprintf("%v_%v", block, tx))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			t.Fatalf("from block %v: %v", tt.block, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("from block %v: iterated %v, want %v", tt.block, got, tt.want)
+		}
+	}
+
+	// only code is iterated, by hash
+	n := 0
+	iter := db.NewCodeIterator()
+	defer iter.Release()
+	for iter.Next() {
+		codeHash, err := DecodeStage1CodeKey(iter.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if CodeHash(iter.Value()) != codeHash || !(bytes.Equal(iter.Value(), codes[0]) || bytes.Equal(iter.Value(), codes[1])) {
+			t.Errorf("code %x under %s", iter.Value(), codeHash.Hex())
+		}
+		n++
+	}
+	if n != len(codes) {
+		t.Errorf("iterated %d codes, want %d", n, len(codes))
+	}
+}
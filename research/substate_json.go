@@ -1,7 +1,10 @@
 package research
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -148,7 +151,7 @@ func (env *SubstateEnv) SetJSON(envJSON *SubstateEnvJSON) {
 	}
 
 	env.BaseFee = (*big.Int)(envJSON.BaseFee)
-	if env.BaseFee.Cmp(big.NewInt(0)) == 0 {
+	if env.BaseFee != nil && env.BaseFee.Cmp(big.NewInt(0)) == 0 {
 		env.BaseFee = nil
 	}
 }
@@ -224,11 +227,11 @@ func (msg *SubstateMessage) SetJSON(msgJSON *SubstateMessageJSON) {
 	msg.AccessList = msgJSON.AccessList
 
 	msg.GasFeeCap = (*big.Int)(msgJSON.GasFeeCap)
-	if msg.GasFeeCap.Cmp(big.NewInt(0)) == 0 {
+	if msg.GasFeeCap == nil || msg.GasFeeCap.Cmp(big.NewInt(0)) == 0 {
 		msg.GasFeeCap = msg.GasPrice
 	}
 	msg.GasTipCap = (*big.Int)(msgJSON.GasTipCap)
-	if msg.GasTipCap.Cmp(big.NewInt(0)) == 0 {
+	if msg.GasTipCap == nil || msg.GasTipCap.Cmp(big.NewInt(0)) == 0 {
 		msg.GasTipCap = msg.GasPrice
 	}
 }
@@ -321,6 +324,10 @@ func NewSubstateJSON(substate *Substate) *SubstateJSON {
 }
 
 func (substate *Substate) SetJSON(substateJSON *SubstateJSON) {
+	substate.Env = &SubstateEnv{}
+	substate.Message = &SubstateMessage{}
+	substate.Result = &SubstateResult{}
+
 	substate.InputAlloc.SetJSON(substateJSON.InputAlloc)
 	substate.OutputAlloc.SetJSON(substateJSON.OutputAlloc)
 	substate.Env.SetJSON(substateJSON.Env)
@@ -345,3 +352,79 @@ func (substate *Substate) UnmarshalJSON(b []byte) error {
 
 	return nil
 }
+
+// SubstateEntryJSON is a substate of a transaction, as written by
+// substate-cli db export
+type SubstateEntryJSON struct {
+	Block    *uint64       `json:"block"`
+	Tx       *int          `json:"tx"`
+	Substate *SubstateJSON `json:"substate"`
+}
+
+// ToSubstate validates the entry, which must be complete to be encoded
+func (entry *SubstateEntryJSON) ToSubstate() (*Substate, error) {
+	if entry.Block == nil || entry.Tx == nil || *entry.Tx < 0 {
+		return nil, fmt.Errorf("missing block or tx")
+	}
+	substateJSON := entry.Substate
+	if substateJSON == nil || substateJSON.Env == nil || substateJSON.Message == nil || substateJSON.Result == nil {
+		return nil, fmt.Errorf("missing env, message or result")
+	}
+	for _, allocJSON := range []SubstateAllocJSON{substateJSON.InputAlloc, substateJSON.OutputAlloc} {
+		for addr, account := range allocJSON {
+			if account == nil || account.Balance == nil {
+				return nil, fmt.Errorf("missing balance of %s", addr.Hex())
+			}
+		}
+	}
+	if msg := substateJSON.Message; msg.GasPrice == nil || msg.Value == nil {
+		return nil, fmt.Errorf("missing gas price or value")
+	}
+	substate := &Substate{}
+	substate.SetJSON(substateJSON)
+	return substate, nil
+}
+
+// ReadSubstatesJSON calls fn for every substate entry of r, either a JSON
+// list (the json format) or a sequence of objects (the jsonl format)
+func ReadSubstatesJSON(r io.Reader, fn func(block uint64, tx int, substate *Substate) error) error {
+	reader := bufio.NewReader(r)
+	decoder := json.NewDecoder(reader)
+	if b, err := peekNonSpace(reader); err == nil && b == '[' {
+		if _, err = decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	for index := 0; decoder.More(); index++ {
+		var entry SubstateEntryJSON
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("error decoding substate #%v: %v", index, err)
+		}
+		substate, err := entry.ToSubstate()
+		if err != nil {
+			return fmt.Errorf("invalid substate #%v: %v", index, err)
+		}
+		if err = fn(*entry.Block, *entry.Tx, substate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peekNonSpace returns the first byte of the reader other than white space,
+// without consuming it
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
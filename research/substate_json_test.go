@@ -0,0 +1,113 @@
+package research
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// substateEntry returns the db export line of the substate of block_tx
+func substateEntry(t *testing.T, block uint64, tx int, substate *Substate) string {
+	data, err := json.Marshal(substate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf(`{"block":%d,"tx":%d,"substate":%s}`, block, tx, data)
+}
+
+func TestReadSubstatesJSON(t *testing.T) {
+	var (
+		entry1 = substateEntry(t, 100, 0, newTestSubstate(1))
+		entry2 = substateEntry(t, 101, 2, newTestSubstate(2))
+	)
+	type key struct {
+		block uint64
+		tx    int
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    []key
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "empty list", input: " [ ] "},
+		{name: "jsonl", input: entry1 + "\n" + entry2 + "\n", want: []key{{100, 0}, {101, 2}}},
+		{name: "json", input: "\n [" + entry1 + ",\n" + entry2 + "]\n", want: []key{{100, 0}, {101, 2}}},
+		{name: "truncated", input: entry1 + "\n" + entry2[:len(entry2)/2], want: []key{{100, 0}}, wantErr: "error decoding substate #1"},
+		{name: "missing block", input: `{"tx":0,"substate":{}}`, wantErr: "invalid substate #0: missing block or tx"},
+		{name: "negative tx", input: `{"block":1,"tx":-1,"substate":{}}`, wantErr: "invalid substate #0: missing block or tx"},
+		{name: "missing message", input: `{"block":1,"tx":0,"substate":{"env":{},"result":{}}}`, wantErr: "invalid substate #0: missing env, message or result"},
+		{name: "not an object", input: `[1]`, wantErr: "error decoding substate #0"},
+	}
+	for _, tt := range tests {
+		var got []key
+		err := ReadSubstatesJSON(strings.NewReader(tt.input), func(block uint64, tx int, substate *Substate) error {
+			if want := newTestSubstate(byte(len(got) + 1)); !substate.Equal(want) {
+				t.Errorf("%s: substate %d_%d differs from the exported one", tt.name, block, tx)
+			}
+			got = append(got, key{block, tx})
+			return nil
+		})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error %v, want %s", tt.name, err, tt.wantErr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: read %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadSubstatesJSONCallbackError(t *testing.T) {
+	input := substateEntry(t, 100, 0, newTestSubstate(1)) + substateEntry(t, 100, 1, newTestSubstate(1))
+	calls := 0
+	err := ReadSubstatesJSON(strings.NewReader(input), func(block uint64, tx int, substate *Substate) error {
+		calls++
+		return fmt.Errorf("stop")
+	})
+	if err == nil || err.Error() != "stop" || calls != 1 {
+		t.Errorf("error %v after %d calls, want stop after 1 call", err, calls)
+	}
+}
+
+func TestSubstateSetJSONDefaults(t *testing.T) {
+	var (
+		alloc  = `"inputAlloc":{},"outputAlloc":{}`
+		result = `"result":{"status":"0x1","logsBloom":"0x` + strings.Repeat("0", 512) + `","logs":[],"contractAddress":"0x0000000000000000000000000000000000000000","gasUsed":"0x5208"}`
+		msg    = `"message":{"nonce":"0x0","checkNonce":true,"gasPrice":"0x7","gas":"0x5208","from":"0x0000000000000000000000000000000000000001","to":null,"value":"0x0","input":"0x"%s}`
+		env    = `"env":{"coinbase":"0x0000000000000000000000000000000000000002","difficulty":"0x1","gasLimit":"0x1000000","number":"0x1","timestamp":"0x0"%s}`
+	)
+	tests := []struct {
+		name        string
+		envFields   string
+		msgFields   string
+		wantBaseFee *big.Int
+		wantFeeCap  int64
+		wantTipCap  int64
+	}{
+		{"before London", "", "", nil, 7, 7},
+		{"zero fees", `,"baseFee":"0x0"`, `,"gasFeeCap":"0x0","gasTipCap":"0x0"`, nil, 7, 7},
+		{"London", `,"baseFee":"0x3"`, `,"gasFeeCap":"0x5","gasTipCap":"0x2"`, big.NewInt(3), 5, 2},
+	}
+	for _, tt := range tests {
+		data := "{" + alloc + "," + fmt.Sprintf(env, tt.envFields) + "," + fmt.Sprintf(msg, tt.msgFields) + "," + result + "}"
+		substate := &Substate{}
+		if err := json.Unmarshal([]byte(data), substate); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := substate.Env.BaseFee; (got == nil) != (tt.wantBaseFee == nil) || got != nil && got.Cmp(tt.wantBaseFee) != 0 {
+			t.Errorf("%s: base fee %v, want %v", tt.name, got, tt.wantBaseFee)
+		}
+		if got := substate.Message.GasFeeCap; got.Cmp(big.NewInt(tt.wantFeeCap)) != 0 {
+			t.Errorf("%s: gas fee cap %v, want %v", tt.name, got, tt.wantFeeCap)
+		}
+		if got := substate.Message.GasTipCap; got.Cmp(big.NewInt(tt.wantTipCap)) != 0 {
+			t.Errorf("%s: gas tip cap %v, want %v", tt.name, got, tt.wantTipCap)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package research
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	stage1MetadataKey = "1m" // stage1MetadataKey -> metadata JSON
+
+	// SubstateSchemaVersion is the version of the DB layout: 1 for substates
+	// in the legacy, berlin and london encodings, 2 adds compact substates
+	SubstateSchemaVersion = 2
+)
+
+// BlockRange is an inclusive range of blocks
+type BlockRange struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+func (r BlockRange) String() string {
+	return fmt.Sprintf("%v-%v", r.First, r.Last)
+}
+
+// BlockRanges is a sorted list of disjoint, non-adjacent block ranges
+type BlockRanges []BlockRange
+
+func (ranges BlockRanges) String() string {
+	if len(ranges) == 0 {
+		return "none"
+	}
+	var s []string
+	for _, r := range ranges {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// Add returns the ranges with the blocks of r added
+func (ranges BlockRanges) Add(r BlockRange) BlockRanges {
+	all := append(append(BlockRanges{}, ranges...), r)
+	sort.Slice(all, func(i, j int) bool { return all[i].First < all[j].First })
+	var merged BlockRanges
+	for _, r := range all {
+		if n := len(merged); n > 0 && (merged[n-1].Last == ^uint64(0) || r.First <= merged[n-1].Last+1) {
+			if r.Last > merged[n-1].Last {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Remove returns the ranges with the blocks of r removed
+func (ranges BlockRanges) Remove(r BlockRange) BlockRanges {
+	var result BlockRanges
+	for _, x := range ranges {
+		if x.Last < r.First || x.First > r.Last {
+			result = append(result, x)
+			continue
+		}
+		if x.First < r.First {
+			result = append(result, BlockRange{First: x.First, Last: r.First - 1})
+		}
+		if x.Last > r.Last {
+			result = append(result, BlockRange{First: r.Last + 1, Last: x.Last})
+		}
+	}
+	return result
+}
+
+// Intersect returns the blocks of the ranges within r
+func (ranges BlockRanges) Intersect(r BlockRange) BlockRanges {
+	var result BlockRanges
+	for _, x := range ranges {
+		if x.Last < r.First || x.First > r.Last {
+			continue
+		}
+		if x.First < r.First {
+			x.First = r.First
+		}
+		if x.Last > r.Last {
+			x.Last = r.Last
+		}
+		result = append(result, x)
+	}
+	return result
+}
+
+// Missing returns the blocks of r not within the ranges
+func (ranges BlockRanges) Missing(r BlockRange) BlockRanges {
+	missing := BlockRanges{r}
+	for _, x := range ranges {
+		missing = missing.Remove(x)
+	}
+	return missing
+}
+
+// SubstateMetadata describes how the substates of a DB were recorded
+type SubstateMetadata struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	ChainID       *big.Int            `json:"chainId,omitempty"`
+	ChainConfig   *params.ChainConfig `json:"chainConfig,omitempty"`
+	ClientVersion string              `json:"clientVersion"`
+	Mode          string              `json:"mode"`              // how the substates were produced, e.g. geth import
+	Filters       []string            `json:"filters,omitempty"` // substates left out of the recorded ranges
+	Ranges        BlockRanges         `json:"ranges"`            // blocks whose substates are all recorded
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+// NewSubstateMetadata returns the metadata of a new DB with no ranges
+func NewSubstateMetadata(mode string) *SubstateMetadata {
+	return &SubstateMetadata{
+		SchemaVersion: SubstateSchemaVersion,
+		ClientVersion: params.VersionWithMeta,
+		Mode:          mode,
+		Ranges:        BlockRanges{},
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+// Copy returns a deep copy of the metadata
+func (md *SubstateMetadata) Copy() *SubstateMetadata {
+	cp := *md
+	cp.Filters = append([]string{}, md.Filters...)
+	cp.Ranges = append(BlockRanges{}, md.Ranges...)
+	return &cp
+}
+
+// Validate checks that the DB layout is supported
+func (md *SubstateMetadata) Validate() error {
+	if md.SchemaVersion > SubstateSchemaVersion {
+		return fmt.Errorf("substate DB schema version %v is newer than the supported version %v", md.SchemaVersion, SubstateSchemaVersion)
+	}
+	if md.SchemaVersion < 1 {
+		return fmt.Errorf("invalid substate DB schema version %v", md.SchemaVersion)
+	}
+	return nil
+}
+
+// Compatible checks that substates of other can be merged with md
+func (md *SubstateMetadata) Compatible(other *SubstateMetadata) error {
+	if md.ChainID != nil && other.ChainID != nil && md.ChainID.Cmp(other.ChainID) != 0 {
+		return fmt.Errorf("chain ID %v differs from chain ID %v", other.ChainID, md.ChainID)
+	}
+	return nil
+}
+
+// ValidateRange checks that the blocks first to last were recorded
+func (md *SubstateMetadata) ValidateRange(first, last uint64) error {
+	if missing := md.Ranges.Missing(BlockRange{First: first, Last: last}); len(missing) > 0 {
+		return fmt.Errorf("blocks %s were not recorded in the substate DB (recorded: %s)", missing, md.Ranges)
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata of the DB, or nil for DBs created before
+// metadata was recorded
+func (db *SubstateDB) GetMetadata() (*SubstateMetadata, error) {
+	key := []byte(stage1MetadataKey)
+	if has, err := db.backend.Has(key); err != nil || !has {
+		return nil, err
+	}
+	value, err := db.backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	md := &SubstateMetadata{}
+	if err = json.Unmarshal(value, md); err != nil {
+		return nil, fmt.Errorf("error decoding substate DB metadata: %v", err)
+	}
+	if err = md.Validate(); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// PutMetadata replaces the metadata of the DB
+func (db *SubstateDB) PutMetadata(md *SubstateMetadata) error {
+	md.SchemaVersion = SubstateSchemaVersion
+	value, err := json.MarshalIndent(md, "", " ")
+	if err != nil {
+		return err
+	}
+	return db.backend.Put([]byte(stage1MetadataKey), value)
+}
+
+// IsMetadataKey tells whether key is the metadata of the DB
+func IsMetadataKey(key []byte) bool {
+	return string(key) == stage1MetadataKey
+}
+
+// ValidateRange checks that the blocks first to last were recorded in the
+// DB. DBs without metadata are accepted with a warning.
+func (db *SubstateDB) ValidateRange(first, last uint64) error {
+	md, err := db.GetMetadata()
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		fmt.Fprintf(os.Stderr, "record-replay: warning: substate DB has no metadata, missing blocks are read as empty\n")
+		return nil
+	}
+	return md.ValidateRange(first, last)
+}
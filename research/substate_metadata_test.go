@@ -0,0 +1,106 @@
+package research
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestBlockRangesAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges BlockRanges
+		add    BlockRange
+		want   BlockRanges
+	}{
+		{"empty", nil, BlockRange{5, 10}, BlockRanges{{5, 10}}},
+		{"disjoint before", BlockRanges{{5, 10}}, BlockRange{1, 2}, BlockRanges{{1, 2}, {5, 10}}},
+		{"disjoint after", BlockRanges{{5, 10}}, BlockRange{20, 30}, BlockRanges{{5, 10}, {20, 30}}},
+		{"adjacent", BlockRanges{{5, 10}}, BlockRange{11, 12}, BlockRanges{{5, 12}}},
+		{"overlapping", BlockRanges{{5, 10}}, BlockRange{8, 15}, BlockRanges{{5, 15}}},
+		{"contained", BlockRanges{{5, 10}}, BlockRange{6, 7}, BlockRanges{{5, 10}}},
+		{"bridging", BlockRanges{{1, 2}, {5, 10}}, BlockRange{3, 4}, BlockRanges{{1, 10}}},
+		{"covering", BlockRanges{{1, 2}, {5, 10}}, BlockRange{0, 20}, BlockRanges{{0, 20}}},
+		{"single block", BlockRanges{{100, 102}}, BlockRange{200, 200}, BlockRanges{{100, 102}, {200, 200}}},
+		{"max block", BlockRanges{{0, ^uint64(0)}}, BlockRange{5, 6}, BlockRanges{{0, ^uint64(0)}}},
+	}
+	for _, tt := range tests {
+		if got := tt.ranges.Add(tt.add); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s add %s = %s, want %s", tt.name, tt.ranges, tt.add, got, tt.want)
+		}
+	}
+}
+
+func TestBlockRangesRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges BlockRanges
+		remove BlockRange
+		want   BlockRanges
+	}{
+		{"empty", nil, BlockRange{5, 10}, nil},
+		{"disjoint", BlockRanges{{5, 10}}, BlockRange{11, 20}, BlockRanges{{5, 10}}},
+		{"all", BlockRanges{{5, 10}}, BlockRange{5, 10}, nil},
+		{"head", BlockRanges{{5, 10}}, BlockRange{0, 6}, BlockRanges{{7, 10}}},
+		{"tail", BlockRanges{{5, 10}}, BlockRange{9, 20}, BlockRanges{{5, 8}}},
+		{"middle", BlockRanges{{5, 10}}, BlockRange{7, 8}, BlockRanges{{5, 6}, {9, 10}}},
+		{"across ranges", BlockRanges{{1, 5}, {10, 15}}, BlockRange{4, 11}, BlockRanges{{1, 3}, {12, 15}}},
+	}
+	for _, tt := range tests {
+		if got := tt.ranges.Remove(tt.remove); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s remove %s = %s, want %s", tt.name, tt.ranges, tt.remove, got, tt.want)
+		}
+	}
+}
+
+func TestBlockRangesMissing(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges BlockRanges
+		r      BlockRange
+		want   BlockRanges
+	}{
+		{"none recorded", nil, BlockRange{5, 10}, BlockRanges{{5, 10}}},
+		{"all recorded", BlockRanges{{0, 100}}, BlockRange{5, 10}, nil},
+		{"exactly recorded", BlockRanges{{5, 10}}, BlockRange{5, 10}, nil},
+		{"gap", BlockRanges{{0, 6}, {9, 20}}, BlockRange{5, 10}, BlockRanges{{7, 8}}},
+		{"both ends", BlockRanges{{100, 102}}, BlockRange{0, 300}, BlockRanges{{0, 99}, {103, 300}}},
+	}
+	for _, tt := range tests {
+		if got := tt.ranges.Missing(tt.r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s missing of %s = %s, want %s", tt.name, tt.ranges, tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		ranges      BlockRanges // nil for a DB without metadata
+		first, last uint64
+		wantErr     bool
+	}{
+		{"no metadata", nil, 0, 1000, false},
+		{"recorded", BlockRanges{{100, 102}}, 100, 102, false},
+		{"single recorded block", BlockRanges{{100, 102}}, 101, 101, false},
+		{"unrecorded block", BlockRanges{{100, 102}}, 200, 200, true},
+		{"partly recorded", BlockRanges{{100, 102}}, 101, 103, true},
+		{"gap", BlockRanges{{100, 102}, {104, 110}}, 100, 110, true},
+		{"no ranges", BlockRanges{}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		db := NewSubstateDB(rawdb.NewMemoryDatabase())
+		if tt.ranges != nil {
+			md := NewSubstateMetadata("test")
+			md.Ranges = tt.ranges
+			if err := db.PutMetadata(md); err != nil {
+				t.Fatalf("%s: error putting metadata: %v", tt.name, err)
+			}
+		}
+		if err := db.ValidateRange(tt.first, tt.last); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateRange(%d, %d) error = %v, want error %v", tt.name, tt.first, tt.last, err, tt.wantErr)
+		}
+		db.Close()
+	}
+}
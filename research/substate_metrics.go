@@ -0,0 +1,125 @@
+package research
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/exp"
+	"github.com/ethereum/go-ethereum/metrics/influxdb"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Metrics are collected with --metrics, which the metrics package reads from
+// the command line before the metrics below are created, as in geth.
+var (
+	MetricsEnabledFlag = cli.BoolFlag{
+		Name:  "metrics",
+		Usage: "Enable metrics collection and reporting",
+	}
+	MetricsHTTPFlag = cli.StringFlag{
+		Name:  "metrics.addr",
+		Usage: "Enable stand-alone metrics HTTP server listening interface, serving /debug/metrics and /debug/metrics/prometheus",
+		Value: metrics.DefaultConfig.HTTP,
+	}
+	MetricsPortFlag = cli.IntFlag{
+		Name:  "metrics.port",
+		Usage: "Metrics HTTP server listening port",
+		Value: metrics.DefaultConfig.Port,
+	}
+	MetricsEnableInfluxDBFlag = cli.BoolFlag{
+		Name:  "metrics.influxdb",
+		Usage: "Enable metrics export/push to an external InfluxDB database",
+	}
+	MetricsInfluxDBEndpointFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.endpoint",
+		Usage: "InfluxDB API endpoint to report metrics to",
+		Value: metrics.DefaultConfig.InfluxDBEndpoint,
+	}
+	MetricsInfluxDBDatabaseFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.database",
+		Usage: "InfluxDB database name to push reported metrics to",
+		Value: metrics.DefaultConfig.InfluxDBDatabase,
+	}
+	MetricsInfluxDBUsernameFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.username",
+		Usage: "Username to authorize access to the database",
+		Value: metrics.DefaultConfig.InfluxDBUsername,
+	}
+	MetricsInfluxDBPasswordFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.password",
+		Usage: "Password to authorize access to the database",
+		Value: metrics.DefaultConfig.InfluxDBPassword,
+	}
+	MetricsInfluxDBTagsFlag = cli.StringFlag{
+		Name:  "metrics.influxdb.tags",
+		Usage: "Comma-separated InfluxDB tags (key/values) attached to all measurements",
+		Value: metrics.DefaultConfig.InfluxDBTags,
+	}
+
+	// MetricsFlags are the flags of the commands running a SubstateTaskPool
+	MetricsFlags = []cli.Flag{
+		MetricsEnabledFlag,
+		MetricsHTTPFlag,
+		MetricsPortFlag,
+		MetricsEnableInfluxDBFlag,
+		MetricsInfluxDBEndpointFlag,
+		MetricsInfluxDBDatabaseFlag,
+		MetricsInfluxDBUsernameFlag,
+		MetricsInfluxDBPasswordFlag,
+		MetricsInfluxDBTagsFlag,
+	}
+)
+
+var (
+	taskBlockCounter   = metrics.NewRegisteredCounter("substate/task/blocks", nil)
+	taskTxCounter      = metrics.NewRegisteredCounter("substate/task/txs", nil)
+	taskBlockTimer     = metrics.NewRegisteredTimer("substate/task/block", nil)
+	taskWorkersGauge   = metrics.NewRegisteredGauge("substate/task/workers", nil)
+	taskBusyGauge      = metrics.NewRegisteredGauge("substate/task/workers/busy", nil)
+	blockCacheHitMeter = metrics.NewRegisteredMeter("substate/blockcache/hits", nil)
+	blockCacheMisMeter = metrics.NewRegisteredMeter("substate/blockcache/misses", nil)
+)
+
+// SetupMetrics starts the exporters of the metrics set by the flags
+func SetupMetrics(ctx *cli.Context) error {
+	if !metrics.Enabled {
+		if ctx.IsSet(MetricsHTTPFlag.Name) || ctx.Bool(MetricsEnableInfluxDBFlag.Name) {
+			return fmt.Errorf("--%s and --%s require --%s", MetricsHTTPFlag.Name, MetricsEnableInfluxDBFlag.Name, MetricsEnabledFlag.Name)
+		}
+		return nil
+	}
+	fmt.Println("record-replay: metrics enabled")
+	go metrics.CollectProcessMetrics(3 * time.Second)
+
+	if ctx.Bool(MetricsEnableInfluxDBFlag.Name) {
+		var (
+			endpoint = ctx.String(MetricsInfluxDBEndpointFlag.Name)
+			database = ctx.String(MetricsInfluxDBDatabaseFlag.Name)
+			username = ctx.String(MetricsInfluxDBUsernameFlag.Name)
+			password = ctx.String(MetricsInfluxDBPasswordFlag.Name)
+			tags     = splitTagsFlag(ctx.String(MetricsInfluxDBTagsFlag.Name))
+		)
+		fmt.Printf("record-replay: exporting metrics to InfluxDB %s\n", endpoint)
+		go influxdb.InfluxDBWithTags(metrics.DefaultRegistry, 10*time.Second, endpoint, database, username, password, "substate.", tags)
+	}
+
+	if ctx.IsSet(MetricsHTTPFlag.Name) {
+		address := fmt.Sprintf("%s:%d", ctx.String(MetricsHTTPFlag.Name), ctx.Int(MetricsPortFlag.Name))
+		fmt.Printf("record-replay: serving metrics on http://%s/debug/metrics/prometheus\n", address)
+		exp.Setup(address)
+	}
+	return nil
+}
+
+// splitTagsFlag parses the key=value pairs of --metrics.influxdb.tags
+func splitTagsFlag(tagsFlag string) map[string]string {
+	tags := make(map[string]string)
+	for _, t := range strings.Split(tagsFlag, ",") {
+		if kv := strings.Split(t, "="); len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return tags
+}
@@ -1,6 +1,7 @@
 package research
 
 import (
+	"fmt"
 	"math/big"
 	"sort"
 
@@ -407,3 +408,31 @@ func (substate *Substate) SetRLP(substateRLP *SubstateRLP, db *SubstateDB) {
 	substate.Message.SetRLP(substateRLP.Message, db)
 	substate.Result.SetRLP(substateRLP.Result, db)
 }
+
+// CodeHashes returns the hashes of the code referenced by a substateRLP,
+// except the empty code which is never stored
+func (substateRLP *SubstateRLP) CodeHashes() ([]common.Hash, error) {
+	var codeHashes []common.Hash
+	for _, allocRLP := range []SubstateAllocRLP{substateRLP.InputAlloc, substateRLP.OutputAlloc} {
+		if len(allocRLP.Addresses) != len(allocRLP.Accounts) {
+			return nil, fmt.Errorf("%v addresses for %v accounts in alloc", len(allocRLP.Addresses), len(allocRLP.Accounts))
+		}
+		for _, saRLP := range allocRLP.Accounts {
+			if saRLP == nil {
+				return nil, fmt.Errorf("nil account in alloc")
+			}
+			if saRLP.CodeHash != EmptyCodeHash {
+				codeHashes = append(codeHashes, saRLP.CodeHash)
+			}
+		}
+	}
+	if msgRLP := substateRLP.Message; msgRLP != nil && msgRLP.To == nil {
+		if msgRLP.InitCodeHash == nil {
+			return nil, fmt.Errorf("no init code hash in contract creation")
+		}
+		if *msgRLP.InitCodeHash != EmptyCodeHash {
+			codeHashes = append(codeHashes, *msgRLP.InitCodeHash)
+		}
+	}
+	return codeHashes, nil
+}
@@ -0,0 +1,81 @@
+package research
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSubstateRLPCodeHashes(t *testing.T) {
+	var (
+		code1    = []byte{0x60, 0x00}
+		code2    = []byte{0x60, 0x01}
+		initCode = []byte{0x60, 0x02}
+		empty    = EmptyCodeHash
+	)
+	alloc := func(codes ...[]byte) SubstateAllocRLP {
+		allocRLP := SubstateAllocRLP{}
+		for i, code := range codes {
+			allocRLP.Addresses = append(allocRLP.Addresses, common.BigToAddress(big.NewInt(int64(i))))
+			allocRLP.Accounts = append(allocRLP.Accounts, NewSubstateAccountRLP(newTestAccount(1, 0, code, common.Hash{})))
+		}
+		return allocRLP
+	}
+	call := &SubstateMessageRLP{To: &testAddr2}
+	creation := func(codeHash *common.Hash) *SubstateMessageRLP {
+		return &SubstateMessageRLP{InitCodeHash: codeHash}
+	}
+	initCodeHash := CodeHash(initCode)
+
+	tests := []struct {
+		name    string
+		rlp     *SubstateRLP
+		want    []common.Hash
+		wantErr bool
+	}{
+		{
+			name: "input and output code",
+			rlp:  &SubstateRLP{InputAlloc: alloc(code1, nil), OutputAlloc: alloc(code1, code2), Message: call},
+			want: []common.Hash{CodeHash(code1), CodeHash(code1), CodeHash(code2)},
+		},
+		{
+			name: "creation",
+			rlp:  &SubstateRLP{InputAlloc: alloc(nil), OutputAlloc: alloc(code1), Message: creation(&initCodeHash)},
+			want: []common.Hash{CodeHash(code1), initCodeHash},
+		},
+		{
+			name: "creation without init code",
+			rlp:  &SubstateRLP{Message: creation(&empty)},
+		},
+		{
+			name:    "creation without init code hash",
+			rlp:     &SubstateRLP{Message: creation(nil)},
+			wantErr: true,
+		},
+		{
+			name:    "addresses without accounts",
+			rlp:     &SubstateRLP{InputAlloc: SubstateAllocRLP{Addresses: []common.Address{testAddr1}}, Message: call},
+			wantErr: true,
+		},
+		{
+			name: "nil account",
+			rlp: &SubstateRLP{
+				OutputAlloc: SubstateAllocRLP{Addresses: []common.Address{testAddr1}, Accounts: []*SubstateAccountRLP{nil}},
+				Message:     call,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.rlp.CodeHashes()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: code hashes %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -16,6 +16,11 @@ var (
 		Usage: "Number of worker threads that execute in parallel",
 		Value: 4,
 	}
+	PrefetchFlag = cli.IntFlag{
+		Name:  "prefetch",
+		Usage: "Number of blocks whose substates are decoded into the block cache ahead of the workers (0 to disable)",
+		Value: 32,
+	}
 	SkipTransferTxsFlag = cli.BoolFlag{
 		Name:  "skip-transfer-txs",
 		Usage: "Skip executing transactions that only transfer ETH",
@@ -44,6 +49,60 @@ var (
 		Name:  "skip-hook",
 		Usage: "Skip HOOK MR",
 	}
+	HookSitesFlag = cli.StringFlag{
+		Name:  "hook-sites",
+		Usage: "External call sites to inject the HOOK message at: all, first, last or comma-separated indices",
+		Value: "all",
+	}
+	SkipRoReentrancyFlag = cli.BoolFlag{
+		Name:  "skip-ro-reentrancy",
+		Usage: "Skip RO-REENTRANCY MR",
+	}
+	SenderRolesFlag = cli.StringFlag{
+		Name:  "sender-roles",
+		Usage: "Sender roles of additional messages, tried from the least privileged one: comma-separated attacker, victim and privileged",
+		Value: "attacker,victim,privileged",
+	}
+	SkipSandwichFlag = cli.BoolFlag{
+		Name:  "skip-sandwich",
+		Usage: "Skip SANDWICH MR",
+	}
+	SkipCrossBlockFlag = cli.BoolFlag{
+		Name:  "skip-cross-block",
+		Usage: "Skip CROSS-BLOCK MR",
+	}
+	SkipInitFlag = cli.BoolFlag{
+		Name:  "skip-init",
+		Usage: "Skip INIT-FRONTRUN MR",
+	}
+	SkipMinimizeFlag = cli.BoolFlag{
+		Name:  "skip-minimize",
+		Usage: "Skip minimizing TOD and HOOK findings",
+	}
+	MaxMsgsPerTxFlag = cli.IntFlag{
+		Name:  "max-msgs-per-tx",
+		Usage: "Maximum number of additional messages replayed per transaction by each MR, spread over functions by priority (0 for unlimited)",
+	}
+	TimePerTxFlag = cli.DurationFlag{
+		Name:  "time-per-tx",
+		Usage: "Time budget of the MRs of a transaction, e.g. 30s (0 for unlimited)",
+	}
+	TotalTimeFlag = cli.DurationFlag{
+		Name:  "total-time",
+		Usage: "Time budget of the whole run, after which remaining transactions are skipped, e.g. 2h (0 for unlimited)",
+	}
+	SkipCoverageFlag = cli.BoolFlag{
+		Name:  "skip-coverage",
+		Usage: "Skip recording the branch coverage that guides message generation",
+	}
+	StrictOracleFlag = cli.BoolFlag{
+		Name:  "strict-oracle",
+		Usage: "Compare full post-state, logs, return data and revert status in SI checks",
+	}
+	FlashLoanFlag = cli.BoolFlag{
+		Name:  "flash-loan",
+		Usage: "Lend generated attackers a large balance of every inner token before replaying their messages",
+	}
 	RichInfoFlag = cli.BoolFlag{
 		Name:  "rich-info",
 		Usage: "Rich Substate",
@@ -68,15 +127,33 @@ type SubstateTaskPool struct {
 	Last  uint64
 
 	Workers  int
+	Prefetch int // blocks decoded ahead of the workers
 	RichInfo bool
 	SkipEnv  bool
 	SkipTod  bool
 	SkipMani bool
 	SkipHook bool
 
+	SkipRoReentrancy bool
+	SkipSandwich     bool
+	SkipCrossBlock   bool
+	SkipInit         bool
+	SkipMinimize     bool
+	SkipCoverage     bool
+	StrictOracle     bool
+	FlashLoan        bool
+	HookSites        string
+	SenderRoles      string
+
+	MaxMsgsPerTx int
+	TimePerTx    time.Duration
+	TotalTime    time.Duration
+
 	Gigahorse string
 	DappDir   string
 
+	IncludeCreate bool // pass CREATE transactions to TaskFunc
+
 	Ctx *cli.Context // CLI context required to read additional flags
 
 	DB *SubstateDB
@@ -91,12 +168,28 @@ func NewSubstateTaskPool(name string, taskFunc SubstateTaskFunc, first, last uin
 		Last:  last,
 
 		Workers:  ctx.Int(WorkersFlag.Name),
+		Prefetch: ctx.Int(PrefetchFlag.Name),
 		SkipEnv:  ctx.Bool(SkipEnvFlag.Name),
 		SkipTod:  ctx.Bool(SkipTodFlag.Name),
 		SkipMani: ctx.Bool(SkipManiFlag.Name),
 		SkipHook: ctx.Bool(SkipHookFlag.Name),
 		RichInfo: ctx.Bool(RichInfoFlag.Name),
 
+		SkipRoReentrancy: ctx.Bool(SkipRoReentrancyFlag.Name),
+		SkipSandwich:     ctx.Bool(SkipSandwichFlag.Name),
+		SkipCrossBlock:   ctx.Bool(SkipCrossBlockFlag.Name),
+		SkipInit:         ctx.Bool(SkipInitFlag.Name),
+		SkipMinimize:     ctx.Bool(SkipMinimizeFlag.Name),
+		SkipCoverage:     ctx.Bool(SkipCoverageFlag.Name),
+		StrictOracle:     ctx.Bool(StrictOracleFlag.Name),
+		FlashLoan:        ctx.Bool(FlashLoanFlag.Name),
+		HookSites:        ctx.String(HookSitesFlag.Name),
+		SenderRoles:      ctx.String(SenderRolesFlag.Name),
+
+		MaxMsgsPerTx: ctx.Int(MaxMsgsPerTxFlag.Name),
+		TimePerTx:    ctx.Duration(TimePerTxFlag.Name),
+		TotalTime:    ctx.Duration(TotalTimeFlag.Name),
+
 		Gigahorse: ctx.String(GigahorseFlag.Name),
 		DappDir:   ctx.String(DappDirFlag.Name),
 
@@ -118,7 +211,7 @@ func (pool *SubstateTaskPool) ExecuteBlock(block uint64) (numTx int64, err error
 			if account, exist := alloc[*to]; !exist || len(account.Code) == 0 {
 				continue
 			}
-		} else {
+		} else if !pool.IncludeCreate {
 			// skip CREATE transactions
 			continue
 		}
@@ -141,6 +234,7 @@ func (pool *SubstateTaskPool) Execute() error {
 	start := time.Now()
 
 	var totalNumBlock, totalNumTx int64
+	startHits, startMisses := pool.DB.BlockCacheStats()
 	defer func() {
 		duration := time.Since(start) + 1*time.Nanosecond
 		sec := duration.Seconds()
@@ -152,6 +246,7 @@ func (pool *SubstateTaskPool) Execute() error {
 		fmt.Printf("%s: total #block = %v\n", pool.Name, nb)
 		fmt.Printf("%s: total #tx    = %v\n", pool.Name, nt)
 		fmt.Printf("%s: %.2f blk/s, %.2f tx/s\n", pool.Name, blkPerSec, txPerSec)
+		pool.printBlockCacheStats(startHits, startMisses)
 		fmt.Printf("%s done in %v\n", pool.Name, duration.Round(1*time.Millisecond))
 	}()
 
@@ -164,16 +259,26 @@ func (pool *SubstateTaskPool) Execute() error {
 	fmt.Printf("%s: block range = %v %v\n", pool.Name, pool.First, pool.Last)
 	fmt.Printf("%s: #CPU = %v, #worker = %v\n", pool.Name, runtime.NumCPU(), pool.Workers)
 
+	if err := pool.DB.ValidateRange(pool.First, pool.Last); err != nil {
+		return fmt.Errorf("%s: %v", pool.Name, err)
+	}
+
+	taskWorkersGauge.Update(int64(pool.Workers))
+
+	// one past the highest block received by a worker
+	started := pool.First
+
 	workChan := make(chan uint64, pool.Workers*10)
 	doneChan := make(chan interface{}, pool.Workers*10)
-	stopChan := make(chan struct{}, pool.Workers)
+	stopChan := make(chan struct{}, pool.Workers+2)
 	wg := sync.WaitGroup{}
 	defer func() {
 		// stop all workers
 		for i := 0; i < pool.Workers; i++ {
 			stopChan <- struct{}{}
 		}
-		// stop work producer (1)
+		// stop work producer (1) and prefetcher (1)
+		stopChan <- struct{}{}
 		stopChan <- struct{}{}
 
 		wg.Wait()
@@ -191,9 +296,21 @@ func (pool *SubstateTaskPool) Execute() error {
 				select {
 
 				case block := <-workChan:
+					for {
+						next := atomic.LoadUint64(&started)
+						if block < next || atomic.CompareAndSwapUint64(&started, next, block+1) {
+							break
+						}
+					}
+					taskBusyGauge.Inc(1)
+					blockStart := time.Now()
 					nt, err := pool.ExecuteBlock(block)
+					taskBlockTimer.UpdateSince(blockStart)
+					taskBusyGauge.Dec(1)
 					atomic.AddInt64(&totalNumTx, nt)
 					atomic.AddInt64(&totalNumBlock, 1)
+					taskTxCounter.Inc(nt)
+					taskBlockCounter.Inc(1)
 					if err != nil {
 						doneChan <- err
 					} else {
@@ -208,6 +325,33 @@ func (pool *SubstateTaskPool) Execute() error {
 		}()
 	}
 
+	// decode upcoming blocks into the block cache ahead of the workers
+	if pool.Prefetch > 0 && pool.DB.HasBlockCache() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for block := pool.First; block <= pool.Last; block++ {
+				// workers decode the blocks they already received
+				if next := atomic.LoadUint64(&started); block < next {
+					block = next
+				}
+				for block >= atomic.LoadUint64(&started)+uint64(pool.Prefetch) {
+					select {
+					case <-ticker.C:
+					case <-stopChan:
+						return
+					}
+				}
+				if block <= pool.Last {
+					pool.DB.PrefetchBlockSubstates(block)
+				}
+			}
+		}()
+	}
+
 	// wait until all workers finish all tasks
 	wg.Add(1)
 	go func() {
@@ -253,6 +397,7 @@ func (pool *SubstateTaskPool) Execute() error {
 			txPerSec := float64(nt-lastNumTx) / (sec - lastSec)
 			fmt.Printf("%s: elapsed time: %v, number = %v\n", pool.Name, duration.Round(1*time.Millisecond), block)
 			fmt.Printf("%s: %.2f blk/s, %.2f tx/s\n", pool.Name, blkPerSec, txPerSec)
+			pool.printBlockCacheStats(startHits, startMisses)
 
 			lastSec, lastNumBlock, lastNumTx = sec, nb, nt
 		}
@@ -276,6 +421,21 @@ func (pool *SubstateTaskPool) Execute() error {
 	return nil
 }
 
+// printBlockCacheStats prints the hit rate of the block cache since Execute
+// started
+func (pool *SubstateTaskPool) printBlockCacheStats(startHits, startMisses int64) {
+	if !pool.DB.HasBlockCache() {
+		return
+	}
+	hits, misses := pool.DB.BlockCacheStats()
+	hits, misses = hits-startHits, misses-startMisses
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses) * 100
+	}
+	fmt.Printf("%s: block cache hits = %v, misses = %v, hit rate = %.2f%%\n", pool.Name, hits, misses, hitRate)
+}
+
 // // obtain a rich substate for taskPool
 // func (pool *SubstateTaskPool) InitRichSubstates(_addr2blocks map[string]([]uint64)) error {
 // 	Addr2Block = make(map[string][]uint64)
@@ -0,0 +1,71 @@
+package research
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestSubstateTaskPoolExecute(t *testing.T) {
+	tests := []struct {
+		name        string
+		first, last uint64
+		workers     int
+		prefetch    int
+		blockCache  int
+	}{
+		{"single worker", 0, 20, 1, 0, 0},
+		{"workers", 0, 20, 4, 0, 0},
+		{"block cache", 5, 30, 4, 0, 8},
+		{"prefetch from block 0", 0, 30, 4, 4, 8},
+		{"prefetch", 10, 60, 8, 16, 32},
+		{"single block", 7, 7, 4, 4, 8},
+	}
+	for _, tt := range tests {
+		db := NewSubstateDB(rawdb.NewMemoryDatabase())
+		for block := tt.first; block <= tt.last; block++ {
+			db.PutSubstate(block, 0, newTestSubstate(byte(block)))
+		}
+		if err := db.SetBlockCache(tt.blockCache); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var (
+			lock   sync.Mutex
+			counts = make(map[uint64]int)
+		)
+		pool := &SubstateTaskPool{
+			Name: "test",
+			TaskFunc: func(block uint64, tx int, substate *Substate, taskPool *SubstateTaskPool) error {
+				if !substate.Equal(newTestSubstate(byte(block))) {
+					t.Errorf("%s: substate %d_%d differs", tt.name, block, tx)
+				}
+				lock.Lock()
+				counts[block]++
+				lock.Unlock()
+				return nil
+			},
+			First:    tt.first,
+			Last:     tt.last,
+			Workers:  tt.workers,
+			Prefetch: tt.prefetch,
+			DB:       db,
+		}
+		if err := pool.Execute(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(counts) != int(tt.last-tt.first+1) {
+			t.Errorf("%s: %d blocks executed, want %d", tt.name, len(counts), tt.last-tt.first+1)
+		}
+		for block, n := range counts {
+			if n != 1 {
+				t.Errorf("%s: block %d executed %d times", tt.name, block, n)
+			}
+		}
+		if hits, misses := db.BlockCacheStats(); tt.blockCache > 0 && hits+misses != int64(len(counts)) {
+			t.Errorf("%s: %d cache hits and %d misses for %d blocks", tt.name, hits, misses, len(counts))
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,154 @@
+package research
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testAddr1 = common.BytesToAddress([]byte("account1"))
+	testAddr2 = common.BytesToAddress([]byte("account2"))
+	testSlot  = common.BytesToHash([]byte("slot"))
+)
+
+// newTestAccount returns an account with the given storage slot value, if
+// not zero
+func newTestAccount(nonce uint64, balance int64, code []byte, value common.Hash) *SubstateAccount {
+	account := NewSubstateAccount(nonce, big.NewInt(balance), code)
+	if value != (common.Hash{}) {
+		account.Storage[testSlot] = value
+	}
+	return account
+}
+
+func TestSubstateAllocStrictStateEqual(t *testing.T) {
+	var (
+		value1 = common.BytesToHash([]byte{1})
+		value2 = common.BytesToHash([]byte{2})
+		code   = []byte{0x60, 0x00}
+	)
+	tests := []struct {
+		name     string
+		x, y     SubstateAlloc
+		want     bool
+		wantAddr common.Address
+	}{
+		{
+			name: "equal",
+			x:    SubstateAlloc{testAddr1: newTestAccount(1, 10, code, value1)},
+			y:    SubstateAlloc{testAddr1: newTestAccount(1, 10, code, value1)},
+			want: true,
+		},
+		{
+			name:     "balance",
+			x:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			y:        SubstateAlloc{testAddr1: newTestAccount(1, 11, nil, common.Hash{})},
+			wantAddr: testAddr1,
+		},
+		{
+			name:     "nonce",
+			x:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			y:        SubstateAlloc{testAddr1: newTestAccount(2, 10, nil, common.Hash{})},
+			wantAddr: testAddr1,
+		},
+		{
+			name:     "code",
+			x:        SubstateAlloc{testAddr1: newTestAccount(1, 10, code, common.Hash{})},
+			y:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			wantAddr: testAddr1,
+		},
+		{
+			name:     "slot value",
+			x:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, value1)},
+			y:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, value2)},
+			wantAddr: testAddr1,
+		},
+		{
+			name:     "slot on one side",
+			x:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			y:        SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, value1)},
+			wantAddr: testAddr1,
+		},
+		{
+			name: "zero slot on one side",
+			x:    SubstateAlloc{testAddr1: &SubstateAccount{Nonce: 1, Balance: big.NewInt(10), Storage: map[common.Hash]common.Hash{testSlot: {}}}},
+			y:    SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			want: true,
+		},
+		{
+			name:     "account created on one side",
+			x:        SubstateAlloc{},
+			y:        SubstateAlloc{testAddr2: newTestAccount(0, 1, nil, common.Hash{})},
+			wantAddr: testAddr2,
+		},
+		{
+			name:     "account deleted on one side",
+			x:        SubstateAlloc{testAddr2: newTestAccount(1, 0, nil, common.Hash{})},
+			y:        SubstateAlloc{},
+			wantAddr: testAddr2,
+		},
+		{
+			name: "empty account on one side",
+			x:    SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{})},
+			y:    SubstateAlloc{testAddr1: newTestAccount(1, 10, nil, common.Hash{}), testAddr2: newTestAccount(0, 0, nil, common.Hash{})},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		for _, swap := range []bool{false, true} {
+			x, y := tt.x, tt.y
+			if swap {
+				x, y = y, x
+			}
+			addr, equal := x.StrictStateEqual(y)
+			if equal != tt.want {
+				t.Errorf("%s (swapped %v): StrictStateEqual = %v, want %v", tt.name, swap, equal, tt.want)
+			}
+			if !tt.want && addr != tt.wantAddr.String() {
+				t.Errorf("%s (swapped %v): differing account %s, want %s", tt.name, swap, addr, tt.wantAddr)
+			}
+		}
+	}
+}
+
+func TestSubstateCopy(t *testing.T) {
+	full := newTestSubstate(1)
+	tests := []struct {
+		name     string
+		substate *Substate
+	}{
+		{"full", full},
+		{"without env", NewSubstate(full.InputAlloc, full.OutputAlloc, nil, full.Message, full.Result)},
+		{"without message", NewSubstate(full.InputAlloc, full.OutputAlloc, full.Env, nil, full.Result)},
+		{"without result", NewSubstate(full.InputAlloc, full.OutputAlloc, full.Env, full.Message, nil)},
+		{"allocs only", NewSubstate(full.InputAlloc, full.OutputAlloc, nil, nil, nil)},
+	}
+	for _, tt := range tests {
+		cp := tt.substate.Copy()
+		if (cp.Env == nil) != (tt.substate.Env == nil) ||
+			(cp.Message == nil) != (tt.substate.Message == nil) ||
+			(cp.Result == nil) != (tt.substate.Result == nil) {
+			t.Errorf("%s: copy has env %v, message %v, result %v", tt.name, cp.Env != nil, cp.Message != nil, cp.Result != nil)
+			continue
+		}
+		if cp.Env != nil && (cp.Env == tt.substate.Env || !cp.Env.Equal(tt.substate.Env)) {
+			t.Errorf("%s: env not copied", tt.name)
+		}
+		if cp.Message != nil && (cp.Message == tt.substate.Message || !cp.Message.Equal(tt.substate.Message)) {
+			t.Errorf("%s: message not copied", tt.name)
+		}
+		if cp.Result != nil && (cp.Result == tt.substate.Result || !cp.Result.Equal(tt.substate.Result)) {
+			t.Errorf("%s: result not copied", tt.name)
+		}
+		if !cp.InputAlloc.Equal(tt.substate.InputAlloc) || !cp.OutputAlloc.Equal(tt.substate.OutputAlloc) {
+			t.Errorf("%s: allocs differ", tt.name)
+		}
+		cp.InputAlloc[testAddr1].Balance = big.NewInt(0)
+		cp.OutputAlloc[testAddr2].Storage[testSlot] = testSlot
+		if !tt.substate.InputAlloc.Equal(full.InputAlloc) || tt.substate.OutputAlloc[testAddr2].Storage[testSlot] == testSlot {
+			t.Errorf("%s: modifying the copy modified the substate", tt.name)
+		}
+	}
+}